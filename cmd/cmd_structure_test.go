@@ -86,7 +86,7 @@ func TestCommandSubcommands(t *testing.T) {
 }
 
 func TestSSHKeysSubcommands(t *testing.T) {
-	expectedSubs := []string{"list"}
+	expectedSubs := []string{"list", "rotate"}
 	for _, expectedSub := range expectedSubs {
 		found := false
 		for _, cmd := range sshKeysCmd.Commands() {
@@ -14,6 +14,7 @@ import (
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
 	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
 )
 
 var connectCmd = &cobra.Command{
@@ -36,15 +37,23 @@ var connectListCmd = &cobra.Command{
 	Short: "List available connections",
 	Long:  `List all available connections from stored tokens.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return listAvailableConnections()
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return listAvailableConnections(out)
 	},
 }
 
 var connectActivateCmd = &cobra.Command{
-	Use:   "activate [token] [student-id]",
+	Use:   "activate [token|token-file] [student-id]",
 	Short: "Activate access token for this machine",
 	Long: `Activate an access token for this machine. This binds the token to your
-hardware and enables lfr connect functionality.`,
+hardware and enables lfr connect functionality.
+
+The token can be the token string or the token file (<project>-<username>.json)
+issued by your instructor, which also carries your SSH key.`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		token := args[0]
@@ -62,6 +71,9 @@ func init() {
 	// Connect command flags
 	connectCmd.Flags().StringP("project", "p", "", "Override project from token")
 	connectCmd.Flags().BoolP("force", "f", false, "Force connection even if instance stopped")
+
+	// List command flags
+	addOutputFlags(connectListCmd)
 }
 
 // connectToInstance connects to a student's instance with automatic start.
@@ -158,12 +170,21 @@ func connectToInstance(ctx context.Context, username, project string, force bool
 	}
 	defer os.Remove(keyFile)
 
+	// Verify the host against the keys published with its status, pinning
+	// it on first connect if there are none
+	knownHostsFile, alias, err := pinStatusHostKeys(token.Project, username, status)
+	if err != nil {
+		return err
+	}
+
 	// Execute SSH
 	sshArgs := []string{
 		"-i", keyFile,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		fmt.Sprintf("%s@%s", username, status.PublicIP),
+		"-o", "HostKeyAlias=" + alias,
+		"-o", "UserKnownHostsFile=" + knownHostsFile,
+		"-o", "StrictHostKeyChecking=accept-new",
+		// The user's key pair is installed for the instance's default user
+		fmt.Sprintf("ubuntu@%s", status.PublicIP),
 	}
 
 	sshCmd := exec.Command("ssh", sshArgs...)
@@ -268,8 +289,40 @@ func waitForInstanceStart(ctx context.Context, bucket, project, username string,
 	}
 }
 
+// connection is a stored access token in structured connection list output.
+// The token hash and key material are deliberately left out.
+type connection struct {
+	Username  string    `json:"username" yaml:"username"`
+	Project   string    `json:"project" yaml:"project"`
+	Role      string    `json:"role" yaml:"role"`
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
+	Status    string    `json:"status" yaml:"status"`
+}
+
+// tokenStatuses maps connection statuses to their table labels.
+var tokenStatuses = map[string]string{
+	"valid":          "✅ Valid",
+	"expired":        "❌ Expired",
+	"not-yet-active": "⏳ Not yet active",
+	"access-ended":   "❌ Access ended",
+}
+
+// tokenStatus returns whether a token can currently be used.
+func tokenStatus(token *config.StudentToken, now time.Time) string {
+	switch {
+	case now.After(token.ExpiresAt):
+		return "expired"
+	case !token.AccessStartDate.IsZero() && now.Before(token.AccessStartDate):
+		return "not-yet-active"
+	case !token.AccessEndDate.IsZero() && now.After(token.AccessEndDate):
+		return "access-ended"
+	default:
+		return "valid"
+	}
+}
+
 // listAvailableConnections lists all available connections.
-func listAvailableConnections() error {
+func listAvailableConnections(out *output.Renderer) error {
 	tm, err := config.NewTokenManager()
 	if err != nil {
 		return fmt.Errorf("failed to initialize token manager: %w", err)
@@ -280,7 +333,29 @@ func listAvailableConnections() error {
 		return fmt.Errorf("failed to list tokens: %w", err)
 	}
 
-	if len(tokens) == 0 {
+	now := time.Now()
+	connections := make([]connection, len(tokens))
+	for i, token := range tokens {
+		connections[i] = connection{
+			Username:  token.Username,
+			Project:   token.Project,
+			Role:      token.Role,
+			ExpiresAt: token.ExpiresAt,
+			Status:    tokenStatus(token, now),
+		}
+	}
+
+	if out.Structured() {
+		return out.Render(connections, func() *output.Table {
+			table := output.NewTable("username", "project", "role", "expires_at", "status")
+			for _, c := range connections {
+				table.AddRow(c.Username, c.Project, c.Role, c.ExpiresAt.Format(time.RFC3339), c.Status)
+			}
+			return table
+		})
+	}
+
+	if len(connections) == 0 {
 		fmt.Println("No access tokens configured.")
 		fmt.Println("To add access: lfr connect activate <token> <student-id>")
 		return nil
@@ -291,26 +366,17 @@ func listAvailableConnections() error {
 		"USERNAME", "PROJECT", "ROLE", "EXPIRES", "STATUS")
 	fmt.Println(strings.Repeat("-", 85))
 
-	for _, token := range tokens {
-		status := "✅ Valid"
-		if time.Now().After(token.ExpiresAt) {
-			status = "❌ Expired"
-		} else if !token.AccessStartDate.IsZero() && time.Now().Before(token.AccessStartDate) {
-			status = "⏳ Not yet active"
-		} else if !token.AccessEndDate.IsZero() && time.Now().After(token.AccessEndDate) {
-			status = "❌ Access ended"
-		}
-
+	for _, c := range connections {
 		fmt.Printf("%-15s %-15s %-10s %-20s %-15s\n",
-			token.Username,
-			token.Project,
-			token.Role,
-			token.ExpiresAt.Format("2006-01-02"),
-			status,
+			c.Username,
+			c.Project,
+			c.Role,
+			c.ExpiresAt.Format("2006-01-02"),
+			tokenStatuses[c.Status],
 		)
 	}
 
-	fmt.Printf("\nTotal: %d connections\n", len(tokens))
+	fmt.Printf("\nTotal: %d connections\n", len(connections))
 	return nil
 }
 
@@ -324,22 +390,32 @@ func activateStudentToken(tokenString, studentID string) error {
 	fmt.Printf("Activating access token for student ID: %s\n", studentID)
 	fmt.Printf("Binding to current machine...\n")
 
+	if info, err := os.Stat(tokenString); err == nil && !info.IsDir() {
+		token, err := tm.ImportToken(tokenString, studentID)
+		if err != nil {
+			return fmt.Errorf("failed to activate token: %w", err)
+		}
+
+		fmt.Printf("✅ Token activated!\n")
+		fmt.Printf("Project: %s\n", token.Project)
+		fmt.Printf("Username: %s\n", token.Username)
+		fmt.Printf("Student ID: %s\n", studentID)
+		fmt.Printf("\nYou can now connect with: lfr connect %s\n", token.Username)
+		return nil
+	}
+
 	err = tm.ActivateToken(tokenString, studentID)
 	if err != nil {
 		return fmt.Errorf("failed to activate token: %w", err)
 	}
 
-	// Parse token to show what was activated
-	parts := strings.Split(tokenString, "-")
-	if len(parts) >= 2 {
-		project := parts[0]
-		username := parts[1]
-		fmt.Printf("✅ Token activated!\n")
-		fmt.Printf("Project: %s\n", project)
-		fmt.Printf("Username: %s\n", username)
-		fmt.Printf("Student ID: %s\n", studentID)
-		fmt.Printf("\nYou can now connect with: lfr connect %s\n", username)
-	}
+	// ActivateToken has already checked the token's format
+	project, username, _ := config.ParseTokenString(tokenString)
+	fmt.Printf("✅ Token activated!\n")
+	fmt.Printf("Project: %s\n", project)
+	fmt.Printf("Username: %s\n", username)
+	fmt.Printf("Student ID: %s\n", studentID)
+	fmt.Printf("\nYou can now connect with: lfr connect %s\n", username)
 
 	return nil
 }
@@ -3,13 +3,18 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
 	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
 )
 
 var efsCmd = &cobra.Command{
@@ -49,7 +54,12 @@ var efsListCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		project, _ := cmd.Flags().GetString("project")
 
-		return listEFSFileSystems(cmd.Context(), project)
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return listEFSFileSystems(cmd.Context(), project, out)
 	},
 }
 
@@ -124,6 +134,7 @@ func init() {
 
 	// List command flags
 	efsListCmd.Flags().StringP("project", "p", "", "Filter by project name")
+	addOutputFlags(efsListCmd)
 
 	// Mount command flags
 	efsMountCmd.Flags().StringP("mount-point", "m", "/mnt/efs", "Mount point on the instance")
@@ -254,7 +265,7 @@ func createEFSFileSystem(ctx context.Context, name, project string) error {
 }
 
 // listEFSFileSystems lists EFS file systems.
-func listEFSFileSystems(ctx context.Context, project string) error {
+func listEFSFileSystems(ctx context.Context, project string, out *output.Renderer) error {
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
@@ -278,6 +289,17 @@ func listEFSFileSystems(ctx context.Context, project string) error {
 		return fmt.Errorf("failed to list EFS file systems: %w", err)
 	}
 
+	if out.Structured() {
+		return out.Render(fileSystems, func() *output.Table {
+			table := output.NewTable("id", "name", "state", "region", "performance_mode", "throughput_mode", "mount_targets", "project", "creation_time")
+			for _, fs := range fileSystems {
+				table.AddRow(fs.ID, fs.Name, fs.State, fs.Region, fs.PerformanceMode, fs.ThroughputMode,
+					len(fs.MountTargets), fs.Tags["Project"], fs.CreationTime)
+			}
+			return table
+		})
+	}
+
 	if len(fileSystems) == 0 {
 		if project != "" {
 			fmt.Printf("No EFS file systems found for project: %s\n", project)
@@ -326,40 +348,112 @@ func mountEFSOnInstance(ctx context.Context, filesystemID, username, mountPoint,
 
 	fmt.Printf("Mounting EFS %s on %s's instance at %s (%s)\n", filesystemID, username, mountPoint, modeDesc)
 
-	// Generate NFS mount options based on mode
-	var mountOptions string
-	if mode == "ro" {
-		mountOptions = "nfsvers=4.1,rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2,ro"
-	} else {
-		mountOptions = "nfsvers=4.1,rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2"
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
 	}
 
-	// This would require SSH execution to the instance
-	// For now, return instructions for manual mounting
-	fmt.Printf(`
-To mount EFS on the instance (%s), SSH to the instance and run:
+	lightsailService := aws.NewLightsailService(awsClient)
+	efsService := aws.NewEFSService(awsClient)
 
-1. Install EFS utilities:
-   sudo apt-get update
-   sudo apt-get install -y nfs-common
+	instances, err := lightsailService.ListInstances(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
 
-2. Create mount point:
-   sudo mkdir -p %s
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+	instance := findUserInstance(instances, username, usernames)
+	if instance == nil {
+		return fmt.Errorf("no instance found for user: %s", username)
+	}
+	if instance.State != "running" {
+		return fmt.Errorf("instance %s is not running (state: %s). Start it first", instance.Name, instance.State)
+	}
+
+	mountIP, err := efsMountTargetIP(ctx, efsService, filesystemID)
+	if err != nil {
+		return err
+	}
 
-3. Get EFS mount target IP:
-   aws efs describe-mount-targets --file-system-id %s --query "MountTargets[0].IpAddress" --output text
+	if err := runEFSMount(ctx, lightsailService, instance, mountIP, mountPoint, mode); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ EFS %s mounted on %s at %s (%s)\n", filesystemID, instance.Name, mountPoint, modeDesc)
+	return nil
+}
+
+// efsMountTargetIP returns the IP address of a file system's first mount target.
+func efsMountTargetIP(ctx context.Context, efsService *aws.EFSService, filesystemID string) (string, error) {
+	fileSystems, err := efsService.ListEFSFileSystems(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to list EFS file systems: %w", err)
+	}
 
-4. Mount EFS %s (replace <IP> with mount target IP):
-   sudo mount -t nfs4 -o %s <IP>:/ %s
+	for _, fs := range fileSystems {
+		if fs.ID != filesystemID {
+			continue
+		}
+		if len(fs.MountTargets) == 0 {
+			return "", fmt.Errorf("EFS file system %s has no mount targets", filesystemID)
+		}
+		return fs.MountTargets[0].IPAddress, nil
+	}
 
-5. Add to /etc/fstab for persistent mounting:
-   echo "<IP>:/ %s nfs4 %s,_netdev 0 0" | sudo tee -a /etc/fstab
+	return "", fmt.Errorf("EFS file system not found: %s", filesystemID)
+}
 
-`, modeDesc, mountPoint, filesystemID, modeDesc, mountOptions, mountPoint, mountPoint, mountOptions)
+// runEFSMount mounts an EFS mount target on an instance over SSH and adds it
+// to /etc/fstab. Mounting an already mounted file system is a no-op.
+func runEFSMount(ctx context.Context, lightsailService *aws.LightsailService, instance *types.Instance, mountIP, mountPoint, mode string) error {
+	client, err := connectInstance(ctx, lightsailService, instance)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
 
+	err = client.RunScript(ctx, efsMountScript(mountIP, mountPoint, mode), ssh.RunOptions{
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Sudo:    true,
+		Timeout: 10 * time.Minute,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mount EFS on %s: %w", instance.Name, err)
+	}
 	return nil
 }
 
+// efsMountScript returns the root shell script that mounts an EFS mount target.
+func efsMountScript(mountIP, mountPoint, mode string) string {
+	mountOptions := "nfsvers=4.1,rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2"
+	if mode == "ro" {
+		mountOptions += ",ro"
+	}
+
+	source := ssh.Quote(mountIP + ":/")
+	target := ssh.Quote(mountPoint)
+	fstabEntry := ssh.Quote(fmt.Sprintf("%s:/ %s nfs4 %s,_netdev 0 0", mountIP, mountPoint, mountOptions))
+
+	return fmt.Sprintf(`set -e
+if ! command -v mount.nfs4 >/dev/null 2>&1; then
+  export DEBIAN_FRONTEND=noninteractive
+  apt-get update -y
+  apt-get install -y nfs-common
+fi
+mkdir -p %[2]s
+if ! mountpoint -q %[2]s; then
+  mount -t nfs4 -o %[3]s %[1]s %[2]s
+fi
+if ! grep -qF %[4]s /etc/fstab; then
+  echo %[4]s >> /etc/fstab
+fi
+`, source, target, mountOptions, fstabEntry)
+}
+
 // checkEFSStatus checks EFS and VPC peering status.
 func checkEFSStatus(ctx context.Context) error {
 	// Load configuration
@@ -448,30 +542,11 @@ func mountEFSOnAllInstances(ctx context.Context, filesystemID, project, mountPoi
 		return nil
 	}
 
-	// Get EFS mount target IP
-	fileSystems, err := efsService.ListEFSFileSystems(ctx, "")
+	mountIP, err := efsMountTargetIP(ctx, efsService, filesystemID)
 	if err != nil {
-		return fmt.Errorf("failed to list EFS file systems: %w", err)
-	}
-
-	var targetFS *aws.EFSFileSystem
-	for _, fs := range fileSystems {
-		if fs.ID == filesystemID {
-			targetFS = fs
-			break
-		}
-	}
-
-	if targetFS == nil {
-		return fmt.Errorf("EFS file system not found: %s", filesystemID)
-	}
-
-	if len(targetFS.MountTargets) == 0 {
-		return fmt.Errorf("EFS file system %s has no mount targets", filesystemID)
+		return err
 	}
 
-	mountIP := targetFS.MountTargets[0].IPAddress
-
 	if dryRun {
 		fmt.Printf("Dry run: EFS %s would be mounted on %d instances in project %s:\n\n", filesystemID, len(instances), project)
 		fmt.Printf("%-20s %-12s %-18s %-15s\n", "INSTANCE", "STATE", "PUBLIC IP", "MOUNT POINT")
@@ -491,7 +566,7 @@ func mountEFSOnAllInstances(ctx context.Context, filesystemID, project, mountPoi
 	fmt.Printf("Mount target IP: %s\n", mountIP)
 	fmt.Printf("Mount point: %s\n\n", mountPoint)
 
-	successCount := 0
+	successCount, failed := 0, 0
 	for i, instance := range instances {
 		username := "unknown"
 		parts := strings.Split(instance.Name, "-")
@@ -511,25 +586,20 @@ func mountEFSOnAllInstances(ctx context.Context, filesystemID, project, mountPoi
 			continue
 		}
 
-		// Generate mount instructions for this instance
-		modeDesc := "read-write"
-		mountOptions := "nfsvers=4.1,rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2"
-		if mode == "ro" {
-			modeDesc = "read-only"
-			mountOptions += ",ro"
+		if err := runEFSMount(ctx, lightsailService, instance, mountIP, mountPoint, mode); err != nil {
+			fmt.Printf("   ❌ %v\n\n", err)
+			failed++
+			continue
 		}
-
-		fmt.Printf("   📋 Mount instructions for %s (%s):\n", instance.Name, modeDesc)
-		fmt.Printf("      ssh ubuntu@%s\n", instance.PublicIP)
-		fmt.Printf("      sudo apt-get update && sudo apt-get install -y nfs-common\n")
-		fmt.Printf("      sudo mkdir -p %s\n", mountPoint)
-		fmt.Printf("      sudo mount -t nfs4 -o %s %s:/ %s\n", mountOptions, mountIP, mountPoint)
-		fmt.Printf("   ✅ Ready to mount on %s (%s)\n\n", instance.Name, modeDesc)
+		fmt.Printf("   ✅ Mounted on %s\n\n", instance.Name)
 
 		successCount++
 	}
 
-	fmt.Printf("🎉 Generated mount instructions for %d/%d instances\n", successCount, len(instances))
+	fmt.Printf("🎉 Mounted EFS on %d/%d instances\n", successCount, len(instances))
+	if failed > 0 {
+		return fmt.Errorf("failed to mount EFS on %d of %d instances", failed, len(instances))
+	}
 	return nil
 }
 
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+// defaultExecParallel is the default number of instances a command runs on at once.
+const defaultExecParallel = 20
+
+var execCmd = &cobra.Command{
+	Use:   "exec -- [command]",
+	Short: "Run a command on every instance in a project",
+	Long: `Run a shell command over SSH on every running instance in a project, or on the
+instances of the users given with --users. Output is streamed with each line
+prefixed by its instance, and a summary of exit codes is printed at the end.
+
+Stopped instances are skipped unless --start is given, which starts them and waits
+for them to be running first.
+
+The arguments after -- are joined with spaces and run by the remote shell, so
+quote pipes and redirections that should happen on the instances.
+
+Examples:
+  lfr exec -p cs101 -- df -h /home
+  lfr exec -p cs101 --users alice,bob --sudo -- apt-get install -y tree`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		users, _ := cmd.Flags().GetStringSlice("users")
+		start, _ := cmd.Flags().GetBool("start")
+		sudo, _ := cmd.Flags().GetBool("sudo")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+
+		return execOnInstances(cmd.Context(), project, users, strings.Join(args, " "), execOptions{
+			Start:    start,
+			Sudo:     sudo,
+			Timeout:  timeout,
+			Parallel: parallel,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().StringP("project", "p", "", "Project name (required)")
+	execCmd.Flags().StringSliceP("users", "u", []string{}, "Only run on these users' instances")
+	execCmd.Flags().Bool("start", false, "Start stopped instances and wait for them before running the command")
+	execCmd.Flags().Bool("sudo", false, "Run the command as root")
+	execCmd.Flags().Duration("timeout", 10*time.Minute, "Kill the command on instances where it runs longer")
+	execCmd.Flags().Int("parallel", defaultExecParallel, "Number of instances to run the command on concurrently")
+
+	execCmd.MarkFlagRequired("project")
+}
+
+// execOptions configures execOnInstances.
+type execOptions struct {
+	Start    bool
+	Sudo     bool
+	Timeout  time.Duration
+	Parallel int
+}
+
+// execResult is the outcome of running a command on one instance.
+type execResult struct {
+	Instance string
+	// ExitCode is the command's exit status, or -1 if it could not be run.
+	ExitCode int
+	Elapsed  time.Duration
+	Err      error
+}
+
+// execOnInstances runs a command on the running instances of a project in
+// parallel and prints a summary of exit codes.
+func execOnInstances(ctx context.Context, project string, users []string, command string, opts execOptions) error {
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	instances, err := lightsailService.ListInstances(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+	instances = selectInstances(instances, users, usernames)
+	if len(instances) == 0 {
+		fmt.Printf("No instances found for project: %s\n", project)
+		return nil
+	}
+
+	var targets, stopped []string
+	byName := make(map[string]*types.Instance)
+	for _, instance := range instances {
+		byName[instance.Name] = instance
+		switch {
+		case instance.State == "running":
+			targets = append(targets, instance.Name)
+		case opts.Start && instance.State == "stopped":
+			stopped = append(stopped, instance.Name)
+		default:
+			fmt.Printf("⏭️  Skipping %s (state: %s)\n", instance.Name, instance.State)
+		}
+	}
+
+	if len(stopped) > 0 {
+		fmt.Printf("Starting %d stopped instances...\n", len(stopped))
+		results := utils.RunBulk(ctx, stopped, utils.BulkOptions{Parallel: opts.Parallel, Action: "Starting instances"},
+			func(ctx context.Context, instanceName string) (string, error) {
+				return setInstanceState(ctx, lightsailService, instanceName, "running", true)
+			})
+		utils.PrintBulkSummary(results)
+
+		for _, result := range results {
+			if result.Err != nil {
+				continue
+			}
+			// Started instances have a new public IP
+			instance, err := lightsailService.GetInstance(ctx, result.Item)
+			if err != nil {
+				fmt.Printf("❌ %s: %v\n", result.Item, err)
+				continue
+			}
+			byName[instance.Name] = instance
+			targets = append(targets, instance.Name)
+		}
+		sort.Strings(targets)
+	}
+
+	if len(targets) == 0 {
+		fmt.Printf("No running instances to run the command on.\n")
+		return nil
+	}
+
+	fmt.Printf("Running on %d instances: %s\n\n", len(targets), command)
+
+	width := 0
+	for _, name := range targets {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	var outputMu sync.Mutex
+	results := make([]execResult, len(targets))
+	index := make(map[string]int)
+	for i, name := range targets {
+		index[name] = i
+	}
+
+	// Output is streamed per host, so the pool's own progress lines are discarded
+	interactive := false
+	bulk := utils.RunBulk(ctx, targets, utils.BulkOptions{Parallel: opts.Parallel, Out: io.Discard, Interactive: &interactive},
+		func(ctx context.Context, instanceName string) (string, error) {
+			prefix := fmt.Sprintf("%-*s | ", width, instanceName)
+			stdout := newPrefixWriter(os.Stdout, &outputMu, prefix)
+			stderr := newPrefixWriter(os.Stderr, &outputMu, prefix)
+
+			start := time.Now()
+			err := runOnInstance(ctx, lightsailService, byName[instanceName], command, ssh.RunOptions{
+				Stdout:  stdout,
+				Stderr:  stderr,
+				Sudo:    opts.Sudo,
+				Timeout: opts.Timeout,
+			})
+			stdout.Flush()
+			stderr.Flush()
+
+			results[index[instanceName]] = execResult{
+				Instance: instanceName,
+				ExitCode: ssh.ExitCode(err),
+				Elapsed:  time.Since(start),
+				Err:      err,
+			}
+			return "", err
+		})
+
+	// Instances not reached before the context was cancelled
+	for i, result := range bulk {
+		if results[i].Instance == "" {
+			results[i] = execResult{Instance: result.Item, ExitCode: -1, Err: result.Err}
+		}
+	}
+
+	return printExecSummary(results)
+}
+
+// runOnInstance connects to an instance and runs a command on it.
+func runOnInstance(ctx context.Context, lightsailService *aws.LightsailService, instance *types.Instance, command string, opts ssh.RunOptions) error {
+	client, err := connectInstance(ctx, lightsailService, instance)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Run(ctx, command, opts)
+}
+
+// printExecSummary prints each instance's exit code and returns an error if
+// the command failed anywhere.
+func printExecSummary(results []execResult) error {
+	fmt.Printf("\n%-30s %-6s %-10s %s\n", "INSTANCE", "EXIT", "DURATION", "ERROR")
+	fmt.Println(strings.Repeat("-", 80))
+
+	failed, unreachable := 0, 0
+	for _, result := range results {
+		exit := fmt.Sprintf("%d", result.ExitCode)
+		message := ""
+		switch {
+		case result.ExitCode == -1:
+			exit = "-"
+			message = result.Err.Error()
+			unreachable++
+		case result.ExitCode != 0:
+			failed++
+		}
+		row := fmt.Sprintf("%-30s %-6s %-10s %s", result.Instance, exit, result.Elapsed.Round(100*time.Millisecond), message)
+		fmt.Println(strings.TrimRight(row, " "))
+	}
+
+	succeeded := len(results) - failed - unreachable
+	fmt.Printf("\n✅ Succeeded: %d\n", succeeded)
+	if failed > 0 {
+		fmt.Printf("❌ Non-zero exit: %d\n", failed)
+	}
+	if unreachable > 0 {
+		fmt.Printf("⚠️ Not run: %d\n", unreachable)
+	}
+
+	if succeeded < len(results) {
+		return fmt.Errorf("command failed on %d of %d instances", failed+unreachable, len(results))
+	}
+	return nil
+}
+
+// prefixWriter writes complete lines to an underlying writer with a prefix,
+// so that output from several hosts interleaves line by line.
+type prefixWriter struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(out io.Writer, mu *sync.Mutex, prefix string) *prefixWriter {
+	return &prefixWriter{out: out, mu: mu, prefix: prefix}
+}
+
+// Write implements io.Writer, holding back a trailing partial line.
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	end := bytes.LastIndexByte(w.buf, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	lines := w.buf[:end+1]
+	w.buf = append([]byte(nil), w.buf[end+1:]...)
+	return len(p), w.writeLines(lines)
+}
+
+// Flush writes a trailing partial line, if any.
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	lines := append(w.buf, '\n')
+	w.buf = nil
+	return w.writeLines(lines)
+}
+
+func (w *prefixWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		out.WriteString(w.prefix)
+		out.Write(line)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/transfer"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+// manifestFileName is the name of the manifest lfr files collect writes.
+const manifestFileName = "manifest.json"
+
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "Copy files to and from a project's instances",
+	Long:  `Distribute files to every instance in a project and collect files from them over SFTP.`,
+}
+
+var filesPushCmd = &cobra.Command{
+	Use:   "push [local] [remote]",
+	Short: "Copy a file or directory to every instance in a project",
+	Long: `Copy a local file or directory to every running instance in a project, or to the
+instances of the users given with --users. Remote paths are relative to the home
+directory. A directory's contents are copied into the remote directory; a file is
+copied to the remote path, or into it if it ends in "/" or is a directory.
+
+With --per-user, the local directory holds one subdirectory per user and each
+user's instance receives only the contents of its own subdirectory.
+
+Every file is read back after upload and its SHA-256 checksum verified.
+
+Examples:
+  lfr files push ./hw1-starter hw1 -p cs101
+  lfr files push ./feedback feedback --per-user -p cs101`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		users, _ := cmd.Flags().GetStringSlice("users")
+		perUser, _ := cmd.Flags().GetBool("per-user")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+
+		return pushFiles(cmd.Context(), project, users, args[0], args[1], perUser, parallel)
+	},
+}
+
+var filesCollectCmd = &cobra.Command{
+	Use:   "collect [remote]",
+	Short: "Collect a file or directory from every instance in a project",
+	Long: `Copy a file or directory from every running instance in a project into a
+subdirectory per user, and write a manifest.json listing the size and SHA-256
+checksum of every collected file, which users had nothing to collect and whose
+instances were not running.
+
+Examples:
+  lfr files collect hw1 -p cs101 --into ./submissions/hw1
+  lfr files collect notebooks/final.ipynb -p cs101 --users alice,bob`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		users, _ := cmd.Flags().GetStringSlice("users")
+		into, _ := cmd.Flags().GetString("into")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+
+		return collectFiles(cmd.Context(), project, users, args[0], into, parallel)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(filesCmd)
+
+	filesCmd.AddCommand(filesPushCmd)
+	filesCmd.AddCommand(filesCollectCmd)
+
+	for _, cmd := range []*cobra.Command{filesPushCmd, filesCollectCmd} {
+		cmd.Flags().StringP("project", "p", "", "Project name (required)")
+		cmd.Flags().StringSliceP("users", "u", []string{}, "Only copy to or from these users' instances")
+		cmd.Flags().Int("parallel", utils.DefaultParallel, "Number of instances to copy to or from concurrently")
+		cmd.MarkFlagRequired("project")
+	}
+
+	filesPushCmd.Flags().Bool("per-user", false, "Push each user's subdirectory of the local directory to their instance")
+	filesCollectCmd.Flags().String("into", "./submissions", "Local directory to collect into, with a subdirectory per user")
+}
+
+// runningProjectInstances lists the running instances of a project, limited to
+// the given users' when users is non-empty, and the IAM usernames they were
+// matched against. Other instances are reported.
+func runningProjectInstances(ctx context.Context, awsClient *aws.Client, project string, users []string) (running, skipped []*types.Instance, usernames []string, err error) {
+	instances, err := aws.NewLightsailService(awsClient).ListInstances(ctx, project)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	usernames, err = aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, instance := range selectInstances(instances, users, usernames) {
+		if instance.State != "running" {
+			fmt.Printf("⏭️  Skipping %s (state: %s)\n", instance.Name, instance.State)
+			skipped = append(skipped, instance)
+			continue
+		}
+		running = append(running, instance)
+	}
+	return running, skipped, usernames, nil
+}
+
+// pushFiles copies a local file or directory to a project's running instances.
+func pushFiles(ctx context.Context, project string, users []string, local, remote string, perUser bool, parallel int) error {
+	info, err := os.Stat(local)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", local, err)
+	}
+	if perUser && !info.IsDir() {
+		return fmt.Errorf("--per-user needs a directory with a subdirectory per user, %s is a file", local)
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	instances, _, _, err := runningProjectInstances(ctx, awsClient, project, users)
+	if err != nil {
+		return err
+	}
+
+	sources := make(map[string]string)
+	var targets []string
+	for _, instance := range instances {
+		source := local
+		if perUser {
+			source = perUserSource(local, instance.Name)
+			if source == "" {
+				fmt.Printf("⏭️  Skipping %s (no directory for its user in %s)\n", instance.Name, local)
+				continue
+			}
+		}
+		sources[instance.Name] = source
+		targets = append(targets, instance.Name)
+	}
+
+	if len(targets) == 0 {
+		fmt.Printf("No running instances to push to.\n")
+		return nil
+	}
+
+	byName := make(map[string]*types.Instance)
+	for _, instance := range instances {
+		byName[instance.Name] = instance
+	}
+
+	fmt.Printf("Pushing %s to %s on %d instances\n", local, remote, len(targets))
+
+	results := utils.RunBulk(ctx, targets, utils.BulkOptions{Parallel: parallel, Action: "Pushing files"},
+		func(ctx context.Context, instanceName string) (string, error) {
+			client, err := connectInstance(ctx, lightsailService, byName[instanceName])
+			if err != nil {
+				return "", err
+			}
+			defer client.Close()
+
+			sftpClient, err := client.SFTP()
+			if err != nil {
+				return "", err
+			}
+			defer sftpClient.Close()
+
+			files, err := transfer.Push(ctx, sftpClient, sources[instanceName], remote)
+			if err != nil {
+				return "", err
+			}
+			return describeFiles(files), nil
+		})
+
+	fmt.Printf("\n🎉 Push completed!\n")
+	utils.PrintBulkSummary(results)
+
+	return utils.BulkError(results, "instances", "push files to")
+}
+
+// perUserSource returns the subdirectory of dir for the user owning an
+// instance, or "" if there is none. The longest matching username wins.
+func perUserSource(dir, instanceName string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	owner := ""
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(instanceName, entry.Name()+"-") && len(entry.Name()) > len(owner) {
+			owner = entry.Name()
+		}
+	}
+	if owner == "" {
+		return ""
+	}
+	return filepath.Join(dir, owner)
+}
+
+// collectionUser returns the IAM user in usernames who owns an instance, whose
+// directory its files are collected into, or the instance's name if no user
+// does.
+func collectionUser(instance *types.Instance, usernames []string) string {
+	if owner := utils.InstanceOwner(instance.Name, usernames); owner != "" {
+		return owner
+	}
+	return instance.Name
+}
+
+// collectFiles copies a remote file or directory from a project's running
+// instances into a directory per user and writes a manifest.
+func collectFiles(ctx context.Context, project string, users []string, remote, into string, parallel int) error {
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	instances, skipped, usernames, err := runningProjectInstances(ctx, awsClient, project, users)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 && len(skipped) == 0 {
+		fmt.Printf("No instances found for project: %s\n", project)
+		return nil
+	}
+
+	if err := os.MkdirAll(into, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", into, err)
+	}
+
+	manifest := &transfer.Manifest{
+		Project:     project,
+		RemotePath:  remote,
+		CollectedAt: time.Now().UTC(),
+		Users:       make([]transfer.UserFiles, len(instances)),
+	}
+
+	var targets []string
+	byName := make(map[string]*types.Instance)
+	index := make(map[string]int)
+	for i, instance := range instances {
+		targets = append(targets, instance.Name)
+		byName[instance.Name] = instance
+		index[instance.Name] = i
+		manifest.Users[i] = transfer.UserFiles{
+			User:     collectionUser(instance, usernames),
+			Instance: instance.Name,
+		}
+	}
+
+	fmt.Printf("Collecting %s from %d instances into %s\n", remote, len(targets), into)
+
+	results := utils.RunBulk(ctx, targets, utils.BulkOptions{Parallel: parallel, Action: "Collecting files"},
+		func(ctx context.Context, instanceName string) (string, error) {
+			entry := &manifest.Users[index[instanceName]]
+
+			files, err := collectFromInstance(ctx, lightsailService, byName[instanceName], remote, filepath.Join(into, entry.User))
+			entry.Files = files
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				entry.Status = transfer.StatusMissing
+				return "nothing to collect", nil
+			case err != nil:
+				entry.Status = transfer.StatusFailed
+				entry.Error = err.Error()
+				return "", err
+			}
+			entry.Status = transfer.StatusCollected
+			return describeFiles(files), nil
+		})
+
+	// Record instances that were skipped or never reached
+	for i, result := range results {
+		if manifest.Users[i].Status == "" {
+			manifest.Users[i].Status = transfer.StatusFailed
+			manifest.Users[i].Error = result.Err.Error()
+		}
+	}
+	for _, instance := range skipped {
+		manifest.Users = append(manifest.Users, transfer.UserFiles{
+			User:     collectionUser(instance, usernames),
+			Instance: instance.Name,
+			Status:   transfer.StatusSkipped,
+			Error:    fmt.Sprintf("instance is %s", instance.State),
+		})
+	}
+
+	manifestPath := filepath.Join(into, manifestFileName)
+	if err := transfer.WriteManifest(manifestPath, manifest); err != nil {
+		return err
+	}
+
+	missing, notRunning := 0, 0
+	for _, entry := range manifest.Users {
+		switch entry.Status {
+		case transfer.StatusMissing:
+			missing++
+		case transfer.StatusSkipped:
+			notRunning++
+		}
+	}
+
+	fmt.Printf("\n🎉 Collection completed!\n")
+	utils.PrintBulkSummary(results)
+	if missing > 0 {
+		fmt.Printf("⚠️ Nothing to collect: %d\n", missing)
+	}
+	if notRunning > 0 {
+		fmt.Printf("⏭️  Not running: %d\n", notRunning)
+	}
+	fmt.Printf("📋 Manifest: %s\n", manifestPath)
+
+	return utils.BulkError(results, "instances", "collect files from")
+}
+
+// collectFromInstance connects to an instance and collects a remote path.
+func collectFromInstance(ctx context.Context, lightsailService *aws.LightsailService, instance *types.Instance, remote, localDir string) ([]transfer.File, error) {
+	client, err := connectInstance(ctx, lightsailService, instance)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	sftpClient, err := client.SFTP()
+	if err != nil {
+		return nil, err
+	}
+	defer sftpClient.Close()
+
+	return transfer.Collect(ctx, sftpClient, remote, localDir)
+}
+
+// describeFiles summarises copied files for progress output.
+func describeFiles(files []transfer.File) string {
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	return fmt.Sprintf("%d files, %s", len(files), utils.FormatBytes(float64(size)))
+}
@@ -0,0 +1,2771 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	lightsailTypes "github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+	"github.com/spf13/viper"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/scttfrdmn/lfr-tools/internal/audit"
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/hostkeys"
+	"github.com/scttfrdmn/lfr-tools/internal/journal"
+	"github.com/scttfrdmn/lfr-tools/internal/manifest"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+	"github.com/scttfrdmn/lfr-tools/internal/software"
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/testutils"
+	"github.com/scttfrdmn/lfr-tools/internal/transfer"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// useFakeCloud routes every aws.NewClient call to an in-memory fake for the
+// duration of the test.
+func useFakeCloud(t *testing.T) *testutils.FakeCloud {
+	t.Helper()
+
+	// Keep operation journals and other local state out of the real home directory
+	t.Setenv("HOME", t.TempDir())
+
+	cloud := testutils.NewFakeCloud()
+	restore := aws.SetClientFactory(func(ctx context.Context, opts aws.Options) (*aws.Client, error) {
+		return &aws.Client{
+			IAM:       cloud.IAM,
+			Lightsail: cloud.Lightsail,
+			S3:        cloud.S3,
+			EFS:       cloud.EFS,
+			EC2:       cloud.EC2,
+			Config:    testutils.MockAWSConfig(),
+		}, nil
+	})
+	t.Cleanup(restore)
+
+	return cloud
+}
+
+// useSSHServer routes every instance SSH connection to an in-process server
+// that accepts the fake cloud's key. hosts receives the instance address each
+// connection was meant for.
+func useSSHServer(t *testing.T, cloud *testutils.FakeCloud) (server *testutils.SSHServer, hosts *[]string) {
+	t.Helper()
+
+	server = testutils.NewSSHServer(t)
+	cloud.Lightsail.SetPrivateKey(string(server.ClientKey))
+
+	hosts = &[]string{}
+	var mu sync.Mutex
+	previous := dialInstance
+	dialInstance = func(ctx context.Context, cfg ssh.Config) (*ssh.Client, error) {
+		mu.Lock()
+		*hosts = append(*hosts, cfg.User+"@"+cfg.Host)
+		mu.Unlock()
+
+		cfg.Host, cfg.Port = server.Host(), server.Port()
+		return ssh.Dial(ctx, cfg)
+	}
+	t.Cleanup(func() { dialInstance = previous })
+
+	return server, hosts
+}
+
+// setViper sets a configuration value for the duration of the test.
+func setViper(t *testing.T, key string, value interface{}) {
+	t.Helper()
+
+	previous := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() {
+		viper.Set(key, previous)
+	})
+}
+
+func TestCreateUsersWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	err := createUsers(ctx, "physics", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice", "bob"})
+	if err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+
+	if got := strings.Join(cloud.IAM.UserNames(), ","); got != "alice,bob" {
+		t.Errorf("expected IAM users alice,bob, got %s", got)
+	}
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "alice-ubuntu_22_04,bob-ubuntu_22_04" {
+		t.Errorf("unexpected instances: %s", got)
+	}
+
+	for _, user := range []string{"alice", "bob"} {
+		if groups := cloud.IAM.UserGroups(user); len(groups) != 1 || groups[0] != "Lightsail-Users" {
+			t.Errorf("expected %s to be in Lightsail-Users, got %v", user, groups)
+		}
+		if !cloud.IAM.HasLoginProfile(user) {
+			t.Errorf("expected %s to have a login profile", user)
+		}
+
+		doc, ok := cloud.IAM.UserPolicy(user, "LightsailLimitedAccess-"+user)
+		if !ok {
+			t.Fatalf("expected inline policy for %s", user)
+		}
+		if !strings.Contains(doc, "Instance/"+user+"-ubuntu_22_04") {
+			t.Errorf("expected policy for %s to reference its instance, got %s", user, doc)
+		}
+	}
+
+	// Each user's instance has its own key pair, saved locally
+	if got := strings.Join(cloud.Lightsail.KeyPairNames(), ","); got != "lfr-alice,lfr-bob" {
+		t.Errorf("expected a key pair per user, got %s", got)
+	}
+	lightsailService := aws.NewLightsailService(&aws.Client{Lightsail: cloud.Lightsail})
+	instance, err := lightsailService.GetInstance(ctx, "alice-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("GetInstance failed: %v", err)
+	}
+	if instance.SSHKeyName != "lfr-alice" {
+		t.Errorf("expected alice's instance to use her key pair, got %s", instance.SSHKeyName)
+	}
+	home, _ := os.UserHomeDir()
+	info, err := os.Stat(filepath.Join(home, ".ssh", "lfr-tools", "lfr-alice.pem"))
+	if err != nil {
+		t.Fatalf("expected alice's private key to be saved: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the private key to be owner-only, got %v", info.Mode().Perm())
+	}
+}
+
+func TestCreateUsersContinuesAfterInstanceFailure(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	cloud.FailWhen("CreateInstances", func(params interface{}) error {
+		input := params.(*lightsail.CreateInstancesInput)
+		if input.InstanceNames[0] == "bob-ubuntu_22_04" {
+			return errors.New("quota exceeded")
+		}
+		return nil
+	})
+
+	err := createUsers(ctx, "physics", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice", "bob", "carol"})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 users") {
+		t.Fatalf("expected one failed user, got %v", err)
+	}
+
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "alice-ubuntu_22_04,carol-ubuntu_22_04" {
+		t.Errorf("unexpected instances: %s", got)
+	}
+	if got := strings.Join(cloud.IAM.UserNames(), ","); got != "alice,carol" {
+		t.Errorf("expected bob's IAM user to be rolled back, got %s", got)
+	}
+}
+
+func TestCreateUsersRollsBackInstanceOnPolicyFailure(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	// bob already exists, is adopted and must not be deleted by the rollback
+	if _, err := aws.NewIAMService(&aws.Client{IAM: cloud.IAM}).CreateUser(ctx, "bob", "Passw0rd!", "physics"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	cloud.FailOn("PutUserPolicy", errors.New("policy size exceeded"))
+
+	results, err := provisionUsers(ctx, "physics", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice", "bob"}, 2, nil)
+	if err != nil {
+		t.Fatalf("provisionUsers failed: %v", err)
+	}
+
+	if status := results[0].Status(); status != "rolled back" {
+		t.Errorf("expected alice to be rolled back, got %s (%v)", status, results[0].Err)
+	}
+	if status := results[1].Status(); status != "rolled back" {
+		t.Errorf("expected bob's new resources to be rolled back, got %s (%v)", status, results[1].Err)
+	}
+	if got := cloud.Lightsail.InstanceNames(); len(got) != 0 {
+		t.Errorf("expected instances to be rolled back, got %v", got)
+	}
+	if got := cloud.Lightsail.KeyPairNames(); len(got) != 0 {
+		t.Errorf("expected key pairs to be rolled back, got %v", got)
+	}
+	if got := strings.Join(cloud.IAM.UserNames(), ","); got != "bob" {
+		t.Errorf("expected only the existing user bob, got %s", got)
+	}
+	if !cloud.IAM.HasLoginProfile("bob") {
+		t.Error("expected bob's login profile to be untouched")
+	}
+}
+
+func TestProvisionUserAdoptsExistingResources(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	// An interrupted run created alice's IAM user and instance, but not her policy
+	if _, err := aws.NewIAMService(&aws.Client{IAM: cloud.IAM}).CreateUser(ctx, "alice", "Passw0rd!", "physics"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	if _, err := aws.NewIAMService(&aws.Client{IAM: cloud.IAM}).CreateUser(ctx, "bob", "Passw0rd!", "chemistry"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	results, err := provisionUsers(ctx, "physics", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice", "bob"}, 1, nil)
+	if err != nil {
+		t.Fatalf("provisionUsers failed: %v", err)
+	}
+
+	if results[0].Err != nil || results[0].Password == "" {
+		t.Fatalf("expected alice to be adopted with a new password, got %v", results[0].Err)
+	}
+	if got := cloud.Lightsail.InstanceNames(); strings.Join(got, ",") != "alice-ubuntu_22_04" {
+		t.Errorf("expected alice's existing instance to be reused, got %v", got)
+	}
+	if _, ok := cloud.IAM.UserPolicy("alice", aws.UserInstancePolicyName("alice")); !ok {
+		t.Error("expected alice to be granted access to her instance")
+	}
+	if groups := cloud.IAM.UserGroups("alice"); len(groups) != 1 || groups[0] != "Lightsail-Users" {
+		t.Errorf("expected alice to join Lightsail-Users, got %v", groups)
+	}
+
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), `already exists in project "chemistry"`) {
+		t.Errorf("expected a user of another project to be refused, got %v", results[1].Err)
+	}
+}
+
+// throttlingError mimics an AWS API error with a throttling error code.
+type throttlingError struct{}
+
+func (throttlingError) Error() string     { return "ThrottlingException: Rate exceeded" }
+func (throttlingError) ErrorCode() string { return "ThrottlingException" }
+
+func TestStopInstancesInParallelRetriesThrottling(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	users := []string{"alice", "bob", "carol", "dave"}
+	for _, user := range users {
+		cloud.Lightsail.AddInstance(user+"-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	}
+
+	// bob's first stop request is throttled
+	var throttled sync.Once
+	cloud.FailWhen("StopInstance", func(params interface{}) error {
+		var err error
+		if *params.(*lightsail.StopInstanceInput).InstanceName == "bob-ubuntu_22_04" {
+			throttled.Do(func() { err = throttlingError{} })
+		}
+		return err
+	})
+
+	if err := stopInstances(ctx, users, "physics", true, 3); err != nil {
+		t.Fatalf("stopInstances failed: %v", err)
+	}
+
+	for _, user := range users {
+		if state, _ := cloud.Lightsail.InstanceState(user + "-ubuntu_22_04"); state != "stopped" {
+			t.Errorf("expected %s's instance to be stopped, got %s", user, state)
+		}
+	}
+	if calls := cloud.CallCount("StopInstance"); calls != 5 {
+		t.Errorf("expected 5 StopInstance calls including one retry, got %d", calls)
+	}
+}
+
+func TestRemoveBulkUsersReportsFailures(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "physics", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice", "bob"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+
+	err := removeBulkUsers(ctx, []string{"alice", "bob", "nobody"}, "", "", true, 2)
+	if err == nil || err.Error() != "failed to remove 1 of 3 users" {
+		t.Fatalf("expected one failed removal, got %v", err)
+	}
+
+	if got := cloud.IAM.UserNames(); len(got) != 0 {
+		t.Errorf("expected all users to be removed, got %v", got)
+	}
+	if got := cloud.Lightsail.InstanceNames(); len(got) != 0 {
+		t.Errorf("expected all instances to be removed, got %v", got)
+	}
+}
+
+func TestRemoveBulkUsersWithOverlappingNames(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "physics", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"bob", "bob-smith"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	if err := createUsers(ctx, "chem", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"carol-jones"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	cloud.Lightsail.AddInstance("carol-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "physics", "running")
+
+	// Removing bob leaves bob-smith's instance alone
+	if err := removeBulkUsers(ctx, []string{"bob"}, "", "", true, 1); err != nil {
+		t.Fatalf("removeBulkUsers failed: %v", err)
+	}
+	if got := strings.Join(cloud.IAM.UserNames(), ","); got != "bob-smith,carol-jones" {
+		t.Errorf("expected only bob to be removed, got %s", got)
+	}
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "bob-smith-ubuntu_22_04,carol-jones-ubuntu_22_04,carol-ubuntu_22_04" {
+		t.Errorf("expected only bob's instance to be removed, got %s", got)
+	}
+
+	// A project's users are its instances' owners, and only its instances go;
+	// carol has no IAM user, so her instance isn't taken for anyone's
+	if err := removeBulkUsers(ctx, nil, "physics", "", true, 1); err != nil {
+		t.Fatalf("removeBulkUsers failed: %v", err)
+	}
+	if got := strings.Join(cloud.IAM.UserNames(), ","); got != "carol-jones" {
+		t.Errorf("expected only bob-smith to be removed, got %s", got)
+	}
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "carol-jones-ubuntu_22_04,carol-ubuntu_22_04" {
+		t.Errorf("expected only bob-smith's instance to be removed, got %s", got)
+	}
+}
+
+func TestResumeStopInstancesOperation(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	users := []string{"alice", "bob", "carol"}
+	for _, user := range users {
+		cloud.Lightsail.AddInstance(user+"-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	}
+
+	cloud.FailWhen("StopInstance", func(params interface{}) error {
+		if *params.(*lightsail.StopInstanceInput).InstanceName == "bob-ubuntu_22_04" {
+			return errors.New("credentials expired")
+		}
+		return nil
+	})
+
+	if err := stopInstances(ctx, users, "physics", false, 2); err == nil {
+		t.Fatal("expected stopInstances to report bob's failure")
+	}
+
+	store, err := journal.NewStore()
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	ops, err := store.List()
+	if err != nil || len(ops) != 1 {
+		t.Fatalf("expected one journaled operation, got %d (%v)", len(ops), err)
+	}
+	op := ops[0]
+	if op.Command != "instances stop" || op.Status != journal.StatusFailed {
+		t.Errorf("unexpected operation: %s %s", op.Command, op.Status)
+	}
+	if got := strings.Join(op.Unfinished(), ","); got != "bob-ubuntu_22_04" {
+		t.Errorf("expected only bob's instance to be unfinished, got %s", got)
+	}
+
+	cloud.ClearFailures()
+	if err := resumeOperation(ctx, op.ID[:15], 0); err != nil {
+		t.Fatalf("resumeOperation failed: %v", err)
+	}
+
+	if state, _ := cloud.Lightsail.InstanceState("bob-ubuntu_22_04"); state != "stopped" {
+		t.Errorf("expected bob's instance to be stopped, got %s", state)
+	}
+	if calls := cloud.CallCount("StopInstance"); calls != 4 {
+		t.Errorf("expected only bob's instance to be retried, got %d StopInstance calls", calls)
+	}
+
+	resumed, err := store.Load(op.ID)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if resumed.Status != journal.StatusCompleted || resumed.Resumes != 1 {
+		t.Errorf("expected completed operation resumed once, got %s (%d resumes)", resumed.Status, resumed.Resumes)
+	}
+}
+
+func TestResumeCreateBulkUsersAdoptsPartialUsers(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	csvFile := filepath.Join(t.TempDir(), "class.csv")
+	if err := os.WriteFile(csvFile, []byte("username,project,blueprint,bundle\nalice,physics,ubuntu_22_04,small_3_0\nbob,physics,ubuntu_22_04,small_3_0\n"), 0644); err != nil {
+		t.Fatalf("failed to write CSV: %v", err)
+	}
+
+	// bob's run stops after his user and instance exist, and they can't be rolled back
+	cloud.FailWhen("PutUserPolicy", func(params interface{}) error {
+		if *params.(*iam.PutUserPolicyInput).UserName == "bob" {
+			return errors.New("credentials expired")
+		}
+		return nil
+	})
+	cloud.FailOn("DeleteInstance", errors.New("credentials expired"))
+	cloud.FailOn("DeleteUser", errors.New("credentials expired"))
+	cloud.FailOn("DeleteKeyPair", errors.New("credentials expired"))
+
+	if err := createBulkUsers(ctx, csvFile, false, true, false, 1); err != nil {
+		t.Fatalf("createBulkUsers failed: %v", err)
+	}
+	if got := strings.Join(cloud.IAM.UserNames(), ","); got != "alice,bob" {
+		t.Fatalf("expected bob to be left behind by the failed rollback, got %s", got)
+	}
+
+	store, err := journal.NewStore()
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	ops, err := store.List()
+	if err != nil || len(ops) != 1 {
+		t.Fatalf("expected one journaled operation, got %d (%v)", len(ops), err)
+	}
+
+	// Resuming uses the recorded rows, not the file
+	if err := os.Remove(csvFile); err != nil {
+		t.Fatalf("failed to remove CSV: %v", err)
+	}
+	cloud.ClearFailures()
+	if err := resumeOperation(ctx, ops[0].ID, 0); err != nil {
+		t.Fatalf("resumeOperation failed: %v", err)
+	}
+
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "alice-ubuntu_22_04,bob-ubuntu_22_04" {
+		t.Errorf("expected bob's instance to be reused, got %s", got)
+	}
+	if _, ok := cloud.IAM.UserPolicy("bob", aws.UserInstancePolicyName("bob")); !ok {
+		t.Error("expected bob to be granted access to his instance")
+	}
+	resumed, err := store.Load(ops[0].ID)
+	if err != nil || resumed.Status != journal.StatusCompleted {
+		t.Errorf("expected the resumed operation to complete, got %v (%v)", resumed, err)
+	}
+}
+
+func TestResizeInstanceWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	cloud.Lightsail.SetInstanceZone("alice-ubuntu_22_04", "us-east-1b")
+	cloud.Lightsail.SetInstanceKeyPair("alice-ubuntu_22_04", "lfr-alice")
+
+	if err := resizeInstance(ctx, "alice-ubuntu_22_04", "up", true, false, false); err != nil {
+		t.Fatalf("resizeInstance failed: %v", err)
+	}
+
+	if state, _ := cloud.Lightsail.InstanceState("alice-ubuntu_22_04"); state != "stopped" {
+		t.Errorf("expected original instance to be stopped, got %s", state)
+	}
+	if got := strings.Join(cloud.Lightsail.SnapshotNames(), ","); got != "alice-ubuntu_22_04-resize-snapshot" {
+		t.Errorf("unexpected snapshots: %s", got)
+	}
+
+	resized, err := aws.NewLightsailService(&aws.Client{Lightsail: cloud.Lightsail}).GetInstance(ctx, "alice-ubuntu_22_04-resized")
+	if err != nil {
+		t.Fatalf("expected resized instance: %v", err)
+	}
+	if resized.Bundle != "app_standard_2xl_1_0" || resized.AvailabilityZone != "us-east-1b" {
+		t.Errorf("expected bundle app_standard_2xl_1_0 in us-east-1b, got %s in %s", resized.Bundle, resized.AvailabilityZone)
+	}
+	if resized.Tags["ResizedFrom"] != "alice-ubuntu_22_04" || resized.Tags["Project"] != "physics" {
+		t.Errorf("unexpected tags on resized instance: %v", resized.Tags)
+	}
+	if resized.SSHKeyName != "lfr-alice" {
+		t.Errorf("expected the resized instance to keep alice's key pair, got %q", resized.SSHKeyName)
+	}
+}
+
+// setupCutoverInstance creates alice's instance with a user, access policy,
+// attached disk and static IP.
+func setupCutoverInstance(t *testing.T, cloud *testutils.FakeCloud) (*aws.Client, *types.Instance) {
+	t.Helper()
+	ctx := context.Background()
+	client := &aws.Client{IAM: cloud.IAM, Lightsail: cloud.Lightsail}
+	lightsailService := aws.NewLightsailService(client)
+	iamService := aws.NewIAMService(client)
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	instance, err := lightsailService.GetInstance(ctx, "alice-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("GetInstance failed: %v", err)
+	}
+
+	if _, err := iamService.CreateUser(ctx, "alice", "", "physics"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := iamService.UpdateUserInstanceAccess(ctx, "alice", []string{instance.ARN}, nil); err != nil {
+		t.Fatalf("UpdateUserInstanceAccess failed: %v", err)
+	}
+	if _, err := lightsailService.CreateDisk(ctx, "alice-data", 32, "us-east-1a", "physics"); err != nil {
+		t.Fatalf("CreateDisk failed: %v", err)
+	}
+	if err := lightsailService.AttachDisk(ctx, "alice-data", instance.Name, "/dev/xvdf"); err != nil {
+		t.Fatalf("AttachDisk failed: %v", err)
+	}
+	cloud.Lightsail.AddStaticIP("alice-ip", instance.Name)
+
+	return client, instance
+}
+
+func TestResizeCutoverWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+	client, original := setupCutoverInstance(t, cloud)
+
+	if err := resizeInstance(ctx, "alice-ubuntu_22_04", "up", false, true, true); err != nil {
+		t.Fatalf("resizeInstance failed: %v", err)
+	}
+
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "alice-ubuntu_22_04-resized" {
+		t.Errorf("expected only the resized instance, got %s", got)
+	}
+	if got := cloud.Lightsail.SnapshotNames(); len(got) != 0 {
+		t.Errorf("expected resize snapshot to be deleted, got %v", got)
+	}
+
+	disk, err := aws.NewLightsailService(client).GetDisk(ctx, "alice-data")
+	if err != nil {
+		t.Fatalf("GetDisk failed: %v", err)
+	}
+	if disk.AttachedTo != "alice-ubuntu_22_04-resized" || disk.Path != "/dev/xvdf" {
+		t.Errorf("expected disk on resized instance at /dev/xvdf, got %s at %s", disk.AttachedTo, disk.Path)
+	}
+	if attached, _ := cloud.Lightsail.StaticIPAttachment("alice-ip"); attached != "alice-ubuntu_22_04-resized" {
+		t.Errorf("expected static IP on resized instance, got %q", attached)
+	}
+
+	policy, _ := cloud.IAM.UserPolicy("alice", "LightsailLimitedAccess-alice")
+	if strings.Contains(policy, original.ARN+"\"") || !strings.Contains(policy, "alice-ubuntu_22_04-resized") {
+		t.Errorf("expected policy to grant only the resized instance, got %s", policy)
+	}
+}
+
+func TestResizeCutoverUpdatesOwnerWithHyphenatedName(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "physics", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"bob", "bob-smith"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	bobPolicy, _ := cloud.IAM.UserPolicy("bob", aws.UserInstancePolicyName("bob"))
+
+	if err := resizeInstance(ctx, "bob-smith-ubuntu_22_04", "up", false, true, false); err != nil {
+		t.Fatalf("resizeInstance failed: %v", err)
+	}
+
+	policy, _ := cloud.IAM.UserPolicy("bob-smith", aws.UserInstancePolicyName("bob-smith"))
+	if !strings.Contains(policy, "bob-smith-ubuntu_22_04-resized") {
+		t.Errorf("expected bob-smith to be granted the resized instance, got %s", policy)
+	}
+	if got, _ := cloud.IAM.UserPolicy("bob", aws.UserInstancePolicyName("bob")); got != bobPolicy {
+		t.Errorf("expected bob's policy to be unchanged, got %s", got)
+	}
+}
+
+func TestResizeCutoverRollsBackOnFailure(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+	client, original := setupCutoverInstance(t, cloud)
+
+	cloud.FailWhen("AttachStaticIp", func(params interface{}) error {
+		if input := params.(*lightsail.AttachStaticIpInput); *input.InstanceName == "alice-ubuntu_22_04-resized" {
+			return errors.New("static IP quota exceeded")
+		}
+		return nil
+	})
+
+	err := resizeInstance(ctx, "alice-ubuntu_22_04", "up", false, true, true)
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected rolled back error, got %v", err)
+	}
+
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "alice-ubuntu_22_04" {
+		t.Errorf("expected resized instance to be deleted, got %s", got)
+	}
+	if got := cloud.Lightsail.SnapshotNames(); len(got) != 0 {
+		t.Errorf("expected resize snapshot to be deleted, got %v", got)
+	}
+
+	lightsailService := aws.NewLightsailService(client)
+	if instance, err := lightsailService.GetInstance(ctx, "alice-ubuntu_22_04"); err != nil || instance.State != "running" {
+		t.Errorf("expected original instance to be restarted, got %+v (%v)", instance, err)
+	}
+
+	disk, err := lightsailService.GetDisk(ctx, "alice-data")
+	if err != nil {
+		t.Fatalf("GetDisk failed: %v", err)
+	}
+	if disk.AttachedTo != "alice-ubuntu_22_04" || disk.Path != "/dev/xvdf" {
+		t.Errorf("expected disk back on original instance, got %s at %s", disk.AttachedTo, disk.Path)
+	}
+	if attached, _ := cloud.Lightsail.StaticIPAttachment("alice-ip"); attached != "alice-ubuntu_22_04" {
+		t.Errorf("expected static IP back on original instance, got %q", attached)
+	}
+
+	policy, _ := cloud.IAM.UserPolicy("alice", "LightsailLimitedAccess-alice")
+	if !strings.Contains(policy, original.ARN) || strings.Contains(policy, "resized") {
+		t.Errorf("expected policy to be unchanged, got %s", policy)
+	}
+}
+
+func TestResizeCutoverRollsBackWhenInterrupted(t *testing.T) {
+	cloud := useFakeCloud(t)
+	client, _ := setupCutoverInstance(t, cloud)
+
+	// The run is interrupted while the static IP moves
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cloud.FailWhen("AttachStaticIp", func(params interface{}) error {
+		if input := params.(*lightsail.AttachStaticIpInput); *input.InstanceName == "alice-ubuntu_22_04-resized" {
+			cancel()
+			return context.Canceled
+		}
+		return nil
+	})
+
+	err := resizeInstance(ctx, "alice-ubuntu_22_04", "up", false, true, true)
+	if err == nil || !strings.Contains(err.Error(), "was rolled back") {
+		t.Fatalf("expected the rollback to complete, got %v", err)
+	}
+
+	background := context.Background()
+	lightsailService := aws.NewLightsailService(client)
+	if instance, err := lightsailService.GetInstance(background, "alice-ubuntu_22_04"); err != nil || instance.State != "running" {
+		t.Errorf("expected original instance to be restarted, got %+v (%v)", instance, err)
+	}
+	if disk, err := lightsailService.GetDisk(background, "alice-data"); err != nil || disk.AttachedTo != "alice-ubuntu_22_04" {
+		t.Errorf("expected disk back on original instance, got %+v (%v)", disk, err)
+	}
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "alice-ubuntu_22_04" {
+		t.Errorf("expected resized instance to be deleted, got %s", got)
+	}
+}
+
+func TestCheckStartRequestsWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	setViper(t, "students.s3_sync_enabled", true)
+	setViper(t, "students.s3_bucket", "lfr-status")
+	setViper(t, "students.project", "physics")
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "stopped")
+	if _, err := aws.NewIAMService(&aws.Client{IAM: cloud.IAM}).CreateUser(ctx, "alice", "", "physics"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	request, _ := json.Marshal(aws.StudentStartRequest{Username: "alice", StudentID: "s-001"})
+	cloud.S3.PutObjectData("lfr-status", "physics/alice/start-request.json", request)
+
+	if err := checkStartRequests(ctx, "physics", true); err != nil {
+		t.Fatalf("checkStartRequests failed: %v", err)
+	}
+
+	if state, _ := cloud.Lightsail.InstanceState("alice-ubuntu_22_04"); state != "running" {
+		t.Errorf("expected instance to be running, got %s", state)
+	}
+	if _, ok := cloud.S3.ObjectData("lfr-status", "physics/alice/start-request.json"); ok {
+		t.Error("expected start request to be deleted")
+	}
+
+	data, ok := cloud.S3.ObjectData("lfr-status", "physics/alice/status.json")
+	if !ok {
+		t.Fatal("expected status.json to be written")
+	}
+	var status aws.StudentStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		t.Fatalf("invalid status.json: %v", err)
+	}
+	if status.State != "running" || status.PublicIP == "" || status.InstanceName != "alice-ubuntu_22_04" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestCollectInstanceUsageWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	period := 5 * time.Minute
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	cloud.Lightsail.AddInstance("bob-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	cloud.Lightsail.AddInstance("carol-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "stopped")
+
+	// alice has been quiet for three hours, bob is busy
+	quiet := make([]float64, 36)
+	for i := range quiet {
+		quiet[i] = 1
+	}
+	cloud.Lightsail.SetMetricData("alice-ubuntu_22_04", lightsailTypes.InstanceMetricNameCPUUtilization, testutils.MetricSeries(now, period, quiet...))
+	cloud.Lightsail.SetMetricData("alice-ubuntu_22_04", lightsailTypes.InstanceMetricNameNetworkIn, testutils.MetricSeries(now, period, 1024, 1024))
+	cloud.Lightsail.SetMetricData("bob-ubuntu_22_04", lightsailTypes.InstanceMetricNameCPUUtilization, testutils.MetricSeries(now, period, 1, 80))
+
+	service := aws.NewLightsailService(&aws.Client{Lightsail: cloud.Lightsail})
+	usage, err := collectInstanceUsage(ctx, service, "physics", monitorOptions{
+		IdleThreshold: 2 * time.Hour,
+		CPUThreshold:  5,
+		Lookback:      6 * time.Hour,
+	}, now)
+	if err != nil {
+		t.Fatalf("collectInstanceUsage failed: %v", err)
+	}
+	if len(usage) != 3 {
+		t.Fatalf("expected 3 instances, got %d", len(usage))
+	}
+
+	byName := make(map[string]*types.InstanceUsage)
+	for _, u := range usage {
+		byName[u.Name] = u
+	}
+
+	alice := byName["alice-ubuntu_22_04"]
+	if !alice.Idle || !alice.IdleForAtLeast || alice.NetworkInBytes != 2048 {
+		t.Errorf("expected alice to be idle, got %+v", alice)
+	}
+	if bob := byName["bob-ubuntu_22_04"]; bob.Idle || bob.IdleFor != 0 {
+		t.Errorf("expected bob to be busy, got %+v", bob)
+	}
+	if carol := byName["carol-ubuntu_22_04"]; carol.HasData || carol.Idle {
+		t.Errorf("expected no metrics for stopped carol, got %+v", carol)
+	}
+
+	// Only running instances are queried, once per metric
+	if got := cloud.CallCount("GetInstanceMetricData"); got != 8 {
+		t.Errorf("expected 8 metric requests, got %d", got)
+	}
+}
+
+func TestCloneInstanceWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	cloud.Lightsail.SetInstanceZone("alice-ubuntu_22_04", "us-east-1c")
+	cloud.Lightsail.SetInstanceKeyPair("alice-ubuntu_22_04", "lfr-alice")
+	if _, err := aws.NewIAMService(&aws.Client{IAM: cloud.IAM}).CreateUser(ctx, "bob", "Passw0rd!", "physics"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	if err := cloneInstance(ctx, "alice-ubuntu_22_04", "bob-ubuntu_22_04", "", "", "eu-west-1a", true); err == nil {
+		t.Error("expected cloning into a zone of another region to fail")
+	}
+	if err := cloneInstance(ctx, "alice-ubuntu_22_04", "bob-ubuntu_22_04", "", "", "", true); err != nil {
+		t.Fatalf("cloneInstance failed: %v", err)
+	}
+
+	clone, err := aws.NewLightsailService(&aws.Client{Lightsail: cloud.Lightsail}).GetInstance(ctx, "bob-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("expected cloned instance: %v", err)
+	}
+	if clone.State != "running" || clone.Bundle != "app_standard_xl_1_0" || clone.AvailabilityZone != "us-east-1c" {
+		t.Errorf("unexpected clone: %+v", clone)
+	}
+	if clone.Tags["ClonedFrom"] != "alice-ubuntu_22_04" || clone.Tags["Project"] != "physics" {
+		t.Errorf("unexpected tags on clone: %v", clone.Tags)
+	}
+	if clone.SSHKeyName != "lfr-alice" {
+		t.Errorf("expected the clone to keep the source's key pair, got %q", clone.SSHKeyName)
+	}
+
+	doc, ok := cloud.IAM.UserPolicy("bob", "LightsailLimitedAccess-bob")
+	if !ok || !strings.Contains(doc, clone.ARN) {
+		t.Errorf("expected bob's policy to reference %s, got %q", clone.ARN, doc)
+	}
+
+	// The intermediate snapshot is tagged with the project so prune can find it
+	snapshots := cloud.Lightsail.SnapshotNames()
+	if len(snapshots) != 1 || !strings.HasPrefix(snapshots[0], "alice-ubuntu_22_04-clone-") {
+		t.Errorf("unexpected snapshots: %v", snapshots)
+	}
+
+	// An instance for bob-smith is theirs, not bob's, and one for a name no
+	// IAM user owns is granted to nobody
+	if _, err := aws.NewIAMService(&aws.Client{IAM: cloud.IAM}).CreateUser(ctx, "bob-smith", "Passw0rd!", "physics"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	for _, name := range []string{"bob-smith-ubuntu_22_04", "carol-ubuntu_22_04"} {
+		if err := restoreSnapshot(ctx, snapshots[0], name, "", "", "", false); err != nil {
+			t.Fatalf("restoreSnapshot failed: %v", err)
+		}
+	}
+	if got, _ := cloud.IAM.UserPolicy("bob", "LightsailLimitedAccess-bob"); got != doc {
+		t.Errorf("expected bob's policy to be unchanged, got %q", got)
+	}
+	if got, _ := cloud.IAM.UserPolicy("bob-smith", "LightsailLimitedAccess-bob-smith"); !strings.Contains(got, "bob-smith-ubuntu_22_04") {
+		t.Errorf("expected bob-smith's policy to reference their instance, got %q", got)
+	}
+	if _, ok := cloud.IAM.UserPolicy("carol", "LightsailLimitedAccess-carol"); ok {
+		t.Error("expected no policy for carol, who has no IAM user")
+	}
+}
+
+func TestRestoreSnapshotWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	cloud.Lightsail.SetInstanceZone("alice-ubuntu_22_04", "us-east-1b")
+	cloud.Lightsail.SetInstanceKeyPair("alice-ubuntu_22_04", "lfr-alice")
+	if err := createSnapshot(ctx, "alice-ubuntu_22_04", "alice-backup", false); err != nil {
+		t.Fatalf("createSnapshot failed: %v", err)
+	}
+
+	if err := restoreSnapshot(ctx, "alice-backup", "alice-restored", "app_standard_2xl_1_0", "eu-west-1", "", true); err == nil {
+		t.Error("expected restoring into another region to fail")
+	}
+
+	if err := restoreSnapshot(ctx, "alice-backup", "alice-restored", "app_standard_2xl_1_0", "", "", true); err != nil {
+		t.Fatalf("restoreSnapshot failed: %v", err)
+	}
+
+	restored, err := aws.NewLightsailService(&aws.Client{Lightsail: cloud.Lightsail}).GetInstance(ctx, "alice-restored")
+	if err != nil {
+		t.Fatalf("expected restored instance: %v", err)
+	}
+	if restored.Bundle != "app_standard_2xl_1_0" || restored.Tags["RestoredFrom"] != "alice-backup" || restored.Tags["Project"] != "physics" {
+		t.Errorf("unexpected restored instance: %+v", restored)
+	}
+	if restored.AvailabilityZone != "us-east-1b" {
+		t.Errorf("expected the restored instance in the source's zone, got %s", restored.AvailabilityZone)
+	}
+	if restored.SSHKeyName != "lfr-alice" {
+		t.Errorf("expected the restored instance to keep the source's key pair, got %q", restored.SSHKeyName)
+	}
+
+	// Another zone can be chosen
+	if err := restoreSnapshot(ctx, "alice-backup", "alice-restored-d", "", "", "us-east-1d", true); err != nil {
+		t.Fatalf("restoreSnapshot failed: %v", err)
+	}
+	if restored, err := aws.NewLightsailService(&aws.Client{Lightsail: cloud.Lightsail}).GetInstance(ctx, "alice-restored-d"); err != nil || restored.AvailabilityZone != "us-east-1d" {
+		t.Errorf("expected the instance in us-east-1d, got %+v (%v)", restored, err)
+	}
+}
+
+func TestPruneSnapshotsWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cloud.Now = func() time.Time {
+		clock = clock.Add(time.Hour)
+		return clock
+	}
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	cloud.Lightsail.AddInstance("bob-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+	cloud.Lightsail.AddInstance("carol-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "chemistry", "running")
+
+	for _, snap := range []struct{ instance, name string }{
+		{"alice-ubuntu_22_04", "alice-1"},
+		{"alice-ubuntu_22_04", "alice-2"},
+		{"alice-ubuntu_22_04", "alice-3"},
+		{"bob-ubuntu_22_04", "bob-1"},
+		{"carol-ubuntu_22_04", "carol-1"},
+		{"carol-ubuntu_22_04", "carol-2"},
+	} {
+		if err := createSnapshot(ctx, snap.instance, snap.name, false); err != nil {
+			t.Fatalf("createSnapshot failed: %v", err)
+		}
+	}
+
+	// Without --confirm only the plan is shown
+	if err := pruneSnapshots(ctx, "physics", 1, false); err != nil {
+		t.Fatalf("pruneSnapshots failed: %v", err)
+	}
+	if got := len(cloud.Lightsail.SnapshotNames()); got != 6 {
+		t.Fatalf("expected no snapshots to be deleted, got %d remaining", got)
+	}
+
+	if err := pruneSnapshots(ctx, "physics", 1, true); err != nil {
+		t.Fatalf("pruneSnapshots failed: %v", err)
+	}
+	if got := strings.Join(cloud.Lightsail.SnapshotNames(), ","); got != "alice-3,bob-1,carol-1,carol-2" {
+		t.Errorf("unexpected snapshots after prune: %s", got)
+	}
+}
+
+func TestListInstancesStructuredOutput(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-cs101", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("bob-cs101", "ubuntu_22_04", "small_3_0", "cs101", "stopped")
+	cloud.Lightsail.AddInstance("carol-bio200", "ubuntu_22_04", "small_3_0", "bio200", "running")
+
+	render := func(format output.Format, project string) string {
+		t.Helper()
+
+		var buf bytes.Buffer
+		out, err := output.NewRenderer(&buf, output.Options{Format: format})
+		if err != nil {
+			t.Fatalf("NewRenderer failed: %v", err)
+		}
+		if err := listInstances(context.Background(), project, "", out); err != nil {
+			t.Fatalf("listInstances failed: %v", err)
+		}
+		return buf.String()
+	}
+
+	var instances []types.Instance
+	if err := json.Unmarshal([]byte(render(output.FormatJSON, "cs101")), &instances); err != nil {
+		t.Fatalf("expected JSON output: %v", err)
+	}
+	if len(instances) != 2 || instances[0].Tags["Project"] != "cs101" {
+		t.Errorf("expected the two cs101 instances, got %+v", instances)
+	}
+
+	csv := render(output.FormatCSV, "bio200")
+	if !strings.HasPrefix(csv, "name,state,public_ip,") || !strings.Contains(csv, "\ncarol-bio200,running,") {
+		t.Errorf("unexpected CSV output:\n%s", csv)
+	}
+
+	if got := strings.TrimSpace(render(output.FormatJSON, "none")); got != "[]" {
+		t.Errorf("expected an empty JSON list for no instances, got %q", got)
+	}
+}
+
+func TestIdleStatusStructuredOutput(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+	cloud.Lightsail.AddInstance("alice-cs101", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("bob-cs101", "ubuntu_22_04", "small_3_0", "cs101", "stopped")
+	lightsailService := aws.NewLightsailService(&aws.Client{Lightsail: cloud.Lightsail})
+	if err := lightsailService.SetIdleDetection(ctx, "alice-cs101", aws.IdleSettings{ThresholdMinutes: 90, DurationMinutes: 15}); err != nil {
+		t.Fatalf("SetIdleDetection failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	out, _ := output.NewRenderer(&buf, output.Options{Format: output.FormatJSON})
+	if err := showIdleStatus(ctx, "cs101", "", out); err != nil {
+		t.Fatalf("showIdleStatus failed: %v", err)
+	}
+
+	var statuses []idleStatus
+	if err := json.Unmarshal(buf.Bytes(), &statuses); err != nil {
+		t.Fatalf("expected JSON output: %v", err)
+	}
+	want := []idleStatus{
+		{Instance: "alice-cs101", State: "running", Enabled: true, ThresholdMinutes: 90, DurationMinutes: 15},
+		{Instance: "bob-cs101", State: "stopped"},
+	}
+	if len(statuses) != len(want) || statuses[0] != want[0] || statuses[1] != want[1] {
+		t.Errorf("expected the instances' add-on settings %+v, got %+v", want, statuses)
+	}
+}
+
+func TestListUsersWithOverlappingNames(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "physics", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"bob", "bob-smith"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	cloud.Lightsail.AddInstance("lab-server", "ubuntu_22_04", "small_3_0", "physics", "running")
+
+	var buf bytes.Buffer
+	out, _ := output.NewRenderer(&buf, output.Options{Format: output.FormatJSON})
+	if err := listUsers(ctx, "physics", out); err != nil {
+		t.Fatalf("listUsers failed: %v", err)
+	}
+
+	var users []userInstance
+	if err := json.Unmarshal(buf.Bytes(), &users); err != nil {
+		t.Fatalf("expected JSON output: %v", err)
+	}
+	got := make(map[string]string)
+	for _, user := range users {
+		got[user.Instance.Name] = user.Username
+	}
+	want := map[string]string{
+		"bob-ubuntu_22_04":       "bob",
+		"bob-smith-ubuntu_22_04": "bob-smith",
+		"lab-server":             "",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d instances, got %v", len(want), got)
+	}
+	for instance, username := range want {
+		if got[instance] != username {
+			t.Errorf("expected %s to be listed under %q, got %q", instance, username, got[instance])
+		}
+	}
+}
+
+func TestApplyManifestWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("carol-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+
+	path := filepath.Join(t.TempDir(), "cs101.yaml")
+	err := os.WriteFile(path, []byte(`
+project: cs101
+blueprint: ubuntu_22_04
+bundle: small_3_0
+idle:
+  threshold: 60
+  duration: 15
+groups:
+  - name: cs101-tas
+users:
+  - name: alice
+    groups: [cs101-tas]
+    disks:
+      - name: alice-data
+        size_gb: 32
+        path: /dev/xvdf
+  - name: bob
+`), 0600)
+	if err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	// Without --confirm only the plan is shown
+	if err := applyManifest(context.Background(), path, true, false); err != nil {
+		t.Fatalf("applyManifest without confirm failed: %v", err)
+	}
+	if len(cloud.IAM.UserNames()) != 0 {
+		t.Fatalf("expected no changes without --confirm, got users %v", cloud.IAM.UserNames())
+	}
+
+	if err := applyManifest(context.Background(), path, true, true); err != nil {
+		t.Fatalf("applyManifest failed: %v", err)
+	}
+
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "alice-ubuntu_22_04,bob-ubuntu_22_04" {
+		t.Errorf("expected carol to be pruned and alice and bob created, got %s", got)
+	}
+	if groups := cloud.IAM.UserGroups("alice"); strings.Join(groups, ",") != "Lightsail-Users,cs101-tas" {
+		t.Errorf("expected alice to be in cs101-tas, got %v", groups)
+	}
+
+	ctx := context.Background()
+	awsClient, err := aws.NewClient(ctx, aws.Options{})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	disk, err := aws.NewLightsailService(awsClient).GetDisk(ctx, "alice-data")
+	if err != nil || disk.AttachedTo != "alice-ubuntu_22_04" || disk.Path != "/dev/xvdf" {
+		t.Errorf("expected alice-data attached to alice's instance, got %+v (%v)", disk, err)
+	}
+
+	// A second run finds nothing to do
+	m, err := manifest.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	live, err := loadProjectState(ctx, awsClient, m)
+	if err != nil {
+		t.Fatalf("loadProjectState failed: %v", err)
+	}
+	if plan := manifest.Diff(m, live, true); len(plan.Changes) != 0 {
+		t.Errorf("expected no changes after apply, got %v", plan.Changes)
+	}
+}
+
+func TestApplyManifestRepairsDrift(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "cs101", "ubuntu_22_04", "small_3_0", "us-east-1", []string{"alice", "bob", "carol"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+
+	// Drift: alice's IAM user was deleted, bob left the users group and
+	// carol's instance was deleted
+	awsClient, err := aws.NewClient(ctx, aws.Options{})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	iamService := aws.NewIAMService(awsClient)
+	lightsailService := aws.NewLightsailService(awsClient)
+	if err := iamService.DeleteUser(ctx, "alice"); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := cloud.IAM.RemoveUserFromGroup(ctx, &iam.RemoveUserFromGroupInput{UserName: awssdk.String("bob"), GroupName: awssdk.String("Lightsail-Users")}); err != nil {
+		t.Fatalf("RemoveUserFromGroup failed: %v", err)
+	}
+	if err := lightsailService.DeleteInstance(ctx, "carol-ubuntu_22_04"); err != nil {
+		t.Fatalf("DeleteInstance failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cs101.yaml")
+	err = os.WriteFile(path, []byte(`
+project: cs101
+blueprint: ubuntu_22_04
+bundle: small_3_0
+zone: us-east-1b
+idle:
+  threshold: 60
+  duration: 15
+users:
+  - name: alice
+  - name: bob
+  - name: dave
+`), 0600)
+	if err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	if err := applyManifest(ctx, path, true, true); err != nil {
+		t.Fatalf("applyManifest failed: %v", err)
+	}
+
+	if got := strings.Join(cloud.Lightsail.InstanceNames(), ","); got != "alice-ubuntu_22_04,bob-ubuntu_22_04,dave-ubuntu_22_04" {
+		t.Errorf("expected alice's instance to be reused and dave's created, got %s", got)
+	}
+	if got := strings.Join(cloud.IAM.UserNames(), ","); got != "alice,bob,dave" {
+		t.Errorf("expected alice to be recreated and carol pruned, got %s", got)
+	}
+	if _, ok := cloud.IAM.UserPolicy("alice", aws.UserInstancePolicyName("alice")); !ok {
+		t.Error("expected alice to be granted access to her instance")
+	}
+	if groups := cloud.IAM.UserGroups("bob"); strings.Join(groups, ",") != "Lightsail-Users" {
+		t.Errorf("expected bob to rejoin Lightsail-Users, got %v", groups)
+	}
+
+	for _, name := range []string{"alice-ubuntu_22_04", "bob-ubuntu_22_04", "dave-ubuntu_22_04"} {
+		instance, err := lightsailService.GetInstance(ctx, name)
+		if err != nil {
+			t.Fatalf("GetInstance failed: %v", err)
+		}
+		if instance.Idle == nil || *instance.Idle != (types.IdleDetection{ThresholdMinutes: 60, DurationMinutes: 15}) {
+			t.Errorf("expected %s to have the manifest's idle settings, got %+v", name, instance.Idle)
+		}
+	}
+	if dave, _ := lightsailService.GetInstance(ctx, "dave-ubuntu_22_04"); dave == nil || dave.AvailabilityZone != "us-east-1b" {
+		t.Errorf("expected dave's instance in the manifest's zone, got %+v", dave)
+	}
+
+	m, err := manifest.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	live, err := loadProjectState(ctx, awsClient, m)
+	if err != nil {
+		t.Fatalf("loadProjectState failed: %v", err)
+	}
+	if plan := manifest.Diff(m, live, true); len(plan.Changes) != 0 {
+		t.Errorf("expected no changes after apply, got %v", plan.Changes)
+	}
+}
+
+func TestPlanManifestWithOverlappingNames(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	// bob-smith's instance isn't named after the manifest, bob has none, and
+	// no user owns the last instance
+	cloud.Lightsail.AddInstance("bob-smith-dev", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("zed-old", "ubuntu_22_04", "small_3_0", "cs101", "stopped")
+	awsClient, err := aws.NewClient(ctx, aws.Options{})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	for _, user := range []string{"bob", "bob-smith"} {
+		if _, err := aws.NewIAMService(awsClient).CreateUser(ctx, user, "", "cs101"); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "cs101.yaml")
+	err = os.WriteFile(path, []byte(`
+project: cs101
+blueprint: ubuntu_22_04
+bundle: small_3_0
+users:
+  - name: bob
+  - name: bob-smith
+`), 0600)
+	if err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	m, err := manifest.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	live, err := loadProjectState(ctx, awsClient, m)
+	if err != nil {
+		t.Fatalf("loadProjectState failed: %v", err)
+	}
+	if instance := live.Instances["bob-smith"]; instance == nil || instance.Name != "bob-smith-dev" {
+		t.Errorf("expected bob-smith-dev to be bob-smith's, got %+v", instance)
+	}
+	if instance := live.Instances["bob"]; instance != nil {
+		t.Errorf("expected bob to have no instance, got %s", instance.Name)
+	}
+
+	var changes []string
+	for _, change := range manifest.Diff(m, live, true).Changes {
+		if change.Kind == manifest.KindUser || change.Kind == manifest.KindInstance {
+			changes = append(changes, change.Action+" "+change.Kind+" "+change.Name)
+		}
+	}
+	want := []string{
+		manifest.ActionCreate + " " + manifest.KindInstance + " bob-ubuntu_22_04",
+		manifest.ActionDelete + " " + manifest.KindUser + " zed-old",
+	}
+	if strings.Join(changes, ",") != strings.Join(want, ",") {
+		t.Errorf("expected changes %v, got %v", want, changes)
+	}
+}
+
+func TestAuditProjectFixWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "cs101", "ubuntu_22_04", "small_3_0", "us-east-1", []string{"alice", "bob"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+
+	// Drift: bob left the users group, alice's policy was deleted, an
+	// untagged instance and disk belong to bob, and dave's user is gone.
+	if _, err := cloud.IAM.RemoveUserFromGroup(ctx, &iam.RemoveUserFromGroupInput{UserName: awssdk.String("bob"), GroupName: awssdk.String("Lightsail-Users")}); err != nil {
+		t.Fatalf("RemoveUserFromGroup failed: %v", err)
+	}
+	if _, err := cloud.IAM.DeleteUserPolicy(ctx, &iam.DeleteUserPolicyInput{UserName: awssdk.String("alice"), PolicyName: awssdk.String("LightsailLimitedAccess-alice")}); err != nil {
+		t.Fatalf("DeleteUserPolicy failed: %v", err)
+	}
+	cloud.Lightsail.AddInstance("bob-gpu", "ubuntu_22_04", "gpu_nvidia_xl_1_0", "", "running")
+	cloud.Lightsail.AddInstance("dave-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "stopped")
+	if _, err := cloud.Lightsail.CreateDisk(ctx, &lightsail.CreateDiskInput{DiskName: awssdk.String("bob-data"), SizeInGb: awssdk.Int32(16), AvailabilityZone: awssdk.String("us-east-1a")}); err != nil {
+		t.Fatalf("CreateDisk failed: %v", err)
+	}
+	if _, err := cloud.Lightsail.AttachDisk(ctx, &lightsail.AttachDiskInput{DiskName: awssdk.String("bob-data"), InstanceName: awssdk.String("bob-gpu"), DiskPath: awssdk.String("/dev/xvdf")}); err != nil {
+		t.Fatalf("AttachDisk failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	out, _ := output.NewRenderer(&buf, output.Options{Format: output.FormatJSON})
+	if err := auditProject(ctx, "cs101", false, out); err != nil {
+		t.Fatalf("auditProject failed: %v", err)
+	}
+
+	var findings []audit.Finding
+	if err := json.Unmarshal(buf.Bytes(), &findings); err != nil {
+		t.Fatalf("failed to decode findings: %v\n%s", err, buf.String())
+	}
+	var kinds []string
+	for _, finding := range findings {
+		kinds = append(kinds, finding.Kind+" "+finding.Resource)
+	}
+	expected := "untagged-instance bob-gpu,orphan-instance dave-ubuntu_22_04,missing-policy alice,missing-group bob,policy-mismatch bob,untagged-disk bob-data"
+	if strings.Join(kinds, ",") != expected {
+		t.Fatalf("unexpected findings:\n%s\nexpected:\n%s", strings.Join(kinds, ","), expected)
+	}
+
+	table, _ := output.NewRenderer(&bytes.Buffer{}, output.Options{})
+	if err := auditProject(ctx, "cs101", true, table); err != nil {
+		t.Fatalf("auditProject --fix failed: %v", err)
+	}
+
+	if groups := cloud.IAM.UserGroups("bob"); strings.Join(groups, ",") != "Lightsail-Users" {
+		t.Errorf("expected bob back in Lightsail-Users, got %v", groups)
+	}
+	doc, ok := cloud.IAM.UserPolicy("bob", "LightsailLimitedAccess-bob")
+	if !ok || !strings.Contains(doc, "Instance/bob-gpu") || !strings.Contains(doc, "Instance/bob-ubuntu_22_04") {
+		t.Errorf("expected bob's policy to cover both instances, got %s", doc)
+	}
+	if _, ok := cloud.IAM.UserPolicy("alice", "LightsailLimitedAccess-alice"); !ok {
+		t.Error("expected alice's policy to be restored")
+	}
+
+	awsClient, err := aws.NewClient(ctx, aws.Options{})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	state, err := loadAuditState(ctx, awsClient, "cs101")
+	if err != nil {
+		t.Fatalf("loadAuditState failed: %v", err)
+	}
+	remaining := audit.Check(state)
+	if len(remaining) != 1 || remaining[0].Kind != audit.KindOrphanInstance {
+		t.Errorf("expected only the orphaned instance to remain, got %+v", remaining)
+	}
+}
+
+// installedProbe matches the scripts of software.InstalledProbe.
+var installedProbe = regexp.MustCompile(`^(dpkg -s [^\n]+ >/dev/null 2>&1 && echo \S+\n)+true\n$`)
+
+// softwareRegistryHandler serves an instance's software registry from
+// records, keyed by pack ID, reports no packs installed without a record and
+// passes other scripts to install.
+func softwareRegistryHandler(records map[string]string, install func(script string, stdout io.Writer) int) testutils.SSHHandler {
+	return func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		data, _ := io.ReadAll(stdin)
+		script := string(data)
+
+		switch {
+		case script == software.ReadRegistryScript:
+			for _, record := range records {
+				fmt.Fprintln(stdout, record)
+			}
+			return 0
+		case installedProbe.MatchString(script):
+			// Nothing was installed before the registry
+			return 0
+		case strings.Contains(script, "<<'LFR_RECORD'"):
+			record := strings.Split(script, "\n")[2]
+			var result types.InstallResult
+			if err := json.Unmarshal([]byte(record), &result); err != nil {
+				return 1
+			}
+			records[result.PackID] = record
+			return 0
+		}
+		return install(script, stdout)
+	}
+}
+
+func TestInstallSoftwarePackOverSSH(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, hosts := useSSHServer(t, cloud)
+
+	records := make(map[string]string)
+	var script string
+	exitCode := 0
+	server.Handle(softwareRegistryHandler(records, func(s string, stdout io.Writer) int {
+		script = s
+		fmt.Fprintln(stdout, "Pack web-dev installed successfully")
+		return exitCode
+	}))
+
+	ctx := context.Background()
+	if err := installSoftwarePack(ctx, "web-dev", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+
+	if got := strings.Join(server.Commands(), ","); got != "bash -s,bash -s,bash -s,bash -s" {
+		t.Errorf("expected the registry, probe, install and record scripts to run with bash -s, got %s", got)
+	}
+	if !strings.Contains(script, "sudo apt-get install -y nodejs") {
+		t.Errorf("expected the install script on stdin, got %q", script)
+	}
+	if len(*hosts) != 1 || !strings.HasPrefix((*hosts)[0], "ubuntu@203.0.113.") {
+		t.Errorf("expected a connection to the instance's public IP, got %v", *hosts)
+	}
+	if !strings.Contains(records["web-dev"], `"success":true`) || !strings.Contains(records["web-dev"], `"version":"1.0"`) {
+		t.Errorf("expected a successful install of web-dev 1.0 to be recorded, got %q", records["web-dev"])
+	}
+
+	// Failed installs are recorded too, and installed again next time
+	exitCode = 100
+	err := installSoftwarePack(ctx, "web-dev", "alice", "cs101", true)
+	if err == nil || !strings.Contains(err.Error(), "installation failed") {
+		t.Errorf("expected a failed script to fail the install, got %v", err)
+	}
+	if !strings.Contains(records["web-dev"], `"success":false`) {
+		t.Errorf("expected the failed install to be recorded, got %q", records["web-dev"])
+	}
+}
+
+func TestInstallSoftwarePackDependencies(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+
+	records := make(map[string]string)
+	var installed []string
+	server.Handle(softwareRegistryHandler(records, func(script string, stdout io.Writer) int {
+		for _, id := range []string{"python-dev", "data-science"} {
+			if strings.Contains(script, "Pack "+id+" installed successfully") {
+				installed = append(installed, id)
+			}
+		}
+		return 0
+	}))
+
+	ctx := context.Background()
+	if err := installSoftwarePack(ctx, "data-science", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if got := strings.Join(installed, ","); got != "python-dev,data-science" {
+		t.Errorf("expected python-dev to install before data-science, got %s", got)
+	}
+
+	// Packs recorded as installed are skipped, except the requested pack with --force
+	installed = nil
+	if err := installSoftwarePack(ctx, "data-science", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if len(installed) != 0 {
+		t.Errorf("expected installed packs to be skipped, got %v", installed)
+	}
+	if err := installSoftwarePack(ctx, "data-science", "alice", "cs101", true); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if got := strings.Join(installed, ","); got != "data-science" {
+		t.Errorf("expected --force to reinstall only data-science, got %s", got)
+	}
+
+	// A different version on the instance doesn't satisfy the pack
+	installed = nil
+	records["python-dev"] = strings.Replace(records["python-dev"], `"version":"1.0"`, `"version":"0.9"`, 1)
+	if err := installSoftwarePack(ctx, "data-science", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if got := strings.Join(installed, ","); got != "python-dev" {
+		t.Errorf("expected only the outdated python-dev to install, got %s", got)
+	}
+}
+
+func TestInstallSoftwarePackSkipsUnrecordedPacks(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+
+	// python-dev's packages were installed before the instance had a registry
+	records := make(map[string]string)
+	var probes, installed []string
+	handler := softwareRegistryHandler(records, func(script string, stdout io.Writer) int {
+		for _, id := range []string{"python-dev", "data-science"} {
+			if strings.Contains(script, "Pack "+id+" installed successfully") {
+				installed = append(installed, id)
+			}
+		}
+		return 0
+	})
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		data, _ := io.ReadAll(stdin)
+		if installedProbe.Match(data) {
+			probes = append(probes, string(data))
+			fmt.Fprintln(stdout, "python-dev")
+			return 0
+		}
+		return handler(ctx, command, bytes.NewReader(data), stdout, stderr)
+	})
+
+	ctx := context.Background()
+	if err := installSoftwarePack(ctx, "data-science", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if got := strings.Join(installed, ","); got != "data-science" {
+		t.Errorf("expected python-dev to be skipped, got %s", got)
+	}
+	if len(probes) != 1 || !strings.Contains(probes[0], "&& echo python-dev\n") {
+		t.Errorf("expected the unrecorded packs to be probed, got %q", probes)
+	}
+
+	// Recorded packs are left to the registry
+	installed, probes = nil, nil
+	if err := installSoftwarePack(ctx, "data-science", "alice", "cs101", true); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if got := strings.Join(installed, ","); got != "data-science" {
+		t.Errorf("expected --force to reinstall only data-science, got %s", got)
+	}
+	if len(probes) != 1 || strings.Contains(probes[0], "data-science") {
+		t.Errorf("expected only python-dev to be probed, got %q", probes)
+	}
+}
+
+func TestUpgradeAndRemoveSoftwarePack(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+
+	// Everything but git is new to the instance
+	records := make(map[string]string)
+	var scripts []string
+	newPackage := regexp.MustCompile(`echo '(` + regexp.QuoteMeta(software.NewPackageMarker) + `[^']+)'`)
+	server.Handle(softwareRegistryHandler(records, func(script string, stdout io.Writer) int {
+		scripts = append(scripts, script)
+		for _, match := range newPackage.FindAllStringSubmatch(script, -1) {
+			if match[1] != software.NewPackageMarker+"git" {
+				fmt.Fprintln(stdout, match[1])
+			}
+		}
+		return 0
+	}))
+
+	ctx := context.Background()
+	if err := installSoftwarePack(ctx, "data-science", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+
+	// A new version of python-dev drops htop, pins git and changes PATH
+	original := builtinPacks["python-dev"]
+	t.Cleanup(func() { builtinPacks["python-dev"] = original })
+	upgraded := *original
+	upgraded.Version = "1.1"
+	upgraded.Packages = nil
+	for _, pkg := range original.Packages {
+		switch pkg.Name {
+		case "htop":
+			continue
+		case "git":
+			pkg.Version = "1:2.34.1-1ubuntu1"
+		}
+		upgraded.Packages = append(upgraded.Packages, pkg)
+	}
+	upgraded.Environment = map[string]string{"PATH": "/opt/python/bin:$PATH"}
+	builtinPacks["python-dev"] = &upgraded
+
+	scripts = nil
+	if err := upgradeSoftwarePack(ctx, "python-dev", "alice", "cs101", false); err != nil {
+		t.Fatalf("upgradeSoftwarePack failed: %v", err)
+	}
+	if len(scripts) != 1 {
+		t.Fatalf("expected one upgrade script, got %d", len(scripts))
+	}
+	script := scripts[0]
+	for _, want := range []string{"sudo apt-get purge -y htop\n", "sudo apt-get install -y git=1:2.34.1-1ubuntu1\n", `export PATH="/opt/python/bin:$PATH"`} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected the upgrade script to contain %q, got:\n%s", want, script)
+		}
+	}
+	for _, unchanged := range []string{"install -y python3\n", "Running pip-packages"} {
+		if strings.Contains(script, unchanged) {
+			t.Errorf("expected %q not to be applied again, got:\n%s", unchanged, script)
+		}
+	}
+	if !strings.Contains(records["python-dev"], `"version":"1.1"`) {
+		t.Errorf("expected the upgrade to be recorded, got %q", records["python-dev"])
+	}
+	if !strings.Contains(records["python-dev"], `"new_packages":["python3","python3-pip","python3-venv","python3-dev","curl","vim"]`) {
+		t.Errorf("expected only the pack's remaining new packages to be recorded, got %q", records["python-dev"])
+	}
+
+	// Upgrading again has nothing to do
+	scripts = nil
+	if err := upgradeSoftwarePack(ctx, "python-dev", "alice", "cs101", false); err != nil || len(scripts) != 0 {
+		t.Errorf("expected an up to date pack to be left alone, got %v and %d scripts", err, len(scripts))
+	}
+	if err := upgradeSoftwarePack(ctx, "web-dev", "alice", "cs101", false); err == nil || !strings.Contains(err.Error(), "is not installed") {
+		t.Errorf("expected upgrading a pack that isn't installed to fail, got %v", err)
+	}
+
+	// python-dev can't be removed from under data-science
+	err := removeSoftwarePack(ctx, "python-dev", "alice", "cs101", false)
+	if err == nil || !strings.Contains(err.Error(), "required by data-science") {
+		t.Errorf("expected removal of a dependency to be refused, got %v", err)
+	}
+
+	scripts = nil
+	if err := removeSoftwarePack(ctx, "data-science", "alice", "cs101", false); err != nil {
+		t.Fatalf("removeSoftwarePack failed: %v", err)
+	}
+	if len(scripts) != 1 || !strings.Contains(scripts[0], "sudo apt-get purge -y r-base r-base-dev\n") || !strings.Contains(scripts[0], "data-science.json") {
+		t.Errorf("expected a removal script for data-science, got %q", scripts)
+	}
+}
+
+func TestInstallContainerSoftwarePack(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+
+	records := make(map[string]string)
+	var scripts []string
+	server.Handle(softwareRegistryHandler(records, func(script string, stdout io.Writer) int {
+		scripts = append(scripts, script)
+		return 0
+	}))
+
+	builtinPacks["rstudio"] = &types.SoftwarePack{
+		ID: "rstudio", Name: "RStudio Server", Type: types.PackTypeContainer, Version: "4.3.2",
+		Container: &types.Container{
+			Image:       "rocker/rstudio:4.3.2",
+			Ports:       []string{"8787"},
+			Volumes:     []string{"~/projects:/home/rstudio/projects"},
+			Environment: map[string]string{"DISABLE_AUTH": "true"},
+		},
+	}
+	t.Cleanup(func() { delete(builtinPacks, "rstudio") })
+
+	ctx := context.Background()
+	if err := installSoftwarePack(ctx, "rstudio", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if len(scripts) != 1 || !strings.Contains(scripts[0], "sudo systemctl restart lfr-rstudio.service\n") {
+		t.Fatalf("expected the install script to start the container service, got %q", scripts)
+	}
+	if !strings.Contains(records["rstudio"], `"container":{"image":"rocker/rstudio:4.3.2"`) {
+		t.Errorf("expected the container to be recorded, got %q", records["rstudio"])
+	}
+
+	forwards, err := containerPackForwards(ctx, []string{"rstudio"})
+	if err != nil || strings.Join(forwards, ",") != "8787" {
+		t.Errorf("expected the pack's port to be forwarded, got %v and %v", forwards, err)
+	}
+	if _, err := containerPackForwards(ctx, []string{"web-dev"}); err == nil || !strings.Contains(err.Error(), "does not run a container") {
+		t.Errorf("expected a pack without a container to be refused, got %v", err)
+	}
+
+	scripts = nil
+	if err := removeSoftwarePack(ctx, "rstudio", "alice", "cs101", false); err != nil {
+		t.Fatalf("removeSoftwarePack failed: %v", err)
+	}
+	if len(scripts) != 1 || !strings.Contains(scripts[0], "sudo systemctl disable --now lfr-rstudio.service") ||
+		!strings.Contains(scripts[0], "sudo docker rmi rocker/rstudio:4.3.2") {
+		t.Errorf("expected the removal script to stop the service and remove the image, got %q", scripts)
+	}
+}
+
+func TestInstallPrefersBuiltinOverLocalCopy(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+
+	var script string
+	records := make(map[string]string)
+	server.Handle(softwareRegistryHandler(records, func(s string, stdout io.Writer) int {
+		script = s
+		return 0
+	}))
+
+	// A local file claims to be the builtin web-dev 1.0
+	home, _ := os.UserHomeDir()
+	packsDir := filepath.Join(home, ".lfr-tools", "packs")
+	if err := os.MkdirAll(packsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	local := `{"id": "web-dev", "name": "Web Development", "version": "1.0", "type": "apt",
+		"packages": [{"name": "netcat-openbsd", "source": "apt"}]}`
+	if err := os.WriteFile(filepath.Join(packsDir, "web-dev.json"), []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := loadSoftwarePacks(context.Background())
+	if err != nil {
+		t.Fatalf("loadSoftwarePacks failed: %v", err)
+	}
+	if warnings := strings.Join(index.Warnings, "; "); !strings.Contains(warnings, "web-dev 1.0 differs from the one in builtin") {
+		t.Errorf("expected the local copy to be reported, got %q", warnings)
+	}
+
+	if err := installSoftwarePack(context.Background(), "web-dev", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if !strings.Contains(script, "nodejs") || strings.Contains(script, "netcat-openbsd") {
+		t.Errorf("expected the builtin web-dev to be installed, got:\n%s", script)
+	}
+}
+
+func TestInstallRefusesPacksThatFailLint(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+
+	records := make(map[string]string)
+	server.Handle(softwareRegistryHandler(records, func(script string, stdout io.Writer) int { return 0 }))
+
+	home, _ := os.UserHomeDir()
+	packsDir := filepath.Join(home, ".lfr-tools", "packs")
+	if err := os.MkdirAll(packsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	local := `{"id": "cleanup", "name": "Cleanup", "version": "1.0", "type": "script",
+		"scripts": [{"name": "clean", "content": "rm -rf ~/"}]}`
+	if err := os.WriteFile(filepath.Join(packsDir, "cleanup.json"), []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	err := installSoftwarePack(ctx, "cleanup", "alice", "cs101", false)
+	if err == nil || !strings.Contains(err.Error(), "lint failed for cleanup") {
+		t.Fatalf("expected a pack with lint errors to be refused, got %v", err)
+	}
+	if len(server.Commands()) != 0 {
+		t.Errorf("expected nothing to run on the instance, got %v", server.Commands())
+	}
+	if err := upgradeSoftwarePack(ctx, "cleanup", "alice", "cs101", false); err == nil || !strings.Contains(err.Error(), "lint failed") {
+		t.Errorf("expected the upgrade to be refused too, got %v", err)
+	}
+
+	if err := installSoftwarePack(ctx, "cleanup", "alice", "cs101", true); err != nil {
+		t.Fatalf("installSoftwarePack with force failed: %v", err)
+	}
+	if records["cleanup"] == "" {
+		t.Error("expected --force to install the pack anyway")
+	}
+}
+
+func TestPublishAndInstallPinnedSoftwarePack(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+
+	records := make(map[string]string)
+	server.Handle(softwareRegistryHandler(records, func(script string, stdout io.Writer) int { return 0 }))
+
+	setViper(t, "packs.s3_bucket", "lfr-packs")
+	cloud.S3.PutObjectData("lfr-packs", "README", []byte("Vetted software packs"))
+
+	// Two versions of a pack are published to the shared catalog
+	dir := t.TempDir()
+	ctx := context.Background()
+	for _, version := range []string{"1.0", "1.1"} {
+		path := filepath.Join(dir, "stats-"+version+".yaml")
+		pack := "id: stats\nname: Statistics\nversion: \"" + version + "\"\ncategory: data-science\npackages:\n  - name: r-base\n    source: apt\n"
+		if err := os.WriteFile(path, []byte(pack), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := publishSoftwarePack(ctx, path, "", "", false); err != nil {
+			t.Fatalf("publishSoftwarePack %s failed: %v", version, err)
+		}
+	}
+	if _, ok := cloud.S3.ObjectData("lfr-packs", "packs/stats/1.1.json"); !ok {
+		t.Fatalf("expected stats 1.1 to be published, got keys %v", cloud.S3.Keys("lfr-packs"))
+	}
+	if err := publishSoftwarePack(ctx, filepath.Join(dir, "stats-1.1.yaml"), "", "", false); err == nil || !strings.Contains(err.Error(), "already published") {
+		t.Errorf("expected republishing a version to be refused, got %v", err)
+	}
+
+	// A local pack pins the older version
+	home, _ := os.UserHomeDir()
+	packsDir := filepath.Join(home, ".lfr-tools", "packs")
+	if err := os.MkdirAll(packsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	local := `{"id": "lab-tools", "name": "Lab Tools", "version": "1.0", "dependencies": ["stats@1.0"]}`
+	if err := os.WriteFile(filepath.Join(packsDir, "lab-tools.json"), []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	out, _ := output.NewRenderer(&buf, output.Options{Format: output.FormatJSON})
+	if err := searchSoftwarePacks(ctx, "statistics", true, out); err != nil {
+		t.Fatalf("searchSoftwarePacks failed: %v", err)
+	}
+	var entries []software.Entry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to parse search results: %v\n%s", err, buf.String())
+	}
+	if len(entries) != 2 || entries[0].Pack.Version != "1.1" || entries[0].Catalog != "s3://lfr-packs/packs/" {
+		t.Errorf("expected both published versions, newest first, got %s", buf.String())
+	}
+
+	if err := installSoftwarePack(ctx, "lab-tools", "alice", "cs101", false); err != nil {
+		t.Fatalf("installSoftwarePack failed: %v", err)
+	}
+	if !strings.Contains(records["stats"], `"version":"1.0"`) || records["lab-tools"] == "" {
+		t.Errorf("expected the pinned stats 1.0 to be installed with lab-tools, got %v", records)
+	}
+
+	err := installSoftwarePack(ctx, "stats@2.0", "alice", "cs101", false)
+	if err == nil || !strings.Contains(err.Error(), "stats has no version 2.0 (available: 1.1, 1.0)") {
+		t.Errorf("expected an unknown version to list the available ones, got %v", err)
+	}
+}
+func TestShowSoftwareStatusReadsRegistry(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+
+	records := map[string]string{
+		"python-dev": `{"pack_id":"python-dev","version":"1.0","success":true,"message":"Installation completed","duration":"42s","installed_at":"2024-01-15T10:00:00Z","packages_installed":["python3","git"]}`,
+		"gpu-ml":     `{"pack_id":"gpu-ml","version":"1.0","success":false,"message":"installation script exited with status 1","duration":"3s","installed_at":"2024-01-15T10:05:00Z","packages_installed":null}`,
+	}
+	server.Handle(softwareRegistryHandler(records, func(script string, stdout io.Writer) int { return 0 }))
+
+	var buf bytes.Buffer
+	out, _ := output.NewRenderer(&buf, output.Options{Format: output.FormatJSON})
+	if err := showSoftwareStatus(context.Background(), "alice", "cs101", out); err != nil {
+		t.Fatalf("showSoftwareStatus failed: %v", err)
+	}
+
+	var got []types.InstallResult
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse status output %q: %v", buf.String(), err)
+	}
+	if len(got) != 2 || got[0].PackID != "gpu-ml" || got[1].PackID != "python-dev" {
+		t.Fatalf("expected both records sorted by pack ID, got %+v", got)
+	}
+	if got[0].Success || !got[1].Success || strings.Join(got[1].Packages, ",") != "python3,git" {
+		t.Errorf("expected the records' results and packages, got %+v", got)
+	}
+
+	if err := listSoftwarePacks(context.Background(), "", true, "alice", "cs101"); err != nil {
+		t.Errorf("listSoftwarePacks --installed failed: %v", err)
+	}
+}
+
+func TestMountEFSOverSSH(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("bob-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "stopped")
+	server, _ := useSSHServer(t, cloud)
+
+	var scripts []string
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		data, _ := io.ReadAll(stdin)
+		scripts = append(scripts, string(data))
+		return 0
+	})
+
+	ctx := context.Background()
+	fs, err := cloud.EFS.CreateFileSystem(ctx, &efs.CreateFileSystemInput{})
+	if err != nil {
+		t.Fatalf("CreateFileSystem failed: %v", err)
+	}
+	target, err := cloud.EFS.CreateMountTarget(ctx, &efs.CreateMountTargetInput{FileSystemId: fs.FileSystemId, SubnetId: awssdk.String("subnet-1")})
+	if err != nil {
+		t.Fatalf("CreateMountTarget failed: %v", err)
+	}
+	fsID, mountIP := awssdk.ToString(fs.FileSystemId), awssdk.ToString(target.IpAddress)
+
+	if err := mountEFSOnInstance(ctx, fsID, "alice", "/mnt/shared", "cs101", "ro"); err != nil {
+		t.Fatalf("mountEFSOnInstance failed: %v", err)
+	}
+	if got := strings.Join(server.Commands(), ","); got != "sudo -n bash -s" {
+		t.Errorf("expected the mount script to run as root, got %s", got)
+	}
+	expected := fmt.Sprintf("mount -t nfs4 -o nfsvers=4.1,rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2,ro '%s:/' '/mnt/shared'", mountIP)
+	if len(scripts) != 1 || !strings.Contains(scripts[0], expected) {
+		t.Errorf("expected the script to mount %s read-only, got %q", mountIP, scripts)
+	}
+
+	// Stopped instances are skipped
+	if err := mountEFSOnAllInstances(ctx, fsID, "cs101", "/mnt/shared", "rw", false); err != nil {
+		t.Fatalf("mountEFSOnAllInstances failed: %v", err)
+	}
+	if len(scripts) != 2 || strings.Contains(scripts[1], ",ro") {
+		t.Errorf("expected one read-write mount on alice's instance, got %q", scripts)
+	}
+}
+
+func TestExecOnInstancesWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("bob-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("carol-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "stopped")
+	server, hosts := useSSHServer(t, cloud)
+
+	var mu sync.Mutex
+	exitCode := 0
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		fmt.Fprintln(stdout, "ok")
+		mu.Lock()
+		defer mu.Unlock()
+		return exitCode
+	})
+
+	ctx := context.Background()
+	opts := execOptions{Parallel: 4, Timeout: time.Minute}
+
+	// Stopped instances are skipped
+	if err := execOnInstances(ctx, "cs101", nil, "uptime", opts); err != nil {
+		t.Fatalf("execOnInstances failed: %v", err)
+	}
+	if got := len(server.Commands()); got != 2 {
+		t.Errorf("expected the command to run on 2 running instances, got %d", got)
+	}
+
+	// --users limits the instances and --sudo wraps the command
+	opts.Sudo = true
+	if err := execOnInstances(ctx, "cs101", []string{"bob"}, "whoami", opts); err != nil {
+		t.Fatalf("execOnInstances with users failed: %v", err)
+	}
+	commands := server.Commands()
+	if got := commands[len(commands)-1]; got != "sudo -n sh -c 'whoami'" {
+		t.Errorf("expected a sudo command, got %q", got)
+	}
+	if got := (*hosts)[len(*hosts)-1]; !strings.HasPrefix(got, "ubuntu@203.0.113.") {
+		t.Errorf("unexpected connection %s", got)
+	}
+
+	// --start starts carol's instance first, and failures are summarised
+	opts.Sudo = false
+	opts.Start = true
+	mu.Lock()
+	exitCode = 2
+	mu.Unlock()
+	err := execOnInstances(ctx, "cs101", nil, "false", opts)
+	if err == nil || !strings.Contains(err.Error(), "failed on 3 of 3 instances") {
+		t.Errorf("expected the command to fail on all 3 instances, got %v", err)
+	}
+	if got := len(server.Commands()); got != 6 {
+		t.Errorf("expected 6 commands in total, got %d", got)
+	}
+}
+
+func TestFindUserInstance(t *testing.T) {
+	instances := []*types.Instance{{Name: "bob-smith-ubuntu_22_04"}, {Name: "bob-ubuntu_22_04"}, {Name: "alice-ubuntu_22_04"}}
+	usernames := []string{"alice", "bob", "bob-smith"}
+
+	tests := map[string]string{"bob": "bob-ubuntu_22_04", "bob-smith": "bob-smith-ubuntu_22_04", "alice": "alice-ubuntu_22_04", "carol": ""}
+	for username, want := range tests {
+		got := ""
+		if instance := findUserInstance(instances, username, usernames); instance != nil {
+			got = instance.Name
+		}
+		if got != want {
+			t.Errorf("findUserInstance(%q) = %q, want %q", username, got, want)
+		}
+	}
+
+	// bob doesn't get bob-smith's instance when he has none
+	if instance := findUserInstance(instances[:1], "bob", usernames); instance != nil {
+		t.Errorf("expected no instance for bob, got %s", instance.Name)
+	}
+	// A user IAM doesn't list yet still finds their instance
+	if instance := findUserInstance(instances, "alice", nil); instance == nil || instance.Name != "alice-ubuntu_22_04" {
+		t.Errorf("expected alice's instance, got %+v", instance)
+	}
+
+	// Of a stopped original and its running resize, the running one is found
+	twins := []*types.Instance{{Name: "bob-ubuntu_22_04", State: "stopped"}, {Name: "bob-ubuntu_22_04-resized", State: "running"}}
+	if instance := findUserInstance(twins, "bob", usernames); instance == nil || instance.Name != "bob-ubuntu_22_04-resized" {
+		t.Errorf("expected bob's running instance, got %+v", instance)
+	}
+	if got := ownedInstances(append(instances, twins[1]), []string{"bob"}, usernames); len(got) != 2 || got[0].Name != "bob-ubuntu_22_04" || got[1].Name != "bob-ubuntu_22_04-resized" {
+		t.Errorf("expected bob's two instances, got %+v", got)
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var mu sync.Mutex
+	w := newPrefixWriter(&out, &mu, "alice | ")
+
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthree"))
+	if out.String() != "alice | one\nalice | two\n" {
+		t.Errorf("expected complete lines only, got %q", out.String())
+	}
+
+	w.Flush()
+	if out.String() != "alice | one\nalice | two\nalice | three\n" {
+		t.Errorf("expected the partial line after Flush, got %q", out.String())
+	}
+}
+
+func TestPushAndCollectFilesWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("bob-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("bob-smith-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("carol-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "stopped")
+	_, hosts := useSSHServer(t, cloud)
+
+	ctx := context.Background()
+	// carol has no IAM user
+	for _, user := range []string{"alice", "bob", "bob-smith"} {
+		if _, err := aws.NewIAMService(&aws.Client{IAM: cloud.IAM}).CreateUser(ctx, user, "", ""); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+
+	local := filepath.Join(t.TempDir(), "hw1")
+	if err := os.MkdirAll(filepath.Join(local, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(local, "README.md"), []byte("# Homework 1\n"), 0644)
+	os.WriteFile(filepath.Join(local, "data", "input.csv"), []byte("a,b\n1,2\n"), 0644)
+
+	if err := pushFiles(ctx, "cs101", nil, local, "~/hw1", false, 2); err != nil {
+		t.Fatalf("pushFiles failed: %v", err)
+	}
+	if len(*hosts) != 3 {
+		t.Errorf("expected pushes to 3 running instances, got %v", *hosts)
+	}
+
+	// The test server shares one filesystem between instances, so every
+	// user collects what was pushed
+	into := filepath.Join(t.TempDir(), "submissions")
+	if err := collectFiles(ctx, "cs101", nil, "hw1", into, 2); err != nil {
+		t.Fatalf("collectFiles failed: %v", err)
+	}
+	for _, user := range []string{"alice", "bob", "bob-smith"} {
+		data, err := os.ReadFile(filepath.Join(into, user, "hw1", "data", "input.csv"))
+		if err != nil || string(data) != "a,b\n1,2\n" {
+			t.Errorf("expected %s's collected file, got %q (%v)", user, data, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(into, manifestFileName))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var manifest transfer.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, entry := range manifest.Users {
+		statuses[entry.User] = entry.Status
+		if entry.Status == transfer.StatusCollected && len(entry.Files) != 2 {
+			t.Errorf("expected 2 files for %s, got %+v", entry.User, entry.Files)
+		}
+	}
+	expected := map[string]string{
+		"alice":              transfer.StatusCollected,
+		"bob":                transfer.StatusCollected,
+		"bob-smith":          transfer.StatusCollected,
+		"carol-ubuntu_22_04": transfer.StatusSkipped,
+	}
+	for user, status := range expected {
+		if statuses[user] != status {
+			t.Errorf("expected %s to be %s, got %q", user, status, statuses[user])
+		}
+	}
+
+	// Nothing to collect is recorded, not an error
+	missing := filepath.Join(t.TempDir(), "missing")
+	if err := collectFiles(ctx, "cs101", []string{"alice"}, "hw2", missing, 2); err != nil {
+		t.Fatalf("collectFiles of a missing path failed: %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(missing, manifestFileName))
+	if !strings.Contains(string(data), `"status": "missing"`) {
+		t.Errorf("expected alice to be missing, got %s", data)
+	}
+}
+
+func TestPerUserSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"al", "alice", "bob"} {
+		os.MkdirAll(filepath.Join(dir, name), 0755)
+	}
+	os.WriteFile(filepath.Join(dir, "carol"), nil, 0644)
+
+	tests := map[string]string{
+		"alice-ubuntu_22_04": filepath.Join(dir, "alice"),
+		"al-ubuntu_22_04":    filepath.Join(dir, "al"),
+		"bob-ubuntu_22_04":   filepath.Join(dir, "bob"),
+		"carol-ubuntu_22_04": "",
+	}
+	for instance, expected := range tests {
+		if got := perUserSource(dir, instance); got != expected {
+			t.Errorf("perUserSource(%q) = %q, expected %q", instance, got, expected)
+		}
+	}
+}
+
+// freePort returns a loopback port that is free at the time of the call.
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestTunnelWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("bob-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "stopped")
+	server, _ := useSSHServer(t, cloud)
+
+	// A service on the "instance"
+	service, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer service.Close()
+	go func() {
+		for {
+			conn, err := service.Accept()
+			if err != nil {
+				return
+			}
+			io.WriteString(conn, "jupyter\n")
+			conn.Close()
+		}
+	}()
+	servicePort := strconv.Itoa(service.Addr().(*net.TCPAddr).Port)
+
+	localPort := freePort(t)
+	spec, err := parseTunnelSpec("alice", "cs101", []string{"127.0.0.1:" + localPort + ":localhost:" + servicePort}, "")
+	if err != nil {
+		t.Fatalf("parseTunnelSpec failed: %v", err)
+	}
+	if spec.ID != "alice-"+localPort {
+		t.Errorf("unexpected tunnel ID %s", spec.ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runTunnel(ctx, spec) }()
+
+	// The tunnel is registered once its forwards are up
+	var tunnels []*tunnelState
+	for i := 0; i < 50 && len(tunnels) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		tunnels, _ = loadTunnels()
+	}
+	if len(tunnels) != 1 || tunnels[0].PID != os.Getpid() || tunnels[0].Instance != "alice-ubuntu_22_04" {
+		t.Fatalf("expected the tunnel to be registered, got %+v", tunnels)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+localPort)
+	if err != nil {
+		t.Fatalf("failed to connect through the tunnel: %v", err)
+	}
+	data, _ := io.ReadAll(conn)
+	conn.Close()
+	if string(data) != "jupyter\n" {
+		t.Errorf("unexpected data through the tunnel %q", data)
+	}
+	if forwards := server.Forwards(); len(forwards) != 1 || forwards[0] != "localhost:"+servicePort {
+		t.Errorf("unexpected forwards %v", forwards)
+	}
+
+	// A second tunnel with the same ID is refused
+	if err := runTunnel(context.Background(), spec); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("expected a duplicate tunnel to fail, got %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected the tunnel to close cleanly, got %v", err)
+	}
+	if tunnels, _ := loadTunnels(); len(tunnels) != 0 {
+		t.Errorf("expected the tunnel to be unregistered, got %+v", tunnels)
+	}
+
+	// Stopped instances can't be tunnelled to
+	spec, _ = parseTunnelSpec("bob", "cs101", []string{freePort(t)}, "")
+	if err := runTunnel(context.Background(), spec); err == nil || !strings.Contains(err.Error(), "stopped") {
+		t.Errorf("expected a stopped instance to fail, got %v", err)
+	}
+}
+
+func TestParseTunnelSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		forwards []string
+		socks    string
+		id       string
+		wantErr  bool
+	}{
+		{name: "single forward", forwards: []string{"8888"}, id: "alice-8888"},
+		{name: "several forwards", forwards: []string{"9000:8787", "8888"}, id: "alice-9000"},
+		{name: "socks only", socks: "1080", id: "alice-1080"},
+		{name: "socks with bind address", socks: "0.0.0.0:1080", id: "alice-1080"},
+		{name: "socks on IPv6", socks: "[::1]:1080", id: "alice-1080"},
+		{name: "IPv6 forward", forwards: []string{"[::1]:8888:localhost:8888"}, id: "alice-8888"},
+		{name: "nothing to forward", wantErr: true},
+		{name: "bad forward", forwards: []string{"jupyter"}, wantErr: true},
+		{name: "bad socks port", socks: "socks", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseTunnelSpec("alice", "", tt.forwards, tt.socks)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTunnelSpec failed: %v", err)
+			}
+			if spec.ID != tt.id {
+				t.Errorf("expected ID %s, got %s", tt.id, spec.ID)
+			}
+		})
+	}
+}
+
+func TestCloseTunnelsRemovesStaleState(t *testing.T) {
+	useFakeCloud(t)
+
+	// A tunnel whose process has exited
+	finished := exec.Command(os.Args[0], "-test.run=^$")
+	if err := finished.Run(); err != nil {
+		t.Fatalf("failed to run a process: %v", err)
+	}
+	if err := saveTunnel(&tunnelState{ID: "alice-8888", PID: finished.Process.Pid, User: "alice"}); err != nil {
+		t.Fatalf("saveTunnel failed: %v", err)
+	}
+
+	tunnels, err := loadTunnels()
+	if err != nil {
+		t.Fatalf("loadTunnels failed: %v", err)
+	}
+	if len(tunnels) != 0 {
+		t.Errorf("expected the stale tunnel to be dropped, got %+v", tunnels)
+	}
+	if _, err := readTunnel("alice-8888"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the stale state file to be removed, got %v", err)
+	}
+
+	if err := closeTunnels([]string{"alice"}, false); err != nil {
+		t.Errorf("closing a missing tunnel should not fail, got %v", err)
+	}
+}
+
+func TestCloseTunnelsChecksProcessIdentity(t *testing.T) {
+	useFakeCloud(t)
+
+	started, err := processStartTime(os.Getpid())
+	if err != nil || started == "" {
+		t.Fatalf("processStartTime failed: %q, %v", started, err)
+	}
+
+	// A tunnel whose PID now belongs to another process is dropped
+	if err := saveTunnel(&tunnelState{ID: "alice-8888", PID: os.Getpid(), ProcessStart: "1", User: "alice"}); err != nil {
+		t.Fatalf("saveTunnel failed: %v", err)
+	}
+	if tunnels, _ := loadTunnels(); len(tunnels) != 0 {
+		t.Errorf("expected a tunnel with a reused PID to be dropped, got %+v", tunnels)
+	}
+
+	// Without a start time the process can't be confirmed, so it isn't signalled
+	if err := saveTunnel(&tunnelState{ID: "bob-8888", PID: os.Getpid(), User: "bob"}); err != nil {
+		t.Fatalf("saveTunnel failed: %v", err)
+	}
+	if err := closeTunnels([]string{"bob"}, false); err == nil {
+		t.Error("expected closing an unconfirmed tunnel to fail")
+	}
+	if _, err := readTunnel("bob-8888"); err != nil {
+		t.Errorf("expected the unconfirmed tunnel's state to be kept, got %v", err)
+	}
+}
+
+func TestGenerateSSHConfigWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "bio101", "running")
+	cloud.Lightsail.AddInstance("bob-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "bio101", "stopped")
+	cloud.Lightsail.AddInstance("carol-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	ctx := context.Background()
+	for _, user := range []string{"alice", "bob", "carol"} {
+		if _, err := aws.NewIAMService(&aws.Client{IAM: cloud.IAM}).CreateUser(ctx, user, "", ""); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+
+	if err := generateSSHConfig(ctx, "bio101", "", []string{"8888"}, true); err != nil {
+		t.Fatalf("generateSSHConfig failed: %v", err)
+	}
+
+	home, _ := os.UserHomeDir()
+	configPath := filepath.Join(home, ".ssh", "config.d", "lfr-tools")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to read generated config: %v", err)
+	}
+	content := string(data)
+	for _, expected := range []string{
+		"Host alice-bio101\n    # alice-ubuntu_22_04\n    HostName 203.0.113.",
+		"IdentityFile " + filepath.Join(home, ".ssh", "lfr-tools", "LightsailDefaultKey.pem"),
+		"LocalForward localhost:8888 localhost:8888",
+		"UserKnownHostsFile " + filepath.Join(home, ".lfr-tools", "known_hosts", "bio101"),
+		"Host bob-bio101\n    # bob-ubuntu_22_04 is not running",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("expected config to contain %q, got:\n%s", expected, content)
+		}
+	}
+	if strings.Contains(content, "carol") {
+		t.Error("expected only bio101's instances")
+	}
+
+	userConfig, _ := os.ReadFile(filepath.Join(home, ".ssh", "config"))
+	if !strings.Contains(string(userConfig), "Include "+configPath) {
+		t.Errorf("expected ~/.ssh/config to include the generated config, got %q", userConfig)
+	}
+
+	// Starting bob gives his Host block an address and keeps the forwards
+	if err := startInstances(ctx, []string{"bob"}, "bio101", true, 2); err != nil {
+		t.Fatalf("startInstances failed: %v", err)
+	}
+	data, _ = os.ReadFile(configPath)
+	if !strings.Contains(string(data), "Host bob-bio101\n    # bob-ubuntu_22_04\n    HostName 203.0.113.") {
+		t.Errorf("expected bob's host to be updated on start, got:\n%s", data)
+	}
+	if strings.Count(string(data), "LocalForward localhost:8888") != 2 {
+		t.Errorf("expected the forwards to be kept, got:\n%s", data)
+	}
+
+	// Stopping alice removes her address
+	if err := stopInstances(ctx, []string{"alice"}, "bio101", true, 2); err != nil {
+		t.Fatalf("stopInstances failed: %v", err)
+	}
+	data, _ = os.ReadFile(configPath)
+	if !strings.Contains(string(data), "# alice-ubuntu_22_04 is not running") {
+		t.Errorf("expected alice's host to be updated on stop, got:\n%s", data)
+	}
+
+	// Projects without a section are not added by start/stop
+	if err := stopInstances(ctx, []string{"carol"}, "cs101", true, 2); err != nil {
+		t.Fatalf("stopInstances failed: %v", err)
+	}
+	data, _ = os.ReadFile(configPath)
+	if strings.Contains(string(data), "cs101") {
+		t.Errorf("expected cs101 not to be added, got:\n%s", data)
+	}
+}
+
+func TestGenerateSSHConfigWithOverlappingNames(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "bio101", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice", "bob", "bob-smith"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	// alice's resize is kept alongside the stopped original, and bob has a
+	// stopped copy of his instance
+	if err := resizeInstance(ctx, "alice-ubuntu_22_04", "up", true, false, false); err != nil {
+		t.Fatalf("resizeInstance failed: %v", err)
+	}
+	cloud.Lightsail.AddInstance("bob-copy", "ubuntu_22_04", "app_standard_xl_1_0", "bio101", "stopped")
+
+	outputPath := filepath.Join(t.TempDir(), "config")
+	if err := generateSSHConfig(ctx, "bio101", outputPath, nil, false); err != nil {
+		t.Fatalf("generateSSHConfig failed: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read generated config: %v", err)
+	}
+	content := string(data)
+
+	home, _ := os.UserHomeDir()
+	keyDir := filepath.Join(home, ".ssh", "lfr-tools")
+	for _, expected := range []string{
+		"Host alice-bio101\n    # alice-ubuntu_22_04-resized\n",
+		"Host bob-bio101\n    # bob-ubuntu_22_04\n",
+		"Host bob-copy-bio101\n    # bob-copy is not running",
+		"Host bob-smith-bio101\n    # bob-smith-ubuntu_22_04\n",
+		"IdentityFile " + filepath.Join(keyDir, "lfr-bob-smith.pem"),
+		"HostKeyAlias bob-smith-ubuntu_22_04\n",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("expected config to contain %q, got:\n%s", expected, content)
+		}
+	}
+	if strings.Contains(content, "# alice-ubuntu_22_04\n") || strings.Contains(content, "# alice-ubuntu_22_04 is not running") {
+		t.Errorf("expected alice's replaced instance to be left out, got:\n%s", content)
+	}
+	if strings.Count(content, "Host bob-bio101\n") != 1 {
+		t.Errorf("expected one Host block for bob, got:\n%s", content)
+	}
+}
+
+func TestHostKeyPinningWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	cloud.Lightsail.AddInstance("alice-smith-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+	server, _ := useSSHServer(t, cloud)
+	ctx := context.Background()
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		t.Fatalf("newAWSClient failed: %v", err)
+	}
+	lightsailService := aws.NewLightsailService(awsClient)
+	instance, err := lightsailService.GetInstance(ctx, "alice-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("GetInstance failed: %v", err)
+	}
+
+	store, err := hostkeys.NewStore()
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	connect := func() error {
+		client, err := connectInstance(ctx, lightsailService, instance)
+		if err != nil {
+			return err
+		}
+		return client.Close()
+	}
+
+	// With no keys from Lightsail the first connection pins the host's key
+	if err := connect(); err != nil {
+		t.Fatalf("first connection failed: %v", err)
+	}
+	keys, _ := store.Keys("cs101", "alice-ubuntu_22_04")
+	if len(keys) != 1 || hostkeys.Format(keys[0]) != hostkeys.Format(server.HostKey) {
+		t.Fatalf("expected the server's key to be pinned, got %v", keys)
+	}
+
+	// A host presenting a different key is refused
+	other, _, _ := ed25519.GenerateKey(nil)
+	otherKey, _ := gossh.NewPublicKey(other)
+	if err := store.Pin("cs101", "alice-ubuntu_22_04", []gossh.PublicKey{otherKey}); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+	if err := connect(); !errors.Is(err, hostkeys.ErrMismatch) {
+		t.Fatalf("expected a host key mismatch, got %v", err)
+	}
+
+	// Instances are pinned by name, so alice-smith's isn't checked against alice's
+	otherInstance, err := lightsailService.GetInstance(ctx, "alice-smith-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("GetInstance failed: %v", err)
+	}
+	client, err := connectInstance(ctx, lightsailService, otherInstance)
+	if err != nil {
+		t.Fatalf("expected alice-smith's instance to be pinned separately, got %v", err)
+	}
+	client.Close()
+
+	// Keys reported by Lightsail replace stale pins, as after a restore
+	cloud.Lightsail.SetHostKey(hostkeys.Format(server.HostKey))
+	if err := connect(); err != nil {
+		t.Fatalf("connection with reported keys failed: %v", err)
+	}
+	keys, _ = store.Keys("cs101", "alice-ubuntu_22_04")
+	if len(keys) != 1 || hostkeys.Format(keys[0]) != hostkeys.Format(server.HostKey) {
+		t.Errorf("expected the reported key to be pinned, got %v", keys)
+	}
+
+	// ...but a host presenting a key Lightsail doesn't report is refused
+	cloud.Lightsail.SetHostKey(hostkeys.Format(otherKey))
+	if err := connect(); !errors.Is(err, hostkeys.ErrMismatch) {
+		t.Errorf("expected a host key mismatch, got %v", err)
+	}
+
+	// Refreshing after a resize or restore pins the reported keys
+	refreshHostKeys(ctx, lightsailService, instance)
+	keys, _ = store.Keys("cs101", "alice-ubuntu_22_04")
+	if len(keys) != 1 || hostkeys.Format(keys[0]) != hostkeys.Format(otherKey) {
+		t.Errorf("expected the refreshed key to be pinned, got %v", keys)
+	}
+
+	// Students pin the keys in their status record under the same alias
+	status := &aws.StudentStatus{InstanceName: instance.Name, HostKeys: []string{hostkeys.Format(server.HostKey)}}
+	if _, alias, err := pinStatusHostKeys("cs101", "alice", status); err != nil || alias != "alice-ubuntu_22_04" {
+		t.Errorf("expected the status keys pinned as alice-ubuntu_22_04, got %q (%v)", alias, err)
+	}
+	keys, _ = store.Keys("cs101", "alice-ubuntu_22_04")
+	if len(keys) != 1 || hostkeys.Format(keys[0]) != hostkeys.Format(server.HostKey) {
+		t.Errorf("expected the status key to be pinned, got %v", keys)
+	}
+}
+
+func TestRotateUserKeyWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "bio101", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	server, hosts := useSSHServer(t, cloud)
+
+	// Keys added to authorized_keys are accepted
+	var mu sync.Mutex
+	var script string
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		data, _ := io.ReadAll(stdin)
+		mu.Lock()
+		script = string(data)
+		mu.Unlock()
+		if m := regexp.MustCompile(`echo '(.*)' >>`).FindStringSubmatch(script); m != nil {
+			key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(m[1]))
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			server.AuthorizeKey(key)
+		}
+		return 0
+	})
+
+	home, _ := os.UserHomeDir()
+	keyPath := filepath.Join(home, ".ssh", "lfr-tools", "lfr-alice.pem")
+	oldKey, _ := os.ReadFile(keyPath)
+	oldPublic, err := publicKeyOf(oldKey)
+	if err != nil {
+		t.Fatalf("failed to parse alice's key: %v", err)
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "tokens")
+	if err := rotateUserKey(ctx, "bio101", "alice", outputDir); err != nil {
+		t.Fatalf("rotateUserKey failed: %v", err)
+	}
+	if got := len(*hosts); got != 2 {
+		t.Errorf("expected the new key to log in before the old one is revoked, got %d connections", got)
+	}
+
+	newKey, _ := os.ReadFile(keyPath)
+	if bytes.Equal(oldKey, newKey) {
+		t.Fatal("expected alice's key to be replaced")
+	}
+	newPublic, err := publicKeyOf(newKey)
+	if err != nil {
+		t.Fatalf("failed to parse the new key: %v", err)
+	}
+
+	// The old key is revoked and the new one authorized on the instance
+	mu.Lock()
+	defer mu.Unlock()
+	oldBlob := strings.Fields(string(gossh.MarshalAuthorizedKey(oldPublic)))[1]
+	if !strings.Contains(script, "grep -v -F -e '"+oldBlob+"'") {
+		t.Errorf("expected the old key to be removed, got:\n%s", script)
+	}
+	if !strings.Contains(script, strings.TrimSpace(string(gossh.MarshalAuthorizedKey(newPublic)))+" lfr-alice") {
+		t.Errorf("expected the new key to be added, got:\n%s", script)
+	}
+	if got := strings.Join(cloud.Lightsail.KeyPairNames(), ","); got != "lfr-alice" {
+		t.Errorf("expected alice's key pair to be replaced, got %s", got)
+	}
+	keyPair, _ := cloud.Lightsail.KeyPair("lfr-alice")
+	if got := awssdk.ToString(keyPair.Fingerprint); got != gossh.FingerprintLegacyMD5(newPublic) {
+		t.Errorf("expected the key pair to hold the new key, got fingerprint %s", got)
+	}
+	if len(keyPair.Tags) != 1 || awssdk.ToString(keyPair.Tags[0].Value) != "bio101" {
+		t.Errorf("expected the key pair to keep its project tag, got %+v", keyPair.Tags)
+	}
+
+	// The re-issued token carries only alice's new key
+	data, err := os.ReadFile(filepath.Join(outputDir, "bio101-alice.json"))
+	if err != nil {
+		t.Fatalf("expected a re-issued token: %v", err)
+	}
+	var token config.StudentToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	if token.SSHKeyData != string(newKey) || token.Username != "alice" || token.Project != "bio101" {
+		t.Errorf("unexpected token %+v", token)
+	}
+}
+
+func TestRotateUserKeyFinishesOnRerun(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "bio101", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	server, _ := useSSHServer(t, cloud)
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		data, _ := io.ReadAll(stdin)
+		if m := regexp.MustCompile(`echo '(.*)' >>`).FindSubmatch(data); m != nil {
+			key, _, _, _, err := gossh.ParseAuthorizedKey(m[1])
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			server.AuthorizeKey(key)
+		}
+		return 0
+	})
+
+	// The key pair can't be re-imported after the instance is rotated
+	cloud.FailWhen("ImportKeyPair", func(params interface{}) error {
+		return errors.New("throttled")
+	})
+	outputDir := filepath.Join(t.TempDir(), "tokens")
+	err := rotateUserKey(ctx, "bio101", "alice", outputDir)
+	if err == nil || !strings.Contains(err.Error(), "lfr-alice") || !strings.Contains(err.Error(), "rerun 'lfr ssh keys rotate --user alice -p bio101'") {
+		t.Fatalf("expected the failed import to say how to finish the rotation, got %v", err)
+	}
+
+	// Rotating again finishes it
+	cloud.ClearFailures()
+	if err := rotateUserKey(ctx, "bio101", "alice", outputDir); err != nil {
+		t.Fatalf("rotateUserKey failed: %v", err)
+	}
+	home, _ := os.UserHomeDir()
+	key, _ := os.ReadFile(filepath.Join(home, ".ssh", "lfr-tools", "lfr-alice.pem"))
+	public, err := publicKeyOf(key)
+	if err != nil {
+		t.Fatalf("failed to parse alice's key: %v", err)
+	}
+	keyPair, ok := cloud.Lightsail.KeyPair("lfr-alice")
+	if !ok || awssdk.ToString(keyPair.Fingerprint) != gossh.FingerprintLegacyMD5(public) {
+		t.Errorf("expected the key pair to hold alice's saved key, got %+v", keyPair)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "bio101-alice.json")); err != nil {
+		t.Errorf("expected a re-issued token: %v", err)
+	}
+}
+
+func TestRotateUserKeyKeepsOldKeyWhenNewKeyFails(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "bio101", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	server, _ := useSSHServer(t, cloud)
+
+	// authorized_keys is updated, but the new key is never accepted
+	var mu sync.Mutex
+	var scripts []string
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		data, _ := io.ReadAll(stdin)
+		mu.Lock()
+		scripts = append(scripts, string(data))
+		mu.Unlock()
+		return 0
+	})
+
+	home, _ := os.UserHomeDir()
+	keyPath := filepath.Join(home, ".ssh", "lfr-tools", "lfr-alice.pem")
+	oldKey, _ := os.ReadFile(keyPath)
+	before, _ := cloud.Lightsail.KeyPair("lfr-alice")
+
+	outputDir := filepath.Join(t.TempDir(), "tokens")
+	err := rotateUserKey(ctx, "bio101", "alice", outputDir)
+	if err == nil || !strings.Contains(err.Error(), "new key was not accepted") {
+		t.Fatalf("expected the new key's login to fail, got %v", err)
+	}
+
+	if key, _ := os.ReadFile(keyPath); !bytes.Equal(key, oldKey) {
+		t.Error("expected alice's old key to be kept")
+	}
+	if _, err := os.Stat(keyPath + ".new"); !os.IsNotExist(err) {
+		t.Errorf("expected the new key to be removed, got %v", err)
+	}
+	after, ok := cloud.Lightsail.KeyPair("lfr-alice")
+	if !ok || awssdk.ToString(after.Fingerprint) != awssdk.ToString(before.Fingerprint) {
+		t.Errorf("expected alice's key pair to be kept, got %+v", after)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "bio101-alice.json")); !os.IsNotExist(err) {
+		t.Errorf("expected no token to be issued, got %v", err)
+	}
+
+	// The new key was added, then removed without revoking the old one
+	mu.Lock()
+	defer mu.Unlock()
+	if len(scripts) != 2 || !strings.Contains(scripts[0], "echo ") || strings.Contains(scripts[1], "echo ") {
+		t.Fatalf("expected the new key to be added and then removed, got %q", scripts)
+	}
+	oldPublic, _ := publicKeyOf(oldKey)
+	if oldBlob := strings.Fields(string(gossh.MarshalAuthorizedKey(oldPublic)))[1]; strings.Contains(strings.Join(scripts, ""), oldBlob) {
+		t.Errorf("expected the old key not to be revoked, got %q", scripts)
+	}
+}
+
+func TestListSSHKeysWithFakeCloud(t *testing.T) {
+	cloud := useFakeCloud(t)
+	ctx := context.Background()
+
+	if err := createUsers(ctx, "bio101", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1", []string{"alice"}); err != nil {
+		t.Fatalf("createUsers failed: %v", err)
+	}
+	cloud.Lightsail.AddInstance("bob-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "bio101", "running")
+	cloud.Lightsail.AddInstance("carol-ubuntu_22_04", "ubuntu_22_04", "small_3_0", "cs101", "running")
+
+	// A leftover key other users can read
+	home, _ := os.UserHomeDir()
+	keyDir := filepath.Join(home, ".ssh", "lfr-tools")
+	alicePEM, _ := os.ReadFile(filepath.Join(keyDir, "lfr-alice.pem"))
+	if err := os.WriteFile(filepath.Join(keyDir, "old.pem"), alicePEM, 0644); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	render := func(project string) map[string]sshKeyInfo {
+		t.Helper()
+
+		var buf bytes.Buffer
+		out, err := output.NewRenderer(&buf, output.Options{Format: output.FormatJSON})
+		if err != nil {
+			t.Fatalf("NewRenderer failed: %v", err)
+		}
+		if err := listSSHKeys(ctx, project, out); err != nil {
+			t.Fatalf("listSSHKeys failed: %v", err)
+		}
+
+		var keys []sshKeyInfo
+		if err := json.Unmarshal(buf.Bytes(), &keys); err != nil {
+			t.Fatalf("expected JSON output: %v", err)
+		}
+		byName := make(map[string]sshKeyInfo)
+		for _, key := range keys {
+			byName[key.Name] = key
+		}
+		return byName
+	}
+
+	keys := render("")
+	alice := keys["lfr-alice"]
+	if !alice.InLightsail || alice.Mode != "0600" || !strings.HasPrefix(alice.PublicKeyFingerprint, "SHA256:") {
+		t.Errorf("unexpected key pair %+v", alice)
+	}
+	if strings.Join(alice.Instances, ",") != "alice-ubuntu_22_04" || len(alice.Warnings) != 0 {
+		t.Errorf("expected alice's key on her instance only, got %+v", alice)
+	}
+	if got := strings.Join(keys[aws.DefaultKeyPairName].Instances, ","); got != "bob-ubuntu_22_04,carol-ubuntu_22_04" {
+		t.Errorf("expected the default key on bob's and carol's instances, got %s", got)
+	}
+
+	old := keys["old"]
+	if old.InLightsail || old.Mode != "0644" {
+		t.Errorf("unexpected local key %+v", old)
+	}
+	if warnings := strings.Join(old.Warnings, "; "); !strings.Contains(warnings, "world-readable") || !strings.Contains(warnings, "not installed on any instance") {
+		t.Errorf("expected world-readable and unused warnings, got %q", warnings)
+	}
+
+	// A project only shows the keys of its instances
+	keys = render("bio101")
+	if _, ok := keys["old"]; ok {
+		t.Error("expected keys unrelated to the project to be left out")
+	}
+	if got := strings.Join(keys[aws.DefaultKeyPairName].Instances, ","); got != "bob-ubuntu_22_04" {
+		t.Errorf("expected only bio101's instances, got %s", got)
+	}
+}
+
+func TestLintSoftwarePacks(t *testing.T) {
+	useFakeCloud(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	// Packs created from templates lint clean and can be installed by name
+	for _, template := range []string{"basic", "development", "data-science", "gpu"} {
+		if err := createSoftwarePack("lab-"+template, template); err != nil {
+			t.Fatalf("createSoftwarePack %s failed: %v", template, err)
+		}
+		pack, err := loadCustomPack("lab-" + template)
+		if err != nil || pack.ID != "lab-"+template {
+			t.Fatalf("expected the %s template to load, got %v, %v", template, pack, err)
+		}
+	}
+	table, _ := output.NewRenderer(&bytes.Buffer{}, output.Options{})
+	files, _ := filepath.Glob(filepath.Join(dir, "*-pack.yaml"))
+	if err := lintSoftwarePacks(context.Background(), files, false, table); err != nil {
+		t.Errorf("expected the templates to lint without errors, got %v", err)
+	}
+
+	for _, pack := range builtinPackList() {
+		if findings := software.LintPack(context.Background(), pack, software.LintOptions{}); len(findings) > 0 {
+			t.Errorf("expected builtin pack %s to lint clean, got %v", pack.ID, findings)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	content := `{"id": "bad", "name": "Bad", "type": "apt", "version": "1.0",
+		"packages": [{"name": "numpy", "source": "pip"}],
+		"scripts": [{"name": "setup", "content": "curl -fsSL https://example.com/install.sh | bash"}]}`
+	if err := os.WriteFile(bad, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	out, _ := output.NewRenderer(&buf, output.Options{Format: output.FormatJSON})
+	err := lintSoftwarePacks(context.Background(), []string{bad}, false, out)
+	if err == nil || !strings.Contains(err.Error(), "1 errors, 1 warnings") {
+		t.Errorf("expected lint to fail with one error and one warning, got %v", err)
+	}
+	var results []lintResult
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil || len(results) != 1 || len(results[0].Findings) != 2 {
+		t.Fatalf("expected the findings as JSON, got %v: %s", err, buf.String())
+	}
+	if f := results[0].Findings[0]; f.Path != "packages[0].source" || f.Rule != "type" {
+		t.Errorf("expected the pip package in an apt pack to be reported first, got %+v", f)
+	}
+
+	if err := publishSoftwarePack(context.Background(), bad, "lfr-packs", "", false); err == nil || !strings.Contains(err.Error(), "lint errors") {
+		t.Errorf("expected publishing a pack with lint errors to be refused, got %v", err)
+	}
+}
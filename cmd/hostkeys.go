@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/hostkeys"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// hostKeyAlias returns the project and alias an instance's host keys are
+// pinned under, the HostKeyAlias of its Host block in the generated SSH
+// config. The alias is the instance's name, which unlike its user-facing
+// alias can't be shared by two instances.
+func hostKeyAlias(instance *types.Instance) (project, alias string) {
+	project = instance.Tags["Project"]
+	if project == "" {
+		project = "default"
+	}
+	return project, instance.Name
+}
+
+// accessHostKeys parses the host keys Lightsail reports in access details,
+// skipping any it can't parse.
+func accessHostKeys(details *lightsail.GetInstanceAccessDetailsOutput) []gossh.PublicKey {
+	if details == nil || details.AccessDetails == nil {
+		return nil
+	}
+
+	var keys []gossh.PublicKey
+	for _, hostKey := range details.AccessDetails.HostKeys {
+		key, err := hostkeys.ParseKey(awssdk.ToString(hostKey.Algorithm), awssdk.ToString(hostKey.PublicKey))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// verifyHostKey returns a host key callback that checks an instance against
+// the keys Lightsail reports for it, or its pinned keys if there are none.
+func verifyHostKey(instance *types.Instance, trusted []gossh.PublicKey) (gossh.HostKeyCallback, error) {
+	store, err := hostkeys.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	project, alias := hostKeyAlias(instance)
+
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		result, err := store.Verify(project, alias, key, trusted)
+		if err != nil {
+			return err
+		}
+		if result == hostkeys.Repinned {
+			fmt.Printf("🔑 %s has a new host key (instance replaced); pinned %s\n", alias, gossh.FingerprintSHA256(key))
+		}
+		return nil
+	}, nil
+}
+
+// pinHostKeys pins the keys Lightsail reports for a running instance so that
+// the ssh client can verify it, and returns the known_hosts file and alias to
+// pass it. pinned is false when Lightsail reported no keys, in which case the
+// key is pinned on first connect.
+func pinHostKeys(ctx context.Context, lightsailService *aws.LightsailService, instance *types.Instance) (knownHostsFile, alias string, pinned bool, err error) {
+	store, err := hostkeys.NewStore()
+	if err != nil {
+		return "", "", false, err
+	}
+	project, alias := hostKeyAlias(instance)
+
+	details, err := lightsailService.GetInstanceAccessDetails(ctx, instance.Name)
+	if err != nil {
+		return "", "", false, err
+	}
+	keys := accessHostKeys(details)
+	if len(keys) > 0 {
+		if err := store.Pin(project, alias, keys); err != nil {
+			return "", "", false, err
+		}
+	}
+
+	return store.Path(project), alias, len(keys) > 0, nil
+}
+
+// pinStatusHostKeys pins the host keys published in a student's S3 status
+// record, for students connecting without AWS credentials, and returns the
+// known_hosts file and alias to pass the ssh client. Records written before
+// they named the instance are pinned under <user>-<project>.
+func pinStatusHostKeys(project, username string, status *aws.StudentStatus) (knownHostsFile, alias string, err error) {
+	store, err := hostkeys.NewStore()
+	if err != nil {
+		return "", "", err
+	}
+	alias = status.InstanceName
+	if alias == "" {
+		alias = username + "-" + project
+	}
+
+	var keys []gossh.PublicKey
+	for _, line := range status.HostKeys {
+		key, err := hostkeys.ParseKey("", line)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) > 0 {
+		if err := store.Pin(project, alias, keys); err != nil {
+			return "", "", err
+		}
+	}
+
+	return store.Path(project), alias, nil
+}
+
+// refreshHostKeys re-pins an instance's host keys after a resize or restore,
+// replacing those of an earlier instance of the same name. If Lightsail
+// doesn't report the new keys yet, the old pins are dropped so the next
+// connection pins afresh.
+func refreshHostKeys(ctx context.Context, lightsailService *aws.LightsailService, instance *types.Instance) {
+	store, err := hostkeys.NewStore()
+	if err != nil {
+		return
+	}
+	project, alias := hostKeyAlias(instance)
+
+	if instance.State == "running" {
+		if _, _, pinned, err := pinHostKeys(ctx, lightsailService, instance); err == nil && pinned {
+			fmt.Printf("🔑 Pinned host keys for %s\n", alias)
+			return
+		}
+	}
+
+	if keys, err := store.Keys(project, alias); err != nil || len(keys) == 0 {
+		return
+	}
+	if err := store.Forget(project, alias); err == nil {
+		fmt.Printf("🔑 Cleared pinned host keys for %s; they are pinned again on next connect\n", alias)
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -10,7 +11,8 @@ import (
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
 	"github.com/scttfrdmn/lfr-tools/internal/config"
-	"github.com/scttfrdmn/lfr-tools/internal/types"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
 )
 
 var idleCmd = &cobra.Command{
@@ -46,8 +48,9 @@ Applies the same idle settings to all specified instances.`,
 		threshold, _ := cmd.Flags().GetInt("threshold")
 		duration, _ := cmd.Flags().GetInt("duration")
 		disable, _ := cmd.Flags().GetBool("disable")
+		parallel, _ := cmd.Flags().GetInt("parallel")
 
-		return configureIdleDetectionBulk(cmd.Context(), project, users, threshold, duration, disable)
+		return configureIdleDetectionBulk(cmd.Context(), project, users, threshold, duration, disable, parallel)
 	},
 }
 
@@ -60,7 +63,12 @@ durations, and current idle status.`,
 		project, _ := cmd.Flags().GetString("project")
 		user, _ := cmd.Flags().GetString("user")
 
-		return showIdleStatus(cmd.Context(), project, user)
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return showIdleStatus(cmd.Context(), project, user, out)
 	},
 }
 
@@ -82,10 +90,12 @@ func init() {
 	idleConfigureBulkCmd.Flags().IntP("threshold", "t", 120, "Idle threshold in minutes (default: 120)")
 	idleConfigureBulkCmd.Flags().IntP("duration", "d", 30, "Duration in minutes before stopping (default: 30)")
 	idleConfigureBulkCmd.Flags().BoolP("disable", "", false, "Disable idle detection")
+	idleConfigureBulkCmd.Flags().Int("parallel", utils.DefaultParallel, "Number of instances to configure concurrently")
 
 	// Status command flags
 	idleStatusCmd.Flags().StringP("project", "p", "", "Filter by project name")
 	idleStatusCmd.Flags().StringP("user", "u", "", "Filter by username")
+	addOutputFlags(idleStatusCmd)
 }
 
 // configureIdleDetection configures idle detection for a single instance.
@@ -143,7 +153,7 @@ func configureIdleDetection(ctx context.Context, instanceName string, threshold,
 }
 
 // configureIdleDetectionBulk configures idle detection for multiple instances.
-func configureIdleDetectionBulk(ctx context.Context, project string, users []string, threshold, duration int, disable bool) error {
+func configureIdleDetectionBulk(ctx context.Context, project string, users []string, threshold, duration int, disable bool, parallel int) error {
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
@@ -169,16 +179,11 @@ func configureIdleDetectionBulk(ctx context.Context, project string, users []str
 
 	// Filter by users if specified
 	if len(users) > 0 {
-		var filtered []*types.Instance
-		for _, instance := range instances {
-			for _, user := range users {
-				if strings.HasPrefix(instance.Name, user+"-") {
-					filtered = append(filtered, instance)
-					break
-				}
-			}
+		usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+		if err != nil {
+			return err
 		}
-		instances = filtered
+		instances = ownedInstances(instances, users, usernames)
 	}
 
 	if len(instances) == 0 {
@@ -197,23 +202,63 @@ func configureIdleDetectionBulk(ctx context.Context, project string, users []str
 	}
 	fmt.Println()
 
+	names := make([]string, len(instances))
 	for i, instance := range instances {
-		fmt.Printf("[%d/%d] %s: %s\n", i+1, len(instances), actionDesc, instance.Name)
+		names[i] = instance.Name
+	}
 
-		err := configureIdleDetection(ctx, instance.Name, threshold, duration, disable)
-		if err != nil {
-			fmt.Printf("❌ Failed to configure %s: %v\n", instance.Name, err)
-		} else {
-			fmt.Printf("✅ Configured %s\n", instance.Name)
-		}
+	op := beginOperation(ctx, "idle configure-bulk", map[string]string{
+		"users":     strings.Join(users, ","),
+		"project":   project,
+		"threshold": strconv.Itoa(threshold),
+		"duration":  strconv.Itoa(duration),
+		"disable":   strconv.FormatBool(disable),
+		"parallel":  strconv.Itoa(parallel),
+	}, names)
+	names = op.Remaining(names)
+	if len(names) == 0 {
+		fmt.Println("All instances were already configured.")
+		finishOperation(ctx, op)
+		return nil
 	}
 
+	results := utils.RunBulk(ctx, names, utils.BulkOptions{Parallel: parallel, Action: actionDesc, Journal: op},
+		func(ctx context.Context, instanceName string) (string, error) {
+			instance, err := lightsailService.GetInstance(ctx, instanceName)
+			if err != nil {
+				return "", fmt.Errorf("failed to get instance details: %w", err)
+			}
+			return "state: " + instance.State, nil
+		})
+
 	fmt.Printf("\n🎉 Bulk idle detection configuration completed!\n")
-	return nil
+	utils.PrintBulkSummary(results)
+	finishOperation(ctx, op)
+
+	// Idle settings are applied when an instance is created, so explain once
+	// rather than for every instance
+	if disable {
+		fmt.Printf("\n⚠️  Idle detection disable requires PutInstancePublicPorts or ModifyInstanceAttributes API\n")
+		fmt.Printf("This may not be available in current Lightsail API\n")
+	} else {
+		fmt.Printf("\n💡 Idle detection is configured at instance creation time\n")
+		fmt.Printf("For new instances, use: lfr users create --idle-threshold=%d --idle-duration=%d\n", threshold, duration)
+	}
+
+	return utils.BulkError(results, "instances", "configure")
+}
+
+// idleStatus is the idle detection status of an instance in structured output.
+type idleStatus struct {
+	Instance         string `json:"instance" yaml:"instance"`
+	State            string `json:"state" yaml:"state"`
+	Enabled          bool   `json:"enabled" yaml:"enabled"`
+	ThresholdMinutes int    `json:"threshold_minutes,omitempty" yaml:"threshold_minutes,omitempty"`
+	DurationMinutes  int    `json:"duration_minutes,omitempty" yaml:"duration_minutes,omitempty"`
 }
 
 // showIdleStatus shows idle detection status for instances.
-func showIdleStatus(ctx context.Context, project, user string) error {
+func showIdleStatus(ctx context.Context, project, user string, out *output.Renderer) error {
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
@@ -239,13 +284,36 @@ func showIdleStatus(ctx context.Context, project, user string) error {
 
 	// Filter by user if specified
 	if user != "" {
-		var filtered []*types.Instance
-		for _, instance := range instances {
-			if strings.HasPrefix(instance.Name, user+"-") {
-				filtered = append(filtered, instance)
+		usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+		if err != nil {
+			return err
+		}
+		instances = userInstances(instances, user, usernames)
+	}
+
+	if out.Structured() {
+		// Settings come from each instance's stop-on-idle add-on
+		statuses := make([]idleStatus, len(instances))
+		for i, instance := range instances {
+			statuses[i] = idleStatus{Instance: instance.Name, State: instance.State}
+			if instance.Idle != nil {
+				statuses[i].Enabled = true
+				statuses[i].ThresholdMinutes = instance.Idle.ThresholdMinutes
+				statuses[i].DurationMinutes = instance.Idle.DurationMinutes
 			}
 		}
-		instances = filtered
+
+		return out.Render(statuses, func() *output.Table {
+			table := output.NewTable("instance", "state", "enabled", "threshold_minutes", "duration_minutes")
+			for _, status := range statuses {
+				threshold, duration := "", ""
+				if status.Enabled {
+					threshold, duration = strconv.Itoa(status.ThresholdMinutes), strconv.Itoa(status.DurationMinutes)
+				}
+				table.AddRow(status.Instance, status.State, status.Enabled, threshold, duration)
+			}
+			return table
+		})
 	}
 
 	if len(instances) == 0 {
@@ -260,13 +328,12 @@ func showIdleStatus(ctx context.Context, project, user string) error {
 	fmt.Println(strings.Repeat("-", 85))
 
 	for _, instance := range instances {
-		// Default LfR idle detection settings
-		idleConfig := "Enabled"
-		threshold := "2 hours"
-		duration := "30 min"
-
-		// Note: Getting actual idle detection settings requires additional API calls
-		// that may not be readily available in the Lightsail API
+		idleConfig, threshold, duration := "Disabled", "-", "-"
+		if instance.Idle != nil {
+			idleConfig = "Enabled"
+			threshold = fmt.Sprintf("%d min", instance.Idle.ThresholdMinutes)
+			duration = fmt.Sprintf("%d min", instance.Idle.DurationMinutes)
+		}
 
 		fmt.Printf("%-20s %-12s %-15s %-10s %-15s\n",
 			instance.Name,
@@ -278,9 +345,6 @@ func showIdleStatus(ctx context.Context, project, user string) error {
 	}
 
 	fmt.Printf("\nTotal: %d instances\n", len(instances))
-	fmt.Printf("\nNote: Idle detection settings are configured at instance creation time.\n")
-	fmt.Printf("Default LfR settings: 2 hours threshold, 30 minutes duration\n")
-	fmt.Printf("To modify settings, recreate instance with new idle configuration.\n")
 
 	return nil
 }
\ No newline at end of file
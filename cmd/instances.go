@@ -3,14 +3,17 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	lightsailTypes "github.com/aws/aws-sdk-go-v2/service/lightsail/types"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
 	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
 	"github.com/scttfrdmn/lfr-tools/internal/types"
 	"github.com/scttfrdmn/lfr-tools/internal/utils"
 )
@@ -30,7 +33,12 @@ or user. Shows instance details including state, IP addresses, and resource util
 		project, _ := cmd.Flags().GetString("project")
 		user, _ := cmd.Flags().GetString("user")
 
-		return listInstances(cmd.Context(), project, user)
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return listInstances(cmd.Context(), project, user, out)
 	},
 }
 
@@ -43,8 +51,9 @@ charged according to your bundle pricing while running.`,
 		users, _ := cmd.Flags().GetStringSlice("users")
 		project, _ := cmd.Flags().GetString("project")
 		wait, _ := cmd.Flags().GetBool("wait")
+		parallel, _ := cmd.Flags().GetInt("parallel")
 
-		return startInstances(cmd.Context(), users, project, wait)
+		return startInstances(cmd.Context(), users, project, wait, parallel)
 	},
 }
 
@@ -57,28 +66,35 @@ but users will lose access until instances are restarted.`,
 		users, _ := cmd.Flags().GetStringSlice("users")
 		project, _ := cmd.Flags().GetString("project")
 		wait, _ := cmd.Flags().GetBool("wait")
+		parallel, _ := cmd.Flags().GetInt("parallel")
 
-		return stopInstances(cmd.Context(), users, project, wait)
+		return stopInstances(cmd.Context(), users, project, wait, parallel)
 	},
 }
 
 var instancesMonitorCmd = &cobra.Command{
 	Use:   "monitor",
 	Short: "Monitor instance usage and idle time",
-	Long: `Monitor instance CPU, memory, and network usage. Identify idle instances
-that may be candidates for automatic shutdown to save costs.`,
+	Long: `Monitor instance CPU, network, and status check metrics. Identify idle instances
+that may be candidates for automatic shutdown to save costs.
+
+An instance is idle when its average CPU utilization has stayed below --cpu-threshold
+for at least --idle-threshold minutes. Use --watch to refresh the table continuously.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		project, _ := cmd.Flags().GetString("project")
 		threshold, _ := cmd.Flags().GetInt("idle-threshold")
-
-		fmt.Printf("Monitoring instances")
-		if project != "" {
-			fmt.Printf(" for project: %s", project)
-		}
-		fmt.Printf(" with idle threshold: %d minutes\n", threshold)
-
-		// TODO: Implement instance monitoring logic
-		return fmt.Errorf("instance monitoring not yet implemented")
+		cpuThreshold, _ := cmd.Flags().GetFloat64("cpu-threshold")
+		lookback, _ := cmd.Flags().GetInt("lookback")
+		watch, _ := cmd.Flags().GetBool("watch")
+		interval, _ := cmd.Flags().GetInt("interval")
+
+		return monitorInstances(cmd.Context(), project, monitorOptions{
+			IdleThreshold: time.Duration(threshold) * time.Minute,
+			CPUThreshold:  cpuThreshold,
+			Lookback:      time.Duration(lookback) * time.Hour,
+			Watch:         watch,
+			Interval:      time.Duration(interval) * time.Second,
+		})
 	},
 }
 
@@ -86,20 +102,19 @@ var instancesSnapshotCmd = &cobra.Command{
 	Use:   "snapshot [instance-name]",
 	Short: "Create a snapshot of an instance",
 	Long: `Create a point-in-time snapshot of a Lightsail instance for backup or cloning purposes.
-Snapshots preserve the instance state and can be used to restore or create new instances.`,
+Snapshots preserve the instance state and can be used to restore or create new instances.
+The snapshot is tagged with the instance's project.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		instanceName := args[0]
 		snapshotName, _ := cmd.Flags().GetString("name")
+		wait, _ := cmd.Flags().GetBool("wait")
 
 		if snapshotName == "" {
 			snapshotName = fmt.Sprintf("%s-snapshot-%d", instanceName, time.Now().Unix())
 		}
 
-		fmt.Printf("Creating snapshot '%s' of instance '%s'\n", snapshotName, instanceName)
-
-		// TODO: Implement snapshot creation logic
-		return fmt.Errorf("instance snapshot not yet implemented")
+		return createSnapshot(cmd.Context(), instanceName, snapshotName, wait)
 	},
 }
 
@@ -107,24 +122,20 @@ var instancesRestoreCmd = &cobra.Command{
 	Use:   "restore [snapshot-name] [new-instance-name]",
 	Short: "Restore an instance from a snapshot",
 	Long: `Create a new instance from an existing snapshot. This allows you to restore
-previous states or clone instances with identical configurations.`,
+previous states or clone instances with identical configurations. The new instance
+keeps the snapshot's project tag and its owner is granted access to it. It is
+created in the availability zone of the snapshot's source instance unless
+--availability-zone is given.`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		snapshotName := args[0]
 		newInstanceName := args[1]
 		bundle, _ := cmd.Flags().GetString("bundle")
 		region, _ := cmd.Flags().GetString("region")
+		zone, _ := cmd.Flags().GetString("availability-zone")
+		wait, _ := cmd.Flags().GetBool("wait")
 
-		fmt.Printf("Restoring snapshot '%s' to new instance '%s'\n", snapshotName, newInstanceName)
-		if bundle != "" {
-			fmt.Printf("Bundle: %s\n", bundle)
-		}
-		if region != "" {
-			fmt.Printf("Region: %s\n", region)
-		}
-
-		// TODO: Implement restore from snapshot logic
-		return fmt.Errorf("instance restore not yet implemented")
+		return restoreSnapshot(cmd.Context(), snapshotName, newInstanceName, bundle, region, zone, wait)
 	},
 }
 
@@ -132,24 +143,20 @@ var instancesCloneCmd = &cobra.Command{
 	Use:   "clone [source-instance] [new-instance-name]",
 	Short: "Clone an existing instance",
 	Long: `Create a new instance by cloning an existing one. This creates a snapshot
-of the source instance and then creates a new instance from that snapshot.`,
+of the source instance and then creates a new instance from that snapshot. The clone
+is tagged with ClonedFrom and the source's project, and the owner named by the new
+instance (e.g. bob for bob-ubuntu_22_04) is granted access to it. The clone is
+created in the source's availability zone unless --availability-zone is given.`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		sourceInstance := args[0]
 		newInstanceName := args[1]
 		bundle, _ := cmd.Flags().GetString("bundle")
 		region, _ := cmd.Flags().GetString("region")
+		zone, _ := cmd.Flags().GetString("availability-zone")
+		wait, _ := cmd.Flags().GetBool("wait")
 
-		fmt.Printf("Cloning instance '%s' to '%s'\n", sourceInstance, newInstanceName)
-		if bundle != "" {
-			fmt.Printf("New bundle: %s\n", bundle)
-		}
-		if region != "" {
-			fmt.Printf("Region: %s\n", region)
-		}
-
-		// TODO: Implement instance cloning logic
-		return fmt.Errorf("instance cloning not yet implemented")
+		return cloneInstance(cmd.Context(), sourceInstance, newInstanceName, bundle, region, zone, wait)
 	},
 }
 
@@ -184,8 +191,10 @@ Direction: 'up' for larger, 'down' for smaller. Instance will be stopped during
 		instanceName := args[0]
 		direction := args[1]
 		wait, _ := cmd.Flags().GetBool("wait")
+		cutover, _ := cmd.Flags().GetBool("cutover")
+		deleteOld, _ := cmd.Flags().GetBool("delete-old")
 
-		return resizeInstance(cmd.Context(), instanceName, direction, wait)
+		return resizeInstance(cmd.Context(), instanceName, direction, wait, cutover, deleteOld)
 	},
 }
 
@@ -221,46 +230,60 @@ func init() {
 	// List command flags
 	instancesListCmd.Flags().StringP("project", "p", "", "Filter by project name")
 	instancesListCmd.Flags().StringP("user", "u", "", "Filter by username")
+	addOutputFlags(instancesListCmd)
 
 	// Start command flags
 	instancesStartCmd.Flags().StringSliceP("users", "u", []string{}, "Comma-separated list of usernames (required)")
 	instancesStartCmd.Flags().StringP("project", "p", "", "Filter by project name")
 	instancesStartCmd.Flags().BoolP("wait", "w", false, "Wait for instances to reach running state")
+	instancesStartCmd.Flags().Int("parallel", utils.DefaultParallel, "Number of instances to start concurrently")
 	instancesStartCmd.MarkFlagRequired("users")
 
 	// Stop command flags
 	instancesStopCmd.Flags().StringSliceP("users", "u", []string{}, "Comma-separated list of usernames (required)")
 	instancesStopCmd.Flags().StringP("project", "p", "", "Filter by project name")
 	instancesStopCmd.Flags().BoolP("wait", "w", false, "Wait for instances to reach stopped state")
+	instancesStopCmd.Flags().Int("parallel", utils.DefaultParallel, "Number of instances to stop concurrently")
 	instancesStopCmd.MarkFlagRequired("users")
 
 	// Monitor command flags
 	instancesMonitorCmd.Flags().StringP("project", "p", "", "Filter by project name")
 	instancesMonitorCmd.Flags().IntP("idle-threshold", "t", 120, "Idle threshold in minutes")
+	instancesMonitorCmd.Flags().Float64("cpu-threshold", 5, "CPU utilization percentage below which an instance counts as idle")
+	instancesMonitorCmd.Flags().Int("lookback", 6, "Hours of metric history to analyze")
+	instancesMonitorCmd.Flags().BoolP("watch", "w", false, "Continuously refresh the report")
+	instancesMonitorCmd.Flags().Int("interval", 60, "Refresh interval in seconds for --watch")
 
 	// Snapshot command flags
 	instancesSnapshotCmd.Flags().StringP("name", "n", "", "Custom snapshot name (auto-generated if not provided)")
+	instancesSnapshotCmd.Flags().BoolP("wait", "w", false, "Wait for the snapshot to become available")
 
 	// Restore command flags
-	instancesRestoreCmd.Flags().StringP("bundle", "b", "", "Bundle for the new instance")
-	instancesRestoreCmd.Flags().StringP("region", "r", "", "Region for the new instance")
+	instancesRestoreCmd.Flags().StringP("bundle", "b", "", "Bundle for the new instance (uses the snapshot's bundle if not provided)")
+	instancesRestoreCmd.Flags().StringP("region", "r", "", "Region for the new instance (must match the snapshot's region)")
+	instancesRestoreCmd.Flags().StringP("availability-zone", "z", "", "Availability zone for the new instance (uses the source instance's zone if not provided)")
+	instancesRestoreCmd.Flags().BoolP("wait", "w", false, "Wait for the snapshot and the new instance to be ready")
 
 	// Clone command flags
 	instancesCloneCmd.Flags().StringP("bundle", "b", "", "Bundle for the new instance (uses source bundle if not provided)")
-	instancesCloneCmd.Flags().StringP("region", "r", "", "Region for the new instance (uses source region if not provided)")
+	instancesCloneCmd.Flags().StringP("region", "r", "", "Region for the new instance (must match the source region)")
+	instancesCloneCmd.Flags().StringP("availability-zone", "z", "", "Availability zone for the new instance (uses the source's zone if not provided)")
+	instancesCloneCmd.Flags().BoolP("wait", "w", false, "Wait for the cloned instance to reach running state")
 
 	// Reboot command flags
 	instancesRebootCmd.Flags().BoolP("force", "f", false, "Force reboot without confirmation")
 
 	// Resize command flags
 	instancesResizeCmd.Flags().BoolP("wait", "w", false, "Wait for resize to complete")
+	instancesResizeCmd.Flags().Bool("cutover", false, "Move disks, static IP, access policy and status to the resized instance, rolling back on failure")
+	instancesResizeCmd.Flags().Bool("delete-old", false, "Delete the old instance and snapshot after a successful cutover")
 
 	// GPU command flags
 	instancesGpuCmd.Flags().BoolP("wait", "w", false, "Wait for GPU switch to complete")
 }
 
 // listInstances lists Lightsail instances with filtering.
-func listInstances(ctx context.Context, project, user string) error {
+func listInstances(ctx context.Context, project, user string, out *output.Renderer) error {
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
@@ -286,13 +309,17 @@ func listInstances(ctx context.Context, project, user string) error {
 
 	// Filter by user if specified
 	if user != "" {
-		var filtered []*types.Instance
-		for _, instance := range instances {
-			if strings.HasPrefix(instance.Name, user+"-") {
-				filtered = append(filtered, instance)
-			}
+		usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+		if err != nil {
+			return err
 		}
-		instances = filtered
+		instances = userInstances(instances, user, usernames)
+	}
+
+	if out.Structured() {
+		return out.Render(instances, func() *output.Table {
+			return instanceTable(instances)
+		})
 	}
 
 	if len(instances) == 0 {
@@ -339,8 +366,39 @@ func listInstances(ctx context.Context, project, user string) error {
 	return nil
 }
 
-// startInstances starts instances for specified users.
-func startInstances(ctx context.Context, users []string, project string, wait bool) error {
+// instanceTable flattens instances for CSV output.
+func instanceTable(instances []*types.Instance) *output.Table {
+	table := output.NewTable("name", "state", "public_ip", "private_ip", "blueprint", "bundle", "region", "project", "created_at")
+	for _, instance := range instances {
+		table.AddRow(
+			instance.Name,
+			instance.State,
+			instance.PublicIP,
+			instance.PrivateIP,
+			instance.Blueprint,
+			instance.Bundle,
+			instance.Region,
+			instance.Tags["Project"],
+			instance.CreatedAt.Format(time.RFC3339),
+		)
+	}
+	return table
+}
+
+// monitorOptions configures the instance usage monitor.
+type monitorOptions struct {
+	IdleThreshold time.Duration
+	CPUThreshold  float64
+	Lookback      time.Duration
+	Watch         bool
+	Interval      time.Duration
+}
+
+// monitorMetricPeriod is the granularity in seconds of the metric data requested from Lightsail.
+const monitorMetricPeriod = 300
+
+// monitorInstances reports CPU, network, and idle time for instances, once or continuously.
+func monitorInstances(ctx context.Context, project string, opts monitorOptions) error {
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
@@ -358,71 +416,237 @@ func startInstances(ctx context.Context, users []string, project string, wait bo
 
 	lightsailService := aws.NewLightsailService(awsClient)
 
-	// Get all instances
-	instances, err := lightsailService.ListInstances(ctx, project)
+	// The stop hints name instances by their owners
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list instances: %w", err)
+		return err
 	}
 
-	// Filter instances for specified users
-	var instancesToStart []string
-	for _, instance := range instances {
-		for _, user := range users {
-			if strings.HasPrefix(instance.Name, user+"-") {
-				instancesToStart = append(instancesToStart, instance.Name)
-				break
-			}
+	if !opts.Watch {
+		usage, err := collectInstanceUsage(ctx, lightsailService, project, opts, time.Now())
+		if err != nil {
+			return err
 		}
+		printMonitorReport(project, usage, usernames, opts)
+		return nil
 	}
 
-	if len(instancesToStart) == 0 {
-		fmt.Printf("No instances found for users: %v\n", users)
-		return nil
+	if opts.Interval < time.Second {
+		return fmt.Errorf("refresh interval must be at least 1 second")
 	}
 
-	fmt.Printf("Starting %d instances for users: %v\n", len(instancesToStart), users)
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
 
-	for i, instanceName := range instancesToStart {
-		fmt.Printf("[%d/%d] Starting instance: %s\n", i+1, len(instancesToStart), instanceName)
+	for {
+		usage, err := collectInstanceUsage(ctx, lightsailService, project, opts, time.Now())
 
-		err = lightsailService.StartInstance(ctx, instanceName)
+		// Clear the screen before redrawing the table
+		fmt.Print("\033[H\033[2J")
 		if err != nil {
-			fmt.Printf("❌ Error starting instance %s: %v\n", instanceName, err)
-			continue
+			fmt.Printf("❌ %v\n", err)
+		} else {
+			printMonitorReport(project, usage, usernames, opts)
 		}
+		fmt.Printf("\nLast updated: %s (refreshing every %s, press Ctrl+C to exit)\n",
+			time.Now().Format("15:04:05"), opts.Interval)
 
-		fmt.Printf("✅ Started instance: %s\n", instanceName)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
 
-		// Wait for instance to reach running state if requested
-		if wait {
-			err = utils.WaitForInstanceState(ctx, instanceName, "running", func() (string, error) {
-				instance, err := lightsailService.GetInstance(ctx, instanceName)
-				if err != nil {
-					return "", err
-				}
+// collectInstanceUsage gathers metric data for every instance in a project and summarizes it.
+func collectInstanceUsage(ctx context.Context, lightsailService *aws.LightsailService, project string, opts monitorOptions, now time.Time) ([]*types.InstanceUsage, error) {
+	instances, err := lightsailService.ListInstances(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
 
-				// Update S3 status during wait
-				_ = utils.UpdateInstanceStatusInS3(ctx, instance)
+	start := now.Add(-opts.Lookback)
+	var usage []*types.InstanceUsage
+	for _, instance := range instances {
+		// Stopped instances report no metrics worth fetching
+		if instance.State != "running" {
+			usage = append(usage, utils.SummarizeInstanceUsage(instance, nil, opts.CPUThreshold, opts.IdleThreshold, now))
+			continue
+		}
 
-				return instance.State, nil
-			})
+		metrics := &utils.InstanceMetrics{}
+		series := []struct {
+			name   lightsailTypes.InstanceMetricName
+			points *[]types.MetricPoint
+		}{
+			{lightsailTypes.InstanceMetricNameCPUUtilization, &metrics.CPU},
+			{lightsailTypes.InstanceMetricNameNetworkIn, &metrics.NetworkIn},
+			{lightsailTypes.InstanceMetricNameNetworkOut, &metrics.NetworkOut},
+			{lightsailTypes.InstanceMetricNameStatusCheckFailed, &metrics.StatusCheckFailed},
+		}
+		for _, s := range series {
+			points, err := lightsailService.GetInstanceMetricData(ctx, instance.Name, s.name, start, now, monitorMetricPeriod)
 			if err != nil {
-				fmt.Printf("❌ Error waiting for instance %s: %v\n", instanceName, err)
+				return nil, err
 			}
+			*s.points = points
 		}
 
-		// Update S3 status after start
-		if instance, err := lightsailService.GetInstance(ctx, instanceName); err == nil {
-			_ = utils.UpdateInstanceStatusInS3(ctx, instance)
+		usage = append(usage, utils.SummarizeInstanceUsage(instance, metrics, opts.CPUThreshold, opts.IdleThreshold, now))
+	}
+
+	return usage, nil
+}
+
+// printMonitorReport prints the usage table and a summary of idle instances,
+// with commands to stop them by the users in usernames who own them.
+func printMonitorReport(project string, usage []*types.InstanceUsage, usernames []string, opts monitorOptions) {
+	if len(usage) == 0 {
+		if project != "" {
+			fmt.Printf("No instances found for project: %s\n", project)
+		} else {
+			fmt.Println("No instances found.")
+		}
+		return
+	}
+
+	fmt.Printf("📊 Instance usage over the last %s (idle: CPU < %.1f%% for %s)\n\n",
+		utils.FormatDuration(opts.Lookback), opts.CPUThreshold, utils.FormatDuration(opts.IdleThreshold))
+	fmt.Printf("%-25s %-10s %-8s %-8s %-12s %-12s %-8s %-10s\n",
+		"INSTANCE", "STATE", "CPU AVG", "CPU MAX", "NET IN", "NET OUT", "STATUS", "IDLE FOR")
+	fmt.Println(strings.Repeat("-", 100))
+
+	var idle []string
+	running := 0
+	for _, u := range usage {
+		cpuAvg, cpuMax, netIn, netOut, status, idleFor := "-", "-", "-", "-", "-", "-"
+		if u.State == "running" {
+			running++
+		}
+		if u.HasData {
+			cpuAvg = fmt.Sprintf("%.1f%%", u.CPUAverage)
+			cpuMax = fmt.Sprintf("%.1f%%", u.CPUMaximum)
+			netIn = utils.FormatBytes(u.NetworkInBytes)
+			netOut = utils.FormatBytes(u.NetworkOutBytes)
+			status = "ok"
+			if u.StatusCheckFailed {
+				status = "FAILED"
+			}
+			idleFor = utils.FormatDuration(u.IdleFor)
+			if u.IdleForAtLeast {
+				idleFor = ">" + idleFor
+			}
+		}
+
+		marker := ""
+		if u.Idle {
+			marker = " 💤"
+			idle = append(idle, u.Name)
+		}
+
+		fmt.Printf("%-25s %-10s %-8s %-8s %-12s %-12s %-8s %-10s%s\n",
+			u.Name, u.State, cpuAvg, cpuMax, netIn, netOut, status, idleFor, marker)
+	}
+
+	fmt.Printf("\nTotal: %d instances (%d running, %d idle)\n", len(usage), running, len(idle))
+
+	if len(idle) > 0 {
+		var users, unowned []string
+		for _, name := range idle {
+			if owner := utils.InstanceOwner(name, usernames); owner != "" {
+				users = append(users, owner)
+			} else {
+				unowned = append(unowned, name)
+			}
+		}
+
+		fmt.Printf("\n💤 Idle instances are still accruing charges. To stop them:\n")
+		if len(users) > 0 {
+			fmt.Printf("lfr instances stop --users=%s\n", strings.Join(users, ","))
+		}
+		for _, name := range unowned {
+			fmt.Printf("aws lightsail stop-instance --instance-name %s\n", name)
+		}
+		if len(users) > 0 {
+			fmt.Printf("\nTo stop idle instances automatically:\n")
+			fmt.Printf("lfr idle configure-bulk --users=%s\n", strings.Join(users, ","))
 		}
 	}
+}
+
+// startInstances starts instances for specified users.
+func startInstances(ctx context.Context, users []string, project string, wait bool, parallel int) error {
+	// Load configuration
+	_, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Create AWS client
+	awsClient, err := aws.NewClient(ctx, aws.Options{
+		Region:  viper.GetString("aws.region"),
+		Profile: viper.GetString("aws.profile"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	// Get all instances
+	instances, err := lightsailService.ListInstances(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Filter instances for specified users
+	var instancesToStart []string
+	changed := ownedInstances(instances, users, usernames)
+	for _, instance := range changed {
+		instancesToStart = append(instancesToStart, instance.Name)
+	}
+
+	if len(instancesToStart) == 0 {
+		fmt.Printf("No instances found for users: %v\n", users)
+		return nil
+	}
+
+	op := beginOperation(ctx, "instances start", map[string]string{
+		"users":    strings.Join(users, ","),
+		"project":  project,
+		"wait":     strconv.FormatBool(wait),
+		"parallel": strconv.Itoa(parallel),
+	}, instancesToStart)
+	instancesToStart = op.Remaining(instancesToStart)
+	if len(instancesToStart) == 0 {
+		fmt.Printf("All instances were already processed.\n")
+		finishOperation(ctx, op)
+		return nil
+	}
+
+	fmt.Printf("Starting %d instances for users: %v\n", len(instancesToStart), users)
+
+	results := utils.RunBulk(ctx, instancesToStart, utils.BulkOptions{Parallel: parallel, Action: "Starting instances", Journal: op},
+		func(ctx context.Context, instanceName string) (string, error) {
+			return setInstanceState(ctx, lightsailService, instanceName, "running", wait)
+		})
 
 	fmt.Printf("\n🎉 Instance start completed!\n")
-	return nil
+	utils.PrintBulkSummary(results)
+	finishOperation(ctx, op)
+	syncSSHConfig(ctx, awsClient, changed)
+
+	return utils.BulkError(results, "instances", "start")
 }
 
 // stopInstances stops instances for specified users.
-func stopInstances(ctx context.Context, users []string, project string, wait bool) error {
+func stopInstances(ctx context.Context, users []string, project string, wait bool, parallel int) error {
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
@@ -446,15 +670,16 @@ func stopInstances(ctx context.Context, users []string, project string, wait boo
 		return fmt.Errorf("failed to list instances: %w", err)
 	}
 
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Filter instances for specified users
 	var instancesToStop []string
-	for _, instance := range instances {
-		for _, user := range users {
-			if strings.HasPrefix(instance.Name, user+"-") {
-				instancesToStop = append(instancesToStop, instance.Name)
-				break
-			}
-		}
+	changed := ownedInstances(instances, users, usernames)
+	for _, instance := range changed {
+		instancesToStop = append(instancesToStop, instance.Name)
 	}
 
 	if len(instancesToStop) == 0 {
@@ -462,52 +687,101 @@ func stopInstances(ctx context.Context, users []string, project string, wait boo
 		return nil
 	}
 
-	fmt.Printf("Stopping %d instances for users: %v\n", len(instancesToStop), users)
+	op := beginOperation(ctx, "instances stop", map[string]string{
+		"users":    strings.Join(users, ","),
+		"project":  project,
+		"wait":     strconv.FormatBool(wait),
+		"parallel": strconv.Itoa(parallel),
+	}, instancesToStop)
+	instancesToStop = op.Remaining(instancesToStop)
+	if len(instancesToStop) == 0 {
+		fmt.Printf("All instances were already processed.\n")
+		finishOperation(ctx, op)
+		return nil
+	}
 
-	for i, instanceName := range instancesToStop {
-		fmt.Printf("[%d/%d] Stopping instance: %s\n", i+1, len(instancesToStop), instanceName)
+	fmt.Printf("Stopping %d instances for users: %v\n", len(instancesToStop), users)
 
-		err = lightsailService.StopInstance(ctx, instanceName)
-		if err != nil {
-			fmt.Printf("❌ Error stopping instance %s: %v\n", instanceName, err)
-			continue
-		}
+	results := utils.RunBulk(ctx, instancesToStop, utils.BulkOptions{Parallel: parallel, Action: "Stopping instances", Journal: op},
+		func(ctx context.Context, instanceName string) (string, error) {
+			return setInstanceState(ctx, lightsailService, instanceName, "stopped", wait)
+		})
 
-		fmt.Printf("✅ Stopped instance: %s\n", instanceName)
+	fmt.Printf("\n🎉 Instance stop completed!\n")
+	utils.PrintBulkSummary(results)
+	finishOperation(ctx, op)
+	syncSSHConfig(ctx, awsClient, changed)
 
-		// Wait for instance to reach stopped state if requested
-		if wait {
-			err = utils.WaitForInstanceState(ctx, instanceName, "stopped", func() (string, error) {
-				instance, err := lightsailService.GetInstance(ctx, instanceName)
-				if err != nil {
-					return "", err
-				}
+	return utils.BulkError(results, "instances", "stop")
+}
 
-				// Update S3 status during wait
-				_ = utils.UpdateInstanceStatusInS3(ctx, instance)
+// setInstanceState starts or stops an instance, optionally waits for it to reach
+// the target state, and refreshes its S3 status record.
+func setInstanceState(ctx context.Context, lightsailService *aws.LightsailService, instanceName, targetState string, wait bool) (string, error) {
+	var err error
+	if targetState == "running" {
+		err = lightsailService.StartInstance(ctx, instanceName)
+	} else {
+		err = lightsailService.StopInstance(ctx, instanceName)
+	}
+	if err != nil {
+		return "", err
+	}
 
-				return instance.State, nil
-			})
+	// Wait for instance to reach the target state if requested
+	if wait {
+		err = utils.WaitForInstanceStateQuiet(ctx, instanceName, targetState, func() (string, error) {
+			instance, err := lightsailService.GetInstance(ctx, instanceName)
 			if err != nil {
-				fmt.Printf("❌ Error waiting for instance %s: %v\n", instanceName, err)
+				return "", err
 			}
-		}
 
-		// Update S3 status after stop
-		if instance, err := lightsailService.GetInstance(ctx, instanceName); err == nil {
+			// Update S3 status during wait
 			_ = utils.UpdateInstanceStatusInS3(ctx, instance)
+
+			return instance.State, nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("error waiting for instance %s: %w", instanceName, err)
 		}
 	}
 
-	fmt.Printf("\n🎉 Instance stop completed!\n")
-	return nil
+	// Update S3 status after the state change
+	instance, err := lightsailService.GetInstance(ctx, instanceName)
+	if err != nil {
+		return "", err
+	}
+	_ = utils.UpdateInstanceStatusInS3(ctx, instance)
+
+	return instance.State, nil
 }
 
-// resizeInstance resizes an instance using the snapshot method.
-func resizeInstance(ctx context.Context, instanceName, direction string, wait bool) error {
+// connectHint returns a command to try an instance with: ssh connect as the
+// IAM user who owns it, or Lightsail's access details for it if no user does
+// or the users can't be listed.
+func connectHint(ctx context.Context, awsClient *aws.Client, instanceName string) string {
+	usernames, _ := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if owner := utils.InstanceOwner(instanceName, usernames); owner != "" {
+		return "lfr ssh connect " + owner
+	}
+	return "aws lightsail get-instance-access-details --instance-name " + instanceName
+}
+
+// resizeInstance resizes an instance using the snapshot method. With cutover, the
+// resized instance takes over the original's disks, static IP, access policy and
+// S3 status, and every completed step is rolled back if a later one fails.
+func resizeInstance(ctx context.Context, instanceName, direction string, wait, cutover, deleteOld bool) error {
 	if direction != "up" && direction != "down" {
 		return fmt.Errorf("direction must be 'up' or 'down', got: %s", direction)
 	}
+	if deleteOld && !cutover {
+		return fmt.Errorf("--delete-old requires --cutover")
+	}
+
+	// Cutover needs every step to finish before the next can start
+	if cutover {
+		wait = true
+	}
 
 	// Load configuration
 	_, err := config.Load()
@@ -551,15 +825,43 @@ func resizeInstance(ctx context.Context, instanceName, direction string, wait bo
 		}
 	}
 
+	snapshotName := instanceName + "-resize-snapshot"
+	newInstanceName := instanceName + "-resized"
+
 	// Display resize plan
 	fmt.Printf("Resizing instance: %s\n", instanceName)
 	fmt.Printf("Current state: %s\n", instance.State)
 	fmt.Printf("%s\n", utils.FormatBundleComparison(currentBundle, targetBundle))
 	fmt.Printf("\n⚠️  This operation will:\n")
 	fmt.Printf("   1. Stop the instance (if running)\n")
-	fmt.Printf("   2. Create a snapshot: %s-resize-snapshot\n", instanceName)
-	fmt.Printf("   3. Create new instance: %s-resized\n", instanceName)
-	fmt.Printf("   4. Optionally delete old instance and snapshot\n\n")
+	fmt.Printf("   2. Create a snapshot: %s\n", snapshotName)
+	fmt.Printf("   3. Create new instance: %s\n", newInstanceName)
+	if cutover {
+		fmt.Printf("   4. Move disks, static IP, access policy and status to %s\n", newInstanceName)
+		if deleteOld {
+			fmt.Printf("   5. Delete the old instance and snapshot\n\n")
+		} else {
+			fmt.Printf("   5. Keep the old instance stopped\n\n")
+		}
+	} else {
+		fmt.Printf("   4. Optionally delete old instance and snapshot\n\n")
+	}
+
+	// Compensating actions are only run in cutover mode, and run even if the
+	// resize is interrupted
+	rollback := &utils.Rollback{}
+	cleanupCtx := context.WithoutCancel(ctx)
+	fail := func(err error) error {
+		if !cutover || rollback.Len() == 0 {
+			return err
+		}
+		fmt.Printf("\n❌ Resize failed: %v\n", err)
+		if errs := rollback.Run(); len(errs) > 0 {
+			return fmt.Errorf("resize of %s failed and %d rollback steps failed: %w", instanceName, len(errs), err)
+		}
+		fmt.Printf("✅ Rolled back resize of %s\n", instanceName)
+		return fmt.Errorf("resize of %s failed and was rolled back: %w", instanceName, err)
+	}
 
 	// Stop instance if running
 	if instance.State == "running" {
@@ -568,70 +870,232 @@ func resizeInstance(ctx context.Context, instanceName, direction string, wait bo
 		if err != nil {
 			return fmt.Errorf("failed to stop instance: %w", err)
 		}
+		rollback.Add("start "+instanceName, func() error {
+			if err := waitForInstanceState(cleanupCtx, lightsailService, instanceName, "stopped"); err != nil {
+				return err
+			}
+			return lightsailService.StartInstance(cleanupCtx, instanceName)
+		})
 
 		if wait {
-			err = utils.WaitForInstanceState(ctx, instanceName, "stopped", func() (string, error) {
-				inst, err := lightsailService.GetInstance(ctx, instanceName)
-				if err != nil {
-					return "", err
-				}
-				return inst.State, nil
-			})
-			if err != nil {
-				return fmt.Errorf("error waiting for instance to stop: %w", err)
+			if err := waitForInstanceState(ctx, lightsailService, instanceName, "stopped"); err != nil {
+				return fail(fmt.Errorf("error waiting for instance to stop: %w", err))
 			}
 		}
 	}
 
 	// Create snapshot
-	snapshotName := instanceName + "-resize-snapshot"
 	fmt.Printf("Creating snapshot: %s\n", snapshotName)
-	err = lightsailService.CreateInstanceSnapshot(ctx, instanceName, snapshotName)
+	err = lightsailService.CreateInstanceSnapshot(ctx, instanceName, snapshotName, copyTags(instance.Tags))
 	if err != nil {
-		return fmt.Errorf("failed to create snapshot: %w", err)
+		return fail(fmt.Errorf("failed to create snapshot: %w", err))
 	}
+	rollback.Add("delete snapshot "+snapshotName, func() error {
+		return lightsailService.DeleteInstanceSnapshot(cleanupCtx, snapshotName)
+	})
 
 	// Wait for snapshot to complete if requested
 	if wait {
 		fmt.Printf("Waiting for snapshot to complete...\n")
-		err = utils.WaitForSnapshotState(ctx, snapshotName, "available", func() (string, error) {
-			snapshot, err := lightsailService.GetInstanceSnapshot(ctx, snapshotName)
-			if err != nil {
-				return "", err
-			}
-			return string(snapshot.State), nil
-		})
-		if err != nil {
-			return fmt.Errorf("error waiting for snapshot: %w", err)
+		if err := waitForSnapshot(ctx, lightsailService, snapshotName); err != nil {
+			return fail(err)
 		}
 	}
 
 	// Create new instance from snapshot
-	newInstanceName := instanceName + "-resized"
 	fmt.Printf("Creating resized instance: %s\n", newInstanceName)
 
-	tags := instance.Tags
-	if tags == nil {
-		tags = make(map[string]string)
+	tags := lineageTags(instance.Tags, "ResizedFrom", instanceName)
+	zone, err := snapshotZone("", instance.AvailabilityZone, instance.Region)
+	if err != nil {
+		return fail(err)
 	}
-	tags["ResizedFrom"] = instanceName
+	newInstance, err := lightsailService.CreateInstanceFromSnapshot(ctx, newInstanceName, snapshotName, targetBundle.ID, zone, instance.SSHKeyName, tags)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create instance from snapshot: %w", err))
+	}
+	rollback.Add("delete instance "+newInstanceName, func() error {
+		return lightsailService.DeleteInstance(cleanupCtx, newInstanceName)
+	})
+
+	if !cutover {
+		fmt.Printf("✅ Resize operation initiated!\n")
+		fmt.Printf("New instance: %s (%s)\n", newInstanceName, targetBundle.Name)
+		fmt.Printf("\nNext steps:\n")
+		fmt.Printf("1. Wait for new instance to be ready\n")
+		fmt.Printf("2. Test the new instance: %s\n", connectHint(ctx, awsClient, newInstanceName))
+		fmt.Printf("3. Delete old instance: aws lightsail delete-instance --instance-name %s\n", instanceName)
+		fmt.Printf("4. Rename new instance if desired\n")
+		fmt.Printf("\nTo do this automatically, use --cutover\n")
+		return nil
+	}
+
+	if err := cutoverInstance(ctx, awsClient, instance, newInstance, rollback); err != nil {
+		return fail(err)
+	}
+
+	// The user's alias now leads to a host with new host keys
+	if refreshed, err := lightsailService.GetInstance(ctx, newInstanceName); err == nil {
+		refreshHostKeys(ctx, lightsailService, refreshed)
+	}
+
+	fmt.Printf("\n✅ Cutover to %s (%s) complete\n", newInstanceName, targetBundle.Name)
+
+	if !deleteOld {
+		fmt.Printf("The old instance %s is stopped and snapshot %s was kept.\n", instanceName, snapshotName)
+		fmt.Printf("Delete them when satisfied:\n")
+		fmt.Printf("aws lightsail delete-instance --instance-name %s\n", instanceName)
+		fmt.Printf("lfr instances snapshots delete %s\n", snapshotName)
+		return nil
+	}
+
+	// The cutover is committed; cleanup failures are reported but not rolled back
+	fmt.Printf("Deleting old instance %s...\n", instanceName)
+	if err := lightsailService.DeleteInstance(ctx, instanceName); err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+	}
+	fmt.Printf("Deleting snapshot %s...\n", snapshotName)
+	if err := lightsailService.DeleteInstanceSnapshot(ctx, snapshotName); err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+	}
+
+	fmt.Printf("\n🎉 Resize of %s completed!\n", instanceName)
+	return nil
+}
 
-	_, err = lightsailService.CreateInstanceFromSnapshot(ctx, newInstanceName, snapshotName, targetBundle.ID, instance.Region+"a", tags)
+// cutoverInstance moves block storage disks, the static IP, the owner's access
+// policy and the S3 status record from an old instance to its replacement,
+// recording a compensating action for each completed step. The compensating
+// actions don't use ctx, so they still run after it is cancelled.
+func cutoverInstance(ctx context.Context, awsClient *aws.Client, oldInstance, newInstance *types.Instance, rollback *utils.Rollback) error {
+	lightsailService := aws.NewLightsailService(awsClient)
+	iamService := aws.NewIAMService(awsClient)
+	oldName, newName := oldInstance.Name, newInstance.Name
+	cleanupCtx := context.WithoutCancel(ctx)
+
+	if err := waitForInstanceState(ctx, lightsailService, newName, "running"); err != nil {
+		return fmt.Errorf("error waiting for instance %s: %w", newName, err)
+	}
+
+	// Move block storage disks, keeping their device paths
+	disks, err := lightsailService.ListDisks(ctx, "")
 	if err != nil {
-		return fmt.Errorf("failed to create instance from snapshot: %w", err)
+		return err
 	}
+	for _, disk := range disks {
+		if disk.AttachedTo != oldName {
+			continue
+		}
+		diskName, diskPath := disk.Name, disk.Path
 
-	fmt.Printf("✅ Resize operation initiated!\n")
-	fmt.Printf("New instance: %s (%s)\n", newInstanceName, targetBundle.Name)
-	fmt.Printf("\nNext steps:\n")
-	fmt.Printf("1. Wait for new instance to be ready\n")
-	fmt.Printf("2. Test the new instance: lfr ssh connect %s\n", strings.Split(newInstanceName, "-")[0])
-	fmt.Printf("3. Delete old instance: lfr instances delete %s\n", instanceName)
-	fmt.Printf("4. Rename new instance if desired\n")
+		fmt.Printf("Moving disk %s (%s) to %s\n", diskName, diskPath, newName)
+		if err := detachDisk(ctx, lightsailService, diskName); err != nil {
+			return err
+		}
+		rollback.Add(fmt.Sprintf("reattach disk %s to %s", diskName, oldName), func() error {
+			if err := detachDisk(cleanupCtx, lightsailService, diskName); err != nil {
+				return err
+			}
+			return lightsailService.AttachDisk(cleanupCtx, diskName, oldName, diskPath)
+		})
+		if err := lightsailService.AttachDisk(ctx, diskName, newName, diskPath); err != nil {
+			return err
+		}
+	}
+
+	// Move the static IP
+	staticIP, err := lightsailService.GetInstanceStaticIP(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	if staticIP != "" {
+		fmt.Printf("Moving static IP %s to %s\n", staticIP, newName)
+		if err := lightsailService.DetachStaticIP(ctx, staticIP); err != nil {
+			return err
+		}
+		rollback.Add(fmt.Sprintf("reattach static IP %s to %s", staticIP, oldName), func() error {
+			if attached, err := lightsailService.GetInstanceStaticIP(cleanupCtx, newName); err == nil && attached == staticIP {
+				if err := lightsailService.DetachStaticIP(cleanupCtx, staticIP); err != nil {
+					return err
+				}
+			}
+			return lightsailService.AttachStaticIP(cleanupCtx, staticIP, oldName)
+		})
+		if err := lightsailService.AttachStaticIP(ctx, staticIP, newName); err != nil {
+			return err
+		}
+	}
+
+	// Point the owner's access policy at the new instance
+	usernames, err := iamService.ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+	owner := utils.InstanceOwner(oldName, usernames)
+	if owner == "" {
+		fmt.Printf("ℹ️  No IAM user owns %s; skipping access policy update\n", oldName)
+	} else {
+		if err := iamService.UpdateUserInstanceAccess(ctx, owner, []string{newInstance.ARN}, []string{oldInstance.ARN}); err != nil {
+			return err
+		}
+		fmt.Printf("Updated access policy for %s\n", owner)
+		rollback.Add("restore access policy for "+owner, func() error {
+			return iamService.UpdateUserInstanceAccess(cleanupCtx, owner, []string{oldInstance.ARN}, []string{newInstance.ARN})
+		})
+	}
+
+	// Refresh the S3 status record so students see the new address
+	refreshed, err := lightsailService.GetInstance(ctx, newName)
+	if err != nil {
+		return err
+	}
+	_ = utils.UpdateInstanceStatusInS3(ctx, refreshed)
+	rollback.Add("restore S3 status for "+oldName, func() error {
+		if old, err := lightsailService.GetInstance(cleanupCtx, oldName); err == nil {
+			_ = utils.UpdateInstanceStatusInS3(cleanupCtx, old)
+		}
+		return nil
+	})
+
+	return nil
+}
+
+// detachDisk detaches a disk if it is attached and waits for it to become available.
+func detachDisk(ctx context.Context, lightsailService *aws.LightsailService, diskName string) error {
+	disk, err := lightsailService.GetDisk(ctx, diskName)
+	if err != nil {
+		return err
+	}
+	if disk.AttachedTo != "" {
+		if err := lightsailService.DetachDisk(ctx, diskName); err != nil {
+			return err
+		}
+	}
 
+	err = utils.WaitForDiskState(ctx, diskName, "available", func() (string, error) {
+		disk, err := lightsailService.GetDisk(ctx, diskName)
+		if err != nil {
+			return "", err
+		}
+		return disk.State, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for disk %s: %w", diskName, err)
+	}
 	return nil
 }
 
+// waitForInstanceState waits for an instance to reach a state.
+func waitForInstanceState(ctx context.Context, lightsailService *aws.LightsailService, instanceName, state string) error {
+	return utils.WaitForInstanceState(ctx, instanceName, state, func() (string, error) {
+		instance, err := lightsailService.GetInstance(ctx, instanceName)
+		if err != nil {
+			return "", err
+		}
+		return instance.State, nil
+	})
+}
+
 // switchGPUMode switches an instance between GPU and standard bundles.
 func switchGPUMode(ctx context.Context, instanceName, action string, wait bool) error {
 	if action != "enable" && action != "disable" {
@@ -733,7 +1197,7 @@ func switchGPUMode(ctx context.Context, instanceName, action string, wait bool)
 	// Create snapshot
 	snapshotName := instanceName + "-gpu-snapshot"
 	fmt.Printf("Creating snapshot: %s\n", snapshotName)
-	err = lightsailService.CreateInstanceSnapshot(ctx, instanceName, snapshotName)
+	err = lightsailService.CreateInstanceSnapshot(ctx, instanceName, snapshotName, copyTags(instance.Tags))
 	if err != nil {
 		return fmt.Errorf("failed to create snapshot: %w", err)
 	}
@@ -746,7 +1210,7 @@ func switchGPUMode(ctx context.Context, instanceName, action string, wait bool)
 			if err != nil {
 				return "", err
 			}
-			return string(snapshot.State), nil
+			return snapshot.State, nil
 		})
 		if err != nil {
 			return fmt.Errorf("error waiting for snapshot: %w", err)
@@ -764,7 +1228,11 @@ func switchGPUMode(ctx context.Context, instanceName, action string, wait bool)
 	tags["GPUSwitchFrom"] = instanceName
 	tags["GPUMode"] = action
 
-	_, err = lightsailService.CreateInstanceFromSnapshot(ctx, newInstanceName, snapshotName, targetBundle.ID, instance.Region+"a", tags)
+	zone, err := snapshotZone("", instance.AvailabilityZone, instance.Region)
+	if err != nil {
+		return err
+	}
+	_, err = lightsailService.CreateInstanceFromSnapshot(ctx, newInstanceName, snapshotName, targetBundle.ID, zone, instance.SSHKeyName, tags)
 	if err != nil {
 		return fmt.Errorf("failed to create GPU-switched instance: %w", err)
 	}
@@ -773,8 +1241,8 @@ func switchGPUMode(ctx context.Context, instanceName, action string, wait bool)
 	fmt.Printf("New instance: %s (%s)\n", newInstanceName, targetBundle.Name)
 	fmt.Printf("\nNext steps:\n")
 	fmt.Printf("1. Wait for new instance to be ready\n")
-	fmt.Printf("2. Test the new instance: lfr ssh connect %s\n", strings.Split(newInstanceName, "-")[0])
-	fmt.Printf("3. Delete old instance: lfr instances delete %s\n", instanceName)
+	fmt.Printf("2. Test the new instance: %s\n", connectHint(ctx, awsClient, newInstanceName))
+	fmt.Printf("3. Delete old instance: aws lightsail delete-instance --instance-name %s\n", instanceName)
 	fmt.Printf("4. Rename new instance if desired\n")
 
 	return nil
@@ -0,0 +1,575 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+// keyPairPath returns where a key pair's private key is saved in keyDir.
+func keyPairPath(keyDir, name string) string {
+	return filepath.Join(keyDir, name+".pem")
+}
+
+// userKeyPath returns the saved private key of a user's key pair, or "" if
+// there is none, as for users created before per-user key pairs.
+func userKeyPath(keyDir, username string) string {
+	keyPath := keyPairPath(keyDir, aws.UserKeyPairName(username))
+	if _, err := os.Stat(keyPath); err != nil {
+		return ""
+	}
+	return keyPath
+}
+
+// instanceKeyPath returns the private key to reach an instance with: the key
+// pair of the user in usernames who owns it if saved, otherwise the region's
+// default key pair.
+func instanceKeyPath(ctx context.Context, lightsailService *aws.LightsailService, keyDir string, instance *types.Instance, usernames []string) (string, error) {
+	if owner := utils.InstanceOwner(instance.Name, usernames); owner != "" {
+		if keyPath := userKeyPath(keyDir, owner); keyPath != "" {
+			return keyPath, nil
+		}
+	}
+	return ensureDefaultKey(ctx, lightsailService, keyDir)
+}
+
+// ensureUserKeyPair creates a user's key pair and saves its private key in
+// the SSH key directory, or reuses it if both already exist. It returns the
+// key pair's name and an undo function that deletes what was created.
+func ensureUserKeyPair(ctx context.Context, lightsailService *aws.LightsailService, project, username string) (string, func(context.Context) error, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	name := aws.UserKeyPairName(username)
+	keyPath := keyPairPath(cfg.SSH.KeyPath, name)
+
+	_, err = lightsailService.GetInstanceSSHKeyPair(ctx, name)
+	switch {
+	case err == nil && userKeyPath(cfg.SSH.KeyPath, username) != "":
+		return name, func(context.Context) error { return nil }, nil
+	case err == nil:
+		return "", nil, fmt.Errorf("key pair %s exists but its private key is not in %s; delete the key pair or restore the key", name, cfg.SSH.KeyPath)
+	case !aws.IsNotFound(err):
+		return "", nil, err
+	}
+
+	privateKey, err := lightsailService.CreateKeyPair(ctx, name, map[string]string{"Project": project})
+	if err != nil {
+		return "", nil, err
+	}
+	undo := func(ctx context.Context) error {
+		// Keep the private key while the key pair exists, so a retry can adopt it
+		if err := lightsailService.DeleteKeyPair(ctx, name); err != nil {
+			return err
+		}
+		os.Remove(keyPath)
+		return nil
+	}
+
+	if err := saveKeyPair(keyPath, privateKey); err != nil {
+		return "", nil, errors.Join(err, undo(context.WithoutCancel(ctx)))
+	}
+	return name, undo, nil
+}
+
+// saveKeyPair writes a private key to keyPath with owner-only permissions.
+func saveKeyPair(keyPath, privateKey string) error {
+	keyBytes, err := decodePrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("failed to create SSH key directory: %w", err)
+	}
+
+	tmp := keyPath + ".tmp"
+	if err := os.WriteFile(tmp, keyBytes, 0600); err != nil {
+		return fmt.Errorf("failed to write SSH key file: %w", err)
+	}
+	if err := os.Rename(tmp, keyPath); err != nil {
+		return fmt.Errorf("failed to write SSH key file: %w", err)
+	}
+	return nil
+}
+
+// publicKeyOf returns the public key of a PEM private key.
+func publicKeyOf(privateKey []byte) (gossh.PublicKey, error) {
+	signer, err := gossh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key: %w", err)
+	}
+	return signer.PublicKey(), nil
+}
+
+// rotateUserKey replaces a user's key pair: a new key is authorized on the
+// instance next to the old ones, and once it has logged in, the old and
+// shared default keys are revoked, the key pair is replaced with it and the
+// user's token is re-issued. A rotation that fails before the new key logs in
+// leaves the old key pair and authorized_keys as they were.
+func rotateUserKey(ctx context.Context, project, username, outputDir string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	instances, err := lightsailService.ListInstances(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+	instance := findUserInstance(instances, username, usernames)
+	if instance == nil {
+		return fmt.Errorf("no instance found for user: %s", username)
+	}
+	if instance.State != "running" {
+		return fmt.Errorf("instance %s is %s; start it so its authorized_keys can be updated", instance.Name, instance.State)
+	}
+
+	// Keys to revoke: the user's current key and the shared default key
+	var revoke []gossh.PublicKey
+	name := aws.UserKeyPairName(username)
+	keyPath := keyPairPath(cfg.SSH.KeyPath, name)
+	if keyBytes, err := os.ReadFile(keyPath); err == nil {
+		if key, err := publicKeyOf(keyBytes); err == nil {
+			revoke = append(revoke, key)
+		}
+	}
+	if keyContent, err := lightsailService.DownloadSSHKey(ctx, ""); err == nil {
+		if keyBytes, err := decodePrivateKey(keyContent); err == nil {
+			if key, err := publicKeyOf(keyBytes); err == nil {
+				revoke = append(revoke, key)
+			}
+		}
+	}
+
+	fmt.Printf("Rotating key pair %s for %s...\n", name, instance.Name)
+
+	// The new key is generated here rather than by CreateKeyPair, as the key
+	// pair's name stays taken by the old key until the new one has logged in
+	privateKey, err := newRSAKey()
+	if err != nil {
+		return err
+	}
+	newKey, err := publicKeyOf(privateKey)
+	if err != nil {
+		return err
+	}
+	newKeyPath := keyPath + ".new"
+	if err := saveKeyPair(newKeyPath, string(privateKey)); err != nil {
+		return err
+	}
+
+	sshCfg, err := instanceSSHConfig(ctx, lightsailService, instance)
+	if err != nil {
+		os.Remove(newKeyPath)
+		return err
+	}
+	client, err := dialInstance(ctx, sshCfg)
+	if err != nil {
+		os.Remove(newKeyPath)
+		return fmt.Errorf("failed to connect to instance %s: %w", instance.Name, err)
+	}
+	defer client.Close()
+
+	if err := client.RunScript(ctx, authorizedKeysScript(nil, newKey, name), ssh.RunOptions{Stderr: os.Stderr}); err != nil {
+		os.Remove(newKeyPath)
+		return fmt.Errorf("failed to update authorized_keys on %s: %w", instance.Name, err)
+	}
+	undo := func(ctx context.Context) error {
+		os.Remove(newKeyPath)
+		if err := client.RunScript(ctx, authorizedKeysScript([]gossh.PublicKey{newKey}, nil, ""), ssh.RunOptions{Stderr: os.Stderr}); err != nil {
+			return fmt.Errorf("failed to remove the new key from authorized_keys on %s: %w", instance.Name, err)
+		}
+		return nil
+	}
+
+	// Log in as the user with the new key before giving up the old ones
+	loginCfg := sshCfg
+	loginCfg.PrivateKey, loginCfg.Certificate = privateKey, nil
+	login, err := dialInstance(ctx, loginCfg)
+	if err != nil {
+		err = fmt.Errorf("new key was not accepted by %s: %w", instance.Name, err)
+		return errors.Join(err, undo(context.WithoutCancel(ctx)))
+	}
+	login.Close()
+
+	if err := client.RunScript(ctx, authorizedKeysScript(revoke, newKey, name), ssh.RunOptions{Stderr: os.Stderr}); err != nil {
+		err = fmt.Errorf("failed to update authorized_keys on %s: %w", instance.Name, err)
+		return errors.Join(err, undo(context.WithoutCancel(ctx)))
+	}
+	if err := os.Rename(newKeyPath, keyPath); err != nil {
+		return fmt.Errorf("failed to save SSH key; %s now accepts only the key in %s: %w", instance.Name, newKeyPath, err)
+	}
+
+	fmt.Printf("✅ %s now accepts only the new key (%s)\n", instance.Name, gossh.FingerprintSHA256(newKey))
+	fmt.Printf("Private key saved to: %s\n", keyPath)
+
+	// The instance and the saved key are rotated by now, so a failure from
+	// here on is finished by rotating again
+	rerun := "lfr ssh keys rotate --user " + username
+	if project != "" {
+		rerun += " -p " + project
+	}
+	rerun = fmt.Sprintf("rerun '%s' to finish the rotation", rerun)
+	if err := lightsailService.DeleteKeyPair(ctx, name); err != nil && !aws.IsNotFound(err) {
+		return fmt.Errorf("failed to delete the old key pair %s after rotating the key of %s; %s: %w", name, instance.Name, rerun, err)
+	}
+	publicKey := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(newKey)))
+	if err := lightsailService.ImportKeyPair(ctx, name, publicKey, map[string]string{"Project": project}); err != nil {
+		return fmt.Errorf("failed to import the new key as key pair %s after rotating the key of %s; %s: %w", name, instance.Name, rerun, err)
+	}
+
+	tokenPath, err := reissueToken(cfg, project, username, outputDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔑 Re-issued token: %s\n", tokenPath)
+	fmt.Printf("Send it to %s to activate with: lfr connect activate %s <student-id>\n", username, filepath.Base(tokenPath))
+
+	return nil
+}
+
+// newRSAKey returns a new PEM private key. Lightsail only imports RSA keys.
+func newRSAKey() ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+}
+
+// authorizedKeysScript returns a script that removes the revoked keys from
+// the login user's authorized_keys and, unless it is nil, adds key.
+func authorizedKeysScript(revoke []gossh.PublicKey, key gossh.PublicKey, comment string) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	b.WriteString("mkdir -p ~/.ssh && chmod 700 ~/.ssh\n")
+	b.WriteString("f=~/.ssh/authorized_keys\n")
+	b.WriteString("touch \"$f\"\n")
+
+	// Keys are matched on their base64 blob, whatever their comment
+	if key != nil {
+		revoke = append(revoke, key)
+	}
+	b.WriteString("grep -v -F")
+	for _, old := range revoke {
+		blob := strings.Fields(string(gossh.MarshalAuthorizedKey(old)))[1]
+		b.WriteString(" -e " + ssh.Quote(blob))
+	}
+	b.WriteString(" \"$f\" > \"$f.lfr\" || true\n")
+	if key != nil {
+		line := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key))) + " " + comment
+		b.WriteString("echo " + ssh.Quote(line) + " >> \"$f.lfr\"\n")
+	}
+	b.WriteString("chmod 600 \"$f.lfr\"\n")
+	b.WriteString("mv \"$f.lfr\" \"$f\"\n")
+	return b.String()
+}
+
+// issuedTokenPath returns where a user's token file is written in outputDir.
+func issuedTokenPath(outputDir, project, username string) string {
+	return filepath.Join(outputDir, fmt.Sprintf("%s-%s.json", project, username))
+}
+
+// writeIssuedToken writes a token file for a user, carrying their private key
+// if they have a key pair, and returns its path.
+func writeIssuedToken(cfg *config.Config, outputDir string, token *config.StudentToken) (string, error) {
+	if keyPath := userKeyPath(cfg.SSH.KeyPath, token.Username); keyPath != "" {
+		keyData, err := os.ReadFile(keyPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read SSH key file: %w", err)
+		}
+		token.SSHKeyData = string(keyData)
+	}
+
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token: %w", err)
+	}
+
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	path := issuedTokenPath(outputDir, token.Project, token.Username)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write token file: %w", err)
+	}
+	return path, nil
+}
+
+// reissueToken re-issues a user's token file with their current key. The
+// previously issued token keeps its role, permissions and expiry; without one
+// a student token is issued.
+func reissueToken(cfg *config.Config, project, username, outputDir string) (string, error) {
+	var token *config.StudentToken
+
+	if data, err := os.ReadFile(issuedTokenPath(outputDir, project, username)); err == nil {
+		token = &config.StudentToken{}
+		if err := json.Unmarshal(data, token); err != nil {
+			return "", fmt.Errorf("failed to parse issued token: %w", err)
+		}
+	} else {
+		tm, err := config.NewTokenManager()
+		if err != nil {
+			return "", fmt.Errorf("failed to initialize token manager: %w", err)
+		}
+		_, token, err = tm.GenerateToken(project, username, username, "student",
+			[]string{"connect"}, classBucket(project), time.Now().AddDate(0, 6, 0))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	token.CreatedAt = time.Now()
+	return writeIssuedToken(cfg, outputDir, token)
+}
+
+// classBucket returns the status bucket of a class set up in the current
+// directory, or "" if there is none.
+func classBucket(project string) string {
+	data, err := os.ReadFile(fmt.Sprintf(".lfr-class-%s.json", project))
+	if err != nil {
+		return ""
+	}
+
+	var classConfig struct {
+		Bucket string `json:"bucket"`
+	}
+	if err := json.Unmarshal(data, &classConfig); err != nil {
+		return ""
+	}
+	return classConfig.Bucket
+}
+
+// sshKeyInfo is a key pair or saved private key in ssh keys list output.
+type sshKeyInfo struct {
+	Name string `json:"name" yaml:"name"`
+	// InLightsail is set if Lightsail has a key pair of this name.
+	InLightsail bool   `json:"in_lightsail" yaml:"in_lightsail"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	// File, Mode and PublicKeyFingerprint describe the saved private key.
+	File                 string   `json:"file,omitempty" yaml:"file,omitempty"`
+	Mode                 string   `json:"mode,omitempty" yaml:"mode,omitempty"`
+	PublicKeyFingerprint string   `json:"public_key_fingerprint,omitempty" yaml:"public_key_fingerprint,omitempty"`
+	Instances            []string `json:"instances" yaml:"instances"`
+	Warnings             []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// listSSHKeys lists Lightsail key pairs and the private keys saved in the SSH
+// key directory, with the instances each is installed on, warning about keys
+// other users can read and keys no instance uses.
+func listSSHKeys(ctx context.Context, project string, out *output.Renderer) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	keyPairs, err := lightsailService.ListKeyPairs(ctx)
+	if err != nil {
+		return err
+	}
+	instances, err := lightsailService.ListInstances(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	keys, err := sshKeyInventory(cfg.SSH.KeyPath, keyPairs, instances, project)
+	if err != nil {
+		return err
+	}
+
+	if out.Structured() {
+		return out.Render(keys, func() *output.Table {
+			table := output.NewTable("name", "in_lightsail", "fingerprint", "file", "mode", "public_key_fingerprint", "instances", "warnings")
+			for _, key := range keys {
+				table.AddRow(key.Name, key.InLightsail, key.Fingerprint, key.File, key.Mode, key.PublicKeyFingerprint,
+					strings.Join(key.Instances, " "), strings.Join(key.Warnings, "; "))
+			}
+			return table
+		})
+	}
+
+	if project != "" {
+		fmt.Printf("SSH keys for project: %s\n\n", project)
+	}
+	if len(keys) == 0 {
+		fmt.Println("No SSH keys found.")
+		return nil
+	}
+
+	fmt.Printf("%-25s %-10s %-6s %-52s %s\n", "NAME", "LIGHTSAIL", "MODE", "FINGERPRINT", "INSTANCES")
+	fmt.Println(strings.Repeat("-", 120))
+
+	warnings := 0
+	for _, key := range keys {
+		inLightsail := "no"
+		if key.InLightsail {
+			inLightsail = "yes"
+		}
+		mode := key.Mode
+		if mode == "" {
+			mode = "-"
+		}
+		fingerprint := key.PublicKeyFingerprint
+		if fingerprint == "" {
+			fingerprint = key.Fingerprint
+		}
+		instanceNames := strings.Join(key.Instances, ", ")
+		if instanceNames == "" {
+			instanceNames = "-"
+		}
+		fmt.Printf("%-25s %-10s %-6s %-52s %s\n", key.Name, inLightsail, mode, fingerprint, instanceNames)
+		warnings += len(key.Warnings)
+	}
+
+	if warnings > 0 {
+		fmt.Println()
+		for _, key := range keys {
+			for _, warning := range key.Warnings {
+				fmt.Printf("⚠️  %s: %s\n", key.Name, warning)
+			}
+		}
+	}
+
+	fmt.Printf("\nTotal: %d keys\n", len(keys))
+	return nil
+}
+
+// sshKeyInventory matches key pairs with the private keys saved in keyDir, by
+// name, and with the instances they are installed on. With a project, only
+// keys of its instances or tagged with it are included.
+func sshKeyInventory(keyDir string, keyPairs []*types.KeyPair, instances []*types.Instance, project string) ([]*sshKeyInfo, error) {
+	byName := make(map[string]*sshKeyInfo)
+	key := func(name string) *sshKeyInfo {
+		if byName[name] == nil {
+			byName[name] = &sshKeyInfo{Name: name, Instances: []string{}}
+		}
+		return byName[name]
+	}
+
+	for _, instance := range instances {
+		name := instance.SSHKeyName
+		if name == "" {
+			name = aws.DefaultKeyPairName
+		}
+		info := key(name)
+		info.Instances = append(info.Instances, instance.Name)
+	}
+
+	for _, keyPair := range keyPairs {
+		if project != "" && byName[keyPair.Name] == nil && keyPair.Tags["Project"] != project {
+			continue
+		}
+		info := key(keyPair.Name)
+		info.InLightsail = true
+		info.Fingerprint = keyPair.Fingerprint
+	}
+
+	entries, err := os.ReadDir(keyDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read SSH key directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".pem")
+		if name == "LightsailDefaultKey" {
+			name = aws.DefaultKeyPairName
+		}
+		if project != "" && byName[name] == nil {
+			continue
+		}
+
+		info := key(name)
+		info.File = filepath.Join(keyDir, entry.Name())
+		describeKeyFile(info)
+	}
+
+	keys := make([]*sshKeyInfo, 0, len(byName))
+	for _, info := range byName {
+		if len(info.Instances) == 0 {
+			info.Warnings = append(info.Warnings, "not installed on any instance")
+		}
+		if info.InLightsail && info.File == "" && info.Name != aws.DefaultKeyPairName {
+			info.Warnings = append(info.Warnings, "private key is not saved in "+keyDir)
+		}
+		keys = append(keys, info)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+// describeKeyFile fills in a saved private key's mode and fingerprint, with
+// warnings if ssh would refuse it.
+func describeKeyFile(info *sshKeyInfo) {
+	fileInfo, err := os.Stat(info.File)
+	if err != nil {
+		info.Warnings = append(info.Warnings, err.Error())
+		return
+	}
+
+	perm := fileInfo.Mode().Perm()
+	info.Mode = fmt.Sprintf("%04o", perm)
+	switch {
+	case perm&0007 != 0:
+		info.Warnings = append(info.Warnings, "world-readable; run chmod 600 "+info.File)
+	case perm&0070 != 0:
+		info.Warnings = append(info.Warnings, "readable by its group; run chmod 600 "+info.File)
+	}
+
+	keyBytes, err := os.ReadFile(info.File)
+	if err != nil {
+		info.Warnings = append(info.Warnings, err.Error())
+		return
+	}
+	publicKey, err := publicKeyOf(keyBytes)
+	var missing *gossh.PassphraseMissingError
+	if errors.As(err, &missing) && missing.PublicKey != nil {
+		publicKey, err = missing.PublicKey, nil
+	}
+	if err != nil {
+		info.Warnings = append(info.Warnings, "not a usable private key")
+		return
+	}
+	info.PublicKeyFingerprint = gossh.FingerprintSHA256(publicKey)
+}
@@ -0,0 +1,550 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/manifest"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan [manifest-file]",
+	Short: "Show the changes needed to match a project manifest",
+	Long: `Compare a YAML project manifest (users, blueprints, bundles, groups, disks,
+EFS mounts, software packs and idle settings) with the live Lightsail and IAM state
+and show what lfr apply would change. Nothing is modified.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prune, _ := cmd.Flags().GetBool("prune")
+
+		return planManifest(cmd.Context(), args[0], prune)
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [manifest-file]",
+	Short: "Create the resources in a project manifest",
+	Long: `Converge live Lightsail and IAM state on a YAML project manifest. Missing groups,
+users, instances, group memberships, disks and EFS file systems are created; software
+packs and EFS mounts are set up on newly created instances, and the idle detection of
+existing instances is updated. With --prune, project users and disks that are not in
+the manifest are deleted.
+
+Drift that can't be fixed in place, such as a different bundle, is reported but not changed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prune, _ := cmd.Flags().GetBool("prune")
+		confirm, _ := cmd.Flags().GetBool("confirm")
+
+		return applyManifest(cmd.Context(), args[0], prune, confirm)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(applyCmd)
+
+	planCmd.Flags().Bool("prune", false, "Include deletion of project users and disks that are not in the manifest")
+
+	applyCmd.Flags().Bool("prune", false, "Delete project users and disks that are not in the manifest")
+	applyCmd.Flags().BoolP("confirm", "y", false, "Apply the changes (otherwise only the plan is shown)")
+}
+
+// planManifest prints the plan for a manifest.
+func planManifest(ctx context.Context, path string, prune bool) error {
+	m, err := manifest.Load(path)
+	if err != nil {
+		return err
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	live, err := loadProjectState(ctx, awsClient, m)
+	if err != nil {
+		return err
+	}
+
+	plan := manifest.Diff(m, live, prune)
+	printPlan(m, plan)
+
+	if !plan.Empty() {
+		fmt.Printf("\nRun 'lfr apply %s' to make these changes.\n", path)
+	}
+	return nil
+}
+
+// applyManifest converges live state on a manifest.
+func applyManifest(ctx context.Context, path string, prune, confirm bool) error {
+	m, err := manifest.Load(path)
+	if err != nil {
+		return err
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	live, err := loadProjectState(ctx, awsClient, m)
+	if err != nil {
+		return err
+	}
+
+	plan := manifest.Diff(m, live, prune)
+	printPlan(m, plan)
+
+	if plan.Empty() {
+		return nil
+	}
+
+	if !confirm {
+		fmt.Printf("\n⚠️  Run with --confirm to apply these changes.\n")
+		return nil
+	}
+
+	fmt.Printf("\nApplying changes...\n")
+	return newApplier(awsClient, m, live).apply(ctx, plan)
+}
+
+// newAWSClient creates an AWS client from the loaded configuration.
+func newAWSClient(ctx context.Context) (*aws.Client, error) {
+	// Load configuration
+	_, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Create AWS client
+	awsClient, err := aws.NewClient(ctx, aws.Options{
+		Region:  viper.GetString("aws.region"),
+		Profile: viper.GetString("aws.profile"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	return awsClient, nil
+}
+
+// loadProjectState reads the live state of the resources a manifest manages.
+func loadProjectState(ctx context.Context, awsClient *aws.Client, m *manifest.Manifest) (*manifest.State, error) {
+	iamService := aws.NewIAMService(awsClient)
+	lightsailService := aws.NewLightsailService(awsClient)
+	live := manifest.NewState()
+
+	instances, err := lightsailService.ListInstances(ctx, m.Project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	iamUsernames, err := iamService.ListUsernames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usernames := append([]string(nil), iamUsernames...)
+	for _, user := range m.Users {
+		usernames = append(usernames, user.Name)
+	}
+
+	// Match each user to their instance, preferring the exact username-blueprint
+	// name, then attribute the remaining instances to the manifest or IAM user
+	// that owns them. Instances no user owns are kept under their own name, so
+	// that pruning removes them.
+	claimed := make(map[string]bool)
+	for _, user := range m.Users {
+		for _, instance := range instances {
+			if instance.Name == m.InstanceName(user) {
+				live.Instances[user.Name] = instance
+				claimed[instance.Name] = true
+			}
+		}
+	}
+	for _, instance := range instances {
+		if claimed[instance.Name] {
+			continue
+		}
+		owner := utils.InstanceOwner(instance.Name, usernames)
+		if owner == "" {
+			owner = instance.Name
+		}
+		if live.Instances[owner] == nil {
+			live.Instances[owner] = instance
+		}
+	}
+
+	for _, user := range m.Users {
+		if _, err := iamService.GetUser(ctx, user.Name); err != nil {
+			if aws.IsNoSuchEntity(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get user %s: %w", user.Name, err)
+		}
+
+		groups, err := iamService.ListUserGroups(ctx, user.Name)
+		if err != nil {
+			return nil, err
+		}
+		live.Users[user.Name] = groups
+	}
+
+	// Other project users are only needed for pruning
+	projectUsers, err := iamService.ListProjectUsers(ctx, m.Project)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range projectUsers {
+		if _, ok := live.Users[user.Username]; !ok {
+			live.Users[user.Username] = nil
+		}
+	}
+
+	for _, group := range m.Groups {
+		if _, err := iamService.GetGroup(ctx, group.Name); err != nil {
+			if aws.IsNoSuchEntity(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get group %s: %w", group.Name, err)
+		}
+		live.Groups[group.Name] = true
+	}
+
+	disks, err := lightsailService.ListDisks(ctx, m.Project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list disks: %w", err)
+	}
+	for _, disk := range disks {
+		live.Disks[disk.Name] = disk
+	}
+
+	// Disks in the manifest may exist without the project tag
+	for _, user := range m.Users {
+		for _, disk := range user.Disks {
+			if live.Disks[disk.Name] != nil {
+				continue
+			}
+			existing, err := lightsailService.GetDisk(ctx, disk.Name)
+			if err != nil {
+				if aws.IsNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get disk %s: %w", disk.Name, err)
+			}
+			live.Disks[disk.Name] = existing
+		}
+	}
+
+	if len(m.EFS) > 0 {
+		fileSystems, err := aws.NewEFSService(awsClient).ListEFSFileSystems(ctx, m.Project)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list EFS file systems: %w", err)
+		}
+		for _, fs := range fileSystems {
+			live.FileSystems[fs.Name] = fs.ID
+		}
+	}
+
+	return live, nil
+}
+
+// printPlan prints the changes in a plan.
+func printPlan(m *manifest.Manifest, plan *manifest.Plan) {
+	fmt.Printf("Project: %s\n\n", m.Project)
+
+	if len(plan.Changes) == 0 {
+		fmt.Println("✅ No changes. Live state matches the manifest.")
+	}
+	for _, change := range plan.Changes {
+		fmt.Printf("  %s\n", change)
+	}
+
+	if len(plan.Unmanaged) > 0 {
+		fmt.Printf("\nNot in the manifest (use --prune to delete): %s\n", strings.Join(plan.Unmanaged, ", "))
+	}
+
+	if len(plan.Changes) > 0 {
+		fmt.Printf("\nPlan: %d to create, %d to update, %d to delete, %d need manual action\n",
+			plan.Count(manifest.ActionCreate), plan.Count(manifest.ActionUpdate), plan.Count(manifest.ActionDelete), plan.Count(manifest.ActionManual))
+	}
+}
+
+// manifestApplier applies the changes in a plan.
+type manifestApplier struct {
+	iam       *aws.IAMService
+	lightsail *aws.LightsailService
+	efs       *aws.EFSService
+	manifest  *manifest.Manifest
+	live      *manifest.State
+	// zone is the availability zone for new instances.
+	zone string
+
+	usersGroupReady bool
+	// created are the instances created by this apply.
+	created map[string]bool
+	// failedUsers are the users whose user or instance could not be created.
+	failedUsers map[string]bool
+	provisioned []*userProvisionResult
+}
+
+func newApplier(awsClient *aws.Client, m *manifest.Manifest, live *manifest.State) *manifestApplier {
+	zone := m.Zone
+	if zone == "" {
+		zone = awsClient.GetRegion() + "a"
+	}
+
+	return &manifestApplier{
+		iam:         aws.NewIAMService(awsClient),
+		lightsail:   aws.NewLightsailService(awsClient),
+		efs:         aws.NewEFSService(awsClient),
+		manifest:    m,
+		live:        live,
+		zone:        zone,
+		created:     make(map[string]bool),
+		failedUsers: make(map[string]bool),
+	}
+}
+
+// apply makes the changes in order, skipping the remaining changes for a user
+// whose user or instance could not be created.
+func (a *manifestApplier) apply(ctx context.Context, plan *manifest.Plan) error {
+	applied, failed, skipped := 0, 0, 0
+
+	for _, change := range plan.Changes {
+		if change.Action == manifest.ActionManual {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if change.User != nil && a.failedUsers[change.User.Name] {
+			fmt.Printf("⏭️  %s: skipped, %s was not created\n", change, change.User.Name)
+			skipped++
+			continue
+		}
+
+		if err := a.applyChange(ctx, change); err != nil {
+			fmt.Printf("❌ %s: %v\n", change, err)
+			failed++
+			if change.User != nil && (change.Kind == manifest.KindUser || change.Kind == manifest.KindInstance) {
+				a.failedUsers[change.User.Name] = true
+			}
+			continue
+		}
+
+		fmt.Printf("✅ %s\n", change)
+		applied++
+	}
+
+	if len(a.provisioned) > 0 {
+		printProvisionSummary(a.provisioned)
+	}
+
+	fmt.Printf("\nApplied %d changes", applied)
+	if failed > 0 || skipped > 0 {
+		fmt.Printf(" (%d failed, %d skipped)", failed, skipped)
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		return fmt.Errorf("failed to apply %d of %d changes", failed, applied+failed+skipped)
+	}
+	return nil
+}
+
+func (a *manifestApplier) applyChange(ctx context.Context, change manifest.Change) error {
+	m := a.manifest
+
+	switch {
+	case change.Kind == manifest.KindGroup:
+		_, err := a.iam.CreateGroup(ctx, change.Group.Name, change.Group.Description, change.Group.Policies)
+		return err
+
+	case change.Kind == manifest.KindEFS:
+		return createEFSFileSystem(ctx, change.EFS.Name, m.Project)
+
+	case change.Kind == manifest.KindUser && change.Action == manifest.ActionCreate:
+		if err := a.ensureUsersGroup(ctx); err != nil {
+			return err
+		}
+
+		// provisionUser adopts the user's existing instance, if any
+		user := *change.User
+		instanceName := a.instanceName(user)
+		result := provisionUser(ctx, a.iam, a.lightsail, m.Project, m.BlueprintFor(user), m.BundleFor(user), a.zone, user.Name, instanceName, a.idleSettings())
+		a.provisioned = append(a.provisioned, result)
+		if result.Err != nil {
+			return result.Err
+		}
+		if a.live.Instances[user.Name] == nil {
+			a.created[instanceName] = true
+		}
+		return nil
+
+	case change.Kind == manifest.KindUser && change.Action == manifest.ActionDelete:
+		// The live state already decided which instance is the user's
+		if instance := a.live.Instances[change.Name]; instance != nil {
+			if err := a.lightsail.DeleteInstance(ctx, instance.Name); err != nil {
+				return fmt.Errorf("failed to delete instance %s: %w", instance.Name, err)
+			}
+		}
+		err := removeUser(ctx, a.iam, a.lightsail, change.Name, nil, nil)
+		if aws.IsNoSuchEntity(err) {
+			// Only the instance was left
+			return nil
+		}
+		return err
+
+	case change.Kind == manifest.KindInstance:
+		user := *change.User
+		keyPair, _, err := ensureUserKeyPair(ctx, a.lightsail, m.Project, user.Name)
+		if err != nil {
+			return err
+		}
+		instance, err := a.lightsail.CreateInstanceWithIdle(ctx, m.InstanceName(user), m.BlueprintFor(user), m.BundleFor(user), a.zone, m.Project, keyPair, a.idleSettings())
+		if err != nil {
+			return err
+		}
+		a.created[instance.Name] = true
+		return a.iam.UpdateUserInstanceAccess(ctx, user.Name, []string{instance.ARN}, nil)
+
+	case change.Kind == manifest.KindMembership:
+		if change.Group.Name == manifest.UsersGroup {
+			if err := a.ensureUsersGroup(ctx); err != nil {
+				return err
+			}
+		}
+		return a.iam.AddUserToGroup(ctx, change.User.Name, change.Group.Name)
+
+	case change.Kind == manifest.KindIdle:
+		return a.lightsail.SetIdleDetection(ctx, change.Name, a.idleSettings())
+
+	case change.Kind == manifest.KindDisk && change.Action == manifest.ActionCreate:
+		disk := change.Disk
+		if _, err := a.lightsail.CreateDisk(ctx, disk.Name, disk.SizeGB, a.diskZone(*change.User), m.Project); err != nil {
+			return err
+		}
+		if err := utils.WaitForDiskState(ctx, disk.Name, "available", func() (string, error) {
+			d, err := a.lightsail.GetDisk(ctx, disk.Name)
+			if err != nil {
+				return "", err
+			}
+			return d.State, nil
+		}); err != nil {
+			return fmt.Errorf("error waiting for disk %s: %w", disk.Name, err)
+		}
+		return a.attachDisk(ctx, *change.User, disk)
+
+	case change.Kind == manifest.KindDisk && change.Action == manifest.ActionDelete:
+		if err := detachDisk(ctx, a.lightsail, change.Name); err != nil {
+			return err
+		}
+		return a.lightsail.DeleteDisk(ctx, change.Name)
+
+	case change.Kind == manifest.KindAttachment:
+		return a.attachDisk(ctx, *change.User, change.Disk)
+
+	case change.Kind == manifest.KindSoftware:
+		if err := a.waitUntilRunning(ctx, *change.User); err != nil {
+			return err
+		}
+		return installSoftwarePack(ctx, change.Pack, change.User.Name, m.Project, false)
+
+	case change.Kind == manifest.KindMount:
+		fsID, err := a.fileSystemID(ctx, change.EFS.Name)
+		if err != nil {
+			return err
+		}
+		mode := change.EFS.Mode
+		if mode == "" {
+			mode = "rw"
+		}
+		return mountEFSOnInstance(ctx, fsID, change.User.Name, change.EFS.MountPoint, m.Project, mode)
+	}
+
+	return fmt.Errorf("unsupported change: %s %s", change.Action, change.Kind)
+}
+
+// ensureUsersGroup ensures the group all users join exists, once per apply.
+func (a *manifestApplier) ensureUsersGroup(ctx context.Context) error {
+	if a.usersGroupReady {
+		return nil
+	}
+	if err := ensureUsersGroup(ctx, a.iam); err != nil {
+		return err
+	}
+	a.usersGroupReady = true
+	return nil
+}
+
+// diskZone returns the availability zone for a user's disk, which must be the
+// zone of the instance it attaches to.
+func (a *manifestApplier) diskZone(user manifest.User) string {
+	if instance := a.live.Instances[user.Name]; instance != nil && instance.AvailabilityZone != "" {
+		return instance.AvailabilityZone
+	}
+	return a.zone
+}
+
+// idleSettings returns the manifest's idle settings.
+func (a *manifestApplier) idleSettings() aws.IdleSettings {
+	if a.manifest.Idle == nil {
+		return aws.DefaultIdleSettings
+	}
+	return aws.IdleSettings{ThresholdMinutes: a.manifest.Idle.Threshold, DurationMinutes: a.manifest.Idle.Duration}
+}
+
+// instanceName returns the name of a user's existing or newly created instance.
+func (a *manifestApplier) instanceName(user manifest.User) string {
+	if instance := a.live.Instances[user.Name]; instance != nil {
+		return instance.Name
+	}
+	return a.manifest.InstanceName(user)
+}
+
+// waitUntilRunning waits for an instance created by this apply to start.
+func (a *manifestApplier) waitUntilRunning(ctx context.Context, user manifest.User) error {
+	instanceName := a.instanceName(user)
+	if !a.created[instanceName] {
+		return nil
+	}
+	return waitForInstanceState(ctx, a.lightsail, instanceName, "running")
+}
+
+func (a *manifestApplier) attachDisk(ctx context.Context, user manifest.User, disk *manifest.Disk) error {
+	if err := a.waitUntilRunning(ctx, user); err != nil {
+		return err
+	}
+	return a.lightsail.AttachDisk(ctx, disk.Name, a.instanceName(user), disk.Path)
+}
+
+// fileSystemID returns the ID of a project EFS file system, looking it up if it
+// was created by this apply.
+func (a *manifestApplier) fileSystemID(ctx context.Context, name string) (string, error) {
+	if id, ok := a.live.FileSystems[name]; ok {
+		return id, nil
+	}
+
+	fileSystems, err := a.efs.ListEFSFileSystems(ctx, a.manifest.Project)
+	if err != nil {
+		return "", fmt.Errorf("failed to list EFS file systems: %w", err)
+	}
+	for _, fs := range fileSystems {
+		a.live.FileSystems[fs.Name] = fs.ID
+	}
+
+	id, ok := a.live.FileSystems[name]
+	if !ok {
+		return "", fmt.Errorf("EFS file system %s not found", name)
+	}
+	return id, nil
+}
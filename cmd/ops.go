@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/lfr-tools/internal/journal"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+var opsCmd = &cobra.Command{
+	Use:   "ops",
+	Short: "Inspect and resume bulk operations",
+	Long: `Bulk commands record the progress of every item in a journal under
+~/.lfr-tools/operations. Use these commands to inspect past runs and to resume a
+run that was interrupted or had failures.`,
+}
+
+var opsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recorded bulk operations",
+	Long:  `List recorded bulk operations, most recent first.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		return listOperations(limit)
+	},
+}
+
+var opsShowCmd = &cobra.Command{
+	Use:   "show [operation-id]",
+	Short: "Show the items of a bulk operation",
+	Long:  `Show the arguments and per-item state of a bulk operation. A unique ID prefix is accepted.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showOperation(args[0])
+	},
+}
+
+var opsResumeCmd = &cobra.Command{
+	Use:   "resume [operation-id]",
+	Short: "Resume an interrupted or failed bulk operation",
+	Long: `Re-run a bulk operation for the items that did not succeed, recording progress
+in the same journal. Items that already succeeded are skipped.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		parallel, _ := cmd.Flags().GetInt("parallel")
+
+		return resumeOperation(cmd.Context(), args[0], parallel)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(opsCmd)
+
+	opsCmd.AddCommand(opsListCmd)
+	opsCmd.AddCommand(opsShowCmd)
+	opsCmd.AddCommand(opsResumeCmd)
+
+	opsListCmd.Flags().IntP("limit", "n", 20, "Maximum number of operations to show (0 for all)")
+
+	opsResumeCmd.Flags().Int("parallel", 0, "Override the number of concurrent workers")
+}
+
+// operationKey is the context key for an operation being resumed.
+type operationKey struct{}
+
+// beginOperation returns the operation being resumed in ctx, or starts a new
+// journal for the command. If the journal can't be written the command runs
+// without one and a nil operation is returned.
+func beginOperation(ctx context.Context, command string, args map[string]string, items []string) *journal.Operation {
+	if op, ok := ctx.Value(operationKey{}).(*journal.Operation); ok {
+		return op
+	}
+
+	store, err := journal.NewStore()
+	if err != nil {
+		fmt.Printf("⚠️  Warning: progress will not be journaled: %v\n", err)
+		return nil
+	}
+
+	op, err := store.Create(command, args, items)
+	if err != nil {
+		fmt.Printf("⚠️  Warning: progress will not be journaled: %v\n", err)
+		return nil
+	}
+
+	fmt.Printf("Operation ID: %s\n", op.ID)
+	return op
+}
+
+// withoutOperation returns a context in which nested bulk commands neither
+// record progress in the caller's operation nor start journals of their own.
+func withoutOperation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, operationKey{}, (*journal.Operation)(nil))
+}
+
+// finishOperation records the final status of an operation and explains how to
+// resume it if it did not complete.
+func finishOperation(ctx context.Context, op *journal.Operation) {
+	if op == nil {
+		return
+	}
+
+	op.Finish(ctx.Err() != nil)
+	if op.Status != journal.StatusCompleted {
+		fmt.Printf("\nTo retry the remaining items: lfr ops resume %s\n", op.ID)
+	}
+}
+
+// listOperations lists recorded operations.
+func listOperations(limit int) error {
+	store, err := journal.NewStore()
+	if err != nil {
+		return err
+	}
+
+	ops, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	if len(ops) == 0 {
+		fmt.Println("No operations recorded.")
+		return nil
+	}
+	if limit > 0 && len(ops) > limit {
+		ops = ops[:limit]
+	}
+
+	fmt.Printf("%-24s %-22s %-12s %-10s %-8s %-20s\n",
+		"ID", "COMMAND", "STATUS", "DONE", "FAILED", "STARTED")
+	fmt.Println(strings.Repeat("-", 100))
+
+	for _, op := range ops {
+		counts := op.Counts()
+		fmt.Printf("%-24s %-22s %-12s %-10s %-8d %-20s\n",
+			op.ID,
+			op.Command,
+			op.Status,
+			fmt.Sprintf("%d/%d", counts[journal.ItemSucceeded], len(op.Items)),
+			counts[journal.ItemFailed],
+			op.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+// showOperation shows an operation and the state of each item.
+func showOperation(id string) error {
+	store, err := journal.NewStore()
+	if err != nil {
+		return err
+	}
+
+	op, err := store.Load(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Operation: %s\n", op.ID)
+	fmt.Printf("Command:   lfr %s\n", op.Command)
+	fmt.Printf("Status:    %s\n", op.Status)
+	fmt.Printf("Started:   %s\n", op.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Updated:   %s\n", op.UpdatedAt.Format("2006-01-02 15:04:05"))
+	if op.Resumes > 0 {
+		fmt.Printf("Resumed:   %d times\n", op.Resumes)
+	}
+
+	if len(op.Args) > 0 {
+		fmt.Printf("\nArguments:\n")
+		for _, key := range sortedArgKeys(op.Args) {
+			fmt.Printf("  %s: %s\n", key, op.Args[key])
+		}
+	}
+
+	fmt.Printf("\n%-30s %-10s %-8s %-20s %s\n", "ITEM", "STATE", "TRIES", "UPDATED", "ERROR")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, item := range op.Items {
+		updated := "-"
+		if !item.UpdatedAt.IsZero() {
+			updated = item.UpdatedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-30s %-10s %-8d %-20s %s\n", item.Name, item.State, item.Attempts, updated, item.Error)
+	}
+
+	counts := op.Counts()
+	fmt.Printf("\nTotal: %d items (%d succeeded, %d failed, %d pending)\n",
+		len(op.Items), counts[journal.ItemSucceeded], counts[journal.ItemFailed],
+		counts[journal.ItemPending]+counts[journal.ItemRunning])
+
+	if op.Status != journal.StatusCompleted {
+		fmt.Printf("\nTo retry the remaining items: lfr ops resume %s\n", op.ID)
+	}
+
+	return nil
+}
+
+// resumeOperation re-runs the command of an operation for its unfinished items.
+func resumeOperation(ctx context.Context, id string, parallel int) error {
+	store, err := journal.NewStore()
+	if err != nil {
+		return err
+	}
+
+	op, err := store.Load(id)
+	if err != nil {
+		return err
+	}
+
+	remaining := op.Unfinished()
+	if len(remaining) == 0 {
+		fmt.Printf("✅ Operation %s has no remaining items.\n", op.ID)
+		op.Finish(false)
+		return nil
+	}
+
+	args := make(map[string]string, len(op.Args))
+	for key, value := range op.Args {
+		args[key] = value
+	}
+	if parallel > 0 {
+		args["parallel"] = strconv.Itoa(parallel)
+	}
+
+	fmt.Printf("Resuming operation %s: lfr %s\n", op.ID, op.Command)
+	fmt.Printf("Remaining items: %d of %d\n\n", len(remaining), len(op.Items))
+
+	op.Resume()
+	ctx = context.WithValue(ctx, operationKey{}, op)
+
+	a := operationArgs(args)
+	switch op.Command {
+	case "users create-bulk":
+		// The recorded rows are used, so changes to the CSV file don't apply
+		var users []utils.BulkUser
+		if err := op.DecodeInput(&users); err != nil {
+			op.Finish(false)
+			return fmt.Errorf("operation %s cannot be resumed: %w", op.ID, err)
+		}
+		return provisionBulkUsers(ctx, a.String("csv"), users, a.Bool("continue-on-error"), a.Bool("start-stopped"), a.Int("parallel"))
+	case "users remove-bulk":
+		// Only the recorded users are removed, even if the run was for a project
+		return removeBulkUsers(ctx, remaining, "", "", true, a.Int("parallel"))
+	case "instances start":
+		return startInstances(ctx, a.Strings("users"), a.String("project"), a.Bool("wait"), a.Int("parallel"))
+	case "instances stop":
+		return stopInstances(ctx, a.Strings("users"), a.String("project"), a.Bool("wait"), a.Int("parallel"))
+	case "idle configure-bulk":
+		return configureIdleDetectionBulk(ctx, a.String("project"), a.Strings("users"), a.Int("threshold"), a.Int("duration"), a.Bool("disable"), a.Int("parallel"))
+	default:
+		op.Finish(false)
+		return fmt.Errorf("operation %s cannot be resumed: unknown command %q", op.ID, op.Command)
+	}
+}
+
+// operationArgs reads typed values from an operation's recorded arguments.
+type operationArgs map[string]string
+
+func (a operationArgs) String(key string) string {
+	return a[key]
+}
+
+func (a operationArgs) Bool(key string) bool {
+	value, _ := strconv.ParseBool(a[key])
+	return value
+}
+
+func (a operationArgs) Int(key string) int {
+	value, _ := strconv.Atoi(a[key])
+	return value
+}
+
+func (a operationArgs) Strings(key string) []string {
+	if a[key] == "" {
+		return nil
+	}
+	return strings.Split(a[key], ",")
+}
+
+// sortedArgKeys returns the argument names in sorted order.
+func sortedArgKeys(args map[string]string) []string {
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
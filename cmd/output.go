@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+)
+
+// addOutputFlags adds the --output and --template flags to a list or status command.
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", string(output.FormatTable), "Output format (table, json, yaml, csv, template)")
+	cmd.Flags().String("template", "", "Go template for --output template, applied to the list of results")
+}
+
+// newRenderer creates a renderer on the command's output from its output flags.
+func newRenderer(cmd *cobra.Command) (*output.Renderer, error) {
+	format, _ := cmd.Flags().GetString("output")
+	tmpl, _ := cmd.Flags().GetString("template")
+	if tmpl != "" && !cmd.Flags().Changed("output") {
+		format = string(output.FormatTemplate)
+	}
+
+	return output.NewRenderer(cmd.OutOrStdout(), output.Options{
+		Format:   output.Format(format),
+		Template: tmpl,
+	})
+}
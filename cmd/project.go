@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/lfr-tools/internal/audit"
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+)
+
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Inspect projects",
+	Long:  `Commands that operate on a project as a whole.`,
+}
+
+var projectAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Detect drift in a project's users, policies, instances and disks",
+	Long: `Cross-check the IAM users tagged with a project against Lightsail-Users group
+membership, their LightsailLimitedAccess policies, instance Project tags and disk
+attachments, and report orphans and mismatches.
+
+With --fix, missing group memberships, missing or out-of-date instance policies and
+missing Project tags on the users' instances and attached disks are repaired. Orphaned
+users, instances and disks are only reported.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		fix, _ := cmd.Flags().GetBool("fix")
+
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+		if fix && out.Structured() {
+			return fmt.Errorf("--fix can't be combined with --output %s", out.Format())
+		}
+
+		return auditProject(cmd.Context(), project, fix, out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(projectCmd)
+
+	projectCmd.AddCommand(projectAuditCmd)
+
+	projectAuditCmd.Flags().StringP("project", "p", "", "Project name (required)")
+	projectAuditCmd.Flags().Bool("fix", false, "Repair the findings that can be fixed automatically")
+	addOutputFlags(projectAuditCmd)
+
+	projectAuditCmd.MarkFlagRequired("project")
+}
+
+// auditProject reports drift in a project and optionally repairs it.
+func auditProject(ctx context.Context, project string, fix bool, out *output.Renderer) error {
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadAuditState(ctx, awsClient, project)
+	if err != nil {
+		return err
+	}
+
+	findings := audit.Check(state)
+
+	if out.Structured() {
+		return out.Render(findings, func() *output.Table {
+			table := output.NewTable("kind", "resource", "detail", "fixable")
+			for _, finding := range findings {
+				table.AddRow(finding.Kind, finding.Resource, finding.Detail, finding.Fixable)
+			}
+			return table
+		})
+	}
+
+	fmt.Printf("Audit of project %s: %d users, %d instances checked\n\n", project, len(state.Users), len(state.Instances))
+
+	if len(findings) == 0 {
+		fmt.Println("✅ No drift found.")
+		return nil
+	}
+
+	fmt.Printf("%-22s %-28s %-8s %s\n", "KIND", "RESOURCE", "FIX", "DETAIL")
+	fmt.Println(strings.Repeat("-", 110))
+	for _, finding := range findings {
+		repair := "manual"
+		if finding.Fixable {
+			repair = "auto"
+		}
+		fmt.Printf("%-22s %-28s %-8s %s\n", finding.Kind, finding.Resource, repair, finding.Detail)
+	}
+
+	fixable := audit.Fixable(findings)
+	fmt.Printf("\nFound %d issues, %d can be fixed automatically.\n", len(findings), len(fixable))
+
+	if len(fixable) == 0 {
+		return nil
+	}
+	if !fix {
+		fmt.Printf("Run with --fix to repair them.\n")
+		return nil
+	}
+
+	fmt.Printf("\nFixing...\n")
+	return fixFindings(ctx, awsClient, project, fixable)
+}
+
+// loadAuditState reads the project's IAM users and every instance and disk in
+// the region.
+func loadAuditState(ctx context.Context, awsClient *aws.Client, project string) (*audit.State, error) {
+	iamService := aws.NewIAMService(awsClient)
+	lightsailService := aws.NewLightsailService(awsClient)
+	state := &audit.State{Project: project}
+
+	users, err := iamService.ListProjectUsers(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		groups, err := iamService.ListUserGroups(ctx, user.Username)
+		if err != nil {
+			return nil, err
+		}
+
+		auditUser := audit.User{Name: user.Username, Groups: groups}
+		document, err := iamService.GetUserPolicy(ctx, user.Username, aws.UserInstancePolicyName(user.Username))
+		switch {
+		case err == nil:
+			auditUser.HasPolicy = true
+			auditUser.PolicyARNs, err = aws.InstanceARNsFromPolicy(document)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read instance policy for user %s: %w", user.Username, err)
+			}
+		case !aws.IsNoSuchEntity(err):
+			return nil, err
+		}
+
+		state.Users = append(state.Users, auditUser)
+	}
+
+	state.Instances, err = lightsailService.ListInstances(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	state.Disks, err = lightsailService.ListDisks(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// fixFindings repairs fixable findings, continuing past failures.
+func fixFindings(ctx context.Context, awsClient *aws.Client, project string, findings []audit.Finding) error {
+	iamService := aws.NewIAMService(awsClient)
+	lightsailService := aws.NewLightsailService(awsClient)
+	usersGroupReady := false
+
+	failed := 0
+	for _, finding := range findings {
+		var err error
+		switch finding.Kind {
+		case audit.KindMissingGroup:
+			if !usersGroupReady {
+				err = ensureUsersGroup(ctx, iamService)
+				usersGroupReady = err == nil
+			}
+			if err == nil {
+				err = iamService.AddUserToGroup(ctx, finding.User, audit.UsersGroup)
+			}
+		case audit.KindMissingPolicy, audit.KindPolicyMismatch:
+			err = iamService.UpdateUserInstanceAccess(ctx, finding.User, finding.AddARNs, finding.RemoveARNs)
+		case audit.KindUntaggedInstance, audit.KindUntaggedDisk:
+			err = lightsailService.TagResource(ctx, finding.Resource, map[string]string{"Project": project})
+		default:
+			err = fmt.Errorf("no automatic fix for %s", finding.Kind)
+		}
+
+		if err != nil {
+			failed++
+			fmt.Printf("❌ %s %s: %v\n", finding.Kind, finding.Resource, err)
+			continue
+		}
+		fmt.Printf("✅ %s %s\n", finding.Kind, finding.Resource)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to fix %d of %d findings", failed, len(findings))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+// dialInstance opens SSH connections to instances. Tests replace it to point
+// connections at an in-process server.
+var dialInstance = ssh.Dial
+
+// connectInstance opens an SSH connection to a running instance using the
+// temporary key from GetInstanceAccessDetails, falling back to the region's
+// default key pair when the access details don't include one. The host key is
+// verified against the keys Lightsail reports, or pinned on first use.
+func connectInstance(ctx context.Context, lightsailService *aws.LightsailService, instance *types.Instance) (*ssh.Client, error) {
+	cfg, err := instanceSSHConfig(ctx, lightsailService, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dialInstance(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to instance %s: %w", instance.Name, err)
+	}
+	return client, nil
+}
+
+// instanceSSHConfig returns the connection settings connectInstance uses.
+func instanceSSHConfig(ctx context.Context, lightsailService *aws.LightsailService, instance *types.Instance) (ssh.Config, error) {
+	cfg := ssh.Config{
+		Host: instance.PublicIP,
+		User: "ubuntu",
+	}
+
+	details, err := lightsailService.GetInstanceAccessDetails(ctx, instance.Name)
+	if err != nil {
+		return ssh.Config{}, err
+	}
+	if access := details.AccessDetails; access != nil {
+		if ip := awssdk.ToString(access.IpAddress); ip != "" {
+			cfg.Host = ip
+		}
+		if username := awssdk.ToString(access.Username); username != "" {
+			cfg.User = username
+		}
+		cfg.PrivateKey = []byte(awssdk.ToString(access.PrivateKey))
+		cfg.Certificate = []byte(awssdk.ToString(access.CertKey))
+	}
+
+	cfg.HostKeyCallback, err = verifyHostKey(instance, accessHostKeys(details))
+	if err != nil {
+		return ssh.Config{}, err
+	}
+
+	if len(cfg.PrivateKey) == 0 {
+		keyContent, err := lightsailService.DownloadSSHKey(ctx, "")
+		if err != nil {
+			return ssh.Config{}, fmt.Errorf("failed to download SSH key: %w", err)
+		}
+		cfg.PrivateKey, err = decodePrivateKey(keyContent)
+		if err != nil {
+			return ssh.Config{}, err
+		}
+		cfg.Certificate = nil
+	}
+
+	if cfg.Host == "" {
+		return ssh.Config{}, fmt.Errorf("instance %s has no public IP", instance.Name)
+	}
+
+	return cfg, nil
+}
+
+// decodePrivateKey returns a PEM private key that Lightsail returned either
+// as PEM or base64 encoded PEM.
+func decodePrivateKey(keyContent string) ([]byte, error) {
+	if strings.HasPrefix(keyContent, "-----BEGIN") {
+		return []byte(keyContent), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(keyContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SSH key (not base64): %w", err)
+	}
+	return decoded, nil
+}
+
+// selectInstances limits instances to the given users', reporting users
+// without one. All instances are returned when users is empty. usernames are
+// the IAM users instances can belong to, as for findUserInstance.
+func selectInstances(instances []*types.Instance, users, usernames []string) []*types.Instance {
+	if len(users) == 0 {
+		return instances
+	}
+
+	var selected []*types.Instance
+	for _, user := range users {
+		instance := findUserInstance(instances, user, usernames)
+		if instance == nil {
+			fmt.Printf("⚠️ No instance found for user %s\n", user)
+			continue
+		}
+		selected = append(selected, instance)
+	}
+	return selected
+}
+
+// userInstances returns all of the user's instances. An instance named after
+// the user belongs to another of usernames when a longer one matches, as
+// decided by utils.InstanceOwner.
+func userInstances(instances []*types.Instance, username string, usernames []string) []*types.Instance {
+	candidates := append([]string{username}, usernames...)
+	var owned []*types.Instance
+	for _, instance := range instances {
+		if utils.InstanceOwner(instance.Name, candidates) == username {
+			owned = append(owned, instance)
+		}
+	}
+	return owned
+}
+
+// ownedInstances returns the instances that belong to any of users, deciding
+// ownership as userInstances does.
+func ownedInstances(instances []*types.Instance, users, usernames []string) []*types.Instance {
+	candidates := append(append([]string(nil), users...), usernames...)
+	wanted := make(map[string]bool)
+	for _, user := range users {
+		wanted[user] = true
+	}
+
+	var owned []*types.Instance
+	for _, instance := range instances {
+		if wanted[utils.InstanceOwner(instance.Name, candidates)] {
+			owned = append(owned, instance)
+		}
+	}
+	return owned
+}
+
+// findUserInstance returns the user's instance, or nil, deciding ownership as
+// userInstances does. A user with several instances, as after a resize that
+// kept the original, gets a running one if there is one.
+func findUserInstance(instances []*types.Instance, username string, usernames []string) *types.Instance {
+	owned := userInstances(instances, username, usernames)
+	for _, instance := range owned {
+		if instance.State == "running" {
+			return instance
+		}
+	}
+	if len(owned) > 0 {
+		return owned[0]
+	}
+	return nil
+}
@@ -0,0 +1,499 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+// lineageTagKeys are tags that record where an instance came from. They are not
+// copied onto instances created from snapshots or clones.
+var lineageTagKeys = []string{"ClonedFrom", "RestoredFrom", "ResizedFrom"}
+
+var instancesSnapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "Manage instance snapshots",
+	Long:  `List, delete, and prune Lightsail instance snapshots.`,
+}
+
+var instancesSnapshotsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List instance snapshots",
+	Long: `List instance snapshots with their state, source instance, and creation time,
+optionally filtered by project or source instance.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		instance, _ := cmd.Flags().GetString("instance")
+
+		return listSnapshots(cmd.Context(), project, instance)
+	},
+}
+
+var instancesSnapshotsDeleteCmd = &cobra.Command{
+	Use:   "delete [snapshot-names...]",
+	Short: "Delete instance snapshots",
+	Long:  `Delete one or more instance snapshots by name.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return deleteSnapshots(cmd.Context(), args)
+	},
+}
+
+var instancesSnapshotsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old snapshots, keeping the newest per instance",
+	Long: `Delete old snapshots in a project, keeping the newest --keep snapshots of each
+source instance. Snapshots that are still being created are never pruned. The
+snapshots to delete are listed first, and only deleted with --confirm.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		keep, _ := cmd.Flags().GetInt("keep")
+		confirm, _ := cmd.Flags().GetBool("confirm")
+
+		return pruneSnapshots(cmd.Context(), project, keep, confirm)
+	},
+}
+
+func init() {
+	instancesCmd.AddCommand(instancesSnapshotsCmd)
+
+	instancesSnapshotsCmd.AddCommand(instancesSnapshotsListCmd)
+	instancesSnapshotsCmd.AddCommand(instancesSnapshotsDeleteCmd)
+	instancesSnapshotsCmd.AddCommand(instancesSnapshotsPruneCmd)
+
+	// List command flags
+	instancesSnapshotsListCmd.Flags().StringP("project", "p", "", "Filter by project name")
+	instancesSnapshotsListCmd.Flags().StringP("instance", "i", "", "Filter by source instance name")
+
+	// Prune command flags
+	instancesSnapshotsPruneCmd.Flags().StringP("project", "p", "", "Project whose snapshots to prune (required)")
+	instancesSnapshotsPruneCmd.Flags().IntP("keep", "k", 3, "Number of snapshots to keep per instance")
+	instancesSnapshotsPruneCmd.Flags().BoolP("confirm", "y", false, "Delete the planned snapshots (otherwise only the plan is shown)")
+	instancesSnapshotsPruneCmd.MarkFlagRequired("project")
+}
+
+// newLightsailService loads configuration and creates a Lightsail service.
+func newLightsailService(ctx context.Context) (*aws.Client, *aws.LightsailService, error) {
+	// Load configuration
+	_, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Create AWS client
+	awsClient, err := aws.NewClient(ctx, aws.Options{
+		Region:  viper.GetString("aws.region"),
+		Profile: viper.GetString("aws.profile"),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	return awsClient, aws.NewLightsailService(awsClient), nil
+}
+
+// createSnapshot snapshots an instance, tagging the snapshot with the instance's project.
+func createSnapshot(ctx context.Context, instanceName, snapshotName string, wait bool) error {
+	_, lightsailService, err := newLightsailService(ctx)
+	if err != nil {
+		return err
+	}
+
+	instance, err := lightsailService.GetInstance(ctx, instanceName)
+	if err != nil {
+		return fmt.Errorf("failed to get instance details: %w", err)
+	}
+
+	fmt.Printf("Creating snapshot '%s' of instance '%s'\n", snapshotName, instanceName)
+	err = lightsailService.CreateInstanceSnapshot(ctx, instanceName, snapshotName, copyTags(instance.Tags))
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	if wait {
+		if err := waitForSnapshot(ctx, lightsailService, snapshotName); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Snapshot %s is available\n", snapshotName)
+		return nil
+	}
+
+	fmt.Printf("✅ Snapshot %s is being created\n", snapshotName)
+	fmt.Printf("Check progress with: lfr instances snapshots list --instance %s\n", instanceName)
+	return nil
+}
+
+// restoreSnapshot creates a new instance from a snapshot.
+func restoreSnapshot(ctx context.Context, snapshotName, newInstanceName, bundle, region, zone string, wait bool) error {
+	awsClient, lightsailService, err := newLightsailService(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := lightsailService.GetInstanceSnapshot(ctx, snapshotName)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot details: %w", err)
+	}
+
+	if region != "" && region != snapshot.Region {
+		return fmt.Errorf("cannot restore %s from %s to %s: snapshots must be copied across regions first", snapshotName, snapshot.Region, region)
+	}
+	if bundle == "" {
+		bundle = snapshot.FromBundle
+	}
+	zone, err = snapshotZone(zone, snapshot.AvailabilityZone, snapshot.Region)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restoring snapshot '%s' to new instance '%s'\n", snapshotName, newInstanceName)
+	fmt.Printf("Bundle: %s, Availability zone: %s\n", bundle, zone)
+
+	if snapshot.State != "available" {
+		if !wait {
+			return fmt.Errorf("snapshot %s is %s; retry when it is available or use --wait", snapshotName, snapshot.State)
+		}
+		if err := waitForSnapshot(ctx, lightsailService, snapshotName); err != nil {
+			return err
+		}
+	}
+
+	instance, err := lightsailService.CreateInstanceFromSnapshot(ctx, newInstanceName, snapshotName, bundle, zone,
+		snapshotKeyPair(ctx, lightsailService, snapshot), lineageTags(snapshot.Tags, "RestoredFrom", snapshotName))
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+
+	grantOwnerAccess(ctx, aws.NewIAMService(awsClient), instance)
+
+	if wait {
+		if err := waitForInstanceRunning(ctx, lightsailService, newInstanceName); err != nil {
+			return err
+		}
+	}
+
+	// The restored host has new host keys
+	if refreshed, err := lightsailService.GetInstance(ctx, newInstanceName); err == nil {
+		refreshHostKeys(ctx, lightsailService, refreshed)
+	}
+
+	fmt.Printf("🎉 Restored %s to instance %s\n", snapshotName, newInstanceName)
+	return nil
+}
+
+// snapshotKeyPair returns the key pair of the instance a snapshot was taken
+// from, so the restored instance accepts the same key. It returns an empty
+// string, the region's default key pair, if the source instance is gone.
+func snapshotKeyPair(ctx context.Context, lightsailService *aws.LightsailService, snapshot *types.Snapshot) string {
+	source, err := lightsailService.GetInstance(ctx, snapshot.FromInstance)
+	if err != nil {
+		fmt.Printf("ℹ️  Source instance %s not found; restoring with the default key pair\n", snapshot.FromInstance)
+		return ""
+	}
+	return source.SSHKeyName
+}
+
+// snapshotZone returns the availability zone for an instance created from a
+// snapshot: zone if given, otherwise the zone of the snapshot's source.
+func snapshotZone(zone, sourceZone, region string) (string, error) {
+	if zone == "" {
+		zone = sourceZone
+	}
+	if zone == "" {
+		return "", fmt.Errorf("the availability zone of the source is unknown; use --availability-zone")
+	}
+	if !strings.HasPrefix(zone, region) {
+		return "", fmt.Errorf("availability zone %s is not in region %s", zone, region)
+	}
+	return zone, nil
+}
+
+// cloneInstance snapshots an instance and creates a new instance from the snapshot.
+func cloneInstance(ctx context.Context, sourceInstance, newInstanceName, bundle, region, zone string, wait bool) error {
+	awsClient, lightsailService, err := newLightsailService(ctx)
+	if err != nil {
+		return err
+	}
+
+	source, err := lightsailService.GetInstance(ctx, sourceInstance)
+	if err != nil {
+		return fmt.Errorf("failed to get source instance details: %w", err)
+	}
+
+	if region != "" && region != source.Region {
+		return fmt.Errorf("cannot clone %s from %s to %s: snapshots must be copied across regions first", sourceInstance, source.Region, region)
+	}
+	if bundle == "" {
+		bundle = source.Bundle
+	}
+	zone, err = snapshotZone(zone, source.AvailabilityZone, source.Region)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cloning instance '%s' to '%s'\n", sourceInstance, newInstanceName)
+	fmt.Printf("Bundle: %s, Availability zone: %s\n", bundle, zone)
+
+	snapshotName := fmt.Sprintf("%s-clone-%d", sourceInstance, time.Now().Unix())
+	fmt.Printf("Creating snapshot: %s\n", snapshotName)
+	err = lightsailService.CreateInstanceSnapshot(ctx, sourceInstance, snapshotName, copyTags(source.Tags))
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	// The new instance can only be created once the snapshot is available
+	if err := waitForSnapshot(ctx, lightsailService, snapshotName); err != nil {
+		return err
+	}
+
+	fmt.Printf("Creating cloned instance: %s\n", newInstanceName)
+	instance, err := lightsailService.CreateInstanceFromSnapshot(ctx, newInstanceName, snapshotName, bundle, zone,
+		source.SSHKeyName, lineageTags(source.Tags, "ClonedFrom", sourceInstance))
+	if err != nil {
+		return fmt.Errorf("failed to create instance from snapshot: %w", err)
+	}
+
+	grantOwnerAccess(ctx, aws.NewIAMService(awsClient), instance)
+
+	if wait {
+		if err := waitForInstanceRunning(ctx, lightsailService, newInstanceName); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("🎉 Cloned %s to %s\n", sourceInstance, newInstanceName)
+	fmt.Printf("Snapshot %s was kept; remove old snapshots with: lfr instances snapshots prune\n", snapshotName)
+	return nil
+}
+
+// listSnapshots lists instance snapshots with filtering.
+func listSnapshots(ctx context.Context, project, instance string) error {
+	_, lightsailService, err := newLightsailService(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := lightsailService.ListInstanceSnapshots(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	if instance != "" {
+		var filtered []*types.Snapshot
+		for _, snapshot := range snapshots {
+			if snapshot.FromInstance == instance {
+				filtered = append(filtered, snapshot)
+			}
+		}
+		snapshots = filtered
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots found.")
+		return nil
+	}
+
+	fmt.Printf("%-45s %-10s %-25s %-22s %-8s %-17s %-15s\n",
+		"SNAPSHOT", "STATE", "FROM INSTANCE", "BUNDLE", "SIZE", "CREATED", "PROJECT")
+	fmt.Println(strings.Repeat("-", 148))
+
+	for _, snapshot := range snapshots {
+		project := snapshot.Tags["Project"]
+		if project == "" {
+			project = "untagged"
+		}
+
+		fmt.Printf("%-45s %-10s %-25s %-22s %-8s %-17s %-15s\n",
+			snapshot.Name,
+			snapshot.State,
+			snapshot.FromInstance,
+			snapshot.FromBundle,
+			fmt.Sprintf("%dGB", snapshot.SizeGB),
+			snapshot.CreatedAt.Format("2006-01-02 15:04"),
+			project,
+		)
+	}
+
+	fmt.Printf("\nTotal: %d snapshots\n", len(snapshots))
+	return nil
+}
+
+// deleteSnapshots deletes instance snapshots by name.
+func deleteSnapshots(ctx context.Context, snapshotNames []string) error {
+	_, lightsailService, err := newLightsailService(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i, name := range snapshotNames {
+		fmt.Printf("[%d/%d] Deleting snapshot: %s\n", i+1, len(snapshotNames), name)
+		if err := lightsailService.DeleteInstanceSnapshot(ctx, name); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("✅ Deleted snapshot: %s\n", name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d snapshots", failed, len(snapshotNames))
+	}
+	return nil
+}
+
+// pruneSnapshots deletes all but the newest keep snapshots of each instance in a project.
+func pruneSnapshots(ctx context.Context, project string, keep int, confirm bool) error {
+	if keep < 0 {
+		return fmt.Errorf("--keep must not be negative, got: %d", keep)
+	}
+
+	_, lightsailService, err := newLightsailService(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := lightsailService.ListInstanceSnapshots(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	prune := selectSnapshotsToPrune(snapshots, keep)
+	if len(prune) == 0 {
+		fmt.Printf("Nothing to prune: every instance in project %s has at most %d snapshots.\n", project, keep)
+		return nil
+	}
+
+	fmt.Printf("Snapshots to prune in project %s (keeping %d per instance):\n", project, keep)
+	for _, snapshot := range prune {
+		fmt.Printf("   - %s (%s, created %s)\n", snapshot.Name, snapshot.FromInstance, snapshot.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	fmt.Println()
+
+	if !confirm {
+		fmt.Printf("Run with --confirm to delete %d snapshots.\n", len(prune))
+		return nil
+	}
+
+	var names []string
+	for _, snapshot := range prune {
+		names = append(names, snapshot.Name)
+	}
+	return deleteSnapshots(ctx, names)
+}
+
+// selectSnapshotsToPrune returns the available snapshots beyond the newest keep of
+// each source instance, oldest first.
+func selectSnapshotsToPrune(snapshots []*types.Snapshot, keep int) []*types.Snapshot {
+	byInstance := make(map[string][]*types.Snapshot)
+	for _, snapshot := range snapshots {
+		if snapshot.State != "available" {
+			continue
+		}
+		byInstance[snapshot.FromInstance] = append(byInstance[snapshot.FromInstance], snapshot)
+	}
+
+	var prune []*types.Snapshot
+	for _, group := range byInstance {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].CreatedAt.After(group[j].CreatedAt)
+		})
+		if len(group) > keep {
+			prune = append(prune, group[keep:]...)
+		}
+	}
+
+	sort.SliceStable(prune, func(i, j int) bool {
+		if prune[i].CreatedAt.Equal(prune[j].CreatedAt) {
+			return prune[i].Name < prune[j].Name
+		}
+		return prune[i].CreatedAt.Before(prune[j].CreatedAt)
+	})
+	return prune
+}
+
+// grantOwnerAccess adds a new instance to its owner's LightsailLimitedAccess
+// policy. The owner is the IAM user the instance is named after, as decided by
+// utils.InstanceOwner; no access is granted when no user matches. Failures are
+// reported but do not fail the calling command.
+func grantOwnerAccess(ctx context.Context, iamService *aws.IAMService, instance *types.Instance) {
+	usernames, err := iamService.ListUsernames(ctx)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to find the owner of %s: %v\n", instance.Name, err)
+		return
+	}
+	owner := utils.InstanceOwner(instance.Name, usernames)
+	if owner == "" {
+		fmt.Printf("ℹ️  No IAM user owns %s; skipping access policy update\n", instance.Name)
+		return
+	}
+
+	if err := iamService.UpdateUserInstanceAccess(ctx, owner, []string{instance.ARN}, nil); err != nil {
+		fmt.Printf("⚠️  Failed to update access policy for %s: %v\n", owner, err)
+		return
+	}
+	fmt.Printf("✅ Granted %s access to %s\n", owner, instance.Name)
+}
+
+// waitForSnapshot waits for a snapshot to become available.
+func waitForSnapshot(ctx context.Context, lightsailService *aws.LightsailService, snapshotName string) error {
+	err := utils.WaitForSnapshotState(ctx, snapshotName, "available", func() (string, error) {
+		snapshot, err := lightsailService.GetInstanceSnapshot(ctx, snapshotName)
+		if err != nil {
+			return "", err
+		}
+		return snapshot.State, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for snapshot: %w", err)
+	}
+	return nil
+}
+
+// waitForInstanceRunning waits for an instance to start and refreshes its S3 status.
+func waitForInstanceRunning(ctx context.Context, lightsailService *aws.LightsailService, instanceName string) error {
+	err := utils.WaitForInstanceState(ctx, instanceName, "running", func() (string, error) {
+		instance, err := lightsailService.GetInstance(ctx, instanceName)
+		if err != nil {
+			return "", err
+		}
+		return instance.State, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for instance %s: %w", instanceName, err)
+	}
+
+	if instance, err := lightsailService.GetInstance(ctx, instanceName); err == nil {
+		_ = utils.UpdateInstanceStatusInS3(ctx, instance)
+	}
+	return nil
+}
+
+// copyTags returns a copy of a tag map.
+func copyTags(tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for key, value := range tags {
+		result[key] = value
+	}
+	return result
+}
+
+// lineageTags copies tags without earlier lineage tags and records a new one.
+func lineageTags(tags map[string]string, key, value string) map[string]string {
+	result := copyTags(tags)
+	for _, lineageKey := range lineageTagKeys {
+		delete(result, lineageKey)
+	}
+	result[key] = value
+	return result
+}
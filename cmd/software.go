@@ -1,17 +1,27 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+	"github.com/scttfrdmn/lfr-tools/internal/software"
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
 	"github.com/scttfrdmn/lfr-tools/internal/types"
 )
 
@@ -25,7 +35,10 @@ var softwareInstallCmd = &cobra.Command{
 	Use:   "install [pack-name] [username]",
 	Short: "Install software pack on user's instance",
 	Long: `Install a software pack on a user's Lightsail instance. Supports APT packages,
-container deployments, and custom scripts.`,
+container deployments, and custom scripts.
+
+The pack and its dependencies are linted first, and packs with lint errors are
+refused unless --force is given.`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		packName := args[0]
@@ -40,12 +53,21 @@ container deployments, and custom scripts.`,
 var softwareListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available software packs",
-	Long:  `List all available software packs with descriptions and installation status.`,
+	Long: `List all available software packs with descriptions and installation status.
+
+With --installed and --user, list the packs installed on the user's instance,
+read from its install registry.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		category, _ := cmd.Flags().GetString("category")
 		installed, _ := cmd.Flags().GetBool("installed")
+		username, _ := cmd.Flags().GetString("user")
+		project, _ := cmd.Flags().GetString("project")
+
+		if installed && username == "" {
+			return fmt.Errorf("--installed requires --user")
+		}
 
-		return listSoftwarePacks(category, installed)
+		return listSoftwarePacks(cmd.Context(), category, installed, username, project)
 	},
 }
 
@@ -66,13 +88,132 @@ Supports APT packages, scripts, and environment configuration.`,
 var softwareStatusCmd = &cobra.Command{
 	Use:   "status [username]",
 	Short: "Show software installation status for user",
-	Long: `Display what software packs are installed on a user's instance and their status.`,
+	Long: `Display what software packs are installed on a user's instance and their status.
+
+Installed packs are read from the install registry lfr keeps on the instance,
+with the version, time, packages and result of each pack's last install.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		username := args[0]
 		project, _ := cmd.Flags().GetString("project")
 
-		return showSoftwareStatus(cmd.Context(), username, project)
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return showSoftwareStatus(cmd.Context(), username, project, out)
+	},
+}
+
+var softwareUpgradeCmd = &cobra.Command{
+	Use:   "upgrade [pack-name] [username]",
+	Short: "Upgrade an installed software pack to its current version",
+	Long: `Upgrade a software pack installed on a user's instance to the pack's current
+definition. Only what changed since the installed version is applied: new and
+re-versioned packages are installed, packages the pack no longer has are
+removed unless another installed pack uses them, environment variables are
+rewritten if they changed, and new or changed scripts are run. Dependencies
+that aren't installed are installed first. Packs with lint errors are refused
+unless --force is given.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		force, _ := cmd.Flags().GetBool("force")
+
+		return upgradeSoftwarePack(cmd.Context(), args[0], args[1], project, force)
+	},
+}
+
+var softwareRemoveCmd = &cobra.Command{
+	Use:   "remove [pack-name] [username]",
+	Short: "Remove a software pack from user's instance",
+	Long: `Remove a software pack installed on a user's instance: its packages, unless
+another installed pack uses them, its environment variables and its install
+record. APT packages are only removed once nothing else depends on them.
+Packages installed by the pack's own scripts are left in place.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		force, _ := cmd.Flags().GetBool("force")
+
+		return removeSoftwarePack(cmd.Context(), args[0], args[1], project, force)
+	},
+}
+
+var softwareSearchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Search the software pack catalogs",
+	Long: `Search the builtin packs, the local pack directory (~/.lfr-tools/packs by
+default) and the shared S3 catalog, if packs.s3_bucket is configured, for
+packs whose ID, name, description, category or tags contain the query.
+
+Install a specific version by pinning it, as in: lfr software install python-dev@1.0 alice`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		allVersions, _ := cmd.Flags().GetBool("all-versions")
+
+		query := ""
+		if len(args) > 0 {
+			query = args[0]
+		}
+
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return searchSoftwarePacks(cmd.Context(), query, allVersions, out)
+	},
+}
+
+var softwarePublishCmd = &cobra.Command{
+	Use:   "publish [pack-file]",
+	Short: "Publish a software pack to the shared catalog",
+	Long: `Publish a pack definition (JSON or YAML) to the shared S3 catalog, so that
+everyone configured with the same packs.s3_bucket can search for and install it.
+
+Each version is published once; publishing a version that already exists is
+refused unless --force is given. The pack must have a version.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bucket, _ := cmd.Flags().GetString("bucket")
+		prefix, _ := cmd.Flags().GetString("prefix")
+		force, _ := cmd.Flags().GetBool("force")
+
+		return publishSoftwarePack(cmd.Context(), args[0], bucket, prefix, force)
+	},
+}
+
+var softwareLintCmd = &cobra.Command{
+	Use:   "lint [pack-file...]",
+	Short: "Check software pack definitions",
+	Long: `Check pack files (JSON or YAML) before they are installed or published:
+against the pack JSON schema (print it with --schema), that the pack type
+agrees with its package sources, that supported platforms are known blueprints,
+and that scripts don't run dangerous commands such as rm -rf / or curl | sh, or
+commands that break unattended installs such as apt-get install without -y.
+Script syntax is checked with bash -n when bash is available.
+
+Errors make lint fail; with --strict, so do warnings.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printSchema, _ := cmd.Flags().GetBool("schema")
+		strict, _ := cmd.Flags().GetBool("strict")
+
+		if printSchema {
+			_, err := os.Stdout.Write(software.Schema)
+			return err
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("requires at least one pack file")
+		}
+
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return lintSoftwarePacks(cmd.Context(), args, strict, out)
 	},
 }
 
@@ -83,22 +224,67 @@ func init() {
 	softwareCmd.AddCommand(softwareListCmd)
 	softwareCmd.AddCommand(softwareCreateCmd)
 	softwareCmd.AddCommand(softwareStatusCmd)
+	softwareCmd.AddCommand(softwareUpgradeCmd)
+	softwareCmd.AddCommand(softwareRemoveCmd)
+	softwareCmd.AddCommand(softwareSearchCmd)
+	softwareCmd.AddCommand(softwarePublishCmd)
+	softwareCmd.AddCommand(softwareLintCmd)
 
 	// Install command flags
 	softwareInstallCmd.Flags().StringP("project", "p", "", "Project name")
-	softwareInstallCmd.Flags().BoolP("force", "f", false, "Force reinstall if already installed")
+	softwareInstallCmd.Flags().BoolP("force", "f", false, "Force reinstall if already installed, and install packs with lint errors")
 
 	// List command flags
 	softwareListCmd.Flags().StringP("category", "c", "", "Filter by category (development, data-science, gpu, etc.)")
-	softwareListCmd.Flags().BoolP("installed", "i", false, "Show only installed packs")
+	softwareListCmd.Flags().BoolP("installed", "i", false, "Show only packs installed on the user's instance")
+	softwareListCmd.Flags().StringP("user", "u", "", "User whose instance to check with --installed")
+	softwareListCmd.Flags().StringP("project", "p", "", "Project name")
 
 	// Create command flags
-	softwareCreateCmd.Flags().StringP("template", "t", "basic", "Template to use (basic, development, data-science, gpu)")
+	softwareCreateCmd.Flags().StringP("template", "t", "basic", "Template to use (basic, development, data-science, gpu, container)")
 
 	// Status command flags
 	softwareStatusCmd.Flags().StringP("project", "p", "", "Project name")
+	addOutputFlags(softwareStatusCmd)
+
+	// Upgrade command flags
+	softwareUpgradeCmd.Flags().StringP("project", "p", "", "Project name")
+	softwareUpgradeCmd.Flags().BoolP("force", "f", false, "Apply changes even if the installed version matches, and upgrade packs with lint errors")
+
+	// Remove command flags
+	softwareRemoveCmd.Flags().StringP("project", "p", "", "Project name")
+	softwareRemoveCmd.Flags().BoolP("force", "f", false, "Remove even if other installed packs depend on it")
+
+	// Search command flags
+	softwareSearchCmd.Flags().Bool("all-versions", false, "Show every version of each pack, not just the newest")
+	addOutputFlags(softwareSearchCmd)
+
+	// Publish command flags
+	softwarePublishCmd.Flags().String("bucket", "", "S3 bucket of the shared catalog (default: packs.s3_bucket)")
+	softwarePublishCmd.Flags().String("prefix", "", "Key prefix of the shared catalog (default: packs.s3_prefix)")
+	softwarePublishCmd.Flags().BoolP("force", "f", false, "Overwrite the version if it is already published")
+
+	// Lint command flags
+	softwareLintCmd.Flags().Bool("strict", false, "Fail on warnings as well as errors")
+	softwareLintCmd.Flags().Bool("schema", false, "Print the pack JSON schema")
+	addOutputFlags(softwareLintCmd)
 }
 
+// installTimeout bounds how long an installation script may run.
+const installTimeout = 30 * time.Minute
+
+// softwareStatusScript reports the package count and the versions of common
+// toolchains on an instance.
+const softwareStatusScript = `echo "System packages: $(dpkg-query -f '.\n' -W 2>/dev/null | wc -l)"
+for tool in python3 pip3 node npm docker R; do
+  if command -v "$tool" >/dev/null 2>&1; then
+    echo "$tool: $("$tool" --version 2>&1 | head -n 1)"
+  else
+    echo "$tool: not installed"
+  fi
+done
+`
+
 // Built-in software packs for common educational use cases
 var builtinPacks = map[string]*types.SoftwarePack{
 	"python-dev": {
@@ -164,7 +350,6 @@ sudo systemctl start rstudio-server
 
 echo "RStudio Server installed on port 8787"`,
 				Type: "bash",
-				RunAs: "root",
 			},
 		},
 		Supported: []string{"ubuntu_22_04", "ubuntu_20_04"},
@@ -239,23 +424,45 @@ echo "Node.js global packages installed"`,
 	},
 }
 
-// installSoftwarePack installs a software pack on a user's instance.
+// installSoftwarePack installs a software pack on a user's instance, after
+// the packs it depends on. Packs already installed are skipped, except the
+// requested pack itself when force is set.
 func installSoftwarePack(ctx context.Context, packName, username, project string, force bool) error {
+	index, err := loadSoftwarePacks(ctx)
+	if err != nil {
+		return err
+	}
+	lookup := softwareLookup(index)
+
 	// Get software pack definition
-	pack, exists := builtinPacks[packName]
-	if !exists {
-		// Try to load custom pack
-		customPack, err := loadCustomPack(packName)
-		if err != nil {
-			return fmt.Errorf("software pack '%s' not found. Available packs: %s",
-				packName, strings.Join(getAvailablePackNames(), ", "))
-		}
-		pack = customPack
+	pack, err := lookup(packName)
+	if err != nil {
+		return err
+	}
+
+	packs, err := software.Resolve([]string{packName}, lookup)
+	if err != nil {
+		return fmt.Errorf("failed to resolve dependencies of '%s': %w", packName, err)
+	}
+
+	if err := checkSoftwareConflicts(packName, packs, force); err != nil {
+		return err
+	}
+	if err := checkSoftwareLint(ctx, packs, force); err != nil {
+		return err
 	}
 
 	fmt.Printf("Installing software pack: %s\n", pack.Name)
 	fmt.Printf("Description: %s\n", pack.Description)
+	fmt.Printf("Source: %s %s from %s\n", pack.ID, pack.Version, packSource(index, pack))
 	fmt.Printf("Target user: %s\n", username)
+	if len(packs) > 1 {
+		var order []string
+		for _, p := range packs {
+			order = append(order, fmt.Sprintf("%s %s (%s)", p.ID, p.Version, packSource(index, p)))
+		}
+		fmt.Printf("Install order: %s\n", strings.Join(order, " -> "))
+	}
 
 	// Find user's instance
 	awsClient, err := aws.NewClient(ctx, aws.Options{
@@ -272,14 +479,11 @@ func installSoftwarePack(ctx context.Context, packName, username, project string
 		return fmt.Errorf("failed to list instances: %w", err)
 	}
 
-	var targetInstance *types.Instance
-	for _, instance := range instances {
-		if strings.HasPrefix(instance.Name, username+"-") {
-			targetInstance = instance
-			break
-		}
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
 	}
-
+	targetInstance := findUserInstance(instances, username, usernames)
 	if targetInstance == nil {
 		return fmt.Errorf("no instance found for user: %s", username)
 	}
@@ -296,56 +500,424 @@ func installSoftwarePack(ctx context.Context, packName, username, project string
 	fmt.Printf("Target instance: %s (%s)\n", targetInstance.Name, targetInstance.PublicIP)
 
 	// Check if blueprint is supported
-	if !isPackSupportedOnBlueprint(pack, targetInstance.Blueprint) {
+	for _, p := range packs {
+		if isPackSupportedOnBlueprint(p, targetInstance.Blueprint) {
+			continue
+		}
 		if !force {
 			return fmt.Errorf("pack '%s' is not supported on blueprint '%s'. Use --force to override",
-				packName, targetInstance.Blueprint)
+				p.ID, targetInstance.Blueprint)
+		}
+		fmt.Printf("⚠️ Warning: Pack %s may not work correctly on blueprint %s\n", p.ID, targetInstance.Blueprint)
+	}
+
+	client, err := connectInstance(ctx, lightsailService, targetInstance)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	records, err := readSoftwareRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+	unrecorded, err := unrecordedSoftwarePacks(ctx, client, records, packs)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range packs {
+		reinstall := force && p.ID == pack.ID
+		if software.Satisfied(records, p) && !reinstall {
+			fmt.Printf("✓ %s %s is already installed, skipping\n", p.ID, p.Version)
+			continue
+		}
+		if unrecorded[p.ID] && !reinstall {
+			fmt.Printf("✓ %s is already installed (not recorded by lfr), skipping\n", p.ID)
+			continue
+		}
+
+		if err := installPack(ctx, client, targetInstance, p, p.ID != pack.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range packs {
+		if p.Container != nil && len(p.Container.Ports) > 0 {
+			fmt.Printf("Open %s with: lfr ssh tunnel %s --pack %s\n", p.ID, username, p.ID)
+		}
+	}
+
+	return nil
+}
+
+// checkSoftwareConflicts reports packages and environment variables that the
+// packs installed for packName set differently, failing unless force is set.
+func checkSoftwareConflicts(packName string, packs []*types.SoftwarePack, force bool) error {
+	conflicts := software.Conflicts(packs)
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	for _, conflict := range conflicts {
+		fmt.Printf("⚠️ Conflict: %s\n", conflict)
+	}
+	if !force {
+		return fmt.Errorf("pack '%s' has %d conflicting dependencies. Use --force to override", packName, len(conflicts))
+	}
+	return nil
+}
+
+// checkSoftwareLint lints the packs about to be installed, as packs from the
+// local directory or the shared catalog may not have been checked. Packs with
+// errors are refused unless force is set.
+func checkSoftwareLint(ctx context.Context, packs []*types.SoftwarePack, force bool) error {
+	var opts software.LintOptions
+	if bash, err := exec.LookPath("bash"); err == nil {
+		opts.Bash = bash
+	}
+
+	var failed []string
+	for _, p := range packs {
+		findings := software.LintPack(ctx, p, opts)
+		if !software.HasErrors(findings) {
+			continue
+		}
+		for _, f := range findings {
+			if f.Severity == software.SeverityError {
+				fmt.Printf("❌ %s: %s\n", p.ID, f)
+			}
 		}
-		fmt.Printf("⚠️ Warning: Pack may not work correctly on blueprint %s\n", targetInstance.Blueprint)
+		failed = append(failed, p.ID)
 	}
 
+	if len(failed) > 0 && !force {
+		return fmt.Errorf("software pack lint failed for %s. Fix the packs or use --force to override", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// installPack installs a pack on an instance over client and records the
+// result in its registry. dependency reports whether the pack is being
+// installed for another.
+func installPack(ctx context.Context, client *ssh.Client, instance *types.Instance, pack *types.SoftwarePack, dependency bool) error {
 	// Generate installation script
-	installScript, err := generateInstallScript(pack, targetInstance, force)
+	installScript, err := generateInstallScript(pack, instance, false)
 	if err != nil {
 		return fmt.Errorf("failed to generate install script: %w", err)
 	}
 
 	// Execute installation via SSH
-	fmt.Printf("Executing installation on %s...\n", targetInstance.PublicIP)
+	fmt.Printf("Executing installation of %s on %s...\n", pack.ID, instance.PublicIP)
 
-	result, err := executeInstallationScript(ctx, targetInstance, installScript, username)
+	result, err := executeInstallationScript(ctx, client, pack, installScript)
 	if err != nil {
 		return fmt.Errorf("installation failed: %w", err)
 	}
+	if err := recordSoftwareInstall(ctx, client, result); err != nil {
+		return err
+	}
 
-	if result.Success {
-		fmt.Printf("✅ Software pack '%s' installed successfully!\n", pack.Name)
-		fmt.Printf("Duration: %s\n", result.Duration)
-		if len(result.Packages) > 0 {
-			fmt.Printf("Packages installed: %s\n", strings.Join(result.Packages, ", "))
+	if !result.Success {
+		printSoftwareErrors("Installation", result)
+		if dependency {
+			return fmt.Errorf("software pack installation failed: dependency '%s' did not install", pack.ID)
 		}
-	} else {
-		fmt.Printf("❌ Installation failed: %s\n", result.Message)
-		if len(result.Errors) > 0 {
-			fmt.Printf("Errors:\n")
-			for _, errMsg := range result.Errors {
-				fmt.Printf("  - %s\n", errMsg)
+		return fmt.Errorf("software pack installation failed")
+	}
+
+	fmt.Printf("✅ Software pack '%s' installed successfully!\n", pack.Name)
+	fmt.Printf("Duration: %s\n", result.Duration)
+	if len(result.Packages) > 0 {
+		fmt.Printf("Packages installed: %s\n", strings.Join(result.Packages, ", "))
+	}
+	return nil
+}
+
+// printSoftwareErrors reports a failed install or upgrade.
+func printSoftwareErrors(action string, result *types.InstallResult) {
+	fmt.Printf("❌ %s failed: %s\n", action, result.Message)
+	if len(result.Errors) > 0 {
+		fmt.Printf("Errors:\n")
+		for _, errMsg := range result.Errors {
+			fmt.Printf("  - %s\n", errMsg)
+		}
+	}
+}
+
+// readSoftwareRegistry reads the records of the packs installed on an
+// instance.
+func readSoftwareRegistry(ctx context.Context, client *ssh.Client) ([]*types.InstallResult, error) {
+	var stdout bytes.Buffer
+	err := client.RunScript(ctx, software.ReadRegistryScript, ssh.RunOptions{
+		Stdout:  &stdout,
+		Timeout: time.Minute,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read software registry: %w", err)
+	}
+	return software.ParseRegistry(stdout.Bytes())
+}
+
+// unrecordedSoftwarePacks reports which of packs are installed on an
+// instance without a registry record, as packs installed before the registry
+// or by hand are. Packs with a record are left to the registry.
+func unrecordedSoftwarePacks(ctx context.Context, client *ssh.Client, records []*types.InstallResult, packs []*types.SoftwarePack) (map[string]bool, error) {
+	var probe []*types.SoftwarePack
+	for _, p := range packs {
+		if software.Find(records, p.ID) == nil {
+			probe = append(probe, p)
+		}
+	}
+	script := software.InstalledProbe(probe)
+	if script == "" {
+		return nil, nil
+	}
+
+	var stdout bytes.Buffer
+	err := client.RunScript(ctx, script, ssh.RunOptions{
+		Stdout:  &stdout,
+		Timeout: time.Minute,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check installed packs: %w", err)
+	}
+	return software.ParseInstalled(stdout.String()), nil
+}
+
+// recordSoftwareInstall writes the result of installing a pack to the
+// instance's registry.
+func recordSoftwareInstall(ctx context.Context, client *ssh.Client, result *types.InstallResult) error {
+	script, err := software.RecordScript(result)
+	if err != nil {
+		return err
+	}
+	if err := client.RunScript(ctx, script, ssh.RunOptions{Timeout: time.Minute}); err != nil {
+		return fmt.Errorf("failed to record installation of %s: %w", result.PackID, err)
+	}
+	return nil
+}
+
+// upgradeSoftwarePack upgrades a pack installed on a user's instance to its
+// current definition, applying the delta from the installed version.
+func upgradeSoftwarePack(ctx context.Context, packName, username, project string, force bool) error {
+	index, err := loadSoftwarePacks(ctx)
+	if err != nil {
+		return err
+	}
+	lookup := softwareLookup(index)
+
+	pack, err := lookup(packName)
+	if err != nil {
+		return err
+	}
+
+	packs, err := software.Resolve([]string{packName}, lookup)
+	if err != nil {
+		return fmt.Errorf("failed to resolve dependencies of '%s': %w", packName, err)
+	}
+	if err := checkSoftwareConflicts(packName, packs, force); err != nil {
+		return err
+	}
+	if err := checkSoftwareLint(ctx, packs, force); err != nil {
+		return err
+	}
+
+	instance, client, err := connectUserInstance(ctx, username, project)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	records, err := readSoftwareRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	record := software.Find(records, pack.ID)
+	if record == nil {
+		return fmt.Errorf("pack '%s' is not installed on %s. Install it with: lfr software install %s %s",
+			pack.ID, instance.Name, packName, username)
+	}
+
+	// Install dependencies the new version added
+	for _, p := range packs[:len(packs)-1] {
+		if software.Satisfied(records, p) {
+			continue
+		}
+		if err := installPack(ctx, client, instance, p, true); err != nil {
+			return err
+		}
+	}
+
+	if software.Satisfied(records, pack) && !force {
+		fmt.Printf("✓ %s is already at version %s\n", pack.ID, pack.Version)
+		return nil
+	}
+
+	delta := software.Diff(record, pack)
+	delta.Remove = software.Unshared(delta.Remove, records, pack.ID)
+
+	fmt.Printf("Upgrading %s from %s to %s from %s on %s\n", pack.ID, record.Version, pack.Version, packSource(index, pack), instance.Name)
+	for _, pkg := range delta.Install {
+		fmt.Printf("  + %s %s\n", pkg.Name, pkg.Version)
+	}
+	for _, pkg := range delta.Remove {
+		fmt.Printf("  - %s\n", pkg.Name)
+	}
+	if delta.Environment {
+		fmt.Printf("  ~ environment variables\n")
+	}
+	for _, script := range delta.Scripts {
+		fmt.Printf("  > %s\n", script.Name)
+	}
+
+	script, err := software.UpgradeScript(record, pack, delta, instance.Name)
+	if err != nil {
+		return fmt.Errorf("failed to generate upgrade script: %w", err)
+	}
+
+	start := time.Now()
+	var output bytes.Buffer
+	err = client.RunScript(ctx, script, ssh.RunOptions{
+		Stdout:  io.MultiWriter(os.Stdout, &output),
+		Stderr:  os.Stderr,
+		Timeout: installTimeout,
+	})
+
+	var exitErr *ssh.ExitError
+	var result *types.InstallResult
+	switch {
+	case err == nil:
+		result = &types.InstallResult{
+			PackID:  pack.ID,
+			Version: pack.Version,
+			Success: true,
+			Message: fmt.Sprintf("Upgraded from %s", record.Version),
+			// Packages the upgrade removed are dropped
+			NewPackages: software.TrackNewPackages(record.NewPackages, pack, output.String()),
+		}
+		recordPackContents(result, pack)
+	case errors.As(err, &exitErr):
+		// Keep what the installed version recorded, so the upgrade can be retried
+		failed := *record
+		failed.Success = false
+		failed.Message = fmt.Sprintf("upgrade to %s exited with status %d", pack.Version, exitErr.Code)
+		failed.Errors = []string{err.Error()}
+		failed.NewPackages = append(append([]string(nil), record.NewPackages...), software.ParseNewPackages(output.String())...)
+		result = &failed
+	default:
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	result.Duration = time.Since(start).Round(time.Second).String()
+	result.InstalledAt = time.Now().Format(time.RFC3339)
+
+	if err := recordSoftwareInstall(ctx, client, result); err != nil {
+		return err
+	}
+
+	if !result.Success {
+		printSoftwareErrors("Upgrade", result)
+		return fmt.Errorf("software pack upgrade failed")
+	}
+
+	fmt.Printf("✅ Software pack '%s' upgraded to %s\n", pack.Name, pack.Version)
+	fmt.Printf("Duration: %s\n", result.Duration)
+	return nil
+}
+
+// removeSoftwarePack removes a pack installed on a user's instance.
+func removeSoftwarePack(ctx context.Context, packName, username, project string, force bool) error {
+	// Whichever version is installed is removed
+	packName, _ = software.ParseRef(packName)
+
+	index, err := loadSoftwarePacks(ctx)
+	if err != nil {
+		return err
+	}
+	lookup := softwareLookup(index)
+
+	instance, client, err := connectUserInstance(ctx, username, project)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	records, err := readSoftwareRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	record := software.Find(records, packName)
+	if record == nil {
+		return fmt.Errorf("pack '%s' is not installed on %s", packName, instance.Name)
+	}
+
+	var dependents []string
+	for _, other := range records {
+		if other.PackID == packName || !other.Success {
+			continue
+		}
+		definition, err := lookup(other.PackID + "@" + other.Version)
+		if err != nil {
+			continue
+		}
+		for _, dep := range definition.Dependencies {
+			if dep == packName {
+				dependents = append(dependents, other.PackID)
 			}
 		}
-		return fmt.Errorf("software pack installation failed")
 	}
+	if len(dependents) > 0 && !force {
+		return fmt.Errorf("pack '%s' is required by %s. Remove them first or use --force",
+			packName, strings.Join(dependents, ", "))
+	}
+
+	// The current definition fills in what old records don't say
+	definition, _ := lookup(packName + "@" + record.Version)
+	packages := software.Unshared(software.InstalledPackages(record, definition), records, packName)
 
+	script, err := software.RemoveScript(packName, packages, record.NewPackages, record.Container)
+	if err != nil {
+		return fmt.Errorf("failed to generate removal script: %w", err)
+	}
+
+	fmt.Printf("Removing %s from %s...\n", packName, instance.Name)
+	err = client.RunScript(ctx, script, ssh.RunOptions{
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Timeout: installTimeout,
+	})
+	if err != nil {
+		return fmt.Errorf("removal of %s failed: %w", packName, err)
+	}
+
+	fmt.Printf("✅ Software pack '%s' removed from %s\n", packName, instance.Name)
 	return nil
 }
 
-// listSoftwarePacks lists available software packs.
-func listSoftwarePacks(category string, installed bool) error {
+// listSoftwarePacks lists available software packs, or with installed the
+// packs installed on a user's instance.
+func listSoftwarePacks(ctx context.Context, category string, installed bool, username, project string) error {
+	index, err := loadSoftwarePacks(ctx)
+	if err != nil {
+		return err
+	}
+
+	if installed {
+		return listInstalledSoftwarePacks(ctx, index, category, username, project)
+	}
+
 	fmt.Printf("Available software packs:\n\n")
-	fmt.Printf("%-15s %-30s %-15s %-40s\n",
-		"ID", "NAME", "CATEGORY", "DESCRIPTION")
+	fmt.Printf("%-15s %-30s %-15s %-8s %-40s\n",
+		"ID", "NAME", "CATEGORY", "VERSION", "DESCRIPTION")
 	fmt.Println(strings.Repeat("-", 115))
 
-	for _, pack := range builtinPacks {
+	entries := index.Search("")
+	categories := make(map[string]bool)
+	for _, entry := range entries {
+		pack := entry.Pack
+		categories[pack.Category] = true
 		if category != "" && pack.Category != category {
 			continue
 		}
@@ -355,27 +927,60 @@ func listSoftwarePacks(category string, installed bool) error {
 			description = description[:37] + "..."
 		}
 
-		fmt.Printf("%-15s %-30s %-15s %-40s\n",
-			pack.ID, pack.Name, pack.Category, description)
+		fmt.Printf("%-15s %-30s %-15s %-8s %-40s\n",
+			pack.ID, pack.Name, pack.Category, pack.Version, description)
 	}
 
 	// Show available categories
-	categories := make(map[string]bool)
-	for _, pack := range builtinPacks {
-		categories[pack.Category] = true
-	}
-
 	var categoryList []string
 	for cat := range categories {
 		categoryList = append(categoryList, cat)
 	}
+	sort.Strings(categoryList)
 
-	fmt.Printf("\nTotal: %d packs\n", len(builtinPacks))
+	fmt.Printf("\nTotal: %d packs\n", len(entries))
 	fmt.Printf("Categories: %s\n", strings.Join(categoryList, ", "))
 
 	return nil
 }
 
+// listInstalledSoftwarePacks lists the packs installed successfully on a
+// user's instance.
+func listInstalledSoftwarePacks(ctx context.Context, index *software.Index, category, username, project string) error {
+	instance, records, err := userSoftwareRegistry(ctx, username, project)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Software packs installed on %s:\n\n", instance.Name)
+	fmt.Printf("%-15s %-30s %-15s %-10s %-25s\n",
+		"ID", "NAME", "CATEGORY", "VERSION", "INSTALLED")
+	fmt.Println(strings.Repeat("-", 100))
+
+	count := 0
+	for _, record := range records {
+		if !record.Success {
+			continue
+		}
+
+		// Packs whose definition isn't found are still listed
+		name, packCategory := "-", "-"
+		if pack, err := softwareLookup(index)(record.PackID); err == nil {
+			name, packCategory = pack.Name, pack.Category
+		}
+		if category != "" && packCategory != category {
+			continue
+		}
+
+		fmt.Printf("%-15s %-30s %-15s %-10s %-25s\n",
+			record.PackID, name, packCategory, record.Version, record.InstalledAt)
+		count++
+	}
+
+	fmt.Printf("\nTotal: %d packs\n", count)
+	return nil
+}
+
 // createSoftwarePack creates a custom software pack template.
 func createSoftwarePack(packName, template string) error {
 	packFile := fmt.Sprintf("%s-pack.yaml", packName)
@@ -391,39 +996,42 @@ func createSoftwarePack(packName, template string) error {
 		pack = createDataSciencePackTemplate(packName)
 	case "gpu":
 		pack = createGPUPackTemplate(packName)
+	case "container":
+		pack = createContainerPackTemplate(packName)
 	default:
-		return fmt.Errorf("unknown template: %s (available: basic, development, data-science, gpu)", template)
+		return fmt.Errorf("unknown template: %s (available: basic, development, data-science, gpu, container)", template)
 	}
 
 	// Write pack to YAML file
-	data, err := json.MarshalIndent(pack, "", "  ")
-	if err != nil {
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(pack); err != nil {
+		return fmt.Errorf("failed to marshal pack: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
 		return fmt.Errorf("failed to marshal pack: %w", err)
 	}
 
-	err = os.WriteFile(packFile, data, 0644)
+	err := os.WriteFile(packFile, data.Bytes(), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write pack file: %w", err)
 	}
 
 	fmt.Printf("✅ Software pack template created: %s\n", packFile)
 	fmt.Printf("Template: %s\n", template)
-	fmt.Printf("Edit the file and install with: lfr software install %s <username>\n", packName)
+	fmt.Printf("Edit the file, check it with: lfr software lint %s\n", packFile)
+	fmt.Printf("Then install with: lfr software install %s <username>\n", packName)
 
 	return nil
 }
 
-// showSoftwareStatus shows installation status for a user's instance.
-func showSoftwareStatus(ctx context.Context, username, project string) error {
-	fmt.Printf("Software status for user: %s\n", username)
-
-	// Find user's instance
-	awsClient, err := aws.NewClient(ctx, aws.Options{
-		Region:  viper.GetString("aws.region"),
-		Profile: viper.GetString("aws.profile"),
-	})
+// showSoftwareStatus shows the packs recorded in the install registry of a
+// user's instance, then the versions of common toolchains on it.
+func showSoftwareStatus(ctx context.Context, username, project string, out *output.Renderer) error {
+	awsClient, err := newAWSClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create AWS client: %w", err)
+		return err
 	}
 
 	lightsailService := aws.NewLightsailService(awsClient)
@@ -432,168 +1040,484 @@ func showSoftwareStatus(ctx context.Context, username, project string) error {
 		return fmt.Errorf("failed to list instances: %w", err)
 	}
 
-	var targetInstance *types.Instance
-	for _, instance := range instances {
-		if strings.HasPrefix(instance.Name, username+"-") {
-			targetInstance = instance
-			break
-		}
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
 	}
-
+	targetInstance := findUserInstance(instances, username, usernames)
 	if targetInstance == nil {
 		return fmt.Errorf("no instance found for user: %s", username)
 	}
 
-	fmt.Printf("Instance: %s (%s)\n", targetInstance.Name, targetInstance.State)
+	if out.Structured() {
+		if targetInstance.State != "running" {
+			return fmt.Errorf("instance %s is not running (state: %s). Start it first",
+				targetInstance.Name, targetInstance.State)
+		}
+	} else {
+		fmt.Printf("Software status for user: %s\n", username)
+		fmt.Printf("Instance: %s (%s)\n", targetInstance.Name, targetInstance.State)
 
-	if targetInstance.State != "running" {
-		fmt.Printf("⚠️ Instance is not running. Start it to check software status.\n")
-		return nil
+		if targetInstance.State != "running" {
+			fmt.Printf("⚠️ Instance is not running. Start it to check software status.\n")
+			return nil
+		}
 	}
 
-	// Check for installed software marker files
-	fmt.Printf("Checking installed software packs...\n")
+	client, err := connectInstance(ctx, lightsailService, targetInstance)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	records, err := readSoftwareRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	if out.Structured() {
+		return out.Render(records, func() *output.Table {
+			table := output.NewTable("pack_id", "version", "success", "message", "duration", "installed_at", "packages", "errors")
+			for _, record := range records {
+				table.AddRow(record.PackID, record.Version, record.Success, record.Message, record.Duration,
+					record.InstalledAt, strings.Join(record.Packages, " "), strings.Join(record.Errors, "; "))
+			}
+			return table
+		})
+	}
 
-	// For now, show placeholder status
-	// TODO: Implement actual software status checking via SSH
 	fmt.Printf("\n📦 Installed software packs:\n")
-	fmt.Printf("- System packages: Available via 'dpkg -l'\n")
-	fmt.Printf("- Python packages: Available via 'pip list'\n")
-	fmt.Printf("- Node packages: Available via 'npm list -g'\n")
-	fmt.Printf("\nTo check specific installations, SSH to instance:\n")
-	fmt.Printf("lfr ssh connect %s\n", username)
+	if len(records) == 0 {
+		fmt.Println("No software packs installed by lfr.")
+	} else {
+		fmt.Printf("%-15s %-10s %-8s %-25s %-10s %s\n", "PACK", "VERSION", "RESULT", "INSTALLED", "DURATION", "PACKAGES")
+		fmt.Println(strings.Repeat("-", 100))
+		for _, record := range records {
+			status := "ok"
+			if !record.Success {
+				status = "failed"
+			}
+			fmt.Printf("%-15s %-10s %-8s %-25s %-10s %s\n", record.PackID, record.Version, status,
+				record.InstalledAt, record.Duration, strings.Join(record.Packages, ", "))
+			if !record.Success && record.Message != "" {
+				fmt.Printf("  %s\n", record.Message)
+			}
+		}
+		fmt.Printf("\nTotal: %d packs\n", len(records))
+	}
 
-	return nil
+	fmt.Printf("\n🔧 Toolchains:\n")
+	return client.RunScript(ctx, softwareStatusScript, ssh.RunOptions{
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Timeout: time.Minute,
+	})
 }
 
-// Helper functions
+// userSoftwareRegistry reads the install registry of a user's running
+// instance.
+func userSoftwareRegistry(ctx context.Context, username, project string) (*types.Instance, []*types.InstallResult, error) {
+	instance, client, err := connectUserInstance(ctx, username, project)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
 
-func getAvailablePackNames() []string {
-	var names []string
-	for name := range builtinPacks {
-		names = append(names, name)
+	records, err := readSoftwareRegistry(ctx, client)
+	if err != nil {
+		return nil, nil, err
 	}
-	return names
+	return instance, records, nil
 }
 
-func loadCustomPack(packName string) (*types.SoftwarePack, error) {
-	packFile := packName + "-pack.yaml"
-	if _, err := os.Stat(packFile); os.IsNotExist(err) {
-		packFile = packName + "-pack.json"
-		if _, err := os.Stat(packFile); os.IsNotExist(err) {
-			return nil, fmt.Errorf("custom pack file not found: %s", packName)
-		}
+// connectUserInstance connects to a user's running instance. The caller
+// closes the client.
+func connectUserInstance(ctx context.Context, username, project string) (*types.Instance, *ssh.Client, error) {
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	data, err := os.ReadFile(packFile)
+	lightsailService := aws.NewLightsailService(awsClient)
+	instances, err := lightsailService.ListInstances(ctx, project)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read pack file: %w", err)
+		return nil, nil, fmt.Errorf("failed to list instances: %w", err)
 	}
 
-	var pack types.SoftwarePack
-	if err := json.Unmarshal(data, &pack); err != nil {
-		return nil, fmt.Errorf("failed to parse pack file: %w", err)
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	instance := findUserInstance(instances, username, usernames)
+	if instance == nil {
+		return nil, nil, fmt.Errorf("no instance found for user: %s", username)
+	}
+	if instance.State != "running" {
+		return nil, nil, fmt.Errorf("instance %s is not running (state: %s). Start it first",
+			instance.Name, instance.State)
 	}
 
-	return &pack, nil
+	client, err := connectInstance(ctx, lightsailService, instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	return instance, client, nil
 }
 
-func isPackSupportedOnBlueprint(pack *types.SoftwarePack, blueprint string) bool {
-	if len(pack.Supported) == 0 {
-		return true // No restrictions
+// Helper functions
+
+// searchSoftwarePacks prints the packs matching a query across every catalog.
+func searchSoftwarePacks(ctx context.Context, query string, allVersions bool, out *output.Renderer) error {
+	index, err := loadSoftwarePacks(ctx)
+	if err != nil {
+		return err
 	}
 
-	for _, supported := range pack.Supported {
-		if supported == blueprint {
-			return true
+	entries := index.Search(query)
+	if allVersions {
+		var versions []software.Entry
+		for _, entry := range entries {
+			versions = append(versions, index.Versions(entry.Pack.ID)...)
 		}
+		entries = versions
 	}
-	return false
-}
 
-func generateInstallScript(pack *types.SoftwarePack, instance *types.Instance, force bool) (string, error) {
-	script := "#!/bin/bash\n"
-	script += "set -e\n\n"
-	script += fmt.Sprintf("echo 'Installing %s on %s'\n", pack.Name, instance.Name)
-	script += "echo 'Starting at: '$(date)\n\n"
+	if out.Structured() {
+		return out.Render(entries, func() *output.Table {
+			table := output.NewTable("id", "version", "name", "category", "catalog", "description")
+			for _, entry := range entries {
+				table.AddRow(entry.Pack.ID, entry.Pack.Version, entry.Pack.Name, entry.Pack.Category, entry.Catalog, entry.Pack.Description)
+			}
+			return table
+		})
+	}
 
-	// Update package manager
-	script += "sudo apt-get update -y\n\n"
+	if len(entries) == 0 {
+		fmt.Printf("No software packs match %q\n", query)
+		return nil
+	}
 
-	// Install APT packages
-	for _, pkg := range pack.Packages {
-		if pkg.Source == "apt" {
-			script += fmt.Sprintf("echo 'Installing %s...'\n", pkg.Name)
-			script += fmt.Sprintf("sudo apt-get install -y %s\n", pkg.Name)
+	fmt.Printf("%-20s %-8s %-15s %-30s %s\n", "ID", "VERSION", "CATEGORY", "CATALOG", "DESCRIPTION")
+	fmt.Println(strings.Repeat("-", 110))
+	for _, entry := range entries {
+		description := entry.Pack.Description
+		if len(description) > 37 {
+			description = description[:37] + "..."
 		}
+		fmt.Printf("%-20s %-8s %-15s %-30s %s\n",
+			entry.Pack.ID, entry.Pack.Version, entry.Pack.Category, entry.Catalog, description)
 	}
+	fmt.Printf("\nTotal: %d packs\n", len(entries))
+
+	return nil
+}
 
-	// Set environment variables
-	if len(pack.Environment) > 0 {
-		script += "\n# Set environment variables\n"
-		for key, value := range pack.Environment {
-			script += fmt.Sprintf("echo 'export %s=\"%s\"' >> ~/.bashrc\n", key, value)
+// lintResult is the findings for one pack file.
+type lintResult struct {
+	File     string             `json:"file" yaml:"file"`
+	Findings []software.Finding `json:"findings" yaml:"findings"`
+}
+
+// lintSoftwarePacks checks pack files, failing if any has errors, or with
+// strict, warnings.
+func lintSoftwarePacks(ctx context.Context, files []string, strict bool, out *output.Renderer) error {
+	var results []lintResult
+	errorCount, warningCount := 0, 0
+	for _, file := range files {
+		findings, err := lintPackFile(ctx, file)
+		if err != nil {
+			return err
 		}
+		for _, f := range findings {
+			if f.Severity == software.SeverityError {
+				errorCount++
+			} else {
+				warningCount++
+			}
+		}
+		results = append(results, lintResult{File: file, Findings: findings})
+	}
+
+	if out.Structured() {
+		if err := out.Render(results, func() *output.Table {
+			table := output.NewTable("file", "severity", "path", "rule", "message")
+			for _, result := range results {
+				for _, f := range result.Findings {
+					table.AddRow(result.File, f.Severity, f.Path, f.Rule, f.Message)
+				}
+			}
+			return table
+		}); err != nil {
+			return err
+		}
+	} else {
+		for _, result := range results {
+			if len(result.Findings) == 0 {
+				fmt.Printf("✓ %s\n", result.File)
+				continue
+			}
+			for _, f := range result.Findings {
+				fmt.Printf("%s: %s\n", result.File, f)
+			}
+		}
+		fmt.Printf("\n%d errors, %d warnings in %d files\n", errorCount, warningCount, len(files))
 	}
 
-	// Run custom scripts
-	for _, customScript := range pack.Scripts {
-		script += fmt.Sprintf("\n# %s\n", customScript.Description)
-		script += fmt.Sprintf("echo 'Running %s...'\n", customScript.Name)
-		script += customScript.Content + "\n"
+	if errorCount > 0 || (strict && warningCount > 0) {
+		return fmt.Errorf("software pack lint failed: %d errors, %d warnings", errorCount, warningCount)
 	}
+	return nil
+}
 
-	script += "\necho 'Installation completed at: '$(date)\n"
-	script += fmt.Sprintf("echo 'Pack %s installed successfully'\n", pack.ID)
+// lintPackFile checks a pack file, checking script syntax with bash if it is
+// installed.
+func lintPackFile(ctx context.Context, file string) ([]software.Finding, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pack file: %w", err)
+	}
 
-	return script, nil
+	var opts software.LintOptions
+	if bash, err := exec.LookPath("bash"); err == nil {
+		opts.Bash = bash
+	}
+	return software.Lint(ctx, data, filepath.Ext(file) == ".json", opts), nil
 }
 
-func executeInstallationScript(ctx context.Context, instance *types.Instance, script, username string) (*types.InstallResult, error) {
-	start := time.Now()
+// publishSoftwarePack uploads a pack file to the shared S3 catalog, once it
+// lints without errors.
+func publishSoftwarePack(ctx context.Context, path, bucket, prefix string, force bool) error {
+	findings, err := lintPackFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	if software.HasErrors(findings) {
+		for _, f := range findings {
+			fmt.Printf("%s: %s\n", path, f)
+		}
+		return fmt.Errorf("pack %s has lint errors; fix them before publishing", path)
+	}
+
+	pack, err := software.LoadPack(path)
+	if err != nil {
+		return err
+	}
+	if pack.Version == "" {
+		return fmt.Errorf("pack '%s' has no version; published packs must be versioned", pack.ID)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	sharedBucket, sharedPrefix := sharedPackCatalog(cfg)
+	if bucket == "" {
+		bucket = sharedBucket
+	}
+	if prefix == "" {
+		prefix = sharedPrefix
+	}
+	if bucket == "" {
+		return fmt.Errorf("no shared catalog configured: set packs.s3_bucket or use --bucket")
+	}
 
-	// Create temporary script file
-	tmpFile, err := os.CreateTemp("", "lfr-install-*.sh")
+	awsClient, err := newAWSClient(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp script: %w", err)
+		return err
 	}
-	defer os.Remove(tmpFile.Name())
 
-	_, err = tmpFile.WriteString(script)
+	key, err := aws.NewS3Service(awsClient).PublishSoftwarePack(ctx, bucket, prefix, pack, force)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write script: %w", err)
+		return err
+	}
+
+	fmt.Printf("✓ Published %s@%s to s3://%s/%s\n", pack.ID, pack.Version, bucket, key)
+	fmt.Printf("Install it with: lfr software install %s@%s <username>\n", pack.ID, pack.Version)
+	return nil
+}
+
+// builtinPackList returns the builtin packs sorted by ID.
+func builtinPackList() []*types.SoftwarePack {
+	var packs []*types.SoftwarePack
+	for _, pack := range builtinPacks {
+		packs = append(packs, pack)
 	}
-	tmpFile.Close()
+	sort.Slice(packs, func(i, j int) bool { return packs[i].ID < packs[j].ID })
+	return packs
+}
 
-	// Make script executable
-	err = os.Chmod(tmpFile.Name(), 0755)
+// loadSoftwarePacks indexes the builtin packs, the shared S3 catalog if one is
+// configured, and the packs in the local pack directory, which take precedence
+// in that order when they have the same version of a pack, so that a local
+// file can't replace a vetted pack. Catalogs that can't be read, and local or
+// shared packs that differ from the version in use, are reported on stderr.
+func loadSoftwarePacks(ctx context.Context) (*software.Index, error) {
+	cfg, err := config.Load()
 	if err != nil {
-		return nil, fmt.Errorf("failed to make script executable: %w", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	catalogs := []software.Catalog{software.NewStaticCatalog("builtin", builtinPackList())}
+	if bucket, prefix := sharedPackCatalog(cfg); bucket != "" {
+		awsClient, err := newAWSClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		catalogs = append(catalogs, &s3PackCatalog{
+			s3:     aws.NewS3Service(awsClient),
+			bucket: bucket,
+			prefix: prefix,
+		})
+	}
+	catalogs = append(catalogs, &software.DirCatalog{Dir: cfg.Packs.Dir})
+
+	index := software.NewIndex(ctx, catalogs...)
+	for _, warning := range index.Warnings {
+		fmt.Fprintf(os.Stderr, "⚠️ Software packs: %s\n", warning)
+	}
+	return index, nil
+}
+
+// sharedPackCatalog returns the bucket and prefix of the shared pack catalog.
+func sharedPackCatalog(cfg *config.Config) (bucket, prefix string) {
+	bucket, prefix = viper.GetString("packs.s3_bucket"), viper.GetString("packs.s3_prefix")
+	if bucket == "" {
+		bucket = cfg.Packs.S3Bucket
+	}
+	if prefix == "" {
+		prefix = cfg.Packs.S3Prefix
+	}
+	return bucket, prefix
+}
+
+// softwareLookup finds packs in an index, then in the custom pack files in
+// the current directory that 'software create' writes.
+func softwareLookup(index *software.Index) software.Lookup {
+	return func(ref string) (*types.SoftwarePack, error) {
+		pack, err := index.Lookup(ref)
+		if err == nil {
+			return pack, nil
+		}
+
+		id, version := software.ParseRef(ref)
+		if version != "" && len(index.Versions(id)) > 0 {
+			return nil, err
+		}
+		if custom, err := loadCustomPack(id); err == nil && (version == "" || custom.Version == version) {
+			return custom, nil
+		}
+
+		return nil, fmt.Errorf("software pack '%s' not found. Available packs: %s",
+			ref, strings.Join(index.IDs(), ", "))
 	}
+}
+
+// packSource names the catalog a pack was found in.
+func packSource(index *software.Index, pack *types.SoftwarePack) string {
+	if catalog := index.CatalogOf(pack); catalog != "" {
+		return catalog
+	}
+	return "the current directory"
+}
+
+// s3PackCatalog is the shared catalog of packs published to an S3 prefix.
+type s3PackCatalog struct {
+	s3     *aws.S3Service
+	bucket string
+	prefix string
+}
+
+func (c *s3PackCatalog) Name() string {
+	return "s3://" + c.bucket + "/" + c.prefix
+}
+
+func (c *s3PackCatalog) Packs(ctx context.Context) ([]*types.SoftwarePack, error) {
+	return c.s3.ListSoftwarePacks(ctx, c.bucket, c.prefix)
+}
+
+func loadCustomPack(packName string) (*types.SoftwarePack, error) {
+	packFile := packName + "-pack.yaml"
+	if _, err := os.Stat(packFile); os.IsNotExist(err) {
+		packFile = packName + "-pack.json"
+		if _, err := os.Stat(packFile); os.IsNotExist(err) {
+			return nil, fmt.Errorf("custom pack file not found: %s", packName)
+		}
+	}
+
+	return software.LoadPack(packFile)
+}
+
+func isPackSupportedOnBlueprint(pack *types.SoftwarePack, blueprint string) bool {
+	if len(pack.Supported) == 0 {
+		return true // No restrictions
+	}
+
+	for _, supported := range pack.Supported {
+		if supported == blueprint {
+			return true
+		}
+	}
+	return false
+}
+
+// generateInstallScript generates the script that installs a pack on an
+// instance.
+func generateInstallScript(pack *types.SoftwarePack, instance *types.Instance, force bool) (string, error) {
+	return software.InstallScript(pack, instance.Name)
+}
 
-	// Execute via SSH
-	// For now, return success placeholder
-	// TODO: Implement actual SSH execution with proper key management
+// executeInstallationScript runs an installation script on an instance over
+// SSH, streaming its output. A script that fails is reported in the result; an
+// error means the script could not be run at all.
+func executeInstallationScript(ctx context.Context, client *ssh.Client, pack *types.SoftwarePack, script string) (*types.InstallResult, error) {
+	start := time.Now()
 
-	duration := time.Since(start)
+	// The output marks the APT packages that weren't installed before
+	var output bytes.Buffer
+	err := client.RunScript(ctx, script, ssh.RunOptions{
+		Stdout:  io.MultiWriter(os.Stdout, &output),
+		Stderr:  os.Stderr,
+		Timeout: installTimeout,
+	})
 
 	result := &types.InstallResult{
-		PackID:      "placeholder",
-		Success:     true,
-		Message:     "Installation script prepared (SSH execution pending)",
-		Duration:    duration.String(),
+		PackID:      pack.ID,
+		Version:     pack.Version,
+		Success:     err == nil,
+		Duration:    time.Since(start).Round(time.Second).String(),
 		InstalledAt: time.Now().Format(time.RFC3339),
-		Packages:    []string{"preparation-complete"},
+		NewPackages: software.TrackNewPackages(nil, pack, output.String()),
 	}
 
-	fmt.Printf("📋 Installation script prepared for %s\n", instance.Name)
-	fmt.Printf("To execute manually:\n")
-	fmt.Printf("1. SSH to instance: lfr ssh connect %s\n", username)
-	fmt.Printf("2. Run the installation commands\n")
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		result.Message = "Installation completed"
+		recordPackContents(result, pack)
+	case errors.As(err, &exitErr):
+		result.Message = fmt.Sprintf("installation script exited with status %d", exitErr.Code)
+		result.Errors = []string{err.Error()}
+	default:
+		return nil, err
+	}
 
 	return result, nil
 }
 
+// recordPackContents records a pack's packages, environment variables,
+// scripts and container in its install result.
+func recordPackContents(result *types.InstallResult, pack *types.SoftwarePack) {
+	for _, pkg := range pack.Packages {
+		result.Packages = append(result.Packages, pkg.Name)
+	}
+	result.PackageSpecs = pack.Packages
+	result.Environment = pack.Environment
+	for _, script := range pack.Scripts {
+		result.Scripts = append(result.Scripts, software.ScriptChecksum(script))
+	}
+	result.Container = pack.Container
+}
+
 // Template creation functions
 
 func createBasicPackTemplate(name string) *types.SoftwarePack {
@@ -676,4 +1600,23 @@ func createGPUPackTemplate(name string) *types.SoftwarePack {
 		Supported: []string{"ubuntu_22_04"},
 		Tags:      []string{"gpu", "cuda"},
 	}
-}
\ No newline at end of file
+}
+
+func createContainerPackTemplate(name string) *types.SoftwarePack {
+	return &types.SoftwarePack{
+		ID:          name,
+		Name:        strings.Title(name) + " JupyterLab Container",
+		Description: "JupyterLab from a pinned container image",
+		Category:    "data-science",
+		Type:        types.PackTypeContainer,
+		Version:     "1.0",
+		Container: &types.Container{
+			Image:   "quay.io/jupyter/scipy-notebook:2024-10-07",
+			Ports:   []string{"8888"},
+			Volumes: []string{"~/work:/home/jovyan/work"},
+			Command: []string{"start-notebook.py", "--IdentityProvider.token="},
+		},
+		Supported: []string{"ubuntu_22_04", "ubuntu_20_04"},
+		Tags:      []string{"container", "jupyter"},
+	}
+}
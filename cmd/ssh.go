@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"os"
 	"os/exec"
@@ -14,7 +13,6 @@ import (
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
 	"github.com/scttfrdmn/lfr-tools/internal/config"
-	"github.com/scttfrdmn/lfr-tools/internal/types"
 )
 
 var sshCmd = &cobra.Command{
@@ -62,63 +60,68 @@ the local SSH directory with proper permissions.`,
 var sshKeysListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available SSH keys",
-	Long:  `List all available SSH keys for Lightsail instances, showing which instances they can access.`,
+	Long: `List all available SSH keys for Lightsail instances, showing which instances they can access.
+
+Key pairs in Lightsail are listed with the private keys saved in the SSH key
+directory (ssh.key_path), matched by name, with each saved key's permissions
+and fingerprint. Keys other users can read, keys no instance uses and key
+pairs whose private key isn't saved are flagged.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		project, _ := cmd.Flags().GetString("project")
 
-		if project != "" {
-			fmt.Printf("Listing SSH keys for project: %s\n", project)
-		} else {
-			fmt.Println("Listing all SSH keys")
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
 		}
 
-		// TODO: Implement SSH key listing logic
-		return fmt.Errorf("SSH key listing not yet implemented")
+		return listSSHKeys(cmd.Context(), project, out)
 	},
 }
 
-var sshConfigCmd = &cobra.Command{
-	Use:   "config",
-	Short: "Generate SSH config entries",
-	Long: `Generate SSH config entries for easy access to Lightsail instances. This creates
-proper SSH config entries with hostnames, users, and key paths.`,
+var sshKeysRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate a user's SSH key pair",
+	Long: `Replace a user's key pair with a new one. The instance's authorized_keys is
+changed to accept only the new key, revoking the old key and the region's
+shared default key, and the user's token file is re-issued with the new key.
+The instance must be running.
+
+Examples:
+  lfr ssh keys rotate --user alice -p bio101
+  lfr ssh keys rotate --user alice -p bio101 -o ./student-tokens`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		username, _ := cmd.Flags().GetString("user")
 		project, _ := cmd.Flags().GetString("project")
-		outputPath, _ := cmd.Flags().GetString("output")
+		outputDir, _ := cmd.Flags().GetString("output")
 
-		fmt.Printf("Generating SSH config")
-		if project != "" {
-			fmt.Printf(" for project: %s", project)
-		}
-		if outputPath != "" {
-			fmt.Printf(" to file: %s", outputPath)
-		}
-		fmt.Println()
-
-		// TODO: Implement SSH config generation logic
-		return fmt.Errorf("SSH config generation not yet implemented")
+		return rotateUserKey(cmd.Context(), project, username, outputDir)
 	},
 }
 
-var sshTunnelCmd = &cobra.Command{
-	Use:   "tunnel [username] [local_port:remote_port]",
-	Short: "Create SSH tunnel to instance",
-	Long: `Create an SSH tunnel to a user's Lightsail instance for secure access to services
-running on the instance (e.g., Jupyter notebooks, web servers).`,
-	Args: cobra.ExactArgs(2),
+var sshConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Generate SSH config entries",
+	Long: `Generate SSH config entries for easy access to Lightsail instances. This creates
+proper SSH config entries with hostnames, users, and key paths.
+
+One Host block named <user>-<project> is written per instance to the generated
+config (default ~/.ssh/config.d/lfr-tools), and an Include of it is added to
+~/.ssh/config so that plain ssh, scp and VS Code Remote can use the names. Each
+project has its own section, which 'lfr instances start --wait' and
+'lfr instances stop' keep up to date as public IPs change.
+
+Examples:
+  lfr ssh config -p bio101
+  ssh alice-bio101
+  lfr ssh config -p bio101 --forward 8888 --forward 8787
+  lfr ssh config -p bio101 -o -              # print instead of writing`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		username := args[0]
-		portMapping := args[1]
 		project, _ := cmd.Flags().GetString("project")
+		outputPath, _ := cmd.Flags().GetString("output")
+		forwards, _ := cmd.Flags().GetStringSlice("forward")
+		noInclude, _ := cmd.Flags().GetBool("no-include")
 
-		fmt.Printf("Creating SSH tunnel to %s instance\n", username)
-		fmt.Printf("Port mapping: %s\n", portMapping)
-		if project != "" {
-			fmt.Printf("Project: %s\n", project)
-		}
-
-		// TODO: Implement SSH tunnel logic
-		return fmt.Errorf("SSH tunnel not yet implemented")
+		return generateSSHConfig(cmd.Context(), project, outputPath, forwards, !noInclude)
 	},
 }
 
@@ -132,6 +135,7 @@ func init() {
 
 	sshKeysCmd.AddCommand(sshKeysDownloadCmd)
 	sshKeysCmd.AddCommand(sshKeysListCmd)
+	sshKeysCmd.AddCommand(sshKeysRotateCmd)
 
 	// Connect command flags
 	sshConnectCmd.Flags().StringP("project", "p", "", "Filter by project name")
@@ -143,13 +147,20 @@ func init() {
 
 	// Key list command flags
 	sshKeysListCmd.Flags().StringP("project", "p", "", "Filter by project name")
+	addOutputFlags(sshKeysListCmd)
 
-	// Config command flags
-	sshConfigCmd.Flags().StringP("project", "p", "", "Filter by project name")
-	sshConfigCmd.Flags().StringP("output", "o", "", "Output path for SSH config (default: stdout)")
+	// Key rotate command flags
+	sshKeysRotateCmd.Flags().StringP("user", "u", "", "User whose key pair to rotate (required)")
+	sshKeysRotateCmd.Flags().StringP("project", "p", "", "Filter by project name")
+	sshKeysRotateCmd.Flags().StringP("output", "o", "./student-tokens", "Output directory for the re-issued token")
+	sshKeysRotateCmd.MarkFlagRequired("user")
 
-	// Tunnel command flags
-	sshTunnelCmd.Flags().StringP("project", "p", "", "Filter by project name")
+	// Config command flags
+	sshConfigCmd.Flags().StringP("project", "p", "", "Project name (required)")
+	sshConfigCmd.Flags().StringP("output", "o", "", "Output path for SSH config, or - for stdout (default: ssh.config_path)")
+	sshConfigCmd.Flags().StringSlice("forward", []string{}, "Port forward to add to every host, such as 8888 or 9000:8787")
+	sshConfigCmd.Flags().Bool("no-include", false, "Don't add an Include of the generated config to ~/.ssh/config")
+	sshConfigCmd.MarkFlagRequired("project")
 }
 
 // connectSSH connects to a user's instance via SSH.
@@ -177,14 +188,12 @@ func connectSSH(ctx context.Context, username, project, keyPath string) error {
 		return fmt.Errorf("failed to list instances: %w", err)
 	}
 
-	var targetInstance *types.Instance
-	for _, instance := range instances {
-		if strings.HasPrefix(instance.Name, username+"-") {
-			targetInstance = instance
-			break
-		}
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
 	}
 
+	targetInstance := findUserInstance(instances, username, usernames)
 	if targetInstance == nil {
 		return fmt.Errorf("no instance found for user: %s", username)
 	}
@@ -196,48 +205,14 @@ func connectSSH(ctx context.Context, username, project, keyPath string) error {
 	fmt.Printf("Connecting to %s's instance: %s\n", username, targetInstance.Name)
 	fmt.Printf("Instance: %s (%s)\n", targetInstance.PublicIP, targetInstance.State)
 
-	// Use custom key path if provided, otherwise try to download/use default
+	// Use custom key path if provided, otherwise the user's key pair or the default
 	var privateKeyPath string
 	if keyPath != "" {
 		privateKeyPath = keyPath
 	} else {
-		// Try to download and use the default key
-		privateKeyPath = filepath.Join(cfg.SSH.KeyPath, "LightsailDefaultKey.pem")
-
-		// Ensure the SSH key directory exists
-		if err := os.MkdirAll(cfg.SSH.KeyPath, 0700); err != nil {
-			return fmt.Errorf("failed to create SSH key directory: %w", err)
-		}
-
-		// Download the key if it doesn't exist
-		if _, err := os.Stat(privateKeyPath); os.IsNotExist(err) {
-			fmt.Println("Downloading SSH key...")
-			keyContent, err := lightsailService.DownloadSSHKey(ctx, "")
-			if err != nil {
-				return fmt.Errorf("failed to download SSH key: %w", err)
-			}
-
-			// Check if key content is already decoded or needs base64 decoding
-			var keyBytes []byte
-			if strings.HasPrefix(keyContent, "-----BEGIN") {
-				// Key is already in PEM format
-				keyBytes = []byte(keyContent)
-			} else {
-				// Try to decode from base64
-				decoded, err := base64.StdEncoding.DecodeString(keyContent)
-				if err != nil {
-					return fmt.Errorf("failed to decode SSH key (not base64): %w", err)
-				}
-				keyBytes = decoded
-			}
-
-			// Write key file with proper permissions
-			err = os.WriteFile(privateKeyPath, keyBytes, 0600)
-			if err != nil {
-				return fmt.Errorf("failed to write SSH key file: %w", err)
-			}
-
-			fmt.Printf("SSH key saved to: %s\n", privateKeyPath)
+		privateKeyPath, err = instanceKeyPath(ctx, lightsailService, cfg.SSH.KeyPath, targetInstance, usernames)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -251,11 +226,19 @@ func connectSSH(ctx context.Context, username, project, keyPath string) error {
 		return fmt.Errorf("failed to set SSH key permissions: %w", err)
 	}
 
+	// Verify the host against the keys Lightsail reports, pinning it on
+	// first connect if there are none
+	knownHostsFile, alias, _, err := pinHostKeys(ctx, lightsailService, targetInstance)
+	if err != nil {
+		return err
+	}
+
 	// Execute SSH command
 	sshArgs := []string{
 		"-i", privateKeyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "HostKeyAlias=" + alias,
+		"-o", "UserKnownHostsFile=" + knownHostsFile,
+		"-o", "StrictHostKeyChecking=accept-new",
 		fmt.Sprintf("ubuntu@%s", targetInstance.PublicIP),
 	}
 
@@ -288,6 +271,25 @@ func downloadSSHKey(ctx context.Context, username, project, outputPath string) e
 
 	lightsailService := aws.NewLightsailService(awsClient)
 
+	// Lightsail doesn't keep the private keys of key pairs it creates, so a
+	// user's own key is copied from where it was saved
+	if userKey := userKeyPath(cfg.SSH.KeyPath, username); userKey != "" {
+		keyBytes, err := os.ReadFile(userKey)
+		if err != nil {
+			return fmt.Errorf("failed to read SSH key file: %w", err)
+		}
+		if outputPath == "" {
+			fmt.Printf("✅ SSH key for %s is at: %s\n", username, userKey)
+			return nil
+		}
+		keyPath := filepath.Join(outputPath, filepath.Base(userKey))
+		if err := saveKeyPair(keyPath, string(keyBytes)); err != nil {
+			return err
+		}
+		fmt.Printf("✅ SSH key for %s copied to: %s\n", username, keyPath)
+		return nil
+	}
+
 	// Download the key
 	fmt.Printf("Downloading SSH key for user: %s\n", username)
 	keyContent, err := lightsailService.DownloadSSHKey(ctx, "")
@@ -295,18 +297,9 @@ func downloadSSHKey(ctx context.Context, username, project, outputPath string) e
 		return fmt.Errorf("failed to download SSH key: %w", err)
 	}
 
-	// Check if key content is already decoded or needs base64 decoding
-	var keyBytes []byte
-	if strings.HasPrefix(keyContent, "-----BEGIN") {
-		// Key is already in PEM format
-		keyBytes = []byte(keyContent)
-	} else {
-		// Try to decode from base64
-		decoded, err := base64.StdEncoding.DecodeString(keyContent)
-		if err != nil {
-			return fmt.Errorf("failed to decode SSH key (not base64): %w", err)
-		}
-		keyBytes = decoded
+	keyBytes, err := decodePrivateKey(keyContent)
+	if err != nil {
+		return err
 	}
 
 	// Determine output path
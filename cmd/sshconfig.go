@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/hostkeys"
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/sshconfig"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+// generateSSHConfig writes a project's Host blocks to the generated SSH config
+// and, unless include is false, includes it from ~/.ssh/config. An output path
+// of "-" prints the project's section instead.
+func generateSSHConfig(ctx context.Context, project, outputPath string, forwards []string, include bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+
+	section, err := buildSSHConfigSection(ctx, lightsailService, cfg, project, forwards, usernames)
+	if err != nil {
+		return err
+	}
+
+	if outputPath == "-" {
+		fmt.Print(section.Render())
+		return nil
+	}
+	if outputPath == "" {
+		outputPath = cfg.SSH.ConfigPath
+	}
+
+	file, err := sshconfig.Load(outputPath)
+	if err != nil {
+		return err
+	}
+	file.Set(section)
+	if err := file.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Wrote %d hosts for project %s to %s\n", len(section.Hosts), project, outputPath)
+
+	if include {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %w", err)
+		}
+		userConfig := filepath.Join(homeDir, ".ssh", "config")
+
+		added, err := sshconfig.EnsureInclude(userConfig, outputPath)
+		if err != nil {
+			return err
+		}
+		if added {
+			fmt.Printf("Added an Include of %s to %s\n", outputPath, userConfig)
+		}
+	}
+
+	fmt.Printf("\nConnect with:\n")
+	for _, host := range section.Hosts {
+		fmt.Printf("  ssh %s\n", host.Alias)
+	}
+	return nil
+}
+
+// buildSSHConfigSection builds a project's Host blocks from its instances,
+// each using the key pair of its owner in usernames, or the default key pair,
+// downloaded if it isn't saved yet, for users without one.
+func buildSSHConfigSection(ctx context.Context, lightsailService *aws.LightsailService, cfg *config.Config, project string, forwards, usernames []string) (*sshconfig.Section, error) {
+	instances, err := lightsailService.ListInstances(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	var localForwards []string
+	for _, spec := range forwards {
+		forward, err := ssh.ParseForward(spec)
+		if err != nil {
+			return nil, err
+		}
+		localForwards = append(localForwards, forward.LocalAddr+" "+forward.RemoteAddr)
+	}
+
+	aliases := sshHostAliases(instances, usernames, project)
+
+	section := &sshconfig.Section{Project: project, Forwards: forwards}
+	for _, instance := range instances {
+		alias, ok := aliases[instance.Name]
+		if !ok {
+			continue
+		}
+		keyPath, err := instanceKeyPath(ctx, lightsailService, cfg.SSH.KeyPath, instance, usernames)
+		if err != nil {
+			return nil, err
+		}
+
+		host := sshconfig.Host{
+			Alias:         alias,
+			Instance:      instance.Name,
+			User:          "ubuntu",
+			IdentityFile:  keyPath,
+			LocalForwards: localForwards,
+		}
+		// Starting instances already have their new IP; stopping ones are losing theirs
+		if instance.State != "stopped" && instance.State != "stopping" {
+			host.HostName = instance.PublicIP
+		}
+		// Pin the keys Lightsail reports where it can; the rest are pinned by
+		// ssh on first connect
+		if instance.State == "running" {
+			if knownHostsFile, _, _, err := pinHostKeys(ctx, lightsailService, instance); err == nil {
+				host.KnownHostsFile = knownHostsFile
+			}
+		}
+		if host.KnownHostsFile == "" {
+			if store, err := hostkeys.NewStore(); err == nil {
+				host.KnownHostsFile = store.Path(project)
+			}
+		}
+		section.Hosts = append(section.Hosts, host)
+	}
+	return section, nil
+}
+
+// sshHostAliases names the Host blocks of a project's instances
+// <user>-<project>, after the user in usernames who owns each. Instances
+// replaced by a resize or GPU switch that were kept are left out. When a user
+// still has several instances, the running one, or else the first by name,
+// gets the alias and the others are named <instance>-<project>, as are
+// instances no user owns.
+func sshHostAliases(instances []*types.Instance, usernames []string, project string) map[string]string {
+	superseded := make(map[string]string)
+	for _, instance := range instances {
+		for _, key := range []string{"ResizedFrom", "GPUSwitchFrom"} {
+			if source := instance.Tags[key]; source != "" {
+				superseded[source] = instance.Name
+			}
+		}
+	}
+
+	owned := make(map[string][]*types.Instance)
+	aliases := make(map[string]string)
+	for _, instance := range instances {
+		if replacement, ok := superseded[instance.Name]; ok {
+			fmt.Printf("⏭️  Skipping %s, replaced by %s\n", instance.Name, replacement)
+			continue
+		}
+		owner := utils.InstanceOwner(instance.Name, usernames)
+		if owner == "" {
+			aliases[instance.Name] = instance.Name + "-" + project
+			continue
+		}
+		owned[owner] = append(owned[owner], instance)
+	}
+
+	for owner, twins := range owned {
+		sort.SliceStable(twins, func(i, j int) bool {
+			if running := twins[i].State == "running"; running != (twins[j].State == "running") {
+				return running
+			}
+			return twins[i].Name < twins[j].Name
+		})
+		aliases[twins[0].Name] = owner + "-" + project
+		for _, twin := range twins[1:] {
+			aliases[twin.Name] = twin.Name + "-" + project
+		}
+	}
+	return aliases
+}
+
+// ensureDefaultKey returns the path of the region's default key pair in
+// keyDir, downloading it first if needed.
+func ensureDefaultKey(ctx context.Context, lightsailService *aws.LightsailService, keyDir string) (string, error) {
+	keyPath := filepath.Join(keyDir, "LightsailDefaultKey.pem")
+
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create SSH key directory: %w", err)
+	}
+
+	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+		fmt.Println("Downloading SSH key...")
+		keyContent, err := lightsailService.DownloadSSHKey(ctx, "")
+		if err != nil {
+			return "", fmt.Errorf("failed to download SSH key: %w", err)
+		}
+
+		keyBytes, err := decodePrivateKey(keyContent)
+		if err != nil {
+			return "", err
+		}
+
+		if err := os.WriteFile(keyPath, keyBytes, 0600); err != nil {
+			return "", fmt.Errorf("failed to write SSH key file: %w", err)
+		}
+
+		fmt.Printf("SSH key saved to: %s\n", keyPath)
+	}
+
+	return keyPath, nil
+}
+
+// syncSSHConfig regenerates the generated SSH config's sections for the
+// projects of instances whose state changed, so Host blocks follow their new
+// public IPs. Projects without a section are left alone, and failures are
+// reported without failing the command.
+func syncSSHConfig(ctx context.Context, awsClient *aws.Client, instances []*types.Instance) {
+	cfg, err := config.Load()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(cfg.SSH.ConfigPath); err != nil {
+		return
+	}
+
+	file, err := sshconfig.Load(cfg.SSH.ConfigPath)
+	if err != nil {
+		fmt.Printf("⚠️ SSH config not updated: %v\n", err)
+		return
+	}
+
+	projects := make(map[string]bool)
+	for _, instance := range instances {
+		if project := instance.Tags["Project"]; project != "" && file.Section(project) != nil {
+			projects[project] = true
+		}
+	}
+	if len(projects) == 0 {
+		return
+	}
+
+	var names []string
+	for project := range projects {
+		names = append(names, project)
+	}
+	sort.Strings(names)
+
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		fmt.Printf("⚠️ SSH config not updated: %v\n", err)
+		return
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+	for _, project := range names {
+		section, err := buildSSHConfigSection(ctx, lightsailService, cfg, project, file.Section(project).Forwards, usernames)
+		if err != nil {
+			fmt.Printf("⚠️ SSH config for project %s not updated: %v\n", project, err)
+			continue
+		}
+		file.Set(section)
+	}
+
+	if err := file.Save(); err != nil {
+		fmt.Printf("⚠️ SSH config not updated: %v\n", err)
+		return
+	}
+	fmt.Printf("🔑 Updated SSH config %s for project %s\n", cfg.SSH.ConfigPath, strings.Join(names, ", "))
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
 	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
 	"github.com/scttfrdmn/lfr-tools/internal/utils"
 )
 
@@ -84,7 +85,12 @@ access permissions, and recent activity.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		project, _ := cmd.Flags().GetString("project")
 
-		return showStudentStatus(cmd.Context(), project)
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return showStudentStatus(cmd.Context(), project, out)
 	},
 }
 
@@ -123,6 +129,7 @@ func init() {
 	// Status command flags
 	studentsStatusCmd.Flags().StringP("project", "p", "", "Project name (required)")
 	studentsStatusCmd.MarkFlagRequired("project")
+	addOutputFlags(studentsStatusCmd)
 }
 
 // setupClass sets up a complete class environment.
@@ -225,6 +232,11 @@ func generateStudentTokens(ctx context.Context, project, outputDir string) error
 	students := classConfig["students"].([]interface{})
 	tas := classConfig["tas"].([]interface{})
 
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
 	// Generate tokens for students and TAs
 	tm, err := config.NewTokenManager()
 	if err != nil {
@@ -247,13 +259,17 @@ func generateStudentTokens(ctx context.Context, project, outputDir string) error
 	for i, studentInterface := range students {
 		student := studentInterface.(string)
 
-		tokenString, _, err := tm.GenerateToken(
+		tokenString, token, err := tm.GenerateToken(
 			project, student, fmt.Sprintf("student-%d", i+1), "student",
 			[]string{"connect"}, bucket, time.Now().AddDate(0, 6, 0)) // 6 months
 		if err != nil {
 			fmt.Printf("❌ Failed to generate token for %s: %v\n", student, err)
 			continue
 		}
+		if _, err := writeIssuedToken(cfg, outputDir, token); err != nil {
+			fmt.Printf("❌ Failed to write token file for %s: %v\n", student, err)
+			continue
+		}
 
 		fmt.Fprintf(tokensList, "%s:student:%s\n", student, tokenString)
 		fmt.Printf("✅ Generated token for student: %s\n", student)
@@ -265,13 +281,17 @@ func generateStudentTokens(ctx context.Context, project, outputDir string) error
 		for i, taInterface := range tas {
 			ta := taInterface.(string)
 
-			tokenString, _, err := tm.GenerateToken(
+			tokenString, token, err := tm.GenerateToken(
 				project, ta, fmt.Sprintf("ta-%d", i+1), "ta",
 				[]string{"connect", "start", "stop", "status"}, bucket, time.Now().AddDate(0, 6, 0))
 			if err != nil {
 				fmt.Printf("❌ Failed to generate token for TA %s: %v\n", ta, err)
 				continue
 			}
+			if _, err := writeIssuedToken(cfg, outputDir, token); err != nil {
+				fmt.Printf("❌ Failed to write token file for TA %s: %v\n", ta, err)
+				continue
+			}
 
 			fmt.Fprintf(tokensList, "%s:ta:%s\n", ta, tokenString)
 			fmt.Printf("✅ Generated token for TA: %s\n", ta)
@@ -281,10 +301,11 @@ func generateStudentTokens(ctx context.Context, project, outputDir string) error
 	fmt.Printf("\n🎉 Token generation completed!\n")
 	fmt.Printf("Tokens saved to: %s\n", tokensFile)
 	fmt.Printf("\nDistribution instructions:\n")
-	fmt.Printf("1. Send each user their specific token via secure email\n")
+	fmt.Printf("1. Send each user their token file (%s-<username>.json) via secure email;\n", project)
+	fmt.Printf("   it carries their own SSH key\n")
 	fmt.Printf("2. Include activation instructions:\n")
 	fmt.Printf("   brew install lfr\n")
-	fmt.Printf("   lfr connect activate <their-token> <their-student-id>\n")
+	fmt.Printf("   lfr connect activate <their-token-file> <their-student-id>\n")
 	fmt.Printf("   lfr connect <their-username>\n")
 
 	return nil
@@ -339,7 +360,7 @@ func checkStartRequests(ctx context.Context, project string, autoApprove bool) e
 		fmt.Printf("\nAuto-approving %d start requests...\n", len(usersToStart))
 
 		// Start the requested instances
-		err = startInstances(ctx, usersToStart, project, true)
+		err = startInstances(ctx, usersToStart, project, true, utils.DefaultParallel)
 		if err != nil {
 			return fmt.Errorf("failed to start instances: %w", err)
 		}
@@ -359,8 +380,17 @@ func checkStartRequests(ctx context.Context, project string, autoApprove bool) e
 	return nil
 }
 
+// studentStatus is a student's instance status in structured output.
+type studentStatus struct {
+	Student      string `json:"student" yaml:"student"`
+	Instance     string `json:"instance" yaml:"instance"`
+	State        string `json:"state" yaml:"state"`
+	PublicIP     string `json:"public_ip,omitempty" yaml:"public_ip,omitempty"`
+	LastActivity string `json:"last_activity" yaml:"last_activity"`
+}
+
 // showStudentStatus shows comprehensive status for all students.
-func showStudentStatus(ctx context.Context, project string) error {
+func showStudentStatus(ctx context.Context, project string, out *output.Renderer) error {
 	// Create AWS client
 	awsClient, err := aws.NewClient(ctx, aws.Options{
 		Region:  viper.GetString("aws.region"),
@@ -377,23 +407,18 @@ func showStudentStatus(ctx context.Context, project string) error {
 	if err != nil {
 		return fmt.Errorf("failed to list instances: %w", err)
 	}
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("Student status for project: %s\n\n", project)
-	fmt.Printf("%-15s %-20s %-12s %-18s %-15s\n",
-		"STUDENT", "INSTANCE", "STATE", "PUBLIC IP", "LAST ACTIVITY")
-	fmt.Println(strings.Repeat("-", 95))
-
+	var students []studentStatus
 	for _, instance := range instances {
-		username := utils.ExtractUsernameFromInstance(instance.Name)
+		username := utils.InstanceOwner(instance.Name, usernames)
 		if username == "" {
 			continue
 		}
 
-		publicIP := instance.PublicIP
-		if publicIP == "" {
-			publicIP = "-"
-		}
-
 		// Calculate last activity (simplified)
 		lastActivity := "Unknown"
 		if instance.State == "running" {
@@ -402,16 +427,46 @@ func showStudentStatus(ctx context.Context, project string) error {
 			lastActivity = "Stopped"
 		}
 
+		students = append(students, studentStatus{
+			Student:      username,
+			Instance:     instance.Name,
+			State:        instance.State,
+			PublicIP:     instance.PublicIP,
+			LastActivity: lastActivity,
+		})
+	}
+
+	if out.Structured() {
+		return out.Render(students, func() *output.Table {
+			table := output.NewTable("student", "instance", "state", "public_ip", "last_activity")
+			for _, student := range students {
+				table.AddRow(student.Student, student.Instance, student.State, student.PublicIP, student.LastActivity)
+			}
+			return table
+		})
+	}
+
+	fmt.Printf("Student status for project: %s\n\n", project)
+	fmt.Printf("%-15s %-20s %-12s %-18s %-15s\n",
+		"STUDENT", "INSTANCE", "STATE", "PUBLIC IP", "LAST ACTIVITY")
+	fmt.Println(strings.Repeat("-", 95))
+
+	for _, student := range students {
+		publicIP := student.PublicIP
+		if publicIP == "" {
+			publicIP = "-"
+		}
+
 		fmt.Printf("%-15s %-20s %-12s %-18s %-15s\n",
-			username,
-			instance.Name,
-			instance.State,
+			student.Student,
+			student.Instance,
+			student.State,
 			publicIP,
-			lastActivity,
+			student.LastActivity,
 		)
 	}
 
-	fmt.Printf("\nTotal: %d students\n", len(instances))
+	fmt.Printf("\nTotal: %d students\n", len(students))
 
 	return nil
 }
\ No newline at end of file
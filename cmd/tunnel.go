@@ -0,0 +1,691 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/scttfrdmn/lfr-tools/internal/aws"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+	"github.com/scttfrdmn/lfr-tools/internal/software"
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+)
+
+// tunnelStartTimeout is how long a background tunnel has to come up.
+const tunnelStartTimeout = time.Minute
+
+var sshTunnelCmd = &cobra.Command{
+	Use:   "tunnel [username] [forward...]",
+	Short: "Create SSH tunnel to instance",
+	Long: `Create an SSH tunnel to a user's Lightsail instance for secure access to services
+running on the instance (e.g., Jupyter notebooks, web servers).
+
+Each forward is a port, local_port:remote_port, local_port:host:remote_port or
+bind_address:local_port:host:remote_port. Remote hosts are resolved on the
+instance and default to its localhost. With -D, a SOCKS5 proxy is also opened
+whose connections are made from the instance. With --pack, the ports published
+by container software packs are forwarded to the same local ports.
+
+The tunnel runs until interrupted, or with --background in a separate process
+that keeps running after this command exits. Use 'lfr ssh tunnel list' and
+'lfr ssh tunnel close' to manage running tunnels.
+
+Examples:
+  lfr ssh tunnel alice 8888 -p cs101                  # Jupyter
+  lfr ssh tunnel alice 8888 8787 --background         # Jupyter and RStudio Server
+  lfr ssh tunnel alice 9000:8787 -D 1080
+  lfr ssh tunnel alice --pack jupyter-container      # A container pack's ports`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		socks, _ := cmd.Flags().GetString("socks")
+		background, _ := cmd.Flags().GetBool("background")
+		id, _ := cmd.Flags().GetString("tunnel-id")
+		packs, _ := cmd.Flags().GetStringSlice("pack")
+
+		forwards := args[1:]
+		if len(packs) > 0 {
+			packForwards, err := containerPackForwards(cmd.Context(), packs)
+			if err != nil {
+				return err
+			}
+			forwards = append(forwards, packForwards...)
+		}
+
+		spec, err := parseTunnelSpec(args[0], project, forwards, socks)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			// Started by --background, which logs to a file
+			spec.ID = id
+			spec.Log, _ = tunnelLogPath(id)
+		}
+
+		if background {
+			return startBackgroundTunnel(cmd.Context(), spec)
+		}
+		return runTunnel(cmd.Context(), spec)
+	},
+}
+
+var sshTunnelListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List running SSH tunnels",
+	Long:  `List the SSH tunnels running on this machine, in the foreground or background.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return listTunnels(out)
+	},
+}
+
+var sshTunnelCloseCmd = &cobra.Command{
+	Use:   "close [id...]",
+	Short: "Close running SSH tunnels",
+	Long: `Close SSH tunnels by ID, as shown by 'lfr ssh tunnel list', or all of a user's
+tunnels by username. Use --all to close every tunnel.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		if !all && len(args) == 0 {
+			return fmt.Errorf("specify tunnel IDs or usernames to close, or --all")
+		}
+
+		return closeTunnels(args, all)
+	},
+}
+
+func init() {
+	sshTunnelCmd.AddCommand(sshTunnelListCmd)
+	sshTunnelCmd.AddCommand(sshTunnelCloseCmd)
+
+	sshTunnelCmd.Flags().StringP("project", "p", "", "Filter by project name")
+	sshTunnelCmd.Flags().StringP("socks", "D", "", "Open a SOCKS5 proxy on [bind_address:]port")
+	sshTunnelCmd.Flags().BoolP("background", "b", false, "Run the tunnel in the background")
+	sshTunnelCmd.Flags().StringSlice("pack", nil, "Forward the ports of container software packs")
+	sshTunnelCmd.Flags().String("tunnel-id", "", "ID to register the tunnel under")
+	sshTunnelCmd.Flags().MarkHidden("tunnel-id")
+
+	addOutputFlags(sshTunnelListCmd)
+
+	sshTunnelCloseCmd.Flags().Bool("all", false, "Close all tunnels")
+}
+
+// containerPackForwards returns forwards of the ports that container packs
+// publish on an instance's localhost.
+func containerPackForwards(ctx context.Context, packIDs []string) ([]string, error) {
+	index, err := loadSoftwarePacks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lookup := softwareLookup(index)
+
+	var forwards []string
+	for _, id := range packIDs {
+		pack, err := lookup(id)
+		if err != nil {
+			return nil, err
+		}
+		if pack.Container == nil {
+			return nil, fmt.Errorf("software pack '%s' does not run a container", pack.ID)
+		}
+
+		ports, err := software.ContainerPorts(pack.Container)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ports in software pack '%s': %w", pack.ID, err)
+		}
+		if len(ports) == 0 {
+			return nil, fmt.Errorf("software pack '%s' publishes no ports", pack.ID)
+		}
+		for _, port := range ports {
+			forwards = append(forwards, strconv.Itoa(port.Host))
+		}
+	}
+	return forwards, nil
+}
+
+// tunnelSpec is a requested tunnel.
+type tunnelSpec struct {
+	ID       string
+	User     string
+	Project  string
+	Forwards []ssh.Forward
+	// SOCKS is the local address of the SOCKS proxy, if any.
+	SOCKS string
+	// Log is the file a background tunnel's output goes to.
+	Log string
+}
+
+// tunnelState is a running tunnel, recorded in the tunnels directory while
+// its process is alive. ProcessStart tells the tunnel's process apart from a
+// later one that reuses its PID.
+type tunnelState struct {
+	ID           string        `json:"id"`
+	PID          int           `json:"pid"`
+	ProcessStart string        `json:"process_start,omitempty"`
+	User         string        `json:"user"`
+	Project      string        `json:"project,omitempty"`
+	Instance     string        `json:"instance"`
+	Host         string        `json:"host"`
+	Forwards     []ssh.Forward `json:"forwards,omitempty"`
+	SOCKS        string        `json:"socks,omitempty"`
+	Log          string        `json:"log,omitempty"`
+	StartedAt    time.Time     `json:"started_at"`
+}
+
+// parseTunnelSpec validates the forwards of a tunnel and names it after the
+// user and its first local port.
+func parseTunnelSpec(username, project string, forwards []string, socks string) (*tunnelSpec, error) {
+	if len(forwards) == 0 && socks == "" {
+		return nil, fmt.Errorf("specify at least one forward, such as 8888 or 8888:8888, or -D for a SOCKS proxy")
+	}
+
+	spec := &tunnelSpec{User: username, Project: project}
+	for _, f := range forwards {
+		forward, err := ssh.ParseForward(f)
+		if err != nil {
+			return nil, err
+		}
+		spec.Forwards = append(spec.Forwards, forward)
+	}
+
+	if socks != "" {
+		host, port := "localhost", socks
+		if strings.Contains(socks, ":") {
+			var err error
+			if host, port, err = net.SplitHostPort(socks); err != nil {
+				return nil, fmt.Errorf("invalid SOCKS address %q: %w", socks, err)
+			}
+		}
+		if _, err := ssh.ParsePort(port); err != nil {
+			return nil, fmt.Errorf("invalid SOCKS address %q: %w", socks, err)
+		}
+		spec.SOCKS = net.JoinHostPort(host, port)
+	}
+
+	first := spec.SOCKS
+	if len(spec.Forwards) > 0 {
+		first = spec.Forwards[0].LocalAddr
+	}
+	_, port, _ := net.SplitHostPort(first)
+	spec.ID = username + "-" + port
+
+	return spec, nil
+}
+
+// runTunnel opens a tunnel's forwards and serves them until ctx is done or
+// the connection to the instance is lost.
+func runTunnel(ctx context.Context, spec *tunnelSpec) error {
+	if existing, err := readTunnel(spec.ID); err == nil && tunnelAlive(existing) {
+		return fmt.Errorf("tunnel %s is already running (PID %d)", spec.ID, existing.PID)
+	}
+
+	awsClient, err := newAWSClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	instances, err := lightsailService.ListInstances(ctx, spec.Project)
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+	instance := findUserInstance(instances, spec.User, usernames)
+	if instance == nil {
+		return fmt.Errorf("no instance found for user: %s", spec.User)
+	}
+	if instance.State != "running" {
+		return fmt.Errorf("instance %s is %s; start it first", instance.Name, instance.State)
+	}
+
+	// Bind every local port before connecting so conflicts fail fast
+	var listeners []net.Listener
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	for _, forward := range spec.Forwards {
+		listener, err := net.Listen("tcp", forward.LocalAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", forward.LocalAddr, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	var socksListener net.Listener
+	if spec.SOCKS != "" {
+		socksListener, err = net.Listen("tcp", spec.SOCKS)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", spec.SOCKS, err)
+		}
+		listeners = append(listeners, socksListener)
+	}
+
+	client, err := connectInstance(ctx, lightsailService, instance)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	state := &tunnelState{
+		ID:        spec.ID,
+		PID:       os.Getpid(),
+		User:      spec.User,
+		Project:   spec.Project,
+		Instance:  instance.Name,
+		Host:      instance.PublicIP,
+		Forwards:  spec.Forwards,
+		SOCKS:     spec.SOCKS,
+		Log:       spec.Log,
+		StartedAt: time.Now(),
+	}
+	if state.ProcessStart, err = processStartTime(state.PID); err != nil {
+		return err
+	}
+	if err := saveTunnel(state); err != nil {
+		return err
+	}
+	defer removeTunnelState(spec.ID)
+
+	fmt.Printf("🔗 Tunnel %s to %s (%s)\n", spec.ID, instance.Name, instance.PublicIP)
+	for _, forward := range spec.Forwards {
+		fmt.Printf("  %s -> %s\n", forward.LocalAddr, forward.RemoteAddr)
+	}
+	if spec.SOCKS != "" {
+		fmt.Printf("  %s (SOCKS5 proxy)\n", spec.SOCKS)
+	}
+	fmt.Printf("Press Ctrl+C to close the tunnel.\n")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(listeners)+1)
+	for i, forward := range spec.Forwards {
+		go func(listener net.Listener, remoteAddr string) {
+			errs <- client.Forward(ctx, listener, remoteAddr)
+		}(listeners[i], forward.RemoteAddr)
+	}
+	if socksListener != nil {
+		go func() {
+			errs <- client.ServeSOCKS(ctx, socksListener)
+		}()
+	}
+	go func() {
+		client.Wait()
+		errs <- fmt.Errorf("connection to %s lost", instance.Name)
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Printf("\nTunnel %s closed\n", spec.ID)
+		return nil
+	case err := <-errs:
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+}
+
+// startBackgroundTunnel runs a tunnel in a detached copy of this process and
+// waits for it to come up.
+func startBackgroundTunnel(ctx context.Context, spec *tunnelSpec) error {
+	if existing, err := readTunnel(spec.ID); err == nil && tunnelAlive(existing) {
+		return fmt.Errorf("tunnel %s is already running (PID %d)", spec.ID, existing.PID)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find lfr executable: %w", err)
+	}
+
+	logFile, err := tunnelLogPath(spec.ID)
+	if err != nil {
+		return err
+	}
+	logOut, err := os.Create(logFile)
+	if err != nil {
+		return fmt.Errorf("failed to create tunnel log: %w", err)
+	}
+	defer logOut.Close()
+
+	args := []string{"ssh", "tunnel", spec.User, "--tunnel-id", spec.ID}
+	for _, forward := range spec.Forwards {
+		args = append(args, forward.String())
+	}
+	if spec.SOCKS != "" {
+		args = append(args, "--socks", spec.SOCKS)
+	}
+	if spec.Project != "" {
+		args = append(args, "--project", spec.Project)
+	}
+	if cfgFile != "" {
+		args = append(args, "--config", cfgFile)
+	}
+	if profile := viper.GetString("aws.profile"); profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	if region := viper.GetString("aws.region"); region != "" {
+		args = append(args, "--region", region)
+	}
+
+	child := exec.Command(executable, args...)
+	child.Stdout = logOut
+	child.Stderr = logOut
+	detachProcess(child)
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to start background tunnel: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- child.Wait()
+	}()
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(tunnelStartTimeout)
+	for {
+		select {
+		case <-exited:
+			log, _ := os.ReadFile(logFile)
+			return fmt.Errorf("background tunnel exited:\n%s", strings.TrimSpace(string(log)))
+		case <-timeout:
+			child.Process.Kill()
+			return fmt.Errorf("background tunnel did not start within %v, see %s", tunnelStartTimeout, logFile)
+		case <-ctx.Done():
+			child.Process.Kill()
+			return ctx.Err()
+		case <-ticker.C:
+			state, err := readTunnel(spec.ID)
+			if err != nil || state.PID != child.Process.Pid {
+				continue
+			}
+
+			fmt.Printf("✅ Tunnel %s running in the background (PID %d)\n", state.ID, state.PID)
+			for _, forward := range state.Forwards {
+				fmt.Printf("  %s -> %s\n", forward.LocalAddr, forward.RemoteAddr)
+			}
+			if state.SOCKS != "" {
+				fmt.Printf("  %s (SOCKS5 proxy)\n", state.SOCKS)
+			}
+			fmt.Printf("Log: %s\n", logFile)
+			fmt.Printf("Close it with: lfr ssh tunnel close %s\n", state.ID)
+			return nil
+		}
+	}
+}
+
+// listTunnels prints the running tunnels.
+func listTunnels(out *output.Renderer) error {
+	tunnels, err := loadTunnels()
+	if err != nil {
+		return err
+	}
+
+	if out.Structured() {
+		return out.Render(tunnels, func() *output.Table {
+			table := output.NewTable("id", "pid", "user", "instance", "host", "forwards", "socks", "started_at")
+			for _, t := range tunnels {
+				table.AddRow(t.ID, strconv.Itoa(t.PID), t.User, t.Instance, t.Host,
+					describeForwards(t.Forwards), t.SOCKS, t.StartedAt.Format(time.RFC3339))
+			}
+			return table
+		})
+	}
+
+	if len(tunnels) == 0 {
+		fmt.Println("No SSH tunnels running.")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-8s %-25s %-30s %-20s\n", "ID", "PID", "INSTANCE", "FORWARDS", "STARTED")
+	fmt.Println(strings.Repeat("-", 105))
+
+	for _, t := range tunnels {
+		forwards := describeForwards(t.Forwards)
+		if t.SOCKS != "" {
+			forwards = strings.TrimPrefix(forwards+", SOCKS "+t.SOCKS, ", ")
+		}
+		fmt.Printf("%-20s %-8d %-25s %-30s %-20s\n",
+			t.ID, t.PID, t.Instance, forwards, t.StartedAt.Format("2006-01-02 15:04"))
+	}
+
+	fmt.Printf("\nTotal: %d tunnels\n", len(tunnels))
+	return nil
+}
+
+// closeTunnels stops the tunnels matching ids, which may also be usernames,
+// or every tunnel when all is set.
+func closeTunnels(ids []string, all bool) error {
+	tunnels, err := loadTunnels()
+	if err != nil {
+		return err
+	}
+
+	matched := make(map[string]bool)
+	var selected []*tunnelState
+	for _, t := range tunnels {
+		for _, id := range ids {
+			if t.ID == id || t.User == id {
+				matched[id] = true
+			}
+		}
+		if all || matched[t.ID] || matched[t.User] {
+			selected = append(selected, t)
+		}
+	}
+	for _, id := range ids {
+		if !matched[id] {
+			fmt.Printf("⚠️ No tunnel found for %s\n", id)
+		}
+	}
+
+	if len(selected) == 0 {
+		fmt.Println("No SSH tunnels to close.")
+		return nil
+	}
+
+	failed := 0
+	for _, t := range selected {
+		// Only signal the PID while it is still the tunnel's process
+		if err := checkTunnelProcess(t); err != nil {
+			fmt.Printf("❌ %s: %v\n", t.ID, err)
+			failed++
+			continue
+		}
+		if err := stopProcess(t.PID); err != nil {
+			fmt.Printf("❌ %s: %v\n", t.ID, err)
+			failed++
+			continue
+		}
+		// The tunnel removes its own state file on exit; don't leave a stale
+		// one if it was killed before it could
+		waitForTunnelExit(t, 5*time.Second)
+		removeTunnelState(t.ID)
+		if t.Log != "" {
+			os.Remove(t.Log)
+		}
+		fmt.Printf("✅ Closed tunnel %s\n", t.ID)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to close %d of %d tunnels", failed, len(selected))
+	}
+	return nil
+}
+
+// waitForTunnelExit waits until a tunnel's process has exited.
+func waitForTunnelExit(t *tunnelState, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for tunnelAlive(t) && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// tunnelAlive reports whether a tunnel's process is still running, and not
+// replaced by another process with the same PID.
+func tunnelAlive(t *tunnelState) bool {
+	if !processAlive(t.PID) {
+		return false
+	}
+	started, err := processStartTime(t.PID)
+	if err != nil || t.ProcessStart == "" {
+		// Can't tell; checkTunnelProcess refuses to signal it
+		return true
+	}
+	return started == t.ProcessStart
+}
+
+// checkTunnelProcess returns an error unless the tunnel's PID is still the
+// process that registered it.
+func checkTunnelProcess(t *tunnelState) error {
+	if t.ProcessStart == "" {
+		return fmt.Errorf("PID %d was recorded without its start time; stop it by hand if it is still the tunnel", t.PID)
+	}
+	started, err := processStartTime(t.PID)
+	if err != nil {
+		return fmt.Errorf("can't confirm PID %d is still the tunnel: %w", t.PID, err)
+	}
+	if started != t.ProcessStart {
+		return fmt.Errorf("PID %d is now another process", t.PID)
+	}
+	return nil
+}
+
+func describeForwards(forwards []ssh.Forward) string {
+	var parts []string
+	for _, forward := range forwards {
+		_, local, _ := net.SplitHostPort(forward.LocalAddr)
+		parts = append(parts, local+"->"+forward.RemoteAddr)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tunnelsDir returns ~/.lfr-tools/tunnels, creating it if needed.
+func tunnelsDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	dir := filepath.Join(homeDir, ".lfr-tools", "tunnels")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create tunnels directory: %w", err)
+	}
+	return dir, nil
+}
+
+func tunnelLogPath(id string) (string, error) {
+	dir, err := tunnelsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".log"), nil
+}
+
+func saveTunnel(state *tunnelState) error {
+	dir, err := tunnelsDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tunnel state: %w", err)
+	}
+
+	// Write atomically so a waiting parent never reads a partial file
+	path := filepath.Join(dir, state.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write tunnel state: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write tunnel state: %w", err)
+	}
+	return nil
+}
+
+func readTunnel(id string) (*tunnelState, error) {
+	dir, err := tunnelsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var state tunnelState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse tunnel state %s: %w", id, err)
+	}
+	return &state, nil
+}
+
+// removeTunnelState removes a tunnel's state file. Its log is kept so the
+// reason a background tunnel exited can be read.
+func removeTunnelState(id string) {
+	dir, err := tunnelsDir()
+	if err != nil {
+		return
+	}
+	os.Remove(filepath.Join(dir, id+".json"))
+}
+
+// loadTunnels returns the running tunnels sorted by ID, removing the state of
+// tunnels whose process is gone or whose PID has been reused.
+func loadTunnels() ([]*tunnelState, error) {
+	dir, err := tunnelsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	tunnels := []*tunnelState{}
+	for _, match := range matches {
+		id := strings.TrimSuffix(filepath.Base(match), ".json")
+		state, err := readTunnel(id)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("⚠️ %v\n", err)
+			}
+			continue
+		}
+		if !tunnelAlive(state) {
+			removeTunnelState(id)
+			continue
+		}
+		tunnels = append(tunnels, state)
+	}
+
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].ID < tunnels[j].ID })
+	return tunnels, nil
+}
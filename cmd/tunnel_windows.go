@@ -0,0 +1,58 @@
+//go:build windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// processQueryLimitedInformation is PROCESS_QUERY_LIMITED_INFORMATION, which
+// is enough to read a process's times.
+const processQueryLimitedInformation = 0x1000
+
+// detachProcess starts cmd in its own process group so it outlives the console.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// processAlive reports whether a process exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+// stopProcess terminates a process.
+func stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	return process.Kill()
+}
+
+// processStartTime returns when a process was created, in a form that only
+// needs to compare equal for the same process.
+func processStartTime(pid int) (string, error) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return "", fmt.Errorf("failed to open process %d: %w", pid, err)
+	}
+	defer syscall.CloseHandle(handle)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return "", fmt.Errorf("failed to get start time of process %d: %w", pid, err)
+	}
+	return strconv.FormatInt(creation.Nanoseconds(), 10), nil
+}
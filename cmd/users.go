@@ -3,13 +3,18 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
 	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/journal"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
 	"github.com/scttfrdmn/lfr-tools/internal/utils"
 )
 
@@ -58,7 +63,12 @@ var usersListCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		project, _ := cmd.Flags().GetString("project")
 
-		return listUsers(cmd.Context(), project)
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return listUsers(cmd.Context(), project, out)
 	},
 }
 
@@ -73,8 +83,9 @@ columns: username, project, blueprint, bundle, groups (optional).`,
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
 		continueOnError, _ := cmd.Flags().GetBool("continue-on-error")
 		startStopped, _ := cmd.Flags().GetBool("start-stopped")
+		parallel, _ := cmd.Flags().GetInt("parallel")
 
-		return createBulkUsers(cmd.Context(), csvFile, dryRun, continueOnError, startStopped)
+		return createBulkUsers(cmd.Context(), csvFile, dryRun, continueOnError, startStopped, parallel)
 	},
 }
 
@@ -88,8 +99,9 @@ and optional rollback capabilities.`,
 		project, _ := cmd.Flags().GetString("project")
 		csvFile, _ := cmd.Flags().GetString("csv")
 		confirm, _ := cmd.Flags().GetBool("confirm")
+		parallel, _ := cmd.Flags().GetInt("parallel")
 
-		return removeBulkUsers(cmd.Context(), users, project, csvFile, confirm)
+		return removeBulkUsers(cmd.Context(), users, project, csvFile, confirm, parallel)
 	},
 }
 
@@ -140,29 +152,83 @@ func init() {
 
 	// List command flags
 	usersListCmd.Flags().StringP("project", "p", "", "Filter by project name")
+	addOutputFlags(usersListCmd)
 
 	// Bulk create command flags
 	usersCreateBulkCmd.Flags().BoolP("dry-run", "d", false, "Show what would be created without executing")
 	usersCreateBulkCmd.Flags().BoolP("continue-on-error", "c", false, "Continue creating users even if some fail")
 	usersCreateBulkCmd.Flags().BoolP("start-stopped", "s", false, "Create instances but immediately stop them to save costs")
 	usersCreateBulkCmd.Flags().String("from-snapshot", "", "Create instances from existing snapshot instead of blueprint")
+	usersCreateBulkCmd.Flags().Int("parallel", utils.DefaultParallel, "Number of users to create concurrently")
 
 	// Bulk remove command flags
 	usersRemoveBulkCmd.Flags().StringSliceP("users", "u", []string{}, "Specific usernames to remove")
 	usersRemoveBulkCmd.Flags().StringP("project", "p", "", "Remove all users from project")
 	usersRemoveBulkCmd.Flags().StringP("csv", "", "", "CSV file containing users to remove")
 	usersRemoveBulkCmd.Flags().BoolP("confirm", "y", false, "Skip confirmation prompts")
+	usersRemoveBulkCmd.Flags().Int("parallel", utils.DefaultParallel, "Number of users to remove concurrently")
+}
+
+// userProvisionResult records the outcome of provisioning a single user.
+type userProvisionResult struct {
+	Username       string
+	Password       string
+	InstanceARN    string
+	Err            error
+	RolledBack     bool
+	RollbackErrors []error
+}
+
+// Status returns a short description of the outcome.
+func (r *userProvisionResult) Status() string {
+	switch {
+	case r.Err == nil:
+		return "succeeded"
+	case len(r.RollbackErrors) > 0:
+		return "rollback failed"
+	case r.RolledBack:
+		return "rolled back"
+	default:
+		return "failed"
+	}
 }
 
 // createUsers implements the core user creation logic from the original script.
+// Each user is provisioned as a unit: if any step fails, the steps that already
+// succeeded for that user are undone before moving on to the next user.
 func createUsers(ctx context.Context, project, blueprint, bundle, region string, usernames []string) error {
+	results, err := provisionUsers(ctx, project, blueprint, bundle, region, usernames, 1, nil)
+	if err != nil {
+		return err
+	}
+
+	printProvisionSummary(results)
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed to provision", failed, len(results))
+	}
+
+	fmt.Printf("\n🎉 User creation completed!\n")
+	return nil
+}
+
+// provisionUsers ensures the shared policy and group exist and provisions up to
+// parallel users at a time, returning one result per user. Progress is recorded
+// in op if it is not nil. An error is only returned if the shared setup fails.
+func provisionUsers(ctx context.Context, project, blueprint, bundle, region string, usernames []string, parallel int, op *journal.Operation) ([]*userProvisionResult, error) {
 	fmt.Printf("Creating %d users for project: %s\n", len(usernames), project)
 	fmt.Printf("Blueprint: %s, Bundle: %s, Region: %s\n", blueprint, bundle, region)
 
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	// Create AWS client
@@ -171,13 +237,55 @@ func createUsers(ctx context.Context, project, blueprint, bundle, region string,
 		Profile: viper.GetString("aws.profile"),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create AWS client: %w", err)
+		return nil, fmt.Errorf("failed to create AWS client: %w", err)
 	}
 
 	iamService := aws.NewIAMService(awsClient)
 	lightsailService := aws.NewLightsailService(awsClient)
 
-	// Step 1: Ensure LightsailReadOnly policy exists
+	// Ensure the policy and group shared by all users exist
+	if err := ensureUsersGroup(ctx, iamService); err != nil {
+		return nil, err
+	}
+
+	// Create users and instances
+	availabilityZone := region + "a"
+
+	fmt.Printf("\nCreating %d users and instances...\n", len(usernames))
+
+	var mu sync.Mutex
+	byUser := make(map[string]*userProvisionResult)
+
+	utils.RunBulk(ctx, usernames, utils.BulkOptions{Parallel: parallel, Action: "Creating users", Journal: op},
+		func(ctx context.Context, username string) (string, error) {
+			result := provisionUser(ctx, iamService, lightsailService, project, blueprint, bundle, availabilityZone, username, username+"-"+blueprint, aws.DefaultIdleSettings)
+
+			mu.Lock()
+			byUser[username] = result
+			mu.Unlock()
+
+			if result.Err != nil {
+				return "", result.Err
+			}
+			return fmt.Sprintf("%s : %s", result.Password, result.InstanceARN), nil
+		})
+
+	results := make([]*userProvisionResult, 0, len(usernames))
+	for _, username := range usernames {
+		result, ok := byUser[username]
+		if !ok {
+			// Not started before the context was cancelled
+			result = &userProvisionResult{Username: username, Err: ctx.Err()}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// ensureUsersGroup ensures the LightsailReadOnly policy exists and that the
+// Lightsail-Users group all users join has it attached.
+func ensureUsersGroup(ctx context.Context, iamService *aws.IAMService) error {
 	lightsailPolicyDoc := `{
 		"Version": "2012-10-17",
 		"Statement": [
@@ -196,76 +304,150 @@ func createUsers(ctx context.Context, project, blueprint, bundle, region string,
 		return fmt.Errorf("failed to create or get LightsailReadOnly policy: %w", err)
 	}
 
-	// Step 2: Ensure Lightsail-Users group exists
 	changePasswordPolicyARN := "arn:aws:iam::aws:policy/IAMUserChangePassword"
 	_, err = iamService.CreateGroup(ctx, "Lightsail-Users", "Group for Lightsail for Research users", []string{policyARN, changePasswordPolicyARN})
 	if err != nil {
 		return fmt.Errorf("failed to create or get Lightsail-Users group: %w", err)
 	}
 
-	// Step 3: Create users and instances
-	availabilityZone := region + "a"
+	return nil
+}
 
-	fmt.Printf("\nCreating %d users and instances...\n", len(usernames))
+// provisionUser creates a user's IAM user, login profile, group membership,
+// key pair, instance and instance policy. A compensating action is recorded for each
+// resource created, and they are run in reverse if a later step fails.
+// Resources an earlier, interrupted attempt already created for the project are
+// adopted rather than created again, so provisioning can be retried. An
+// existing instance is adopted with the key pair it already has.
+func provisionUser(ctx context.Context, iamService *aws.IAMService, lightsailService *aws.LightsailService, project, blueprint, bundle, availabilityZone, username, instanceName string, idle aws.IdleSettings) *userProvisionResult {
+	result := &userProvisionResult{Username: username}
+	rollback := &utils.Rollback{}
+
+	// Clean up even if the run is interrupted
+	cleanupCtx := context.WithoutCancel(ctx)
+
+	fail := func(err error) *userProvisionResult {
+		result.Err = err
+		if rollback.Len() > 0 {
+			result.RolledBack = true
+			result.RollbackErrors = rollback.Run()
+		}
+		return result
+	}
 
-	for i, username := range usernames {
-		fmt.Printf("\n[%d/%d] Creating user: %s\n", i+1, len(usernames), username)
+	// Generate secure password
+	password, err := utils.GeneratePassword()
+	if err != nil {
+		return fail(fmt.Errorf("failed to generate password for %s: %w", username, err))
+	}
 
-		// Generate secure password
-		password, err := utils.GeneratePassword()
+	// Create IAM user with login profile. DeleteUser also removes the group
+	// membership and inline policy added below.
+	existing, err := iamService.GetUser(ctx, username)
+	switch {
+	case err == nil:
+		if existing.Project != project {
+			return fail(fmt.Errorf("IAM user %s already exists in project %q", username, existing.Project))
+		}
+		// The password of an adopted user was never reported, so reset it
+		created, err := iamService.EnsureLoginProfile(ctx, username, password)
 		if err != nil {
-			fmt.Printf("❌ Error generating password for %s: %v\n", username, err)
-			continue
+			return fail(err)
 		}
-
-		// Create IAM user
+		if created {
+			rollback.Add("delete login profile for "+username, func() error {
+				return iamService.DeleteLoginProfile(cleanupCtx, username)
+			})
+		}
+	case aws.IsNoSuchEntity(err):
 		_, err = iamService.CreateUser(ctx, username, password, project)
 		if err != nil {
-			fmt.Printf("❌ Error creating user %s: %v\n", username, err)
-			continue
+			return fail(err)
 		}
+		rollback.Add("delete IAM user "+username, func() error {
+			return iamService.DeleteUser(cleanupCtx, username)
+		})
+		rollback.Add("delete login profile for "+username, func() error {
+			return iamService.DeleteLoginProfile(cleanupCtx, username)
+		})
+	default:
+		return fail(err)
+	}
 
-		// Add user to Lightsail-Users group
-		err = iamService.AddUserToGroup(ctx, username, "Lightsail-Users")
-		if err != nil {
-			fmt.Printf("❌ Error adding user %s to group: %v\n", username, err)
-			continue
-		}
+	// Add user to Lightsail-Users group
+	err = iamService.AddUserToGroup(ctx, username, "Lightsail-Users")
+	if err != nil {
+		return fail(err)
+	}
 
-		// Create Lightsail instance
-		instanceName := username + "-" + blueprint
-		instance, err := lightsailService.CreateInstance(ctx, instanceName, blueprint, bundle, availabilityZone, project)
+	// Create Lightsail instance
+	instance, err := lightsailService.GetInstance(ctx, instanceName)
+	switch {
+	case err == nil:
+		if instance.Tags["Project"] != project {
+			return fail(fmt.Errorf("instance %s already exists in project %q", instanceName, instance.Tags["Project"]))
+		}
+	case aws.IsNotFound(err):
+		// Create the user's own key pair, so the instance doesn't accept the
+		// region's default key shared by every instance
+		keyPair, undoKeyPair, err := ensureUserKeyPair(ctx, lightsailService, project, username)
 		if err != nil {
-			fmt.Printf("❌ Error creating instance for %s: %v\n", username, err)
-			continue
+			return fail(err)
 		}
+		rollback.Add("delete key pair "+keyPair, func() error {
+			return undoKeyPair(cleanupCtx)
+		})
 
-		// Create user-specific policy for their instance
-		userPolicyDoc := fmt.Sprintf(`{
-			"Version": "2012-10-17",
-			"Statement": [
-				{
-					"Effect": "Allow",
-					"Action": [
-						"lightsail:*"
-					],
-					"Resource": "%s"
-				}
-			]
-		}`, instance.ARN)
-
-		policyName := fmt.Sprintf("LightsailLimitedAccess-%s", username)
-		err = iamService.PutUserPolicy(ctx, username, policyName, userPolicyDoc)
+		instance, err = lightsailService.CreateInstanceWithIdle(ctx, instanceName, blueprint, bundle, availabilityZone, project, keyPair, idle)
 		if err != nil {
-			fmt.Printf("❌ Error creating user policy for %s: %v\n", username, err)
-			continue
+			return fail(err)
 		}
+		rollback.Add("delete instance "+instanceName, func() error {
+			return lightsailService.DeleteInstance(cleanupCtx, instanceName)
+		})
+	default:
+		return fail(err)
+	}
 
-		fmt.Printf("✅ %s : %s : %s\n", username, password, instance.ARN)
+	// Grant the user access to their instance, keeping access an adopted user
+	// already has
+	err = iamService.UpdateUserInstanceAccess(ctx, username, []string{instance.ARN}, nil)
+	if err != nil {
+		return fail(err)
 	}
 
-	fmt.Printf("\n🎉 User creation completed!\n")
-	return nil
+	result.Password = password
+	result.InstanceARN = instance.ARN
+	return result
+}
+
+// printProvisionSummary prints which users succeeded, failed or were rolled back.
+func printProvisionSummary(results []*userProvisionResult) {
+	counts := make(map[string]int)
+
+	fmt.Printf("\n%-20s %-16s %s\n", "USER", "STATUS", "DETAILS")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, result := range results {
+		status := result.Status()
+		counts[status]++
+
+		details := result.InstanceARN
+		if result.Err != nil {
+			details = result.Err.Error()
+		}
+		fmt.Printf("%-20s %-16s %s\n", result.Username, status, details)
+		for _, rollbackErr := range result.RollbackErrors {
+			fmt.Printf("%-20s %-16s ⚠️  %v\n", "", "", rollbackErr)
+		}
+	}
+
+	fmt.Printf("\n✅ Succeeded: %d", counts["succeeded"])
+	fmt.Printf("  ❌ Failed: %d", counts["failed"])
+	fmt.Printf("  ↩️  Rolled back: %d", counts["rolled back"])
+	if n := counts["rollback failed"]; n > 0 {
+		fmt.Printf("  ⚠️  Rollback failed: %d (clean up manually)", n)
+	}
+	fmt.Println()
 }
 
 // removeUsers removes IAM users and their Lightsail instances.
@@ -288,22 +470,20 @@ func removeUsers(ctx context.Context, project string, usernames []string, all bo
 	iamService := aws.NewIAMService(awsClient)
 	lightsailService := aws.NewLightsailService(awsClient)
 
+	iamUsernames, err := iamService.ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Get list of users to remove
 	var usersToRemove []string
 	if all {
-		// Get all instances for the project and extract usernames
+		// Get all instances for the project and find their owners
 		instances, err := lightsailService.ListInstances(ctx, project)
 		if err != nil {
 			return fmt.Errorf("failed to list instances for project %s: %w", project, err)
 		}
-
-		for _, instance := range instances {
-			// Extract username from instance name (format: username-blueprint)
-			parts := strings.Split(instance.Name, "-")
-			if len(parts) > 0 {
-				usersToRemove = append(usersToRemove, parts[0])
-			}
-		}
+		usersToRemove = instanceOwners(instances, iamUsernames)
 	} else {
 		usersToRemove = usernames
 	}
@@ -326,21 +506,8 @@ func removeUsers(ctx context.Context, project string, usernames []string, all bo
 			continue
 		}
 
-		// Delete instances belonging to this user
-		for _, instance := range instances {
-			if strings.HasPrefix(instance.Name, username+"-") {
-				fmt.Printf("  Deleting instance: %s\n", instance.Name)
-				err = lightsailService.DeleteInstance(ctx, instance.Name)
-				if err != nil {
-					fmt.Printf("❌ Error deleting instance %s: %v\n", instance.Name, err)
-				}
-			}
-		}
-
-		// Delete IAM user (this handles group removal, policies, login profile)
-		err = iamService.DeleteUser(ctx, username)
-		if err != nil {
-			fmt.Printf("❌ Error deleting user %s: %v\n", username, err)
+		if err := removeUser(ctx, iamService, lightsailService, username, instances, iamUsernames); err != nil {
+			fmt.Printf("❌ %v\n", err)
 			continue
 		}
 
@@ -351,8 +518,56 @@ func removeUsers(ctx context.Context, project string, usernames []string, all bo
 	return nil
 }
 
+// removeUser deletes the user's instances from the given list, then the IAM user
+// itself. The IAM user is kept if an instance can't be deleted so it can be retried.
+// usernames are the IAM users instances can belong to, so that removing bob
+// leaves bob-smith's instances alone.
+func removeUser(ctx context.Context, iamService *aws.IAMService, lightsailService *aws.LightsailService, username string, instances []*types.Instance, usernames []string) error {
+	// Delete instances belonging to this user
+	for _, instance := range userInstances(instances, username, usernames) {
+		if err := lightsailService.DeleteInstance(ctx, instance.Name); err != nil {
+			return fmt.Errorf("failed to delete instance %s: %w", instance.Name, err)
+		}
+	}
+
+	// Delete the user's key pair; the private key is kept in case it is
+	// still needed to reach a restored instance
+	if err := lightsailService.DeleteKeyPair(ctx, aws.UserKeyPairName(username)); err != nil && !aws.IsNotFound(err) {
+		return err
+	}
+
+	// Delete IAM user (this handles group removal, policies, login profile)
+	return iamService.DeleteUser(ctx, username)
+}
+
+// instanceOwners returns the IAM users in usernames that own instances, in
+// order and without duplicates. Instances no user owns are reported and left
+// out rather than guessed from their names.
+func instanceOwners(instances []*types.Instance, usernames []string) []string {
+	var owners []string
+	seen := make(map[string]bool)
+	for _, instance := range instances {
+		owner := utils.InstanceOwner(instance.Name, usernames)
+		if owner == "" {
+			fmt.Printf("⚠️ No IAM user owns instance %s, skipping it\n", instance.Name)
+			continue
+		}
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+// userInstance is a user and their instance in structured users list output.
+type userInstance struct {
+	Username string          `json:"username" yaml:"username"`
+	Instance *types.Instance `json:"instance" yaml:"instance"`
+}
+
 // listUsers lists IAM users and their instances.
-func listUsers(ctx context.Context, project string) error {
+func listUsers(ctx context.Context, project string, out *output.Renderer) error {
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
@@ -375,6 +590,27 @@ func listUsers(ctx context.Context, project string) error {
 	if err != nil {
 		return fmt.Errorf("failed to list instances: %w", err)
 	}
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Instances no IAM user owns are listed without a username
+	if out.Structured() {
+		users := make([]userInstance, len(instances))
+		for i, instance := range instances {
+			users[i] = userInstance{Username: utils.InstanceOwner(instance.Name, usernames), Instance: instance}
+		}
+
+		return out.Render(users, func() *output.Table {
+			table := output.NewTable("username", "instance", "state", "blueprint", "bundle", "public_ip")
+			for _, user := range users {
+				table.AddRow(user.Username, user.Instance.Name, user.Instance.State,
+					user.Instance.Blueprint, user.Instance.Bundle, user.Instance.PublicIP)
+			}
+			return table
+		})
+	}
 
 	if len(instances) == 0 {
 		if project != "" {
@@ -397,11 +633,9 @@ func listUsers(ctx context.Context, project string) error {
 	fmt.Println(strings.Repeat("-", 120))
 
 	for _, instance := range instances {
-		// Extract username from instance name
-		username := "unknown"
-		parts := strings.Split(instance.Name, "-")
-		if len(parts) > 0 {
-			username = parts[0]
+		username := utils.InstanceOwner(instance.Name, usernames)
+		if username == "" {
+			username = "-"
 		}
 
 		publicIP := instance.PublicIP
@@ -424,7 +658,7 @@ func listUsers(ctx context.Context, project string) error {
 }
 
 // createBulkUsers creates multiple users from a CSV file.
-func createBulkUsers(ctx context.Context, csvFile string, dryRun, continueOnError, startStopped bool) error {
+func createBulkUsers(ctx context.Context, csvFile string, dryRun, continueOnError, startStopped bool, parallel int) error {
 	// Parse CSV file
 	users, err := utils.ParseUsersCSV(csvFile)
 	if err != nil {
@@ -456,6 +690,34 @@ func createBulkUsers(ctx context.Context, csvFile string, dryRun, continueOnErro
 		return nil
 	}
 
+	return provisionBulkUsers(ctx, csvFile, users, continueOnError, startStopped, parallel)
+}
+
+// provisionBulkUsers creates the users parsed from a CSV file, recording the
+// rows in the operation journal so that resuming creates the same users.
+func provisionBulkUsers(ctx context.Context, csvFile string, users []utils.BulkUser, continueOnError, startStopped bool, parallel int) error {
+	usernames := make([]string, len(users))
+	for i, user := range users {
+		usernames[i] = user.Username
+	}
+
+	op := beginOperation(ctx, "users create-bulk", map[string]string{
+		"csv":               csvFile,
+		"continue-on-error": strconv.FormatBool(continueOnError),
+		"start-stopped":     strconv.FormatBool(startStopped),
+		"parallel":          strconv.Itoa(parallel),
+	}, usernames)
+	defer finishOperation(ctx, op)
+	if err := op.SetInput(users); err != nil {
+		fmt.Printf("⚠️  Warning: %v\n", err)
+	}
+
+	// Skip users that a previous run of this operation already created
+	remaining := make(map[string]bool)
+	for _, username := range op.Remaining(usernames) {
+		remaining[username] = true
+	}
+
 	// Group users by project and configuration for efficient creation
 	type ProjectConfig struct {
 		Project   string
@@ -467,6 +729,10 @@ func createBulkUsers(ctx context.Context, csvFile string, dryRun, continueOnErro
 
 	projectGroups := make(map[string]*ProjectConfig)
 	for _, user := range users {
+		if !remaining[user.Username] {
+			continue
+		}
+
 		key := fmt.Sprintf("%s-%s-%s", user.Project, user.Blueprint, user.Bundle)
 		if _, exists := projectGroups[key]; !exists {
 			projectGroups[key] = &ProjectConfig{
@@ -480,10 +746,14 @@ func createBulkUsers(ctx context.Context, csvFile string, dryRun, continueOnErro
 		projectGroups[key].Users = append(projectGroups[key].Users, user.Username)
 	}
 
+	if len(projectGroups) == 0 {
+		fmt.Println("All users were already created.")
+		return nil
+	}
+
 	fmt.Printf("Creating users in %d batch(es):\n\n", len(projectGroups))
 
-	successCount := 0
-	failCount := 0
+	var results []*userProvisionResult
 	batchNum := 1
 
 	for _, config := range projectGroups {
@@ -491,44 +761,81 @@ func createBulkUsers(ctx context.Context, csvFile string, dryRun, continueOnErro
 			batchNum, config.Project, config.Blueprint, config.Bundle, len(config.Users))
 		batchNum++
 
-		err := createUsers(ctx, config.Project, config.Blueprint, config.Bundle, config.Region, config.Users)
+		batchResults, err := provisionUsers(ctx, config.Project, config.Blueprint, config.Bundle, config.Region, config.Users, parallel, op)
 		if err != nil {
-			fmt.Printf("❌ Batch failed: %v\n", err)
-			failCount += len(config.Users)
-			if !continueOnError {
-				return fmt.Errorf("bulk creation failed, use --continue-on-error to proceed despite failures")
+			return fmt.Errorf("bulk creation failed: %w", err)
+		}
+		results = append(results, batchResults...)
+
+		var created, failed []string
+		for _, result := range batchResults {
+			if result.Err != nil {
+				failed = append(failed, result.Username)
+			} else {
+				created = append(created, result.Username)
 			}
-		} else {
-			successCount += len(config.Users)
-
-			// Stop instances immediately if requested
-			if startStopped {
-				fmt.Printf("🛑 Stopping instances to save costs...\n")
-				stopErr := stopInstances(ctx, config.Users, config.Project, false)
-				if stopErr != nil {
-					fmt.Printf("⚠️  Warning: Failed to stop some instances: %v\n", stopErr)
-				} else {
-					fmt.Printf("✅ Instances stopped for cost savings\n")
-				}
+		}
+
+		// Stop instances immediately if requested
+		if startStopped && len(created) > 0 {
+			fmt.Printf("🛑 Stopping instances to save costs...\n")
+			stopErr := stopInstances(withoutOperation(ctx), created, config.Project, false, parallel)
+			if stopErr != nil {
+				fmt.Printf("⚠️  Warning: Failed to stop some instances: %v\n", stopErr)
+			} else {
+				fmt.Printf("✅ Instances stopped for cost savings\n")
 			}
 		}
 		fmt.Println()
-	}
 
-	fmt.Printf("🎉 Bulk user creation completed!\n")
-	fmt.Printf("✅ Success: %d users\n", successCount)
-	if failCount > 0 {
-		fmt.Printf("❌ Failed: %d users\n", failCount)
+		if len(failed) > 0 && !continueOnError {
+			printProvisionSummary(results)
+			return fmt.Errorf("failed to create users %s, use --continue-on-error to proceed despite failures", strings.Join(failed, ", "))
+		}
 	}
 
+	printProvisionSummary(results)
+	fmt.Printf("\n🎉 Bulk user creation completed!\n")
+
 	return nil
 }
 
 // removeBulkUsers removes multiple users with progress tracking.
-func removeBulkUsers(ctx context.Context, users []string, project, csvFile string, confirm bool) error {
-	var usersToRemove []string
+func removeBulkUsers(ctx context.Context, users []string, project, csvFile string, confirm bool, parallel int) error {
+	if csvFile == "" && project == "" && len(users) == 0 {
+		return fmt.Errorf("must specify --users, --project, or --csv")
+	}
+
+	// Load configuration
+	_, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Create AWS client
+	awsClient, err := aws.NewClient(ctx, aws.Options{
+		Region:  viper.GetString("aws.region"),
+		Profile: viper.GetString("aws.profile"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create AWS client: %w", err)
+	}
+
+	iamService := aws.NewIAMService(awsClient)
+	lightsailService := aws.NewLightsailService(awsClient)
+
+	// Only the project's instances are removed when one is given
+	instances, err := lightsailService.ListInstances(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+	iamUsernames, err := iamService.ListUsernames(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Determine users to remove
+	var usersToRemove []string
 	if csvFile != "" {
 		bulkUsers, err := utils.ParseUsersCSV(csvFile)
 		if err != nil {
@@ -539,11 +846,9 @@ func removeBulkUsers(ctx context.Context, users []string, project, csvFile strin
 		}
 	} else if project != "" {
 		// Get all users from project (via instances)
-		return removeUsers(ctx, project, []string{}, true)
-	} else if len(users) > 0 {
-		usersToRemove = users
+		usersToRemove = instanceOwners(instances, iamUsernames)
 	} else {
-		return fmt.Errorf("must specify --users, --project, or --csv")
+		usersToRemove = users
 	}
 
 	if len(usersToRemove) == 0 {
@@ -564,30 +869,26 @@ func removeBulkUsers(ctx context.Context, users []string, project, csvFile strin
 		return nil
 	}
 
-	fmt.Printf("Removing %d users...\n\n", len(usersToRemove))
+	op := beginOperation(ctx, "users remove-bulk", map[string]string{
+		"users":    strings.Join(users, ","),
+		"project":  project,
+		"csv":      csvFile,
+		"parallel": strconv.Itoa(parallel),
+	}, usersToRemove)
+	usersToRemove = op.Remaining(usersToRemove)
 
-	successCount := 0
-	failCount := 0
-
-	for i, username := range usersToRemove {
-		fmt.Printf("[%d/%d] Removing user: %s\n", i+1, len(usersToRemove), username)
+	fmt.Printf("Removing %d users...\n\n", len(usersToRemove))
 
-		err := removeUsers(ctx, "", []string{username}, false)
-		if err != nil {
-			fmt.Printf("❌ Failed to remove %s: %v\n", username, err)
-			failCount++
-		} else {
-			successCount++
-		}
-	}
+	results := utils.RunBulk(ctx, usersToRemove, utils.BulkOptions{Parallel: parallel, Action: "Removing users", Journal: op},
+		func(ctx context.Context, username string) (string, error) {
+			return "", removeUser(ctx, iamService, lightsailService, username, instances, iamUsernames)
+		})
 
 	fmt.Printf("\n🎉 Bulk user removal completed!\n")
-	fmt.Printf("✅ Success: %d users\n", successCount)
-	if failCount > 0 {
-		fmt.Printf("❌ Failed: %d users\n", failCount)
-	}
+	utils.PrintBulkSummary(results)
+	finishOperation(ctx, op)
 
-	return nil
+	return utils.BulkError(results, "users", "remove")
 }
 
 // generateUserTemplate generates a CSV template for bulk user creation.
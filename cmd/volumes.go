@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
 	"github.com/scttfrdmn/lfr-tools/internal/config"
+	"github.com/scttfrdmn/lfr-tools/internal/output"
 	"github.com/scttfrdmn/lfr-tools/internal/utils"
 )
 
@@ -43,7 +45,12 @@ var volumesListCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		project, _ := cmd.Flags().GetString("project")
 
-		return listVolumes(cmd.Context(), project)
+		out, err := newRenderer(cmd)
+		if err != nil {
+			return err
+		}
+
+		return listVolumes(cmd.Context(), project, out)
 	},
 }
 
@@ -107,6 +114,7 @@ func init() {
 
 	// List command flags
 	volumesListCmd.Flags().StringP("project", "p", "", "Filter by project name")
+	addOutputFlags(volumesListCmd)
 
 	// Attach command flags
 	volumesAttachCmd.Flags().BoolP("wait", "w", false, "Wait for volume to attach")
@@ -185,7 +193,7 @@ func createVolume(ctx context.Context, name, sizeStr, zone, project string, wait
 }
 
 // listVolumes lists all block storage volumes.
-func listVolumes(ctx context.Context, project string) error {
+func listVolumes(ctx context.Context, project string, out *output.Renderer) error {
 	// Load configuration
 	_, err := config.Load()
 	if err != nil {
@@ -209,6 +217,17 @@ func listVolumes(ctx context.Context, project string) error {
 		return fmt.Errorf("failed to list volumes: %w", err)
 	}
 
+	if out.Structured() {
+		return out.Render(disks, func() *output.Table {
+			table := output.NewTable("name", "state", "size_gb", "iops", "attached_to", "path", "availability_zone", "project", "created_at")
+			for _, disk := range disks {
+				table.AddRow(disk.Name, disk.State, disk.SizeGB, disk.IOPS, disk.AttachedTo, disk.Path,
+					disk.AvailabilityZone, disk.Tags["Project"], disk.CreatedAt.Format(time.RFC3339))
+			}
+			return table
+		})
+	}
+
 	if len(disks) == 0 {
 		if project != "" {
 			fmt.Printf("No volumes found for project: %s\n", project)
@@ -0,0 +1,204 @@
+// Package audit cross-checks a project's IAM users, group memberships,
+// instance policies, instances and disks against how lfr provisions them and
+// reports orphans and mismatches.
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+// UsersGroup is the IAM group every lfr user belongs to.
+const UsersGroup = "Lightsail-Users"
+
+// Finding kinds.
+const (
+	KindUserWithoutInstance = "user-without-instance"
+	KindMissingGroup        = "missing-group"
+	KindMissingPolicy       = "missing-policy"
+	KindPolicyMismatch      = "policy-mismatch"
+	KindUntaggedInstance    = "untagged-instance"
+	KindProjectMismatch     = "project-mismatch"
+	KindOrphanInstance      = "orphan-instance"
+	KindUntaggedDisk        = "untagged-disk"
+	KindOrphanDisk          = "orphan-disk"
+	KindDiskMismatch        = "disk-mismatch"
+)
+
+// User is an IAM user tagged with the project.
+type User struct {
+	Name   string
+	Groups []string
+	// HasPolicy reports whether the user has a LightsailLimitedAccess policy,
+	// and PolicyARNs are the instance ARNs it grants access to.
+	HasPolicy  bool
+	PolicyARNs []string
+}
+
+// State is the live state an audit checks.
+type State struct {
+	Project string
+	// Users are the IAM users tagged with the project.
+	Users []User
+	// Instances and Disks are all instances and disks in the region, so that
+	// resources missing their Project tag are found too.
+	Instances []*types.Instance
+	Disks     []*types.Disk
+}
+
+// Finding is a problem found by an audit.
+type Finding struct {
+	Kind     string `json:"kind" yaml:"kind"`
+	Resource string `json:"resource" yaml:"resource"`
+	Detail   string `json:"detail" yaml:"detail"`
+	// Fixable reports whether lfr project audit --fix can repair it.
+	Fixable bool `json:"fixable" yaml:"fixable"`
+
+	// User is the user a group or policy finding applies to, and AddARNs
+	// and RemoveARNs are the policy changes that fix it.
+	User       string   `json:"-" yaml:"-"`
+	AddARNs    []string `json:"-" yaml:"-"`
+	RemoveARNs []string `json:"-" yaml:"-"`
+}
+
+// Fixable returns the findings that can be repaired automatically.
+func Fixable(findings []Finding) []Finding {
+	var fixable []Finding
+	for _, finding := range findings {
+		if finding.Fixable {
+			fixable = append(fixable, finding)
+		}
+	}
+	return fixable
+}
+
+// Check audits a project. Instances belong to the user whose name prefixes
+// theirs (username-blueprint), and the longest matching username wins.
+func Check(state *State) []Finding {
+	var findings []Finding
+	add := func(finding Finding) {
+		findings = append(findings, finding)
+	}
+
+	users := append([]User(nil), state.Users...)
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+
+	instances := append([]*types.Instance(nil), state.Instances...)
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+
+	disks := append([]*types.Disk(nil), state.Disks...)
+	sort.Slice(disks, func(i, j int) bool { return disks[i].Name < disks[j].Name })
+
+	existingARNs := make(map[string]bool)
+	for _, instance := range instances {
+		existingARNs[instance.ARN] = true
+	}
+	usernames := make([]string, len(users))
+	for i, user := range users {
+		usernames[i] = user.Name
+	}
+
+	owned := make(map[string][]*types.Instance)
+	projectInstances := make(map[string]bool)
+	for _, instance := range instances {
+		owner := utils.InstanceOwner(instance.Name, usernames)
+		tag := instance.Tags["Project"]
+
+		switch {
+		case owner != "" && tag == "":
+			add(Finding{Kind: KindUntaggedInstance, Resource: instance.Name, Fixable: true,
+				Detail: fmt.Sprintf("owned by %s but has no Project tag", owner)})
+		case owner != "" && tag != state.Project:
+			add(Finding{Kind: KindProjectMismatch, Resource: instance.Name,
+				Detail: fmt.Sprintf("tagged Project=%s but its owner %s is in project %s", tag, owner, state.Project)})
+			continue
+		case owner == "" && tag == state.Project:
+			add(Finding{Kind: KindOrphanInstance, Resource: instance.Name,
+				Detail: "no IAM user tagged with the project owns it"})
+		}
+
+		if owner != "" {
+			owned[owner] = append(owned[owner], instance)
+		}
+		if owner != "" || tag == state.Project {
+			projectInstances[instance.Name] = true
+		}
+	}
+
+	for _, user := range users {
+		if !contains(user.Groups, UsersGroup) {
+			add(Finding{Kind: KindMissingGroup, Resource: user.Name, User: user.Name, Fixable: true,
+				Detail: "not a member of " + UsersGroup})
+		}
+
+		var expected []string
+		for _, instance := range owned[user.Name] {
+			expected = append(expected, instance.ARN)
+		}
+		if len(expected) == 0 {
+			add(Finding{Kind: KindUserWithoutInstance, Resource: user.Name,
+				Detail: "has no instance; remove the user with lfr users remove or create an instance"})
+		}
+
+		if !user.HasPolicy {
+			if len(expected) > 0 {
+				add(Finding{Kind: KindMissingPolicy, Resource: user.Name, User: user.Name, Fixable: true,
+					AddARNs: expected, Detail: "has no LightsailLimitedAccess policy"})
+			}
+			continue
+		}
+
+		var missing, stale []string
+		for _, arn := range expected {
+			if !contains(user.PolicyARNs, arn) {
+				missing = append(missing, arn)
+			}
+		}
+		for _, arn := range user.PolicyARNs {
+			if !existingARNs[arn] {
+				stale = append(stale, arn)
+			}
+		}
+		if len(missing) > 0 || len(stale) > 0 {
+			var details []string
+			if len(missing) > 0 {
+				details = append(details, fmt.Sprintf("missing %d of the user's instances", len(missing)))
+			}
+			if len(stale) > 0 {
+				details = append(details, fmt.Sprintf("grants access to %d deleted instances", len(stale)))
+			}
+			add(Finding{Kind: KindPolicyMismatch, Resource: user.Name, User: user.Name, Fixable: true,
+				AddARNs: missing, RemoveARNs: stale, Detail: "LightsailLimitedAccess policy is " + strings.Join(details, " and ")})
+		}
+	}
+
+	for _, disk := range disks {
+		tag := disk.Tags["Project"]
+		switch {
+		case tag == state.Project && disk.AttachedTo == "":
+			add(Finding{Kind: KindOrphanDisk, Resource: disk.Name,
+				Detail: fmt.Sprintf("%d GB, not attached to any instance", disk.SizeGB)})
+		case tag == state.Project && !projectInstances[disk.AttachedTo]:
+			add(Finding{Kind: KindDiskMismatch, Resource: disk.Name,
+				Detail: fmt.Sprintf("attached to %s, which is not in the project", disk.AttachedTo)})
+		case tag == "" && projectInstances[disk.AttachedTo]:
+			add(Finding{Kind: KindUntaggedDisk, Resource: disk.Name, Fixable: true,
+				Detail: fmt.Sprintf("attached to %s but has no Project tag", disk.AttachedTo)})
+		}
+	}
+
+	return findings
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
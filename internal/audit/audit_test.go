@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+func instance(name, project string) *types.Instance {
+	tags := map[string]string{}
+	if project != "" {
+		tags["Project"] = project
+	}
+	return &types.Instance{Name: name, ARN: "arn:instance/" + name, Tags: tags}
+}
+
+func disk(name, project, attachedTo string) *types.Disk {
+	tags := map[string]string{}
+	if project != "" {
+		tags["Project"] = project
+	}
+	return &types.Disk{Name: name, SizeGB: 8, AttachedTo: attachedTo, Tags: tags}
+}
+
+func findingStrings(findings []Finding) []string {
+	var result []string
+	for _, finding := range findings {
+		result = append(result, finding.Kind+" "+finding.Resource)
+	}
+	return result
+}
+
+func TestCheckCleanProject(t *testing.T) {
+	state := &State{
+		Project: "cs101",
+		Users: []User{
+			{Name: "alice", Groups: []string{UsersGroup}, HasPolicy: true, PolicyARNs: []string{"arn:instance/alice-ubuntu_22_04"}},
+		},
+		Instances: []*types.Instance{instance("alice-ubuntu_22_04", "cs101"), instance("zed-ubuntu_22_04", "bio200")},
+		Disks:     []*types.Disk{disk("alice-data", "cs101", "alice-ubuntu_22_04"), disk("zed-data", "", "zed-ubuntu_22_04")},
+	}
+
+	if findings := Check(state); len(findings) != 0 {
+		t.Errorf("expected no findings, got %v", findingStrings(findings))
+	}
+}
+
+func TestCheckReportsDrift(t *testing.T) {
+	state := &State{
+		Project: "cs101",
+		Users: []User{
+			// Not in the users group, policy grants access to a deleted instance
+			{Name: "alice", HasPolicy: true, PolicyARNs: []string{"arn:instance/alice-ubuntu_22_04", "arn:instance/alice-old"}},
+			// Policy deleted, instance untagged
+			{Name: "bob", Groups: []string{UsersGroup}},
+			// No instance at all
+			{Name: "carol", Groups: []string{UsersGroup}},
+			// Prefix of another user's name
+			{Name: "al", Groups: []string{UsersGroup}, HasPolicy: true, PolicyARNs: []string{"arn:instance/al-ubuntu_22_04"}},
+		},
+		Instances: []*types.Instance{
+			instance("al-ubuntu_22_04", "cs101"),
+			instance("alice-ubuntu_22_04", "cs101"),
+			instance("bob-ubuntu_22_04", ""),
+			instance("dave-ubuntu_22_04", "cs101"),
+		},
+		Disks: []*types.Disk{
+			disk("bob-data", "", "bob-ubuntu_22_04"),
+			disk("spare", "cs101", ""),
+			disk("stray", "cs101", "other-instance"),
+		},
+	}
+
+	findings := Check(state)
+
+	expected := []string{
+		"untagged-instance bob-ubuntu_22_04",
+		"orphan-instance dave-ubuntu_22_04",
+		"missing-group alice",
+		"policy-mismatch alice",
+		"missing-policy bob",
+		"user-without-instance carol",
+		"untagged-disk bob-data",
+		"orphan-disk spare",
+		"disk-mismatch stray",
+	}
+	if got := findingStrings(findings); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected findings:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	for _, finding := range findings {
+		switch finding.Kind {
+		case KindPolicyMismatch:
+			if len(finding.AddARNs) != 0 || strings.Join(finding.RemoveARNs, ",") != "arn:instance/alice-old" {
+				t.Errorf("expected alice's fix to remove only the deleted instance, got +%v -%v", finding.AddARNs, finding.RemoveARNs)
+			}
+		case KindMissingPolicy:
+			if strings.Join(finding.AddARNs, ",") != "arn:instance/bob-ubuntu_22_04" {
+				t.Errorf("expected bob's fix to grant his instance, got %v", finding.AddARNs)
+			}
+		}
+	}
+
+	if got := len(Fixable(findings)); got != 5 {
+		t.Errorf("expected 5 fixable findings, got %d", got)
+	}
+}
+
+func TestCheckReportsInstanceInOtherProject(t *testing.T) {
+	state := &State{
+		Project:   "cs101",
+		Users:     []User{{Name: "alice", Groups: []string{UsersGroup}}},
+		Instances: []*types.Instance{instance("alice-ubuntu_22_04", "bio200")},
+	}
+
+	got := findingStrings(Check(state))
+	if strings.Join(got, ",") != "project-mismatch alice-ubuntu_22_04,user-without-instance alice" {
+		t.Errorf("unexpected findings: %v", got)
+	}
+}
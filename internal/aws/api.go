@@ -0,0 +1,111 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// LightsailAPI is the subset of the Lightsail client used by lfr-tools.
+type LightsailAPI interface {
+	GetBlueprints(ctx context.Context, params *lightsail.GetBlueprintsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetBlueprintsOutput, error)
+	GetBundles(ctx context.Context, params *lightsail.GetBundlesInput, optFns ...func(*lightsail.Options)) (*lightsail.GetBundlesOutput, error)
+	GetRegions(ctx context.Context, params *lightsail.GetRegionsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetRegionsOutput, error)
+	CreateInstances(ctx context.Context, params *lightsail.CreateInstancesInput, optFns ...func(*lightsail.Options)) (*lightsail.CreateInstancesOutput, error)
+	GetInstance(ctx context.Context, params *lightsail.GetInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstanceOutput, error)
+	GetInstances(ctx context.Context, params *lightsail.GetInstancesInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstancesOutput, error)
+	DeleteInstance(ctx context.Context, params *lightsail.DeleteInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.DeleteInstanceOutput, error)
+	StartInstance(ctx context.Context, params *lightsail.StartInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.StartInstanceOutput, error)
+	StopInstance(ctx context.Context, params *lightsail.StopInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.StopInstanceOutput, error)
+	EnableAddOn(ctx context.Context, params *lightsail.EnableAddOnInput, optFns ...func(*lightsail.Options)) (*lightsail.EnableAddOnOutput, error)
+	GetInstanceMetricData(ctx context.Context, params *lightsail.GetInstanceMetricDataInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstanceMetricDataOutput, error)
+	GetKeyPair(ctx context.Context, params *lightsail.GetKeyPairInput, optFns ...func(*lightsail.Options)) (*lightsail.GetKeyPairOutput, error)
+	GetKeyPairs(ctx context.Context, params *lightsail.GetKeyPairsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetKeyPairsOutput, error)
+	CreateKeyPair(ctx context.Context, params *lightsail.CreateKeyPairInput, optFns ...func(*lightsail.Options)) (*lightsail.CreateKeyPairOutput, error)
+	DeleteKeyPair(ctx context.Context, params *lightsail.DeleteKeyPairInput, optFns ...func(*lightsail.Options)) (*lightsail.DeleteKeyPairOutput, error)
+	ImportKeyPair(ctx context.Context, params *lightsail.ImportKeyPairInput, optFns ...func(*lightsail.Options)) (*lightsail.ImportKeyPairOutput, error)
+	DownloadDefaultKeyPair(ctx context.Context, params *lightsail.DownloadDefaultKeyPairInput, optFns ...func(*lightsail.Options)) (*lightsail.DownloadDefaultKeyPairOutput, error)
+	GetInstanceAccessDetails(ctx context.Context, params *lightsail.GetInstanceAccessDetailsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstanceAccessDetailsOutput, error)
+	CreateDisk(ctx context.Context, params *lightsail.CreateDiskInput, optFns ...func(*lightsail.Options)) (*lightsail.CreateDiskOutput, error)
+	GetDisk(ctx context.Context, params *lightsail.GetDiskInput, optFns ...func(*lightsail.Options)) (*lightsail.GetDiskOutput, error)
+	GetDisks(ctx context.Context, params *lightsail.GetDisksInput, optFns ...func(*lightsail.Options)) (*lightsail.GetDisksOutput, error)
+	AttachDisk(ctx context.Context, params *lightsail.AttachDiskInput, optFns ...func(*lightsail.Options)) (*lightsail.AttachDiskOutput, error)
+	DetachDisk(ctx context.Context, params *lightsail.DetachDiskInput, optFns ...func(*lightsail.Options)) (*lightsail.DetachDiskOutput, error)
+	DeleteDisk(ctx context.Context, params *lightsail.DeleteDiskInput, optFns ...func(*lightsail.Options)) (*lightsail.DeleteDiskOutput, error)
+	CreateInstanceSnapshot(ctx context.Context, params *lightsail.CreateInstanceSnapshotInput, optFns ...func(*lightsail.Options)) (*lightsail.CreateInstanceSnapshotOutput, error)
+	CreateInstancesFromSnapshot(ctx context.Context, params *lightsail.CreateInstancesFromSnapshotInput, optFns ...func(*lightsail.Options)) (*lightsail.CreateInstancesFromSnapshotOutput, error)
+	DeleteInstanceSnapshot(ctx context.Context, params *lightsail.DeleteInstanceSnapshotInput, optFns ...func(*lightsail.Options)) (*lightsail.DeleteInstanceSnapshotOutput, error)
+	GetInstanceSnapshot(ctx context.Context, params *lightsail.GetInstanceSnapshotInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstanceSnapshotOutput, error)
+	GetInstanceSnapshots(ctx context.Context, params *lightsail.GetInstanceSnapshotsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstanceSnapshotsOutput, error)
+	GetStaticIps(ctx context.Context, params *lightsail.GetStaticIpsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetStaticIpsOutput, error)
+	AttachStaticIp(ctx context.Context, params *lightsail.AttachStaticIpInput, optFns ...func(*lightsail.Options)) (*lightsail.AttachStaticIpOutput, error)
+	DetachStaticIp(ctx context.Context, params *lightsail.DetachStaticIpInput, optFns ...func(*lightsail.Options)) (*lightsail.DetachStaticIpOutput, error)
+	TagResource(ctx context.Context, params *lightsail.TagResourceInput, optFns ...func(*lightsail.Options)) (*lightsail.TagResourceOutput, error)
+	PeerVpc(ctx context.Context, params *lightsail.PeerVpcInput, optFns ...func(*lightsail.Options)) (*lightsail.PeerVpcOutput, error)
+	IsVpcPeered(ctx context.Context, params *lightsail.IsVpcPeeredInput, optFns ...func(*lightsail.Options)) (*lightsail.IsVpcPeeredOutput, error)
+}
+
+// IAMAPI is the subset of the IAM client used by lfr-tools.
+type IAMAPI interface {
+	ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error)
+	CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error)
+	GetGroup(ctx context.Context, params *iam.GetGroupInput, optFns ...func(*iam.Options)) (*iam.GetGroupOutput, error)
+	CreateGroup(ctx context.Context, params *iam.CreateGroupInput, optFns ...func(*iam.Options)) (*iam.CreateGroupOutput, error)
+	AttachGroupPolicy(ctx context.Context, params *iam.AttachGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachGroupPolicyOutput, error)
+	ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error)
+	CreateUser(ctx context.Context, params *iam.CreateUserInput, optFns ...func(*iam.Options)) (*iam.CreateUserOutput, error)
+	ListUsers(ctx context.Context, params *iam.ListUsersInput, optFns ...func(*iam.Options)) (*iam.ListUsersOutput, error)
+	GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error)
+	ListUserTags(ctx context.Context, params *iam.ListUserTagsInput, optFns ...func(*iam.Options)) (*iam.ListUserTagsOutput, error)
+	CreateLoginProfile(ctx context.Context, params *iam.CreateLoginProfileInput, optFns ...func(*iam.Options)) (*iam.CreateLoginProfileOutput, error)
+	DeleteLoginProfile(ctx context.Context, params *iam.DeleteLoginProfileInput, optFns ...func(*iam.Options)) (*iam.DeleteLoginProfileOutput, error)
+	UpdateLoginProfile(ctx context.Context, params *iam.UpdateLoginProfileInput, optFns ...func(*iam.Options)) (*iam.UpdateLoginProfileOutput, error)
+	AddUserToGroup(ctx context.Context, params *iam.AddUserToGroupInput, optFns ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error)
+	RemoveUserFromGroup(ctx context.Context, params *iam.RemoveUserFromGroupInput, optFns ...func(*iam.Options)) (*iam.RemoveUserFromGroupOutput, error)
+	ListGroupsForUser(ctx context.Context, params *iam.ListGroupsForUserInput, optFns ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error)
+	PutUserPolicy(ctx context.Context, params *iam.PutUserPolicyInput, optFns ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error)
+	GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error)
+	ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error)
+	DeleteUserPolicy(ctx context.Context, params *iam.DeleteUserPolicyInput, optFns ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error)
+	DeleteUser(ctx context.Context, params *iam.DeleteUserInput, optFns ...func(*iam.Options)) (*iam.DeleteUserOutput, error)
+}
+
+// S3API is the subset of the S3 client used by lfr-tools.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+	PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error)
+}
+
+// EFSAPI is the subset of the EFS client used by lfr-tools.
+type EFSAPI interface {
+	CreateFileSystem(ctx context.Context, params *efs.CreateFileSystemInput, optFns ...func(*efs.Options)) (*efs.CreateFileSystemOutput, error)
+	CreateMountTarget(ctx context.Context, params *efs.CreateMountTargetInput, optFns ...func(*efs.Options)) (*efs.CreateMountTargetOutput, error)
+	DescribeFileSystems(ctx context.Context, params *efs.DescribeFileSystemsInput, optFns ...func(*efs.Options)) (*efs.DescribeFileSystemsOutput, error)
+	DescribeTags(ctx context.Context, params *efs.DescribeTagsInput, optFns ...func(*efs.Options)) (*efs.DescribeTagsOutput, error)
+	DescribeMountTargets(ctx context.Context, params *efs.DescribeMountTargetsInput, optFns ...func(*efs.Options)) (*efs.DescribeMountTargetsOutput, error)
+}
+
+// EC2API is the subset of the EC2 client used by lfr-tools.
+type EC2API interface {
+	DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error)
+	DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error)
+	CreateSecurityGroup(ctx context.Context, params *ec2.CreateSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error)
+	AuthorizeSecurityGroupIngress(ctx context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error)
+}
+
+// Compile-time checks that the SDK clients satisfy the API interfaces.
+var (
+	_ LightsailAPI = (*lightsail.Client)(nil)
+	_ IAMAPI       = (*iam.Client)(nil)
+	_ S3API        = (*s3.Client)(nil)
+	_ EFSAPI       = (*efs.Client)(nil)
+	_ EC2API       = (*ec2.Client)(nil)
+)
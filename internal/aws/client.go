@@ -7,14 +7,20 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 // Client wraps AWS service clients.
 type Client struct {
-	IAM       *iam.Client
-	Lightsail *lightsail.Client
+	IAM       IAMAPI
+	Lightsail LightsailAPI
+	S3        S3API
+	EFS       EFSAPI
+	EC2       EC2API
 	Config    aws.Config
 }
 
@@ -24,8 +30,28 @@ type Options struct {
 	Profile string
 }
 
+// ClientFactory builds a Client from options.
+type ClientFactory func(ctx context.Context, opts Options) (*Client, error)
+
+// clientFactory overrides NewClient when set, e.g. to return an in-memory fake.
+var clientFactory ClientFactory
+
+// SetClientFactory replaces the factory used by NewClient and returns a
+// function that restores the previous one. Pass nil to use the AWS SDK.
+func SetClientFactory(factory ClientFactory) func() {
+	previous := clientFactory
+	clientFactory = factory
+	return func() {
+		clientFactory = previous
+	}
+}
+
 // NewClient creates a new AWS client with the specified options.
 func NewClient(ctx context.Context, opts Options) (*Client, error) {
+	if clientFactory != nil {
+		return clientFactory(ctx, opts)
+	}
+
 	var configOpts []func(*config.LoadOptions) error
 
 	if opts.Region != "" {
@@ -41,14 +67,22 @@ func NewClient(ctx context.Context, opts Options) (*Client, error) {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
+	return NewClientFromConfig(cfg), nil
+}
+
+// NewClientFromConfig creates SDK-backed service clients from an AWS config.
+func NewClientFromConfig(cfg aws.Config) *Client {
 	return &Client{
 		IAM:       iam.NewFromConfig(cfg),
 		Lightsail: lightsail.NewFromConfig(cfg),
+		S3:        s3.NewFromConfig(cfg),
+		EFS:       efs.NewFromConfig(cfg),
+		EC2:       ec2.NewFromConfig(cfg),
 		Config:    cfg,
-	}, nil
+	}
 }
 
 // GetRegion returns the configured AWS region.
 func (c *Client) GetRegion() string {
 	return c.Config.Region
-}
\ No newline at end of file
+}
@@ -15,39 +15,39 @@ import (
 // EFSService provides EFS operations and Lightsail integration.
 type EFSService struct {
 	client       *Client
-	efsClient    *efs.Client
-	ec2Client    *ec2.Client
+	efsClient    EFSAPI
+	ec2Client    EC2API
 }
 
 // NewEFSService creates a new EFS service.
 func NewEFSService(client *Client) *EFSService {
 	return &EFSService{
 		client:    client,
-		efsClient: efs.NewFromConfig(client.Config),
-		ec2Client: ec2.NewFromConfig(client.Config),
+		efsClient: client.EFS,
+		ec2Client: client.EC2,
 	}
 }
 
 // EFSFileSystem represents an EFS file system configuration.
 type EFSFileSystem struct {
-	ID               string            `json:"id"`
-	Name             string            `json:"name"`
-	State            string            `json:"state"`
-	Region           string            `json:"region"`
-	MountTargets     []EFSMountTarget  `json:"mount_targets"`
-	Tags             map[string]string `json:"tags"`
-	CreationTime     string            `json:"creation_time"`
-	PerformanceMode  string            `json:"performance_mode"`
-	ThroughputMode   string            `json:"throughput_mode"`
+	ID               string            `json:"id" yaml:"id"`
+	Name             string            `json:"name" yaml:"name"`
+	State            string            `json:"state" yaml:"state"`
+	Region           string            `json:"region" yaml:"region"`
+	MountTargets     []EFSMountTarget  `json:"mount_targets" yaml:"mount_targets"`
+	Tags             map[string]string `json:"tags" yaml:"tags"`
+	CreationTime     string            `json:"creation_time" yaml:"creation_time"`
+	PerformanceMode  string            `json:"performance_mode" yaml:"performance_mode"`
+	ThroughputMode   string            `json:"throughput_mode" yaml:"throughput_mode"`
 }
 
 // EFSMountTarget represents an EFS mount target.
 type EFSMountTarget struct {
-	ID               string `json:"id"`
-	IPAddress        string `json:"ip_address"`
-	SubnetID         string `json:"subnet_id"`
-	AvailabilityZone string `json:"availability_zone"`
-	State            string `json:"state"`
+	ID               string `json:"id" yaml:"id"`
+	IPAddress        string `json:"ip_address" yaml:"ip_address"`
+	SubnetID         string `json:"subnet_id" yaml:"subnet_id"`
+	AvailabilityZone string `json:"availability_zone" yaml:"availability_zone"`
+	State            string `json:"state" yaml:"state"`
 }
 
 // EnableVPCPeering enables VPC peering for Lightsail in the current region.
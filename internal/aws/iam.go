@@ -2,7 +2,10 @@ package aws
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -109,12 +112,139 @@ func (s *IAMService) CreateUser(ctx context.Context, username, password, project
 		PasswordResetRequired: true,
 	})
 	if err != nil {
+		// Don't leave a user behind that can never sign in
+		if _, deleteErr := s.client.IAM.DeleteUser(ctx, &iam.DeleteUserInput{UserName: aws.String(username)}); deleteErr != nil {
+			fmt.Printf("Warning: failed to delete user %s after login profile failure: %v\n", username, deleteErr)
+		}
 		return nil, fmt.Errorf("failed to create login profile for user %s: %w", username, err)
 	}
 
 	return s.getUserInfo(ctx, username)
 }
 
+// EnsureLoginProfile gives an existing user a console password, replacing the
+// password of a login profile the user already has. It reports whether the
+// login profile was created.
+func (s *IAMService) EnsureLoginProfile(ctx context.Context, username, password string) (bool, error) {
+	_, err := s.client.IAM.CreateLoginProfile(ctx, &iam.CreateLoginProfileInput{
+		UserName:              aws.String(username),
+		Password:              aws.String(password),
+		PasswordResetRequired: true,
+	})
+	if err == nil {
+		return true, nil
+	}
+	if !IsEntityAlreadyExists(err) {
+		return false, fmt.Errorf("failed to create login profile for user %s: %w", username, err)
+	}
+
+	_, err = s.client.IAM.UpdateLoginProfile(ctx, &iam.UpdateLoginProfileInput{
+		UserName:              aws.String(username),
+		Password:              aws.String(password),
+		PasswordResetRequired: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to reset password for user %s: %w", username, err)
+	}
+	return false, nil
+}
+
+// DeleteLoginProfile removes a user's console password.
+func (s *IAMService) DeleteLoginProfile(ctx context.Context, username string) error {
+	_, err := s.client.IAM.DeleteLoginProfile(ctx, &iam.DeleteLoginProfileInput{
+		UserName: aws.String(username),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete login profile for user %s: %w", username, err)
+	}
+
+	return nil
+}
+
+// GetUser returns a user. Use IsNoSuchEntity to check whether it exists.
+func (s *IAMService) GetUser(ctx context.Context, username string) (*types.User, error) {
+	return s.getUserInfo(ctx, username)
+}
+
+// GetGroup returns a group. Use IsNoSuchEntity to check whether it exists.
+func (s *IAMService) GetGroup(ctx context.Context, name string) (*types.Group, error) {
+	return s.getGroupInfo(ctx, name)
+}
+
+// ListUsernames returns the names of all IAM users.
+func (s *IAMService) ListUsernames(ctx context.Context) ([]string, error) {
+	var usernames []string
+	var marker *string
+	for {
+		output, err := s.client.IAM.ListUsers(ctx, &iam.ListUsersInput{Marker: marker})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+		for _, user := range output.Users {
+			usernames = append(usernames, aws.ToString(user.UserName))
+		}
+
+		if !output.IsTruncated {
+			return usernames, nil
+		}
+		marker = output.Marker
+	}
+}
+
+// ListProjectUsers returns the users tagged with a project.
+func (s *IAMService) ListProjectUsers(ctx context.Context, project string) ([]*types.User, error) {
+	var users []*types.User
+	var marker *string
+	for {
+		output, err := s.client.IAM.ListUsers(ctx, &iam.ListUsersInput{Marker: marker})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+
+		for _, user := range output.Users {
+			username := aws.ToString(user.UserName)
+			tags, err := s.client.IAM.ListUserTags(ctx, &iam.ListUserTagsInput{
+				UserName: aws.String(username),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get user tags for %s: %w", username, err)
+			}
+
+			for _, tag := range tags.Tags {
+				if aws.ToString(tag.Key) == "Project" && aws.ToString(tag.Value) == project {
+					users = append(users, &types.User{
+						Username:  username,
+						Project:   project,
+						CreatedAt: aws.ToTime(user.CreateDate),
+					})
+					break
+				}
+			}
+		}
+
+		if !output.IsTruncated {
+			return users, nil
+		}
+		marker = output.Marker
+	}
+}
+
+// ListUserGroups returns the names of the groups a user belongs to.
+func (s *IAMService) ListUserGroups(ctx context.Context, username string) ([]string, error) {
+	output, err := s.client.IAM.ListGroupsForUser(ctx, &iam.ListGroupsForUserInput{
+		UserName: aws.String(username),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups for user %s: %w", username, err)
+	}
+
+	var groups []string
+	for _, group := range output.Groups {
+		groups = append(groups, aws.ToString(group.GroupName))
+	}
+	return groups, nil
+}
+
 // AddUserToGroup adds a user to a group.
 func (s *IAMService) AddUserToGroup(ctx context.Context, username, groupName string) error {
 	_, err := s.client.IAM.AddUserToGroup(ctx, &iam.AddUserToGroupInput{
@@ -142,6 +272,153 @@ func (s *IAMService) PutUserPolicy(ctx context.Context, username, policyName, po
 	return nil
 }
 
+// GetUserPolicy retrieves the document of a user's inline policy.
+func (s *IAMService) GetUserPolicy(ctx context.Context, username, policyName string) (string, error) {
+	output, err := s.client.IAM.GetUserPolicy(ctx, &iam.GetUserPolicyInput{
+		UserName:   aws.String(username),
+		PolicyName: aws.String(policyName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get user policy %s for user %s: %w", policyName, username, err)
+	}
+
+	// IAM returns policy documents URL-encoded
+	document, err := url.QueryUnescape(aws.ToString(output.PolicyDocument))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode user policy %s for user %s: %w", policyName, username, err)
+	}
+
+	return document, nil
+}
+
+// UserInstancePolicyName returns the name of the inline policy that grants a user
+// access to their own Lightsail instances.
+func UserInstancePolicyName(username string) string {
+	return "LightsailLimitedAccess-" + username
+}
+
+// instancePolicyStatement is a single statement of a user instance policy.
+type instancePolicyStatement struct {
+	Effect   string          `json:"Effect"`
+	Action   []string        `json:"Action"`
+	Resource json.RawMessage `json:"Resource"`
+}
+
+// instancePolicy is a user instance policy document.
+type instancePolicy struct {
+	Version   string                    `json:"Version"`
+	Statement []instancePolicyStatement `json:"Statement"`
+}
+
+// UserInstancePolicyDocument returns a policy document allowing all Lightsail
+// actions on the given instance ARNs.
+func UserInstancePolicyDocument(instanceARNs []string) string {
+	resource, _ := json.Marshal(instanceARNs)
+	document, _ := json.MarshalIndent(instancePolicy{
+		Version: "2012-10-17",
+		Statement: []instancePolicyStatement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"lightsail:*"},
+				Resource: resource,
+			},
+		},
+	}, "", "  ")
+	return string(document)
+}
+
+// InstanceARNsFromPolicy returns the resources of a user instance policy document.
+// Resource may be a single ARN or a list of ARNs.
+func InstanceARNsFromPolicy(document string) ([]string, error) {
+	var policy instancePolicy
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy document: %w", err)
+	}
+
+	var arns []string
+	for _, statement := range policy.Statement {
+		if len(statement.Resource) == 0 {
+			continue
+		}
+
+		var single string
+		if err := json.Unmarshal(statement.Resource, &single); err == nil {
+			arns = append(arns, single)
+			continue
+		}
+
+		var multiple []string
+		if err := json.Unmarshal(statement.Resource, &multiple); err != nil {
+			return nil, fmt.Errorf("failed to parse policy resources: %w", err)
+		}
+		arns = append(arns, multiple...)
+	}
+
+	return arns, nil
+}
+
+// UpdateUserInstanceAccess adds and removes instance ARNs in a user's
+// LightsailLimitedAccess policy, creating the policy if it does not exist.
+// The policy is deleted when no instances remain.
+func (s *IAMService) UpdateUserInstanceAccess(ctx context.Context, username string, add, remove []string) error {
+	policyName := UserInstancePolicyName(username)
+
+	var current []string
+	document, err := s.GetUserPolicy(ctx, username, policyName)
+	if err == nil {
+		current, err = InstanceARNsFromPolicy(document)
+		if err != nil {
+			return fmt.Errorf("failed to read policy %s for user %s: %w", policyName, username, err)
+		}
+	} else if !IsNoSuchEntity(err) {
+		return err
+	}
+
+	removed := make(map[string]bool)
+	for _, arn := range remove {
+		removed[arn] = true
+	}
+
+	seen := make(map[string]bool)
+	var arns []string
+	for _, arn := range append(current, add...) {
+		if removed[arn] || seen[arn] {
+			continue
+		}
+		seen[arn] = true
+		arns = append(arns, arn)
+	}
+
+	if len(arns) == 0 {
+		if len(current) == 0 {
+			return nil
+		}
+		_, err = s.client.IAM.DeleteUserPolicy(ctx, &iam.DeleteUserPolicyInput{
+			UserName:   aws.String(username),
+			PolicyName: aws.String(policyName),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete user policy %s for user %s: %w", policyName, username, err)
+		}
+		return nil
+	}
+
+	return s.PutUserPolicy(ctx, username, policyName, UserInstancePolicyDocument(arns))
+}
+
+// IsNoSuchEntity reports whether err is an IAM NoSuchEntity error.
+func IsNoSuchEntity(err error) bool {
+	var notFound *iamTypes.NoSuchEntityException
+	return errors.As(err, &notFound)
+}
+
+// IsEntityAlreadyExists reports whether err is an IAM EntityAlreadyExists
+// error.
+func IsEntityAlreadyExists(err error) bool {
+	var exists *iamTypes.EntityAlreadyExistsException
+	return errors.As(err, &exists)
+}
+
 // DeleteUser removes a user and all associated resources.
 func (s *IAMService) DeleteUser(ctx context.Context, username string) error {
 	// Remove user from all groups
@@ -166,7 +443,7 @@ func (s *IAMService) DeleteUser(ctx context.Context, username string) error {
 	_, err = s.client.IAM.DeleteLoginProfile(ctx, &iam.DeleteLoginProfileInput{
 		UserName: aws.String(username),
 	})
-	if err != nil {
+	if err != nil && !IsNoSuchEntity(err) {
 		// Login profile might not exist, continue
 		fmt.Printf("Warning: failed to delete login profile for user %s: %v\n", username, err)
 	}
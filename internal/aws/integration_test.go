@@ -8,8 +8,6 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/iam"
-	"github.com/aws/aws-sdk-go-v2/service/lightsail"
 
 	"github.com/scttfrdmn/lfr-tools/internal/testutils"
 )
@@ -55,11 +53,7 @@ func setupIntegrationTest(t *testing.T) *Client {
 			t.Fatalf("Failed to load LocalStack config: %v", err)
 		}
 
-		client = &Client{
-			IAM:       iam.NewFromConfig(cfg),
-			Lightsail: lightsail.NewFromConfig(cfg),
-			Config:    cfg,
-		}
+		client = NewClientFromConfig(cfg)
 	} else {
 		// Real AWS configuration
 		opts := Options{
@@ -2,7 +2,12 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/lightsail"
@@ -72,13 +77,38 @@ func (s *LightsailService) GetRegions(ctx context.Context) ([]string, error) {
 	return regions, nil
 }
 
-// CreateInstance creates a Lightsail instance.
+// IdleSettings configures the stop-on-idle add-on of a Lightsail for Research instance.
+type IdleSettings struct {
+	// ThresholdMinutes is how long an instance must be inactive to count as idle.
+	ThresholdMinutes int
+	// DurationMinutes is how long an idle instance keeps running before it is stopped.
+	DurationMinutes int
+}
+
+// DefaultIdleSettings are the Lightsail for Research defaults: a 2 hour
+// threshold and a 30 minute duration.
+var DefaultIdleSettings = IdleSettings{ThresholdMinutes: 120, DurationMinutes: 30}
+
+// CreateInstance creates a Lightsail instance with the default idle settings.
 func (s *LightsailService) CreateInstance(ctx context.Context, name, blueprintID, bundleID, availabilityZone, project string) (*types.Instance, error) {
+	return s.CreateInstanceWithIdle(ctx, name, blueprintID, bundleID, availabilityZone, project, "", DefaultIdleSettings)
+}
+
+// CreateInstanceWithIdle creates a Lightsail instance with custom idle settings.
+// The key pair is installed for the instance's default user; an empty name uses
+// the region's default key pair.
+func (s *LightsailService) CreateInstanceWithIdle(ctx context.Context, name, blueprintID, bundleID, availabilityZone, project, keyPairName string, idle IdleSettings) (*types.Instance, error) {
+	var keyPair *string
+	if keyPairName != "" {
+		keyPair = aws.String(keyPairName)
+	}
+
 	_, err := s.client.Lightsail.CreateInstances(ctx, &lightsail.CreateInstancesInput{
 		InstanceNames:    []string{name},
 		BlueprintId:      aws.String(blueprintID),
 		BundleId:         aws.String(bundleID),
 		AvailabilityZone: aws.String(availabilityZone),
+		KeyPairName:      keyPair,
 		Tags: []lightsailTypes.Tag{
 			{
 				Key:   aws.String("Project"),
@@ -86,13 +116,7 @@ func (s *LightsailService) CreateInstance(ctx context.Context, name, blueprintID
 			},
 		},
 		AddOns: []lightsailTypes.AddOnRequest{
-			{
-				AddOnType: lightsailTypes.AddOnTypeStopInstanceOnIdle,
-				StopInstanceOnIdleRequest: &lightsailTypes.StopInstanceOnIdleRequest{
-					Threshold: aws.String("2"),   // 2 hours
-					Duration:  aws.String("30"),  // 30 minutes
-				},
-			},
+			idleAddOn(idle),
 		},
 	})
 	if err != nil {
@@ -103,6 +127,50 @@ func (s *LightsailService) CreateInstance(ctx context.Context, name, blueprintID
 	return s.GetInstance(ctx, name)
 }
 
+// SetIdleDetection enables the stop-on-idle add-on of an existing instance, or
+// changes its settings if it is already enabled.
+func (s *LightsailService) SetIdleDetection(ctx context.Context, name string, idle IdleSettings) error {
+	addOn := idleAddOn(idle)
+	_, err := s.client.Lightsail.EnableAddOn(ctx, &lightsail.EnableAddOnInput{
+		ResourceName: aws.String(name),
+		AddOnRequest: &addOn,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set idle detection for instance %s: %w", name, err)
+	}
+	return nil
+}
+
+func idleAddOn(idle IdleSettings) lightsailTypes.AddOnRequest {
+	return lightsailTypes.AddOnRequest{
+		AddOnType: lightsailTypes.AddOnTypeStopInstanceOnIdle,
+		StopInstanceOnIdleRequest: &lightsailTypes.StopInstanceOnIdleRequest{
+			// The threshold is in hours and the duration in minutes
+			Threshold: aws.String(strconv.FormatFloat(float64(idle.ThresholdMinutes)/60, 'f', -1, 64)),
+			Duration:  aws.String(strconv.Itoa(idle.DurationMinutes)),
+		},
+	}
+}
+
+// idleDetection returns the settings of an enabled stop-on-idle add-on.
+func idleDetection(addOns []lightsailTypes.AddOn) *types.IdleDetection {
+	for _, addOn := range addOns {
+		if aws.ToString(addOn.Name) != string(lightsailTypes.AddOnTypeStopInstanceOnIdle) || aws.ToString(addOn.Status) != "Enabled" {
+			continue
+		}
+		hours, err := strconv.ParseFloat(aws.ToString(addOn.Threshold), 64)
+		if err != nil {
+			return nil
+		}
+		minutes, err := strconv.Atoi(aws.ToString(addOn.Duration))
+		if err != nil {
+			return nil
+		}
+		return &types.IdleDetection{ThresholdMinutes: int(math.Round(hours * 60)), DurationMinutes: minutes}
+	}
+	return nil
+}
+
 // GetInstance retrieves instance details.
 func (s *LightsailService) GetInstance(ctx context.Context, name string) (*types.Instance, error) {
 	output, err := s.client.Lightsail.GetInstance(ctx, &lightsail.GetInstanceInput{
@@ -119,14 +187,19 @@ func (s *LightsailService) GetInstance(ctx context.Context, name string) (*types
 	}
 
 	result := &types.Instance{
-		Name:      aws.ToString(instance.Name),
-		ARN:       aws.ToString(instance.Arn),
-		State:     aws.ToString(instance.State.Name),
-		Blueprint: aws.ToString(instance.BlueprintName),
-		Bundle:    aws.ToString(instance.BundleId),
-		Region:    string(instance.Location.RegionName),
-		Tags:      tags,
-		CreatedAt: *instance.CreatedAt,
+		Name:       aws.ToString(instance.Name),
+		ARN:        aws.ToString(instance.Arn),
+		State:      aws.ToString(instance.State.Name),
+		Blueprint:  aws.ToString(instance.BlueprintName),
+		Bundle:     aws.ToString(instance.BundleId),
+		Region:     string(instance.Location.RegionName),
+		Tags:       tags,
+		CreatedAt:  *instance.CreatedAt,
+		SSHKeyName: aws.ToString(instance.SshKeyName),
+		Idle:       idleDetection(instance.AddOns),
+	}
+	if instance.Location != nil {
+		result.AvailabilityZone = aws.ToString(instance.Location.AvailabilityZone)
 	}
 
 	if instance.PublicIpAddress != nil {
@@ -161,14 +234,19 @@ func (s *LightsailService) ListInstances(ctx context.Context, project string) ([
 		}
 
 		result := &types.Instance{
-			Name:      aws.ToString(instance.Name),
-			ARN:       aws.ToString(instance.Arn),
-			State:     aws.ToString(instance.State.Name),
-			Blueprint: aws.ToString(instance.BlueprintName),
-			Bundle:    aws.ToString(instance.BundleId),
-			Region:    string(instance.Location.RegionName),
-			Tags:      tags,
-			CreatedAt: *instance.CreatedAt,
+			Name:       aws.ToString(instance.Name),
+			ARN:        aws.ToString(instance.Arn),
+			State:      aws.ToString(instance.State.Name),
+			Blueprint:  aws.ToString(instance.BlueprintName),
+			Bundle:     aws.ToString(instance.BundleId),
+			Region:     string(instance.Location.RegionName),
+			Tags:       tags,
+			CreatedAt:  *instance.CreatedAt,
+			SSHKeyName: aws.ToString(instance.SshKeyName),
+			Idle:       idleDetection(instance.AddOns),
+		}
+		if instance.Location != nil {
+			result.AvailabilityZone = aws.ToString(instance.Location.AvailabilityZone)
 		}
 
 		if instance.PublicIpAddress != nil {
@@ -232,6 +310,103 @@ func (s *LightsailService) GetInstanceSSHKeyPair(ctx context.Context, keyPairNam
 	return output.KeyPair, nil
 }
 
+// UserKeyPairName returns the name of the key pair created for a user.
+func UserKeyPairName(username string) string {
+	return "lfr-" + username
+}
+
+// DefaultKeyPairName is the name of the region's default key pair, which
+// instances created without a key pair use.
+const DefaultKeyPairName = "LightsailDefaultKeyPair"
+
+// ListKeyPairs lists the region's key pairs, including the default key pair.
+func (s *LightsailService) ListKeyPairs(ctx context.Context) ([]*types.KeyPair, error) {
+	var keyPairs []*types.KeyPair
+	var pageToken *string
+	for {
+		output, err := s.client.Lightsail.GetKeyPairs(ctx, &lightsail.GetKeyPairsInput{
+			IncludeDefaultKeyPair: aws.Bool(true),
+			PageToken:             pageToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list key pairs: %w", err)
+		}
+
+		for _, keyPair := range output.KeyPairs {
+			tags := make(map[string]string)
+			for _, tag := range keyPair.Tags {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+
+			result := &types.KeyPair{
+				Name:        aws.ToString(keyPair.Name),
+				ARN:         aws.ToString(keyPair.Arn),
+				Fingerprint: aws.ToString(keyPair.Fingerprint),
+				Tags:        tags,
+			}
+			if keyPair.CreatedAt != nil {
+				result.CreatedAt = *keyPair.CreatedAt
+			}
+			keyPairs = append(keyPairs, result)
+		}
+
+		if aws.ToString(output.NextPageToken) == "" {
+			return keyPairs, nil
+		}
+		pageToken = output.NextPageToken
+	}
+}
+
+// CreateKeyPair creates a key pair and returns its PEM private key, which
+// Lightsail does not keep.
+func (s *LightsailService) CreateKeyPair(ctx context.Context, name string, tags map[string]string) (string, error) {
+	output, err := s.client.Lightsail.CreateKeyPair(ctx, &lightsail.CreateKeyPairInput{
+		KeyPairName: aws.String(name),
+		Tags:        lightsailTags(tags),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create key pair %s: %w", name, err)
+	}
+
+	return aws.ToString(output.PrivateKeyBase64), nil
+}
+
+// ImportKeyPair creates a key pair from an authorized_keys line, which
+// Lightsail requires to be an ssh-rsa key, and tags it.
+func (s *LightsailService) ImportKeyPair(ctx context.Context, name, publicKey string, tags map[string]string) error {
+	_, err := s.client.Lightsail.ImportKeyPair(ctx, &lightsail.ImportKeyPairInput{
+		KeyPairName:     aws.String(name),
+		PublicKeyBase64: aws.String(publicKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import key pair %s: %w", name, err)
+	}
+
+	if len(tags) > 0 {
+		if _, err := s.client.Lightsail.TagResource(ctx, &lightsail.TagResourceInput{
+			ResourceName: aws.String(name),
+			Tags:         lightsailTags(tags),
+		}); err != nil {
+			return fmt.Errorf("failed to tag key pair %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteKeyPair deletes a key pair. Instances it was installed on keep it in
+// their authorized_keys.
+func (s *LightsailService) DeleteKeyPair(ctx context.Context, name string) error {
+	_, err := s.client.Lightsail.DeleteKeyPair(ctx, &lightsail.DeleteKeyPairInput{
+		KeyPairName: aws.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete key pair %s: %w", name, err)
+	}
+
+	return nil
+}
+
 // DownloadSSHKey downloads the private key for an instance.
 func (s *LightsailService) DownloadSSHKey(ctx context.Context, keyPairName string) (string, error) {
 	output, err := s.client.Lightsail.DownloadDefaultKeyPair(ctx, &lightsail.DownloadDefaultKeyPairInput{})
@@ -387,11 +562,25 @@ func (s *LightsailService) DeleteDisk(ctx context.Context, diskName string) erro
 	return nil
 }
 
-// CreateInstanceSnapshot creates a snapshot of an instance.
-func (s *LightsailService) CreateInstanceSnapshot(ctx context.Context, instanceName, snapshotName string) error {
+// TagResource adds or overwrites tags on an instance, disk or other Lightsail resource.
+func (s *LightsailService) TagResource(ctx context.Context, resourceName string, tags map[string]string) error {
+	_, err := s.client.Lightsail.TagResource(ctx, &lightsail.TagResourceInput{
+		ResourceName: aws.String(resourceName),
+		Tags:         lightsailTags(tags),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag resource %s: %w", resourceName, err)
+	}
+
+	return nil
+}
+
+// CreateInstanceSnapshot creates a tagged snapshot of an instance.
+func (s *LightsailService) CreateInstanceSnapshot(ctx context.Context, instanceName, snapshotName string, tags map[string]string) error {
 	_, err := s.client.Lightsail.CreateInstanceSnapshot(ctx, &lightsail.CreateInstanceSnapshotInput{
 		InstanceName:         aws.String(instanceName),
 		InstanceSnapshotName: aws.String(snapshotName),
+		Tags:                 lightsailTags(tags),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create instance snapshot %s: %w", snapshotName, err)
@@ -401,22 +590,20 @@ func (s *LightsailService) CreateInstanceSnapshot(ctx context.Context, instanceN
 }
 
 // CreateInstanceFromSnapshot creates a new instance from a snapshot with specified bundle.
-func (s *LightsailService) CreateInstanceFromSnapshot(ctx context.Context, newInstanceName, snapshotName, bundleID, availabilityZone string, tags map[string]string) (*types.Instance, error) {
-	var lightsailTags []lightsailTypes.Tag
-	for key, value := range tags {
-		lightsailTags = append(lightsailTags, lightsailTypes.Tag{
-			Key:   aws.String(key),
-			Value: aws.String(value),
-		})
-	}
-
-	_, err := s.client.Lightsail.CreateInstancesFromSnapshot(ctx, &lightsail.CreateInstancesFromSnapshotInput{
+// The instance is created with keyPairName, or the region's default key pair if it is empty.
+func (s *LightsailService) CreateInstanceFromSnapshot(ctx context.Context, newInstanceName, snapshotName, bundleID, availabilityZone, keyPairName string, tags map[string]string) (*types.Instance, error) {
+	input := &lightsail.CreateInstancesFromSnapshotInput{
 		InstanceNames:        []string{newInstanceName},
 		InstanceSnapshotName: aws.String(snapshotName),
 		BundleId:             aws.String(bundleID),
 		AvailabilityZone:     aws.String(availabilityZone),
-		Tags:                 lightsailTags,
-	})
+		Tags:                 lightsailTags(tags),
+	}
+	if keyPairName != "" {
+		input.KeyPairName = aws.String(keyPairName)
+	}
+
+	_, err := s.client.Lightsail.CreateInstancesFromSnapshot(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create instance %s from snapshot %s: %w", newInstanceName, snapshotName, err)
 	}
@@ -437,7 +624,7 @@ func (s *LightsailService) DeleteInstanceSnapshot(ctx context.Context, snapshotN
 }
 
 // GetInstanceSnapshot gets snapshot details.
-func (s *LightsailService) GetInstanceSnapshot(ctx context.Context, snapshotName string) (*lightsailTypes.InstanceSnapshot, error) {
+func (s *LightsailService) GetInstanceSnapshot(ctx context.Context, snapshotName string) (*types.Snapshot, error) {
 	output, err := s.client.Lightsail.GetInstanceSnapshot(ctx, &lightsail.GetInstanceSnapshotInput{
 		InstanceSnapshotName: aws.String(snapshotName),
 	})
@@ -445,5 +632,194 @@ func (s *LightsailService) GetInstanceSnapshot(ctx context.Context, snapshotName
 		return nil, fmt.Errorf("failed to get instance snapshot %s: %w", snapshotName, err)
 	}
 
-	return output.InstanceSnapshot, nil
-}
\ No newline at end of file
+	return toSnapshot(output.InstanceSnapshot), nil
+}
+
+// GetInstanceStaticIP returns the name of the static IP attached to an instance,
+// or an empty string if it has none.
+func (s *LightsailService) GetInstanceStaticIP(ctx context.Context, instanceName string) (string, error) {
+	var pageToken *string
+	for {
+		output, err := s.client.Lightsail.GetStaticIps(ctx, &lightsail.GetStaticIpsInput{
+			PageToken: pageToken,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to list static IPs: %w", err)
+		}
+
+		for _, staticIP := range output.StaticIps {
+			if aws.ToBool(staticIP.IsAttached) && aws.ToString(staticIP.AttachedTo) == instanceName {
+				return aws.ToString(staticIP.Name), nil
+			}
+		}
+
+		if aws.ToString(output.NextPageToken) == "" {
+			return "", nil
+		}
+		pageToken = output.NextPageToken
+	}
+}
+
+// AttachStaticIP attaches a static IP to an instance.
+func (s *LightsailService) AttachStaticIP(ctx context.Context, staticIPName, instanceName string) error {
+	_, err := s.client.Lightsail.AttachStaticIp(ctx, &lightsail.AttachStaticIpInput{
+		StaticIpName: aws.String(staticIPName),
+		InstanceName: aws.String(instanceName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach static IP %s to instance %s: %w", staticIPName, instanceName, err)
+	}
+
+	return nil
+}
+
+// DetachStaticIP detaches a static IP from its instance.
+func (s *LightsailService) DetachStaticIP(ctx context.Context, staticIPName string) error {
+	_, err := s.client.Lightsail.DetachStaticIp(ctx, &lightsail.DetachStaticIpInput{
+		StaticIpName: aws.String(staticIPName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to detach static IP %s: %w", staticIPName, err)
+	}
+
+	return nil
+}
+
+// ListInstanceSnapshots lists instance snapshots, optionally filtered by project, oldest first.
+func (s *LightsailService) ListInstanceSnapshots(ctx context.Context, project string) ([]*types.Snapshot, error) {
+	var snapshots []*types.Snapshot
+	var pageToken *string
+	for {
+		output, err := s.client.Lightsail.GetInstanceSnapshots(ctx, &lightsail.GetInstanceSnapshotsInput{
+			PageToken: pageToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list instance snapshots: %w", err)
+		}
+
+		for _, snapshot := range output.InstanceSnapshots {
+			result := toSnapshot(&snapshot)
+
+			// Filter by project if specified
+			if project != "" && result.Tags["Project"] != project {
+				continue
+			}
+
+			snapshots = append(snapshots, result)
+		}
+
+		if aws.ToString(output.NextPageToken) == "" {
+			break
+		}
+		pageToken = output.NextPageToken
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+
+	return snapshots, nil
+}
+
+// toSnapshot converts a Lightsail instance snapshot.
+func toSnapshot(snapshot *lightsailTypes.InstanceSnapshot) *types.Snapshot {
+	result := &types.Snapshot{
+		Name:          aws.ToString(snapshot.Name),
+		ARN:           aws.ToString(snapshot.Arn),
+		State:         string(snapshot.State),
+		FromInstance:  aws.ToString(snapshot.FromInstanceName),
+		FromBlueprint: aws.ToString(snapshot.FromBlueprintId),
+		FromBundle:    aws.ToString(snapshot.FromBundleId),
+		SizeGB:        aws.ToInt32(snapshot.SizeInGb),
+		Tags:          make(map[string]string),
+	}
+	for _, tag := range snapshot.Tags {
+		result.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if snapshot.Location != nil {
+		result.Region = string(snapshot.Location.RegionName)
+		result.AvailabilityZone = aws.ToString(snapshot.Location.AvailabilityZone)
+	}
+	if snapshot.CreatedAt != nil {
+		result.CreatedAt = *snapshot.CreatedAt
+	}
+	return result
+}
+
+// lightsailTags converts a tag map to Lightsail tags in key order.
+func lightsailTags(tags map[string]string) []lightsailTypes.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []lightsailTypes.Tag
+	for _, key := range keys {
+		result = append(result, lightsailTypes.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
+
+// IsNotFound reports whether err is a Lightsail NotFound error.
+func IsNotFound(err error) bool {
+	var notFound *lightsailTypes.NotFoundException
+	return errors.As(err, &notFound)
+}
+
+// instanceMetricUnits maps instance metric names to the unit Lightsail reports them in.
+var instanceMetricUnits = map[lightsailTypes.InstanceMetricName]lightsailTypes.MetricUnit{
+	lightsailTypes.InstanceMetricNameCPUUtilization:    lightsailTypes.MetricUnitPercent,
+	lightsailTypes.InstanceMetricNameNetworkIn:         lightsailTypes.MetricUnitBytes,
+	lightsailTypes.InstanceMetricNameNetworkOut:        lightsailTypes.MetricUnitBytes,
+	lightsailTypes.InstanceMetricNameStatusCheckFailed: lightsailTypes.MetricUnitCount,
+}
+
+// GetInstanceMetricData retrieves metric datapoints for an instance, oldest first.
+// The period is the granularity of the datapoints in seconds (a multiple of 60).
+func (s *LightsailService) GetInstanceMetricData(ctx context.Context, instanceName string, metricName lightsailTypes.InstanceMetricName, start, end time.Time, period int32) ([]types.MetricPoint, error) {
+	unit, ok := instanceMetricUnits[metricName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported instance metric: %s", metricName)
+	}
+
+	output, err := s.client.Lightsail.GetInstanceMetricData(ctx, &lightsail.GetInstanceMetricDataInput{
+		InstanceName: aws.String(instanceName),
+		MetricName:   metricName,
+		Period:       aws.Int32(period),
+		StartTime:    aws.Time(start),
+		EndTime:      aws.Time(end),
+		Unit:         unit,
+		Statistics: []lightsailTypes.MetricStatistic{
+			lightsailTypes.MetricStatisticAverage,
+			lightsailTypes.MetricStatisticMaximum,
+			lightsailTypes.MetricStatisticSum,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s metric data for %s: %w", metricName, instanceName, err)
+	}
+
+	points := make([]types.MetricPoint, 0, len(output.MetricData))
+	for _, datapoint := range output.MetricData {
+		if datapoint.Timestamp == nil {
+			continue
+		}
+		points = append(points, types.MetricPoint{
+			Timestamp: *datapoint.Timestamp,
+			Average:   aws.ToFloat64(datapoint.Average),
+			Maximum:   aws.ToFloat64(datapoint.Maximum),
+			Sum:       aws.ToFloat64(datapoint.Sum),
+		})
+	}
+
+	// Lightsail does not guarantee datapoint order
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Timestamp.Before(points[j].Timestamp)
+	})
+
+	return points, nil
+}
@@ -4,25 +4,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
 )
 
 // S3Service provides S3 operations for student status updates.
 type S3Service struct {
 	client *Client
-	s3     *s3.Client
+	s3     S3API
 }
 
 // NewS3Service creates a new S3 service.
 func NewS3Service(client *Client) *S3Service {
 	return &S3Service{
 		client: client,
-		s3:     s3.NewFromConfig(client.Config),
+		s3:     client.S3,
 	}
 }
 
@@ -36,6 +40,12 @@ type StudentStatus struct {
 	RequestedBy     string    `json:"requested_by,omitempty"`
 	BudgetRemaining float64   `json:"budget_remaining,omitempty"`
 	AccessExpires   time.Time `json:"access_expires,omitempty"`
+	// HostKeys are the instance's SSH host keys as authorized_keys lines, so
+	// students can verify it without AWS credentials.
+	HostKeys []string `json:"host_keys,omitempty"`
+	// InstanceName is the name of the student's instance, which its host
+	// keys are pinned under.
+	InstanceName string `json:"instance_name,omitempty"`
 }
 
 // UpdateStudentStatus updates a student's status in S3.
@@ -230,4 +240,107 @@ func (s *S3Service) CreateStatusBucket(ctx context.Context, bucketName, project
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// softwarePackKey is where a version of a pack is published under a prefix.
+func softwarePackKey(prefix string, pack *types.SoftwarePack) string {
+	return fmt.Sprintf("%s%s/%s.json", softwarePackPrefix(prefix), pack.ID, pack.Version)
+}
+
+// softwarePackPrefix treats a prefix as a directory, so "packs" and "packs/"
+// are the same catalog.
+func softwarePackPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// ListSoftwarePacks reads every pack published under a prefix. Packs that
+// can't be read are skipped and reported in the error.
+func (s *S3Service) ListSoftwarePacks(ctx context.Context, bucket, prefix string) ([]*types.SoftwarePack, error) {
+	var keys []string
+	var token *string
+	for {
+		output, err := s.s3.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			Prefix:            aws.String(softwarePackPrefix(prefix)),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list software packs: %w", err)
+		}
+		for _, obj := range output.Contents {
+			if key := aws.ToString(obj.Key); strings.HasSuffix(key, ".json") {
+				keys = append(keys, key)
+			}
+		}
+		if !aws.ToBool(output.IsTruncated) {
+			break
+		}
+		token = output.NextContinuationToken
+	}
+
+	var packs []*types.SoftwarePack
+	var errs []error
+	for _, key := range keys {
+		output, err := s.s3.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get software pack %s: %w", key, err))
+			continue
+		}
+
+		var pack types.SoftwarePack
+		err = json.NewDecoder(output.Body).Decode(&pack)
+		output.Body.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to decode software pack %s: %w", key, err))
+			continue
+		}
+		packs = append(packs, &pack)
+	}
+
+	return packs, errors.Join(errs...)
+}
+
+// PublishSoftwarePack uploads a pack under a prefix and returns its key. A
+// version that is already published is only replaced if overwrite is set, so
+// published versions stay as they were reviewed.
+func (s *S3Service) PublishSoftwarePack(ctx context.Context, bucket, prefix string, pack *types.SoftwarePack, overwrite bool) (string, error) {
+	key := softwarePackKey(prefix, pack)
+
+	if !overwrite {
+		output, err := s.s3.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(key),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to check for a published software pack: %w", err)
+		}
+		for _, obj := range output.Contents {
+			if aws.ToString(obj.Key) == key {
+				return "", fmt.Errorf("%s %s is already published at s3://%s/%s", pack.ID, pack.Version, bucket, key)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(pack, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal software pack: %w", err)
+	}
+
+	_, err = s.s3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to publish software pack: %w", err)
+	}
+
+	return key, nil
+}
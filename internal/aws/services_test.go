@@ -0,0 +1,260 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/testutils"
+)
+
+// The in-memory fakes must stay in sync with the API interfaces.
+var (
+	_ LightsailAPI = (*testutils.FakeLightsail)(nil)
+	_ IAMAPI       = (*testutils.FakeIAM)(nil)
+	_ S3API        = (*testutils.FakeS3)(nil)
+	_ EFSAPI       = (*testutils.FakeEFS)(nil)
+	_ EC2API       = (*testutils.FakeEC2)(nil)
+	_ LightsailAPI = (*testutils.MockLightsailClient)(nil)
+	_ IAMAPI       = (*testutils.MockIAMClient)(nil)
+)
+
+func newFakeClient() (*Client, *testutils.FakeCloud) {
+	cloud := testutils.NewFakeCloud()
+	return &Client{
+		IAM:       cloud.IAM,
+		Lightsail: cloud.Lightsail,
+		S3:        cloud.S3,
+		EFS:       cloud.EFS,
+		EC2:       cloud.EC2,
+		Config:    testutils.MockAWSConfig(),
+	}, cloud
+}
+
+func TestLightsailServiceWithFake(t *testing.T) {
+	client, _ := newFakeClient()
+	service := NewLightsailService(client)
+	ctx := context.Background()
+
+	instance, err := service.CreateInstance(ctx, "alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "us-east-1a", "physics")
+	if err != nil {
+		t.Fatalf("CreateInstance failed: %v", err)
+	}
+	if instance.State != "running" || instance.Tags["Project"] != "physics" {
+		t.Errorf("unexpected instance: %+v", instance)
+	}
+
+	instances, err := service.ListInstances(ctx, "chemistry")
+	if err != nil {
+		t.Fatalf("ListInstances failed: %v", err)
+	}
+	if len(instances) != 0 {
+		t.Errorf("expected project filter to exclude instance, got %d", len(instances))
+	}
+
+	if err := service.DeleteInstance(ctx, "alice-ubuntu_22_04"); err != nil {
+		t.Fatalf("DeleteInstance failed: %v", err)
+	}
+	if _, err := service.GetInstance(ctx, "alice-ubuntu_22_04"); err == nil {
+		t.Error("expected GetInstance to fail after delete")
+	}
+}
+
+func TestIAMServiceWithFake(t *testing.T) {
+	client, cloud := newFakeClient()
+	service := NewIAMService(client)
+	ctx := context.Background()
+
+	first, err := service.CreatePolicy(ctx, "LightsailReadOnly", "read only", "{}")
+	if err != nil {
+		t.Fatalf("CreatePolicy failed: %v", err)
+	}
+	second, err := service.CreatePolicy(ctx, "LightsailReadOnly", "read only", "{}")
+	if err != nil || second != first {
+		t.Errorf("expected CreatePolicy to reuse %s, got %s (%v)", first, second, err)
+	}
+
+	if _, err := service.CreateGroup(ctx, "Lightsail-Users", "users", []string{first}); err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	if _, err := service.CreateUser(ctx, "alice", "Passw0rd!", "physics"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := service.AddUserToGroup(ctx, "alice", "Lightsail-Users"); err != nil {
+		t.Fatalf("AddUserToGroup failed: %v", err)
+	}
+	if err := service.PutUserPolicy(ctx, "alice", "LightsailLimitedAccess-alice", "{}"); err != nil {
+		t.Fatalf("PutUserPolicy failed: %v", err)
+	}
+
+	if err := service.DeleteUser(ctx, "alice"); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if len(cloud.IAM.UserNames()) != 0 {
+		t.Errorf("expected alice to be deleted, got %v", cloud.IAM.UserNames())
+	}
+}
+
+func TestS3ServiceWithFake(t *testing.T) {
+	client, _ := newFakeClient()
+	service := NewS3Service(client)
+	ctx := context.Background()
+
+	if err := service.CreateStatusBucket(ctx, "lfr-status", "physics"); err != nil {
+		t.Fatalf("CreateStatusBucket failed: %v", err)
+	}
+
+	if err := service.UpdateStudentStatus(ctx, "lfr-status", "physics", "alice", &StudentStatus{State: "running"}); err != nil {
+		t.Fatalf("UpdateStudentStatus failed: %v", err)
+	}
+	status, err := service.GetStudentStatus(ctx, "lfr-status", "physics", "alice")
+	if err != nil {
+		t.Fatalf("GetStudentStatus failed: %v", err)
+	}
+	if status.State != "running" {
+		t.Errorf("expected state running, got %s", status.State)
+	}
+
+	if err := service.SubmitStartRequest(ctx, "lfr-status", "physics", &StudentStartRequest{Username: "bob"}); err != nil {
+		t.Fatalf("SubmitStartRequest failed: %v", err)
+	}
+	requests, err := service.CheckStartRequests(ctx, "lfr-status", "physics")
+	if err != nil {
+		t.Fatalf("CheckStartRequests failed: %v", err)
+	}
+	if len(requests) != 1 || requests["bob"] == nil {
+		t.Errorf("expected one start request for bob, got %v", requests)
+	}
+}
+
+func TestInstanceARNsFromPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "single resource",
+			document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["lightsail:*"],"Resource":"arn:a"}]}`,
+			expected: []string{"arn:a"},
+		},
+		{
+			name:     "resource list",
+			document: UserInstancePolicyDocument([]string{"arn:a", "arn:b"}),
+			expected: []string{"arn:a", "arn:b"},
+		},
+		{
+			name:     "invalid json",
+			document: `{`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arns, err := InstanceARNsFromPolicy(tt.document)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(arns, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v, got %v", tt.expected, arns)
+			}
+		})
+	}
+}
+
+func TestUpdateUserInstanceAccess(t *testing.T) {
+	client, cloud := newFakeClient()
+	service := NewIAMService(client)
+	ctx := context.Background()
+
+	if _, err := service.CreateUser(ctx, "alice", "Passw0rd!", "physics"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	steps := []struct {
+		add, remove []string
+		expected    string
+	}{
+		{[]string{"arn:a"}, nil, "arn:a"},
+		{[]string{"arn:b", "arn:a"}, nil, "arn:a,arn:b"},
+		{[]string{"arn:c"}, []string{"arn:a"}, "arn:b,arn:c"},
+		{nil, []string{"arn:b", "arn:c"}, ""},
+	}
+
+	for i, step := range steps {
+		if err := service.UpdateUserInstanceAccess(ctx, "alice", step.add, step.remove); err != nil {
+			t.Fatalf("step %d: UpdateUserInstanceAccess failed: %v", i, err)
+		}
+
+		document, ok := cloud.IAM.UserPolicy("alice", UserInstancePolicyName("alice"))
+		if step.expected == "" {
+			if ok {
+				t.Errorf("step %d: expected policy to be deleted, got %s", i, document)
+			}
+			continue
+		}
+		arns, err := InstanceARNsFromPolicy(document)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got := strings.Join(arns, ","); got != step.expected {
+			t.Errorf("step %d: expected %s, got %s", i, step.expected, got)
+		}
+	}
+
+	err := service.UpdateUserInstanceAccess(ctx, "nobody", []string{"arn:a"}, nil)
+	if !IsNoSuchEntity(err) {
+		t.Errorf("expected NoSuchEntity for a missing user, got %v", err)
+	}
+}
+
+func TestCreateUserRemovesUserWhenLoginProfileFails(t *testing.T) {
+	client, cloud := newFakeClient()
+	service := NewIAMService(client)
+	ctx := context.Background()
+
+	cloud.FailOn("CreateLoginProfile", errors.New("password policy violation"))
+
+	if _, err := service.CreateUser(ctx, "alice", "weak", "physics"); err == nil {
+		t.Fatal("expected CreateUser to fail")
+	}
+	if got := cloud.IAM.UserNames(); len(got) != 0 {
+		t.Errorf("expected no users to remain, got %v", got)
+	}
+}
+
+func TestListInstanceSnapshotsWithFake(t *testing.T) {
+	client, cloud := newFakeClient()
+	service := NewLightsailService(client)
+	ctx := context.Background()
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "running")
+
+	for _, snap := range []struct{ name, project string }{{"b-snap", "physics"}, {"a-snap", "chemistry"}, {"c-snap", "physics"}} {
+		if err := service.CreateInstanceSnapshot(ctx, "alice-ubuntu_22_04", snap.name, map[string]string{"Project": snap.project}); err != nil {
+			t.Fatalf("CreateInstanceSnapshot failed: %v", err)
+		}
+	}
+
+	snapshots, err := service.ListInstanceSnapshots(ctx, "physics")
+	if err != nil {
+		t.Fatalf("ListInstanceSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 physics snapshots, got %d", len(snapshots))
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.FromInstance != "alice-ubuntu_22_04" || snapshot.FromBundle != "app_standard_xl_1_0" || snapshot.Tags["Project"] != "physics" {
+			t.Errorf("unexpected snapshot: %+v", snapshot)
+		}
+	}
+}
@@ -14,6 +14,7 @@ type Config struct {
 	AWS      AWSConfig      `mapstructure:"aws" json:"aws" yaml:"aws"`
 	Defaults DefaultsConfig `mapstructure:"defaults" json:"defaults" yaml:"defaults"`
 	SSH      SSHConfig      `mapstructure:"ssh" json:"ssh" yaml:"ssh"`
+	Packs    PacksConfig    `mapstructure:"packs" json:"packs" yaml:"packs"`
 	Debug    bool           `mapstructure:"debug" json:"debug" yaml:"debug"`
 }
 
@@ -36,6 +37,16 @@ type SSHConfig struct {
 	ConfigPath string `mapstructure:"config_path" json:"config_path" yaml:"config_path"`
 }
 
+// PacksConfig holds where software packs are published.
+type PacksConfig struct {
+	// Dir holds local pack files.
+	Dir string `mapstructure:"dir" json:"dir" yaml:"dir"`
+	// S3Bucket and S3Prefix locate a shared catalog of published packs; it is
+	// not used when S3Bucket is empty.
+	S3Bucket string `mapstructure:"s3_bucket" json:"s3_bucket" yaml:"s3_bucket"`
+	S3Prefix string `mapstructure:"s3_prefix" json:"s3_prefix" yaml:"s3_prefix"`
+}
+
 // Load reads and parses the configuration from file and environment variables.
 func Load() (*Config, error) {
 	config := &Config{
@@ -52,6 +63,10 @@ func Load() (*Config, error) {
 			KeyPath:    filepath.Join(mustGetHomeDir(), ".ssh", "lfr-tools"),
 			ConfigPath: filepath.Join(mustGetHomeDir(), ".ssh", "config.d", "lfr-tools"),
 		},
+		Packs: PacksConfig{
+			Dir:      filepath.Join(mustGetHomeDir(), ".lfr-tools", "packs"),
+			S3Prefix: "packs/",
+		},
 		Debug: false,
 	}
 
@@ -63,6 +78,7 @@ func Load() (*Config, error) {
 	// Expand tilde in paths
 	config.SSH.KeyPath = expandPath(config.SSH.KeyPath)
 	config.SSH.ConfigPath = expandPath(config.SSH.ConfigPath)
+	config.Packs.Dir = expandPath(config.Packs.Dir)
 
 	return config, nil
 }
@@ -32,6 +32,10 @@ func TestLoadDefaultConfig(t *testing.T) {
 	if config.Defaults.IdleThreshold != 120 {
 		t.Errorf("expected default idle threshold 120, got %d", config.Defaults.IdleThreshold)
 	}
+
+	if filepath.Base(config.Packs.Dir) != "packs" || config.Packs.S3Bucket != "" || config.Packs.S3Prefix != "packs/" {
+		t.Errorf("expected local packs only by default, got %+v", config.Packs)
+	}
 }
 
 func TestExpandPath(t *testing.T) {
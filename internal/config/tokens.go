@@ -62,7 +62,7 @@ func (tm *TokenManager) GenerateToken(project, username, studentID, role string,
 		return "", nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	tokenString := fmt.Sprintf("%s-%s-%s", project, username, base64.URLEncoding.EncodeToString(tokenBytes)[:16])
+	tokenString := fmt.Sprintf("%s-%s-%s", project, username, base64.URLEncoding.EncodeToString(tokenBytes)[:tokenSecretLength])
 
 	// Create token object
 	token := &StudentToken{
@@ -82,16 +82,11 @@ func (tm *TokenManager) GenerateToken(project, username, studentID, role string,
 
 // ActivateToken binds a token to the current machine.
 func (tm *TokenManager) ActivateToken(tokenString, studentID string) error {
-	// Parse token to get basic info
-	// This is a simplified version - real implementation would validate token format
-	parts := splitTokenString(tokenString)
-	if len(parts) < 3 {
-		return fmt.Errorf("invalid token format")
+	project, username, err := ParseTokenString(tokenString)
+	if err != nil {
+		return err
 	}
 
-	project := parts[0]
-	username := parts[1]
-
 	// Generate machine fingerprint
 	fingerprint, err := utils.GenerateMachineFingerprint()
 	if err != nil {
@@ -113,6 +108,35 @@ func (tm *TokenManager) ActivateToken(tokenString, studentID string) error {
 	return tm.SaveToken(project, username, token)
 }
 
+// ImportToken activates a token file issued by an instructor, which unlike a
+// token string carries the user's SSH key, binding it to the current machine.
+func (tm *TokenManager) ImportToken(path, studentID string) (*StudentToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	var token StudentToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token: %w", err)
+	}
+	if token.Project == "" || token.Username == "" {
+		return nil, fmt.Errorf("invalid token file: missing project or username")
+	}
+
+	fingerprint, err := utils.GenerateMachineFingerprint()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate machine fingerprint: %w", err)
+	}
+	token.Fingerprint = fingerprint
+	token.StudentID = studentID
+
+	if err := tm.SaveToken(token.Project, token.Username, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
 // SaveToken saves a token to local storage.
 func (tm *TokenManager) SaveToken(project, username string, token *StudentToken) error {
 	filename := fmt.Sprintf("%s-%s.json", project, username)
@@ -212,7 +236,28 @@ func (tm *TokenManager) ListTokens() ([]*StudentToken, error) {
 	return tokens, nil
 }
 
-// splitTokenString splits a token string into components.
-func splitTokenString(tokenString string) []string {
-	return strings.Split(tokenString, "-")
+// tokenSecretLength is the length of the random part GenerateToken ends a
+// token string with.
+const tokenSecretLength = 16
+
+// ParseTokenString returns the project and username of a token string,
+// <project>-<username>-<secret>. Secrets from GenerateToken are
+// tokenSecretLength characters and may contain hyphens; other secrets are
+// taken to run from the last hyphen. The username is the part before the
+// secret, so projects may contain hyphens but usernames may not.
+func ParseTokenString(tokenString string) (project, username string, err error) {
+	var rest string
+	if n := len(tokenString) - tokenSecretLength - 1; n > 0 && tokenString[n] == '-' {
+		rest = tokenString[:n]
+	} else if i := strings.LastIndex(tokenString, "-"); i > 0 {
+		rest = tokenString[:i]
+	} else {
+		return "", "", fmt.Errorf("invalid token format")
+	}
+
+	i := strings.LastIndex(rest, "-")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", fmt.Errorf("invalid token format")
+	}
+	return rest[:i], rest[i+1:], nil
 }
\ No newline at end of file
@@ -0,0 +1,253 @@
+// Package hostkeys pins instance SSH host keys in a known_hosts file per
+// project. Hosts are recorded under an alias such as alice-bio101 rather than
+// their address, since public IPs change whenever an instance restarts.
+package hostkeys
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Result describes how a host key was verified.
+type Result int
+
+const (
+	// Matched means the key was already pinned.
+	Matched Result = iota
+	// Pinned means the host had no pins and the key was pinned.
+	Pinned
+	// Repinned means the host's pins were replaced by the keys Lightsail
+	// reports, as happens when a resize or restore replaces the instance.
+	Repinned
+)
+
+// ErrMismatch is returned when a host presents a key that is neither pinned
+// nor reported by Lightsail.
+var ErrMismatch = errors.New("host key mismatch")
+
+// mu serialises updates to known_hosts files from concurrent connections.
+var mu sync.Mutex
+
+// Store keeps known_hosts files in a directory, one per project.
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store under ~/.lfr-tools/known_hosts.
+func NewStore() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return NewStoreAt(filepath.Join(homeDir, ".lfr-tools", "known_hosts"))
+}
+
+// NewStoreAt creates a store in dir.
+func NewStoreAt(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create known hosts directory: %w", err)
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// Path returns the known_hosts file of a project, for UserKnownHostsFile.
+func (s *Store) Path(project string) string {
+	if project == "" {
+		project = "default"
+	}
+	return filepath.Join(s.dir, project)
+}
+
+// Keys returns the keys pinned for an alias.
+func (s *Store) Keys(project, alias string) ([]gossh.PublicKey, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	entries, err := s.read(project)
+	if err != nil {
+		return nil, err
+	}
+	return entries[alias], nil
+}
+
+// Pin replaces the keys pinned for an alias.
+func (s *Store) Pin(project, alias string, keys []gossh.PublicKey) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.pin(project, alias, keys)
+}
+
+// Forget removes the keys pinned for an alias, so the next connection pins
+// afresh.
+func (s *Store) Forget(project, alias string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.pin(project, alias, nil)
+}
+
+// Verify checks a key presented by the host known as alias. Keys reported by
+// Lightsail in trusted are authoritative: when there are any, the presented
+// key must be one of them and they replace the pins. Otherwise the key must
+// match the pins, and is pinned on first use.
+func (s *Store) Verify(project, alias string, key gossh.PublicKey, trusted []gossh.PublicKey) (Result, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	entries, err := s.read(project)
+	if err != nil {
+		return 0, err
+	}
+	pinned := entries[alias]
+
+	if len(trusted) > 0 {
+		if !contains(trusted, key) {
+			return 0, fmt.Errorf("%w for %s: presented %s key %s is not one Lightsail reports for the instance",
+				ErrMismatch, alias, key.Type(), gossh.FingerprintSHA256(key))
+		}
+		if sameKeys(pinned, trusted) {
+			return Matched, nil
+		}
+		if err := s.pin(project, alias, trusted); err != nil {
+			return 0, err
+		}
+		if len(pinned) == 0 {
+			return Pinned, nil
+		}
+		return Repinned, nil
+	}
+
+	if len(pinned) == 0 {
+		if err := s.pin(project, alias, []gossh.PublicKey{key}); err != nil {
+			return 0, err
+		}
+		return Pinned, nil
+	}
+	if contains(pinned, key) {
+		return Matched, nil
+	}
+	return 0, fmt.Errorf("%w for %s: presented %s key %s is not pinned in %s",
+		ErrMismatch, alias, key.Type(), gossh.FingerprintSHA256(key), s.Path(project))
+}
+
+// read parses a project's file into keys by alias. A missing file is empty.
+func (s *Store) read(project string) (map[string][]gossh.PublicKey, error) {
+	entries := make(map[string][]gossh.PublicKey)
+
+	data, err := os.ReadFile(s.Path(project))
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	for {
+		_, hosts, key, _, rest, err := gossh.ParseKnownHosts(data)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", s.Path(project), err)
+		}
+		for _, host := range hosts {
+			entries[host] = append(entries[host], key)
+		}
+		data = rest
+	}
+	return entries, nil
+}
+
+// pin rewrites a project's file with an alias's keys replaced. The caller
+// holds mu.
+func (s *Store) pin(project, alias string, keys []gossh.PublicKey) error {
+	path := s.Path(project)
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	// Keep every other host's lines as they are
+	var out strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || lineHost(line) == alias {
+			continue
+		}
+		out.WriteString(line + "\n")
+	}
+	for _, key := range keys {
+		out.WriteString(knownhosts.Line([]string{alias}, key) + "\n")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(out.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write known hosts: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write known hosts: %w", err)
+	}
+	return nil
+}
+
+// lineHost returns the host field of a known_hosts line written by pin.
+func lineHost(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return ""
+	}
+	return fields[0]
+}
+
+// ParseKey parses a host key as Lightsail reports it: the key blob with its
+// algorithm given separately, or a whole authorized_keys style line.
+func ParseKey(algorithm, publicKey string) (gossh.PublicKey, error) {
+	line := strings.TrimSpace(publicKey)
+	if !strings.Contains(line, " ") {
+		line = algorithm + " " + line
+	}
+
+	key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s host key: %w", algorithm, err)
+	}
+	return key, nil
+}
+
+// Format formats a key as an authorized_keys style line.
+func Format(key gossh.PublicKey) string {
+	return strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
+}
+
+func contains(keys []gossh.PublicKey, key gossh.PublicKey) bool {
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameKeys(a, b []gossh.PublicKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, key := range a {
+		if !contains(b, key) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package hostkeys
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func newKey(t *testing.T) gossh.PublicKey {
+	t.Helper()
+
+	public, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := gossh.NewPublicKey(public)
+	if err != nil {
+		t.Fatalf("failed to convert key: %v", err)
+	}
+	return key
+}
+
+func TestVerify(t *testing.T) {
+	store, err := NewStoreAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStoreAt failed: %v", err)
+	}
+	first, second, third := newKey(t), newKey(t), newKey(t)
+
+	tests := []struct {
+		name     string
+		alias    string
+		key      gossh.PublicKey
+		trusted  []gossh.PublicKey
+		expected Result
+		mismatch bool
+	}{
+		{name: "first use pins", alias: "alice-bio101", key: first, expected: Pinned},
+		{name: "pinned key matches", alias: "alice-bio101", key: first, expected: Matched},
+		{name: "other key is refused", alias: "alice-bio101", key: second, mismatch: true},
+		{name: "other host pins separately", alias: "bob-bio101", key: third, expected: Pinned},
+		{name: "trusted keys replace pins", alias: "alice-bio101", key: second, trusted: []gossh.PublicKey{second}, expected: Repinned},
+		{name: "repinned key matches", alias: "alice-bio101", key: second, expected: Matched},
+		{name: "key not trusted is refused", alias: "alice-bio101", key: first, trusted: []gossh.PublicKey{second}, mismatch: true},
+		{name: "trusted keys already pinned", alias: "alice-bio101", key: second, trusted: []gossh.PublicKey{second}, expected: Matched},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := store.Verify("bio101", tt.alias, tt.key, tt.trusted)
+			if tt.mismatch {
+				if !errors.Is(err, ErrMismatch) {
+					t.Errorf("expected ErrMismatch, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected result %d, got %d", tt.expected, result)
+			}
+		})
+	}
+
+	// Each host's pins survive the other's updates
+	keys, err := store.Keys("bio101", "bob-bio101")
+	if err != nil || len(keys) != 1 || !contains(keys, third) {
+		t.Errorf("expected bob's key to be kept, got %v, %v", keys, err)
+	}
+
+	if err := store.Forget("bio101", "alice-bio101"); err != nil {
+		t.Fatalf("Forget failed: %v", err)
+	}
+	if result, err := store.Verify("bio101", "alice-bio101", first, nil); err != nil || result != Pinned {
+		t.Errorf("expected a forgotten host to be pinned afresh, got %d, %v", result, err)
+	}
+
+	// The file is usable as an OpenSSH UserKnownHostsFile
+	data, err := os.ReadFile(store.Path("bio101"))
+	if err != nil {
+		t.Fatalf("failed to read known hosts: %v", err)
+	}
+	if !strings.Contains(string(data), "alice-bio101 ssh-ed25519 ") {
+		t.Errorf("expected a known_hosts line for alice, got:\n%s", data)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := newKey(t)
+	line := Format(key)
+	algorithm, blob, _ := strings.Cut(line, " ")
+
+	for _, tt := range []struct {
+		name      string
+		algorithm string
+		publicKey string
+	}{
+		{name: "blob with algorithm", algorithm: algorithm, publicKey: blob},
+		{name: "whole line", publicKey: line},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseKey(tt.algorithm, tt.publicKey)
+			if err != nil {
+				t.Fatalf("ParseKey failed: %v", err)
+			}
+			if Format(parsed) != line {
+				t.Errorf("expected %s, got %s", line, Format(parsed))
+			}
+		})
+	}
+
+	if _, err := ParseKey("ssh-ed25519", "not-a-key"); err == nil {
+		t.Error("expected an invalid key to fail")
+	}
+}
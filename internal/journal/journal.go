@@ -0,0 +1,395 @@
+// Package journal records the per-item progress of bulk operations so that an
+// interrupted run can be inspected and resumed.
+package journal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+// Operation states.
+const (
+	StatusRunning     = "running"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// Item states.
+const (
+	ItemPending   = "pending"
+	ItemRunning   = "running"
+	ItemSucceeded = "succeeded"
+	ItemFailed    = "failed"
+)
+
+// Item is the recorded state of a single item in an operation.
+type Item struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Operation is a journaled run of a bulk command. Its methods are safe for
+// concurrent use and save the journal after every change; all of them are
+// no-ops on a nil Operation so callers can run without a journal.
+type Operation struct {
+	ID        string            `json:"id"`
+	Command   string            `json:"command"`
+	Args      map[string]string `json:"args"`
+	Status    string            `json:"status"`
+	Items     []*Item           `json:"items"`
+	Resumes   int               `json:"resumes,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+
+	// Input is what the command read from files, such as the rows of a CSV
+	// file, so that resuming doesn't depend on the files being unchanged.
+	Input json.RawMessage `json:"input,omitempty"`
+
+	mu    sync.Mutex
+	store *Store
+}
+
+// Store keeps operation journals as JSON files in a directory.
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store under ~/.lfr-tools/operations.
+func NewStore() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return NewStoreAt(filepath.Join(homeDir, ".lfr-tools", "operations"))
+}
+
+// NewStoreAt creates a store in dir.
+func NewStoreAt(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create operations directory: %w", err)
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// Create starts a journal for a command run over items.
+func (s *Store) Create(command string, args map[string]string, items []string) (*Operation, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate operation ID: %w", err)
+	}
+
+	now := time.Now()
+	op := &Operation{
+		ID:        now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		Command:   command,
+		Args:      args,
+		Status:    StatusRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+		store:     s,
+	}
+	for _, name := range items {
+		op.Items = append(op.Items, &Item{Name: name, State: ItemPending, UpdatedAt: now})
+	}
+
+	if err := op.save(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// Load reads an operation by ID. A unique ID prefix is also accepted.
+func (s *Store) Load(id string) (*Operation, error) {
+	path := s.path(id)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		ops, err := s.List()
+		if err != nil {
+			return nil, err
+		}
+
+		var matches []string
+		for _, op := range ops {
+			if strings.HasPrefix(op.ID, id) {
+				matches = append(matches, op.ID)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("operation %s not found", id)
+		case 1:
+			path = s.path(matches[0])
+		default:
+			return nil, fmt.Errorf("operation ID %s is ambiguous: %s", id, strings.Join(matches, ", "))
+		}
+	}
+
+	return s.read(path)
+}
+
+// List returns all operations, most recent first.
+func (s *Store) List() ([]*Operation, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operations directory: %w", err)
+	}
+
+	var ops []*Operation
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		op, err := s.read(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			continue // Skip unreadable journals
+		}
+		ops = append(ops, op)
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].CreatedAt.After(ops[j].CreatedAt)
+	})
+
+	return ops, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *Store) read(path string) (*Operation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operation journal: %w", err)
+	}
+
+	var op Operation
+	if err := json.Unmarshal(data, &op); err != nil {
+		return nil, fmt.Errorf("failed to parse operation journal %s: %w", filepath.Base(path), err)
+	}
+	op.store = s
+
+	return &op, nil
+}
+
+// save writes the journal atomically. Callers must hold op.mu or own op exclusively.
+func (op *Operation) save() error {
+	data, err := json.MarshalIndent(op, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal operation journal: %w", err)
+	}
+
+	path := op.store.path(op.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write operation journal: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write operation journal: %w", err)
+	}
+
+	return nil
+}
+
+// saveLocked saves the journal, warning rather than failing the operation.
+func (op *Operation) saveLocked() {
+	op.UpdatedAt = time.Now()
+	if err := op.save(); err != nil {
+		fmt.Printf("⚠️  Warning: %v\n", err)
+	}
+}
+
+func (op *Operation) item(name string) *Item {
+	for _, item := range op.Items {
+		if item.Name == name {
+			return item
+		}
+	}
+
+	item := &Item{Name: name, State: ItemPending}
+	op.Items = append(op.Items, item)
+	return item
+}
+
+// Remaining filters items to those that have not yet succeeded.
+func (op *Operation) Remaining(items []string) []string {
+	if op == nil {
+		return items
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	var remaining []string
+	for _, name := range items {
+		if op.item(name).State != ItemSucceeded {
+			remaining = append(remaining, name)
+		}
+	}
+	return remaining
+}
+
+// Unfinished returns the names of items that have not succeeded.
+func (op *Operation) Unfinished() []string {
+	if op == nil {
+		return nil
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	var names []string
+	for _, item := range op.Items {
+		if item.State != ItemSucceeded {
+			names = append(names, item.Name)
+		}
+	}
+	return names
+}
+
+// Counts returns the number of items in each state.
+func (op *Operation) Counts() map[string]int {
+	counts := make(map[string]int)
+	if op == nil {
+		return counts
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	for _, item := range op.Items {
+		counts[item.State]++
+	}
+	return counts
+}
+
+// Resume marks a finished or interrupted operation as running again.
+func (op *Operation) Resume() {
+	if op == nil {
+		return
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.Status = StatusRunning
+	op.Resumes++
+	op.saveLocked()
+}
+
+// ItemStarted records that an item is being processed.
+func (op *Operation) ItemStarted(name string) {
+	if op == nil {
+		return
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	item := op.item(name)
+	item.State = ItemRunning
+	item.UpdatedAt = time.Now()
+	op.saveLocked()
+}
+
+// ItemFinished records the outcome of an item. Items that were never attempted
+// because the run was cancelled stay pending.
+func (op *Operation) ItemFinished(result utils.BulkResult) {
+	if op == nil {
+		return
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	item := op.item(result.Item)
+	item.UpdatedAt = time.Now()
+	item.Attempts += result.Attempts
+	switch {
+	case result.Err == nil:
+		item.State = ItemSucceeded
+		item.Error = ""
+	case result.Attempts == 0:
+		item.State = ItemPending
+	default:
+		item.State = ItemFailed
+		item.Error = result.Err.Error()
+	}
+	op.saveLocked()
+}
+
+// SetInput records the command's input.
+func (op *Operation) SetInput(v interface{}) error {
+	if op == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal operation input: %w", err)
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.Input = data
+	op.UpdatedAt = time.Now()
+	return op.save()
+}
+
+// DecodeInput reads the recorded input into v, returning an error if the
+// operation has none.
+func (op *Operation) DecodeInput(v interface{}) error {
+	if op == nil {
+		return fmt.Errorf("no operation journal")
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if len(op.Input) == 0 {
+		return fmt.Errorf("operation %s has no recorded input", op.ID)
+	}
+	if err := json.Unmarshal(op.Input, v); err != nil {
+		return fmt.Errorf("failed to parse input of operation %s: %w", op.ID, err)
+	}
+	return nil
+}
+
+// Finish sets the final status from the item states: interrupted if the run
+// was cancelled, failed if any item failed, and completed otherwise.
+func (op *Operation) Finish(interrupted bool) {
+	if op == nil {
+		return
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.Status = StatusCompleted
+	for _, item := range op.Items {
+		if item.State != ItemSucceeded {
+			op.Status = StatusFailed
+		}
+	}
+	if interrupted && op.Status != StatusCompleted {
+		op.Status = StatusInterrupted
+	}
+	op.saveLocked()
+}
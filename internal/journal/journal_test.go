@@ -0,0 +1,114 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/utils"
+)
+
+func TestOperationLifecycle(t *testing.T) {
+	store, err := NewStoreAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStoreAt failed: %v", err)
+	}
+
+	op, err := store.Create("users create-bulk", map[string]string{"csv": "class.csv"}, []string{"alice", "bob", "carol"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := op.SetInput([]utils.BulkUser{{Username: "alice", Project: "physics"}}); err != nil {
+		t.Fatalf("SetInput failed: %v", err)
+	}
+
+	op.ItemStarted("alice")
+	op.ItemFinished(utils.BulkResult{Item: "alice", Attempts: 1})
+	op.ItemStarted("bob")
+	op.ItemFinished(utils.BulkResult{Item: "bob", Attempts: 2, Err: errors.New("quota exceeded")})
+	op.ItemFinished(utils.BulkResult{Item: "carol", Err: context.Canceled})
+	op.Finish(true)
+
+	loaded, err := store.Load(op.ID)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if loaded.Status != StatusInterrupted {
+		t.Errorf("expected interrupted status, got %s", loaded.Status)
+	}
+	if loaded.Args["csv"] != "class.csv" {
+		t.Errorf("expected args to be saved, got %v", loaded.Args)
+	}
+	var users []utils.BulkUser
+	if err := loaded.DecodeInput(&users); err != nil || len(users) != 1 || users[0].Project != "physics" {
+		t.Errorf("expected the input to be saved, got %+v (%v)", users, err)
+	}
+
+	expected := map[string]string{"alice": ItemSucceeded, "bob": ItemFailed, "carol": ItemPending}
+	for _, item := range loaded.Items {
+		if item.State != expected[item.Name] {
+			t.Errorf("expected %s to be %s, got %s", item.Name, expected[item.Name], item.State)
+		}
+	}
+	if loaded.Items[1].Error != "quota exceeded" || loaded.Items[1].Attempts != 2 {
+		t.Errorf("unexpected failed item: %+v", loaded.Items[1])
+	}
+
+	remaining := loaded.Remaining([]string{"alice", "bob", "carol", "dave"})
+	if len(remaining) != 3 || remaining[0] != "bob" || remaining[2] != "dave" {
+		t.Errorf("expected bob, carol and dave to remain, got %v", remaining)
+	}
+
+	// Completing the remaining items completes the operation
+	loaded.Resume()
+	for _, name := range []string{"bob", "carol", "dave"} {
+		loaded.ItemFinished(utils.BulkResult{Item: name, Attempts: 1})
+	}
+	loaded.Finish(false)
+
+	if loaded.Status != StatusCompleted || loaded.Resumes != 1 {
+		t.Errorf("expected completed after one resume, got %s (%d)", loaded.Status, loaded.Resumes)
+	}
+}
+
+func TestStoreListAndLoadByPrefix(t *testing.T) {
+	store, err := NewStoreAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStoreAt failed: %v", err)
+	}
+
+	first, _ := store.Create("instances start", nil, []string{"a"})
+	if _, err := store.Load(first.ID[:15]); err != nil {
+		t.Fatalf("Load by unique prefix failed: %v", err)
+	}
+
+	_, _ = store.Create("instances stop", nil, []string{"b"})
+
+	ops, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(ops) != 2 {
+		t.Fatalf("expected 2 operations, got %d", len(ops))
+	}
+
+	if _, err := store.Load("missing"); err == nil {
+		t.Error("expected an error for a missing operation")
+	}
+	if _, err := store.Load("2"); err == nil {
+		t.Error("expected an error for an ambiguous prefix")
+	}
+}
+
+func TestNilOperationIsNoOp(t *testing.T) {
+	var op *Operation
+
+	op.ItemStarted("alice")
+	op.ItemFinished(utils.BulkResult{Item: "alice"})
+	op.Finish(false)
+
+	if got := op.Remaining([]string{"alice"}); len(got) != 1 {
+		t.Errorf("expected a nil operation to keep all items, got %v", got)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package keychain
+
+// NewMacOSKeychain returns the file keychain on other platforms, where the
+// macOS system keychain isn't available.
+func NewMacOSKeychain() KeychainService {
+	return NewFileKeychain()
+}
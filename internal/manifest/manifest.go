@@ -0,0 +1,202 @@
+// Package manifest defines the declarative project manifest used by lfr plan
+// and lfr apply, and computes the changes needed to converge live state on it.
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Manifest describes the desired state of a project.
+type Manifest struct {
+	Project   string `yaml:"project"`
+	Blueprint string `yaml:"blueprint"`
+	Bundle    string `yaml:"bundle"`
+	// Zone is the availability zone for new instances, defaulting to the
+	// region's first zone.
+	Zone string `yaml:"zone,omitempty"`
+	// Idle is the idle detection of users' instances. Existing instances are
+	// updated to match it.
+	Idle *Idle `yaml:"idle,omitempty"`
+	// Software packs are installed on every user's instance when it is created.
+	Software []string `yaml:"software,omitempty"`
+	Groups   []Group  `yaml:"groups,omitempty"`
+	EFS      []EFS    `yaml:"efs,omitempty"`
+	Users    []User   `yaml:"users"`
+}
+
+// Idle configures idle detection in minutes.
+type Idle struct {
+	Threshold int `yaml:"threshold"`
+	Duration  int `yaml:"duration"`
+}
+
+// Group is an IAM group.
+type Group struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Policies    []string `yaml:"policies,omitempty"`
+}
+
+// EFS is a shared file system mounted on every user's instance.
+type EFS struct {
+	Name       string `yaml:"name"`
+	MountPoint string `yaml:"mount_point"`
+	// Mode is "rw" (default) or "ro".
+	Mode string `yaml:"mode,omitempty"`
+}
+
+// User is an IAM user with their own instance.
+type User struct {
+	Name      string   `yaml:"name"`
+	Blueprint string   `yaml:"blueprint,omitempty"`
+	Bundle    string   `yaml:"bundle,omitempty"`
+	Groups    []string `yaml:"groups,omitempty"`
+	Software  []string `yaml:"software,omitempty"`
+	Disks     []Disk   `yaml:"disks,omitempty"`
+}
+
+// Disk is a block storage disk attached to a user's instance.
+type Disk struct {
+	Name   string `yaml:"name"`
+	SizeGB int32  `yaml:"size_gb"`
+	Path   string `yaml:"path"`
+}
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Load reads and validates a manifest file.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes and validates a manifest. Unknown fields are rejected so that
+// typos don't silently drop part of the desired state.
+func Parse(data []byte) (*Manifest, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var m Manifest
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate checks that the manifest is complete and consistent.
+func (m *Manifest) Validate() error {
+	if m.Project == "" {
+		return fmt.Errorf("manifest: project is required")
+	}
+	if m.Idle != nil && (m.Idle.Threshold <= 0 || m.Idle.Duration <= 0) {
+		return fmt.Errorf("manifest: idle threshold and duration must be positive")
+	}
+
+	groups := make(map[string]bool)
+	for _, group := range m.Groups {
+		if !namePattern.MatchString(group.Name) {
+			return fmt.Errorf("manifest: invalid group name %q", group.Name)
+		}
+		if groups[group.Name] {
+			return fmt.Errorf("manifest: duplicate group %s", group.Name)
+		}
+		groups[group.Name] = true
+	}
+
+	fileSystems := make(map[string]bool)
+	for _, fs := range m.EFS {
+		if fs.Name == "" || fs.MountPoint == "" {
+			return fmt.Errorf("manifest: efs entries need a name and mount_point")
+		}
+		if fs.Mode != "" && fs.Mode != "rw" && fs.Mode != "ro" {
+			return fmt.Errorf("manifest: efs %s mode must be rw or ro, got %s", fs.Name, fs.Mode)
+		}
+		if fileSystems[fs.Name] {
+			return fmt.Errorf("manifest: duplicate efs %s", fs.Name)
+		}
+		fileSystems[fs.Name] = true
+	}
+
+	users := make(map[string]bool)
+	disks := make(map[string]bool)
+	for _, user := range m.Users {
+		if !namePattern.MatchString(user.Name) {
+			return fmt.Errorf("manifest: invalid user name %q", user.Name)
+		}
+		if users[user.Name] {
+			return fmt.Errorf("manifest: duplicate user %s", user.Name)
+		}
+		users[user.Name] = true
+
+		if m.BlueprintFor(user) == "" || m.BundleFor(user) == "" {
+			return fmt.Errorf("manifest: user %s needs a blueprint and bundle (set them at the top level or on the user)", user.Name)
+		}
+
+		for _, disk := range user.Disks {
+			if !namePattern.MatchString(disk.Name) {
+				return fmt.Errorf("manifest: invalid disk name %q for user %s", disk.Name, user.Name)
+			}
+			if disks[disk.Name] {
+				return fmt.Errorf("manifest: duplicate disk %s", disk.Name)
+			}
+			disks[disk.Name] = true
+
+			if disk.SizeGB < 8 || disk.SizeGB > 16384 {
+				return fmt.Errorf("manifest: disk %s size must be between 8 and 16384 GB", disk.Name)
+			}
+			if disk.Path == "" {
+				return fmt.Errorf("manifest: disk %s needs a path", disk.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// BlueprintFor returns the blueprint for a user's instance.
+func (m *Manifest) BlueprintFor(user User) string {
+	if user.Blueprint != "" {
+		return user.Blueprint
+	}
+	return m.Blueprint
+}
+
+// BundleFor returns the bundle for a user's instance.
+func (m *Manifest) BundleFor(user User) string {
+	if user.Bundle != "" {
+		return user.Bundle
+	}
+	return m.Bundle
+}
+
+// InstanceName returns the name of a user's instance, following the
+// username-blueprint convention used by lfr users create.
+func (m *Manifest) InstanceName(user User) string {
+	return user.Name + "-" + m.BlueprintFor(user)
+}
+
+// SoftwareFor returns the packs to install on a user's instance.
+func (m *Manifest) SoftwareFor(user User) []string {
+	seen := make(map[string]bool)
+	var packs []string
+	for _, pack := range append(append([]string(nil), m.Software...), user.Software...) {
+		if !seen[pack] {
+			seen[pack] = true
+			packs = append(packs, pack)
+		}
+	}
+	return packs
+}
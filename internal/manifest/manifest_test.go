@@ -0,0 +1,197 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+const classManifest = `
+project: cs101
+blueprint: ubuntu_22_04
+bundle: small_3_0
+idle:
+  threshold: 60
+  duration: 15
+software: [python-dev]
+groups:
+  - name: cs101-tas
+    policies: [arn:aws:iam::aws:policy/ReadOnlyAccess]
+efs:
+  - name: cs101-shared
+    mount_point: /mnt/shared
+    mode: ro
+users:
+  - name: alice
+    groups: [cs101-tas]
+    disks:
+      - name: alice-data
+        size_gb: 32
+        path: /dev/xvdf
+  - name: bob
+    bundle: medium_3_0
+`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(classManifest))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	bob := m.Users[1]
+	if m.BundleFor(bob) != "medium_3_0" || m.BlueprintFor(bob) != "ubuntu_22_04" {
+		t.Errorf("expected bob to override only the bundle, got %s/%s", m.BlueprintFor(bob), m.BundleFor(bob))
+	}
+	if m.InstanceName(bob) != "bob-ubuntu_22_04" {
+		t.Errorf("unexpected instance name %s", m.InstanceName(bob))
+	}
+	if m.Idle == nil || m.Idle.Threshold != 60 || m.Idle.Duration != 15 {
+		t.Errorf("unexpected idle settings: %+v", m.Idle)
+	}
+}
+
+func TestParseRejectsInvalidManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		expected string
+	}{
+		{"missing project", "users: [{name: alice, blueprint: b, bundle: s}]", "project is required"},
+		{"unknown field", "project: p\nuserz: []", "userz"},
+		{"no bundle", "project: p\nblueprint: b\nusers: [{name: alice}]", "needs a blueprint and bundle"},
+		{"duplicate user", "project: p\nblueprint: b\nbundle: s\nusers: [{name: alice}, {name: alice}]", "duplicate user"},
+		{"small disk", "project: p\nblueprint: b\nbundle: s\nusers: [{name: alice, disks: [{name: d, size_gb: 4, path: /dev/xvdf}]}]", "between 8 and 16384"},
+		{"bad efs mode", "project: p\nefs: [{name: fs, mount_point: /mnt, mode: rx}]\nusers: []", "mode must be rw or ro"},
+		{"bad idle", "project: p\nidle: {threshold: 0, duration: 30}\nusers: []", "must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.manifest))
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func changeStrings(plan *Plan) []string {
+	var changes []string
+	for _, change := range plan.Changes {
+		changes = append(changes, change.Action+" "+change.Kind+" "+change.Name)
+	}
+	return changes
+}
+
+func TestDiffFromEmptyState(t *testing.T) {
+	m, _ := Parse([]byte(classManifest))
+
+	plan := Diff(m, NewState(), false)
+
+	expected := []string{
+		"create group cs101-tas",
+		"create efs cs101-shared",
+		"create user alice",
+		"create membership alice → cs101-tas",
+		"create disk alice-data",
+		"create software alice ← python-dev",
+		"create mount alice ← cs101-shared",
+		"create user bob",
+		"create software bob ← python-dev",
+		"create mount bob ← cs101-shared",
+	}
+	got := changeStrings(plan)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected plan:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestDiffAgainstLiveState(t *testing.T) {
+	m, _ := Parse([]byte(classManifest))
+
+	live := NewState()
+	live.Groups["cs101-tas"] = true
+	live.FileSystems["cs101-shared"] = "fs-123"
+	live.Users["alice"] = []string{"Lightsail-Users", "cs101-tas"}
+	live.Users["bob"] = []string{"Lightsail-Users"}
+	live.Users["carol"] = []string{"Lightsail-Users"}
+	live.Instances["alice"] = &types.Instance{Name: "alice-ubuntu_22_04", Blueprint: "ubuntu_22_04", Bundle: "small_3_0",
+		Idle: &types.IdleDetection{ThresholdMinutes: 60, DurationMinutes: 15}}
+	live.Instances["carol"] = &types.Instance{Name: "carol-ubuntu_22_04", Blueprint: "ubuntu_22_04", Bundle: "small_3_0"}
+	live.Disks["alice-data"] = &types.Disk{Name: "alice-data", SizeGB: 64, Tags: map[string]string{"Project": "cs101"}}
+	live.Disks["old-data"] = &types.Disk{Name: "old-data", SizeGB: 8, Tags: map[string]string{"Project": "cs101"}}
+	live.Disks["other-data"] = &types.Disk{Name: "other-data", SizeGB: 8, Tags: map[string]string{"Project": "bio200"}}
+
+	plan := Diff(m, live, false)
+
+	expected := []string{
+		"create attachment alice-data",
+		"manual disk alice-data",
+		"create instance bob-ubuntu_22_04",
+		"create software bob ← python-dev",
+		"create mount bob ← cs101-shared",
+	}
+	got := changeStrings(plan)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected plan:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+	if strings.Join(plan.Unmanaged, ",") != "user carol,disk old-data" {
+		t.Errorf("unexpected unmanaged resources: %v", plan.Unmanaged)
+	}
+
+	pruned := Diff(m, live, true)
+	if pruned.Count(ActionDelete) != 2 || len(pruned.Unmanaged) != 0 {
+		t.Errorf("expected carol and old-data to be deleted when pruning, got %v", changeStrings(pruned))
+	}
+}
+
+func TestDiffReportsInstanceDrift(t *testing.T) {
+	m, _ := Parse([]byte("project: p\nblueprint: ubuntu_22_04\nbundle: medium_3_0\nusers: [{name: alice}]"))
+
+	live := NewState()
+	live.Users["alice"] = []string{"Lightsail-Users"}
+	live.Instances["alice"] = &types.Instance{Name: "alice-ubuntu_22_04", Blueprint: "ubuntu_22_04", Bundle: "small_3_0"}
+
+	plan := Diff(m, live, false)
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != ActionManual || !plan.Empty() {
+		t.Fatalf("expected a single manual change, got %v", changeStrings(plan))
+	}
+	if !strings.Contains(plan.Changes[0].Detail, "lfr instances resize") {
+		t.Errorf("expected the drift to point at resize, got %s", plan.Changes[0].Detail)
+	}
+}
+
+func TestDiffRepairsUsersAndIdleDetection(t *testing.T) {
+	m, _ := Parse([]byte("project: p\nblueprint: ubuntu_22_04\nbundle: small_3_0\nidle: {threshold: 60, duration: 15}\nusers: [{name: alice}, {name: bob}]"))
+
+	live := NewState()
+	// alice's IAM user was deleted, but not her instance
+	live.Instances["alice"] = &types.Instance{Name: "alice-ubuntu_22_04", Blueprint: "ubuntu_22_04", Bundle: "small_3_0",
+		Idle: &types.IdleDetection{ThresholdMinutes: 60, DurationMinutes: 15}}
+	// bob left the users group and his instance has the default idle settings
+	live.Users["bob"] = nil
+	live.Instances["bob"] = &types.Instance{Name: "bob-ubuntu_22_04", Blueprint: "ubuntu_22_04", Bundle: "small_3_0",
+		Idle: &types.IdleDetection{ThresholdMinutes: 120, DurationMinutes: 30}}
+	// carol is a project user without an instance
+	live.Users["carol"] = nil
+
+	plan := Diff(m, live, true)
+
+	expected := []string{
+		"create user alice",
+		"update idle bob-ubuntu_22_04",
+		"create membership bob → Lightsail-Users",
+		"delete user carol",
+	}
+	got := changeStrings(plan)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected plan:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+	if detail := plan.Changes[0].Detail; detail != "for existing instance alice-ubuntu_22_04" {
+		t.Errorf("expected alice to reuse her instance, got %q", detail)
+	}
+	if detail := plan.Changes[1].Detail; detail != "idle detection is 120 min threshold, 30 min duration, manifest has 60 min threshold, 15 min duration" {
+		t.Errorf("unexpected idle detail %q", detail)
+	}
+}
@@ -0,0 +1,296 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// Change actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	// ActionManual marks drift that apply can't fix in place.
+	ActionManual = "manual"
+)
+
+// Change kinds.
+const (
+	KindGroup      = "group"
+	KindEFS        = "efs"
+	KindUser       = "user"
+	KindInstance   = "instance"
+	KindMembership = "membership"
+	KindDisk       = "disk"
+	KindAttachment = "attachment"
+	KindSoftware   = "software"
+	KindMount      = "mount"
+	KindIdle       = "idle"
+)
+
+// UsersGroup is the IAM group every user joins for read access to Lightsail.
+const UsersGroup = "Lightsail-Users"
+
+// State is the live state of a project relevant to a manifest.
+type State struct {
+	// Users are the existing IAM users and the groups they belong to. Project
+	// users that aren't in the manifest are included without their groups.
+	Users map[string][]string
+	// Groups are the existing IAM groups.
+	Groups map[string]bool
+	// Instances are the project's instances by username.
+	Instances map[string]*types.Instance
+	// Disks are the existing disks by name.
+	Disks map[string]*types.Disk
+	// FileSystems are the project's EFS file system IDs by name.
+	FileSystems map[string]string
+}
+
+// NewState returns an empty state.
+func NewState() *State {
+	return &State{
+		Users:       make(map[string][]string),
+		Groups:      make(map[string]bool),
+		Instances:   make(map[string]*types.Instance),
+		Disks:       make(map[string]*types.Disk),
+		FileSystems: make(map[string]string),
+	}
+}
+
+// Change is one step needed to converge live state on the manifest.
+type Change struct {
+	Action string
+	Kind   string
+	Name   string
+	Detail string
+
+	// The manifest entries the change applies to, where relevant.
+	User  *User
+	Group *Group
+	Disk  *Disk
+	EFS   *EFS
+	Pack  string
+}
+
+// String describes the change for plan output.
+func (c Change) String() string {
+	symbol := map[string]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-", ActionManual: "!"}[c.Action]
+	s := fmt.Sprintf("%s %s %s", symbol, c.Kind, c.Name)
+	if c.Detail != "" {
+		s += ": " + c.Detail
+	}
+	return s
+}
+
+// Plan is the ordered list of changes for a manifest.
+type Plan struct {
+	Changes []Change
+	// Unmanaged are project users and disks that are not in the manifest.
+	// They are only deleted when pruning.
+	Unmanaged []string
+}
+
+// Count returns the number of changes with an action.
+func (p *Plan) Count(action string) int {
+	n := 0
+	for _, change := range p.Changes {
+		if change.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Empty reports whether there is nothing for apply to do.
+func (p *Plan) Empty() bool {
+	return p.Count(ActionCreate)+p.Count(ActionUpdate)+p.Count(ActionDelete) == 0
+}
+
+// Diff computes the changes that converge live state on the manifest. Changes
+// are ordered so that each one only depends on earlier ones. Resources not in
+// the manifest are deleted only if prune is set.
+func Diff(m *Manifest, live *State, prune bool) *Plan {
+	plan := &Plan{}
+	add := func(change Change) {
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	for i := range m.Groups {
+		group := &m.Groups[i]
+		if !live.Groups[group.Name] {
+			add(Change{Action: ActionCreate, Kind: KindGroup, Name: group.Name, Group: group})
+		}
+	}
+
+	for i := range m.EFS {
+		fs := &m.EFS[i]
+		if _, ok := live.FileSystems[fs.Name]; !ok {
+			add(Change{Action: ActionCreate, Kind: KindEFS, Name: fs.Name, EFS: fs})
+		}
+	}
+
+	wantDisks := make(map[string]bool)
+	for i := range m.Users {
+		user := &m.Users[i]
+		instanceName := m.InstanceName(*user)
+		blueprint, bundle := m.BlueprintFor(*user), m.BundleFor(*user)
+
+		groups, userExists := live.Users[user.Name]
+		instance := live.Instances[user.Name]
+
+		newInstance := false
+		switch {
+		case !userExists && instance == nil:
+			add(Change{Action: ActionCreate, Kind: KindUser, Name: user.Name, User: user,
+				Detail: fmt.Sprintf("with instance %s (%s, %s)", instanceName, blueprint, bundle)})
+			newInstance = true
+		case instance == nil:
+			add(Change{Action: ActionCreate, Kind: KindInstance, Name: instanceName, User: user,
+				Detail: fmt.Sprintf("%s, %s for existing user %s", blueprint, bundle, user.Name)})
+			newInstance = true
+		default:
+			if !userExists {
+				// Only the IAM user was deleted, so it is recreated for the
+				// instance that is still there
+				add(Change{Action: ActionCreate, Kind: KindUser, Name: user.Name, User: user,
+					Detail: fmt.Sprintf("for existing instance %s", instance.Name)})
+			}
+			if instance.Blueprint != blueprint {
+				add(Change{Action: ActionManual, Kind: KindInstance, Name: instance.Name, User: user,
+					Detail: fmt.Sprintf("blueprint is %s, manifest has %s; recreate the instance", instance.Blueprint, blueprint)})
+			}
+			if instance.Bundle != bundle {
+				add(Change{Action: ActionManual, Kind: KindInstance, Name: instance.Name, User: user,
+					Detail: fmt.Sprintf("bundle is %s, manifest has %s; use lfr instances resize", instance.Bundle, bundle)})
+			}
+			if m.Idle != nil && !idleMatches(instance.Idle, m.Idle) {
+				add(Change{Action: ActionUpdate, Kind: KindIdle, Name: instance.Name, User: user,
+					Detail: fmt.Sprintf("idle detection is %s, manifest has %s", describeIdle(instance.Idle), describeIdle(&types.IdleDetection{
+						ThresholdMinutes: m.Idle.Threshold, DurationMinutes: m.Idle.Duration}))})
+			}
+			instanceName = instance.Name
+		}
+
+		// New users join the users group when they are created
+		if userExists && !contains(groups, UsersGroup) {
+			add(Change{Action: ActionCreate, Kind: KindMembership, Name: user.Name + " → " + UsersGroup, User: user,
+				Group: &Group{Name: UsersGroup}})
+		}
+		for _, group := range user.Groups {
+			if !contains(groups, group) {
+				add(Change{Action: ActionCreate, Kind: KindMembership, Name: user.Name + " → " + group, User: user,
+					Group: &Group{Name: group}})
+			}
+		}
+
+		for j := range user.Disks {
+			disk := &user.Disks[j]
+			wantDisks[disk.Name] = true
+
+			existing := live.Disks[disk.Name]
+			switch {
+			case existing == nil:
+				add(Change{Action: ActionCreate, Kind: KindDisk, Name: disk.Name, User: user, Disk: disk,
+					Detail: fmt.Sprintf("%d GB at %s on %s", disk.SizeGB, disk.Path, instanceName)})
+			case existing.AttachedTo == "":
+				add(Change{Action: ActionCreate, Kind: KindAttachment, Name: disk.Name, User: user, Disk: disk,
+					Detail: fmt.Sprintf("attach at %s on %s", disk.Path, instanceName)})
+			case existing.AttachedTo != instanceName:
+				add(Change{Action: ActionManual, Kind: KindAttachment, Name: disk.Name, User: user, Disk: disk,
+					Detail: fmt.Sprintf("attached to %s, manifest has %s", existing.AttachedTo, instanceName)})
+			}
+			if existing != nil && existing.SizeGB != disk.SizeGB {
+				add(Change{Action: ActionManual, Kind: KindDisk, Name: disk.Name, User: user, Disk: disk,
+					Detail: fmt.Sprintf("size is %d GB, manifest has %d GB; disks can't be resized", existing.SizeGB, disk.SizeGB)})
+			}
+		}
+
+		// Software and mounts are only set up on new instances, as their
+		// state on existing instances isn't tracked.
+		if newInstance {
+			for _, pack := range m.SoftwareFor(*user) {
+				add(Change{Action: ActionCreate, Kind: KindSoftware, Name: user.Name + " ← " + pack, User: user, Pack: pack})
+			}
+			for k := range m.EFS {
+				fs := &m.EFS[k]
+				add(Change{Action: ActionCreate, Kind: KindMount, Name: user.Name + " ← " + fs.Name, User: user, EFS: fs,
+					Detail: fs.MountPoint})
+			}
+		}
+	}
+
+	wantUsers := make(map[string]bool)
+	for _, user := range m.Users {
+		wantUsers[user.Name] = true
+	}
+
+	// Project users may have lost their instance, and instances their user
+	liveUsers := sortedKeys(live.Users)
+	for _, username := range sortedKeys(live.Instances) {
+		if _, ok := live.Users[username]; !ok {
+			liveUsers = append(liveUsers, username)
+		}
+	}
+	sort.Strings(liveUsers)
+
+	for _, username := range liveUsers {
+		if wantUsers[username] {
+			continue
+		}
+		if prune {
+			change := Change{Action: ActionDelete, Kind: KindUser, Name: username}
+			if instance := live.Instances[username]; instance != nil {
+				change.Detail = fmt.Sprintf("and instance %s", instance.Name)
+			}
+			add(change)
+		} else {
+			plan.Unmanaged = append(plan.Unmanaged, "user "+username)
+		}
+	}
+
+	for _, name := range sortedKeys(live.Disks) {
+		disk := live.Disks[name]
+		if wantDisks[name] || disk.Tags["Project"] != m.Project {
+			continue
+		}
+		if prune {
+			add(Change{Action: ActionDelete, Kind: KindDisk, Name: name, Detail: fmt.Sprintf("%d GB", disk.SizeGB)})
+		} else {
+			plan.Unmanaged = append(plan.Unmanaged, "disk "+name)
+		}
+	}
+
+	return plan
+}
+
+// idleMatches reports whether an instance's idle detection has the manifest's settings.
+func idleMatches(live *types.IdleDetection, want *Idle) bool {
+	return live != nil && live.ThresholdMinutes == want.Threshold && live.DurationMinutes == want.Duration
+}
+
+func describeIdle(idle *types.IdleDetection) string {
+	if idle == nil {
+		return "off"
+	}
+	return fmt.Sprintf("%d min threshold, %d min duration", idle.ThresholdMinutes, idle.DurationMinutes)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
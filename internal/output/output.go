@@ -0,0 +1,181 @@
+// Package output renders command results as JSON, YAML, CSV or a Go template
+// for scripts and automation.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Format is an output format.
+type Format string
+
+// Supported output formats. FormatTable is the human-readable default that
+// each command prints itself.
+const (
+	FormatTable    Format = "table"
+	FormatJSON     Format = "json"
+	FormatYAML     Format = "yaml"
+	FormatCSV      Format = "csv"
+	FormatTemplate Format = "template"
+)
+
+// Formats lists the supported output formats.
+var Formats = []Format{FormatTable, FormatJSON, FormatYAML, FormatCSV, FormatTemplate}
+
+// Options selects the output format.
+type Options struct {
+	Format Format
+	// Template is the Go template used with FormatTemplate.
+	Template string
+}
+
+// Table is the flat form of a result used for CSV output.
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// NewTable creates a table with the given columns.
+func NewTable(columns ...string) *Table {
+	return &Table{Columns: columns}
+}
+
+// AddRow appends a row, formatting each value with fmt.Sprint.
+func (t *Table) AddRow(values ...interface{}) {
+	row := make([]string, len(values))
+	for i, value := range values {
+		row[i] = fmt.Sprint(value)
+	}
+	t.Rows = append(t.Rows, row)
+}
+
+// Renderer writes results in a machine-readable format.
+type Renderer struct {
+	w      io.Writer
+	format Format
+	tmpl   *template.Template
+}
+
+// NewRenderer creates a renderer, validating the format and parsing the template.
+// An empty format selects FormatTable, or FormatTemplate if a template is given.
+func NewRenderer(w io.Writer, opts Options) (*Renderer, error) {
+	format := Format(strings.ToLower(string(opts.Format)))
+	if format == "" {
+		format = FormatTable
+		if opts.Template != "" {
+			format = FormatTemplate
+		}
+	}
+
+	r := &Renderer{w: w, format: format}
+	switch format {
+	case FormatTable, FormatJSON, FormatYAML, FormatCSV:
+		if opts.Template != "" {
+			return nil, fmt.Errorf("--template can only be used with --output template")
+		}
+	case FormatTemplate:
+		if opts.Template == "" {
+			return nil, fmt.Errorf("--output template requires --template")
+		}
+		tmpl, err := template.New("output").Funcs(templateFuncs).Parse(opts.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+		r.tmpl = tmpl
+	default:
+		names := make([]string, len(Formats))
+		for i, f := range Formats {
+			names[i] = string(f)
+		}
+		return nil, fmt.Errorf("unsupported output format %q (must be one of: %s)", opts.Format, strings.Join(names, ", "))
+	}
+
+	return r, nil
+}
+
+// templateFuncs are the extra functions available to --template.
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Format returns the selected format.
+func (r *Renderer) Format() Format {
+	return r.format
+}
+
+// Structured reports whether results should be rendered by Render rather than
+// printed as the command's own table.
+func (r *Renderer) Structured() bool {
+	return r.format != FormatTable
+}
+
+// Render writes data in the selected format. table is only called for CSV
+// output. Nil slices are rendered as empty lists so that consumers always
+// receive a list.
+func (r *Renderer) Render(data interface{}, table func() *Table) error {
+	data = emptyIfNil(data)
+
+	switch r.format {
+	case FormatJSON:
+		encoder := json.NewEncoder(r.w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+	case FormatYAML:
+		encoder := yaml.NewEncoder(r.w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(data); err != nil {
+			return fmt.Errorf("failed to encode YAML: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return fmt.Errorf("failed to encode YAML: %w", err)
+		}
+	case FormatCSV:
+		if err := writeCSV(r.w, table()); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	case FormatTemplate:
+		if err := r.tmpl.Execute(r.w, data); err != nil {
+			return fmt.Errorf("failed to execute template: %w", err)
+		}
+	default:
+		return fmt.Errorf("format %s must be printed by the command", r.format)
+	}
+
+	return nil
+}
+
+func writeCSV(w io.Writer, table *Table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(table.Columns); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(table.Rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// emptyIfNil replaces a nil slice with an empty one of the same type.
+func emptyIfNil(data interface{}) interface{} {
+	v := reflect.ValueOf(data)
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	}
+	return data
+}
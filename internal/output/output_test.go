@@ -0,0 +1,103 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type server struct {
+	Name  string `json:"name" yaml:"name"`
+	State string `json:"state" yaml:"state"`
+}
+
+var servers = []server{{"web-1", "running"}, {"db, primary", "stopped"}}
+
+func serverTable() *Table {
+	table := NewTable("name", "state")
+	for _, s := range servers {
+		table.AddRow(s.Name, s.State)
+	}
+	return table
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"json", Options{Format: FormatJSON}, []string{`"name": "web-1"`, `"state": "stopped"`}},
+		{"yaml", Options{Format: FormatYAML}, []string{"web-1", "stopped"}},
+		{"csv", Options{Format: FormatCSV}, []string{"name,state\n", "web-1,running\n", "\"db, primary\",stopped\n"}},
+		{"template", Options{Format: FormatTemplate, Template: `{{range .}}{{.Name}}={{upper .State}};{{end}}`}, []string{"web-1=RUNNING;db, primary=STOPPED;"}},
+		{"format is case-insensitive", Options{Format: "JSON"}, []string{`"name": "web-1"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			r, err := NewRenderer(&buf, tt.opts)
+			if err != nil {
+				t.Fatalf("NewRenderer failed: %v", err)
+			}
+			if !r.Structured() {
+				t.Fatal("expected a structured renderer")
+			}
+
+			if err := r.Render(servers, serverTable); err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRenderNilSliceAsEmptyList(t *testing.T) {
+	var buf bytes.Buffer
+	r, _ := NewRenderer(&buf, Options{Format: FormatJSON})
+
+	var none []server
+	if err := r.Render(none, serverTable); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	var decoded []server
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded == nil {
+		t.Errorf("expected an empty JSON list, got %q", buf.String())
+	}
+}
+
+func TestNewRendererValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       Options
+		expectErr  bool
+		structured bool
+	}{
+		{"default is table", Options{}, false, false},
+		{"table", Options{Format: FormatTable}, false, false},
+		{"template implied by template text", Options{Template: "{{.}}"}, false, true},
+		{"unknown format", Options{Format: "xml"}, true, false},
+		{"template without text", Options{Format: FormatTemplate}, true, false},
+		{"template text with other format", Options{Format: FormatJSON, Template: "{{.}}"}, true, false},
+		{"invalid template", Options{Format: FormatTemplate, Template: "{{.Name"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRenderer(&bytes.Buffer{}, tt.opts)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error=%v, got %v", tt.expectErr, err)
+			}
+			if err == nil && r.Structured() != tt.structured {
+				t.Errorf("expected structured=%v for format %s", tt.structured, r.Format())
+			}
+		})
+	}
+}
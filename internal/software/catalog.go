@@ -0,0 +1,305 @@
+package software
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// ErrPackNotFound is returned when no catalog has a pack.
+var ErrPackNotFound = errors.New("software pack not found")
+
+// Catalog is a source of software packs, such as the builtin packs, a local
+// directory or a shared S3 prefix.
+type Catalog interface {
+	// Name identifies the catalog in listings.
+	Name() string
+	// Packs returns every version of every pack in the catalog. A catalog
+	// that can only read some of its packs returns them with an error.
+	Packs(ctx context.Context) ([]*types.SoftwarePack, error)
+}
+
+// staticCatalog is a fixed set of packs.
+type staticCatalog struct {
+	name  string
+	packs []*types.SoftwarePack
+}
+
+// NewStaticCatalog creates a catalog of a fixed set of packs.
+func NewStaticCatalog(name string, packs []*types.SoftwarePack) Catalog {
+	return &staticCatalog{name: name, packs: packs}
+}
+
+func (c *staticCatalog) Name() string { return c.name }
+
+func (c *staticCatalog) Packs(ctx context.Context) ([]*types.SoftwarePack, error) {
+	return c.packs, nil
+}
+
+// DirCatalog is a directory of pack files, in JSON or YAML.
+type DirCatalog struct {
+	Dir string
+}
+
+// Name implements Catalog.
+func (c *DirCatalog) Name() string { return c.Dir }
+
+// Packs implements Catalog. A missing directory has no packs.
+func (c *DirCatalog) Packs(ctx context.Context) ([]*types.SoftwarePack, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pack directory: %w", err)
+	}
+
+	var packs []*types.SoftwarePack
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() || !IsPackFile(entry.Name()) {
+			continue
+		}
+		pack, err := LoadPack(filepath.Join(c.Dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		packs = append(packs, pack)
+	}
+	return packs, errors.Join(errs...)
+}
+
+// IsPackFile reports whether a file name has a pack file extension.
+func IsPackFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// LoadPack reads a pack file.
+func LoadPack(path string) (*types.SoftwarePack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pack file: %w", err)
+	}
+
+	pack, err := ParsePack(data, filepath.Ext(path) == ".json")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pack, nil
+}
+
+// ParsePack parses a pack definition in JSON or, unless isJSON, YAML, and
+// checks that it has an ID.
+func ParsePack(data []byte, isJSON bool) (*types.SoftwarePack, error) {
+	var pack types.SoftwarePack
+	if isJSON {
+		if err := json.Unmarshal(data, &pack); err != nil {
+			return nil, fmt.Errorf("failed to parse pack: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &pack); err != nil {
+			return nil, fmt.Errorf("failed to parse pack: %w", err)
+		}
+	}
+
+	if !packID.MatchString(pack.ID) {
+		return nil, fmt.Errorf("invalid pack ID %q", pack.ID)
+	}
+	return &pack, nil
+}
+
+// Entry is a version of a pack and the catalog it came from.
+type Entry struct {
+	Pack    *types.SoftwarePack `json:"pack" yaml:"pack"`
+	Catalog string              `json:"catalog" yaml:"catalog"`
+}
+
+// Index merges catalogs. When catalogs have the same version of a pack, the
+// first one's is used, and a different definition in a later catalog is
+// reported in Warnings.
+type Index struct {
+	// byID holds each pack's versions, newest first.
+	byID map[string][]Entry
+	// Warnings describe catalogs or packs that couldn't be read.
+	Warnings []string
+}
+
+// NewIndex reads catalogs into an index. Catalogs that can't be read are
+// reported in Warnings rather than failing, so that packs from the others
+// can still be installed.
+func NewIndex(ctx context.Context, catalogs ...Catalog) *Index {
+	x := &Index{byID: make(map[string][]Entry)}
+
+	for _, catalog := range catalogs {
+		packs, err := catalog.Packs(ctx)
+		if err != nil {
+			x.Warnings = append(x.Warnings, fmt.Sprintf("%s: %v", catalog.Name(), err))
+		}
+		for _, pack := range packs {
+			if existing := x.find(pack.ID, pack.Version); existing != nil {
+				if !samePack(existing.Pack, pack) {
+					x.Warnings = append(x.Warnings, fmt.Sprintf("%s: %s %s differs from the one in %s, which is used",
+						catalog.Name(), pack.ID, pack.Version, existing.Catalog))
+				}
+				continue
+			}
+			x.byID[pack.ID] = append(x.byID[pack.ID], Entry{Pack: pack, Catalog: catalog.Name()})
+		}
+	}
+
+	for _, entries := range x.byID {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return CompareVersions(entries[i].Pack.Version, entries[j].Pack.Version) > 0
+		})
+	}
+	return x
+}
+
+// samePack reports whether two packs have the same definition.
+func samePack(a, b *types.SoftwarePack) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+func (x *Index) find(id, version string) *Entry {
+	for i, entry := range x.byID[id] {
+		if entry.Pack.Version == version {
+			return &x.byID[id][i]
+		}
+	}
+	return nil
+}
+
+// ParseRef splits a pack reference such as python-dev@1.1 into its ID and
+// pinned version, which is empty if it isn't pinned.
+func ParseRef(ref string) (id, version string) {
+	id, version, _ = strings.Cut(ref, "@")
+	return id, version
+}
+
+// Lookup returns the pack a reference names: the pinned version, or the
+// newest version if it isn't pinned.
+func (x *Index) Lookup(ref string) (*types.SoftwarePack, error) {
+	id, version := ParseRef(ref)
+
+	entries := x.byID[id]
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPackNotFound, id)
+	}
+	if version == "" {
+		return entries[0].Pack, nil
+	}
+
+	if entry := x.find(id, version); entry != nil {
+		return entry.Pack, nil
+	}
+
+	var versions []string
+	for _, entry := range entries {
+		versions = append(versions, entry.Pack.Version)
+	}
+	return nil, fmt.Errorf("%w: %s has no version %s (available: %s)", ErrPackNotFound, id, version, strings.Join(versions, ", "))
+}
+
+// IDs returns the IDs of every pack, sorted.
+func (x *Index) IDs() []string {
+	ids := make([]string, 0, len(x.byID))
+	for id := range x.byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// CatalogOf returns the name of the catalog a pack from the index came from,
+// or "" if it isn't from the index.
+func (x *Index) CatalogOf(pack *types.SoftwarePack) string {
+	for _, entry := range x.byID[pack.ID] {
+		if entry.Pack == pack {
+			return entry.Catalog
+		}
+	}
+	return ""
+}
+
+// Versions returns every version of a pack, newest first.
+func (x *Index) Versions(id string) []Entry {
+	return x.byID[id]
+}
+
+// Search returns the newest version of each pack whose ID, name,
+// description, category or tags contain query, ignoring case, sorted by ID.
+// An empty query matches every pack.
+func (x *Index) Search(query string) []Entry {
+	query = strings.ToLower(query)
+
+	var results []Entry
+	for _, id := range x.IDs() {
+		entry := x.byID[id][0]
+		pack := entry.Pack
+
+		fields := append([]string{pack.ID, pack.Name, pack.Description, pack.Category}, pack.Tags...)
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), query) {
+				results = append(results, entry)
+				break
+			}
+		}
+	}
+	return results
+}
+
+// CompareVersions compares two versions a dot or dash separated part at a
+// time, numerically where both parts are numbers, returning -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(strings.TrimPrefix(v, "v"), func(r rune) bool { return r == '.' || r == '-' })
+	}
+	pa, pb := split(a), split(b)
+
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+
+		nx, errX := strconv.Atoi(x)
+		ny, errY := strconv.Atoi(y)
+		switch {
+		case errX == nil && errY == nil:
+			if nx != ny {
+				return compare(nx < ny)
+			}
+		case x != y:
+			return compare(x < y)
+		}
+	}
+	return 0
+}
+
+func compare(less bool) int {
+	if less {
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,172 @@
+package software
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+func versioned(id, version string, deps ...string) *types.SoftwarePack {
+	return &types.SoftwarePack{ID: id, Name: id, Version: version, Dependencies: deps}
+}
+
+func TestIndex(t *testing.T) {
+	local := versioned("python-dev", "1.0")
+	local.Description = "local copy"
+	builtin := versioned("python-dev", "1.0")
+	index := NewIndex(context.Background(),
+		NewStaticCatalog("builtin", []*types.SoftwarePack{builtin}),
+		NewStaticCatalog("shared", []*types.SoftwarePack{
+			versioned("python-dev", "1.10"),
+			versioned("python-dev", "1.2"),
+			versioned("python-dev", "1.0"),
+			{ID: "r-stats", Name: "R", Version: "2.0", Category: "data-science", Tags: []string{"statistics"}},
+		}),
+		NewStaticCatalog("local", []*types.SoftwarePack{local}),
+	)
+
+	var versions []string
+	for _, entry := range index.Versions("python-dev") {
+		versions = append(versions, entry.Pack.Version+"="+entry.Catalog)
+	}
+	if got := strings.Join(versions, ","); got != "1.10=shared,1.2=shared,1.0=builtin" {
+		t.Errorf("expected versions newest first with the first catalog winning, got %s", got)
+	}
+	// The shared copy of 1.0 is the same as the builtin one; the local one isn't
+	if got := strings.Join(index.Warnings, "; "); got != "local: python-dev 1.0 differs from the one in builtin, which is used" {
+		t.Errorf("expected only the different local copy to be reported, got %q", got)
+	}
+	if got := index.CatalogOf(builtin); got != "builtin" {
+		t.Errorf("expected builtin's 1.0 to come from builtin, got %q", got)
+	}
+	if got := index.CatalogOf(local); got != "" {
+		t.Errorf("expected the shadowed local copy not to be in the index, got %q", got)
+	}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "python-dev", want: "1.10"},
+		{ref: "python-dev@1.2", want: "1.2"},
+		{ref: "python-dev@1.0", want: "1.0"},
+		{ref: "python-dev@3.0", wantErr: "python-dev has no version 3.0 (available: 1.10, 1.2, 1.0)"},
+		{ref: "nope", wantErr: "software pack not found: nope"},
+	}
+	for _, tt := range tests {
+		pack, err := index.Lookup(tt.ref)
+		if tt.wantErr != "" {
+			if !errors.Is(err, ErrPackNotFound) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Lookup(%s): expected error containing %q, got %v", tt.ref, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || pack.Version != tt.want {
+			t.Errorf("Lookup(%s): expected version %s, got %v, %v", tt.ref, tt.want, pack, err)
+		}
+	}
+	if pack, _ := index.Lookup("python-dev@1.0"); pack != builtin {
+		t.Errorf("expected the builtin 1.0, got %q", pack.Description)
+	}
+
+	for query, want := range map[string]string{
+		"":           "python-dev,r-stats",
+		"STATISTICS": "r-stats",
+		"data":       "r-stats",
+		"python":     "python-dev",
+		"fortran":    "",
+	} {
+		var ids []string
+		for _, entry := range index.Search(query) {
+			ids = append(ids, entry.Pack.ID)
+		}
+		if got := strings.Join(ids, ","); got != want {
+			t.Errorf("Search(%q): expected %s, got %s", query, want, got)
+		}
+	}
+}
+
+func TestResolvePinnedVersions(t *testing.T) {
+	index := NewIndex(context.Background(), NewStaticCatalog("test", []*types.SoftwarePack{
+		versioned("python-dev", "1.0"),
+		versioned("python-dev", "1.1"),
+		versioned("data-science", "1.0", "python-dev@1.0"),
+		versioned("notebooks", "1.0", "python-dev"),
+	}))
+
+	packs, err := Resolve([]string{"data-science", "notebooks"}, index.Lookup)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if packs[0].ID != "python-dev" || packs[0].Version != "1.0" || len(packs) != 3 {
+		t.Errorf("expected the pinned python-dev 1.0 to satisfy both, got %v", packs)
+	}
+
+	_, err = Resolve([]string{"python-dev", "data-science"}, index.Lookup)
+	if !errors.Is(err, ErrVersionConflict) || !strings.Contains(err.Error(), "python-dev is needed at 1.0 by 'data-science' but 1.1 was already chosen") {
+		t.Errorf("expected a version conflict, got %v", err)
+	}
+}
+
+func TestDirCatalog(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"stats.yaml":  "id: stats\nname: Stats\nversion: \"1.0\"\npackages:\n  - name: r-base\n    source: apt\n",
+		"web.json":    `{"id": "web", "name": "Web", "version": "2.0"}`,
+		"notes.txt":   "not a pack",
+		"broken.json": `{"id": `,
+		"noid.yml":    "name: No ID\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	packs, err := (&DirCatalog{Dir: dir}).Packs(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "broken.json") || !strings.Contains(err.Error(), `invalid pack ID ""`) {
+		t.Errorf("expected errors for the broken and ID-less packs, got %v", err)
+	}
+
+	var ids []string
+	for _, pack := range packs {
+		ids = append(ids, pack.ID)
+	}
+	if got := strings.Join(ids, ","); got != "stats,web" {
+		t.Errorf("expected the readable packs, got %s", got)
+	}
+	if packs[0].Packages[0].Name != "r-base" {
+		t.Errorf("expected YAML packages to be parsed, got %+v", packs[0].Packages)
+	}
+
+	packs, err = (&DirCatalog{Dir: filepath.Join(dir, "missing")}).Packs(context.Background())
+	if err != nil || len(packs) != 0 {
+		t.Errorf("expected a missing directory to have no packs, got %v, %v", packs, err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.2", "1.10", -1},
+		{"2.0", "1.10", 1},
+		{"1.0", "1.0.1", -1},
+		{"v1.1", "1.1", 0},
+		{"1.0-beta", "1.0-alpha", 1},
+		{"", "1.0", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package software
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// Container runtimes.
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+// ContainerEnvDir is the directory on an instance holding each container
+// pack's environment file, readable only by root.
+const ContainerEnvDir = "/etc/lfr-tools/containers"
+
+// ContainerService is the systemd service a container pack runs as.
+func ContainerService(id string) string {
+	return "lfr-" + id + ".service"
+}
+
+// containerName is the name of a container pack's container.
+func containerName(id string) string {
+	return "lfr-" + id
+}
+
+// runtimeOf returns a container's runtime, which defaults to Docker.
+func runtimeOf(c *types.Container) string {
+	if c.Runtime == "" {
+		return RuntimeDocker
+	}
+	return c.Runtime
+}
+
+// ContainerPort is a port a container publishes.
+type ContainerPort struct {
+	// Host is the instance port, which only listens on localhost so that it
+	// is reached through an SSH tunnel.
+	Host int
+	// Container is the port inside the container.
+	Container int
+}
+
+// ParseContainerPort parses a port mapping, port or host_port:container_port.
+func ParseContainerPort(s string) (ContainerPort, error) {
+	host, container, found := strings.Cut(s, ":")
+	if !found {
+		container = host
+	}
+
+	h, err := ssh.ParsePort(host)
+	if err != nil {
+		return ContainerPort{}, fmt.Errorf("invalid port %q: %w", s, err)
+	}
+	c, err := ssh.ParsePort(container)
+	if err != nil {
+		return ContainerPort{}, fmt.Errorf("invalid port %q: %w", s, err)
+	}
+	return ContainerPort{Host: h, Container: c}, nil
+}
+
+// ContainerPorts parses a container's ports.
+func ContainerPorts(c *types.Container) ([]ContainerPort, error) {
+	var ports []ContainerPort
+	for _, p := range c.Ports {
+		port, err := ParseContainerPort(p)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// containerImage matches image references that need no quoting.
+var containerImage = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/:@-]*$`)
+
+// volumeName matches named volumes.
+var volumeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// volumeOptions matches a volume's options, such as ro or ro,Z.
+var volumeOptions = regexp.MustCompile(`^(ro|rw|z|Z)(,(ro|rw|z|Z))*$`)
+
+// homePlaceholder stands for the instance user's home directory in systemd
+// units, which are written with it replaced.
+const homePlaceholder = "@HOME@"
+
+// containerVolume is a parsed volume.
+type containerVolume struct {
+	// source is a host path, with a home directory as homePlaceholder, or a
+	// named volume.
+	source  string
+	target  string
+	options string
+	named   bool
+}
+
+// parseVolume parses host_path_or_volume:container_path[:options]. Host paths
+// are absolute or start with ~/ or $HOME/.
+func parseVolume(s string) (containerVolume, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return containerVolume{}, fmt.Errorf("invalid volume %q: expected source:target[:options]", s)
+	}
+
+	v := containerVolume{source: parts[0], target: parts[1]}
+	if len(parts) == 3 {
+		v.options = parts[2]
+		if !volumeOptions.MatchString(v.options) {
+			return containerVolume{}, fmt.Errorf("invalid volume %q: unknown options %q", s, v.options)
+		}
+	}
+	if !path.IsAbs(v.target) || !safeWord.MatchString(v.target) {
+		return containerVolume{}, fmt.Errorf("invalid volume %q: target must be an absolute path", s)
+	}
+
+	switch {
+	case strings.HasPrefix(v.source, "~/"):
+		v.source = homePlaceholder + v.source[1:]
+	case strings.HasPrefix(v.source, "$HOME/"):
+		v.source = homePlaceholder + v.source[len("$HOME"):]
+	case strings.HasPrefix(v.source, "/"):
+	case volumeName.MatchString(v.source):
+		v.named = true
+		return v, nil
+	default:
+		return containerVolume{}, fmt.Errorf("invalid volume %q: source must be an absolute path, ~/path or a volume name", s)
+	}
+	if !safeWord.MatchString(strings.TrimPrefix(v.source, homePlaceholder)) {
+		return containerVolume{}, fmt.Errorf("invalid volume %q: unsupported characters in source", s)
+	}
+	return v, nil
+}
+
+func (v containerVolume) String() string {
+	s := v.source + ":" + v.target
+	if v.options != "" {
+		s += ":" + v.options
+	}
+	return s
+}
+
+// ValidateContainer checks a container definition.
+func ValidateContainer(c *types.Container) error {
+	if c.Image == "" {
+		return fmt.Errorf("container has no image")
+	}
+	if !containerImage.MatchString(c.Image) {
+		return fmt.Errorf("invalid container image %q", c.Image)
+	}
+	if runtime := runtimeOf(c); runtime != RuntimeDocker && runtime != RuntimePodman {
+		return fmt.Errorf("unsupported container runtime %q (use docker or podman)", runtime)
+	}
+
+	hostPorts := make(map[int]bool)
+	ports, err := ContainerPorts(c)
+	if err != nil {
+		return err
+	}
+	for _, port := range ports {
+		if hostPorts[port.Host] {
+			return fmt.Errorf("port %d is published twice", port.Host)
+		}
+		hostPorts[port.Host] = true
+	}
+
+	for _, volume := range c.Volumes {
+		if _, err := parseVolume(volume); err != nil {
+			return err
+		}
+	}
+	keys := make([]string, 0, len(c.Environment))
+	for key := range c.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := c.Environment[key]
+		if !envName.MatchString(key) {
+			return fmt.Errorf("%q is not a valid environment variable name", key)
+		}
+		if strings.Contains(value, "\n") {
+			return fmt.Errorf("container environment variable %s contains a newline", key)
+		}
+	}
+	return nil
+}
+
+// ImagePinned reports whether an image names a tag other than latest, or a
+// digest.
+func ImagePinned(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	// A colon after the last slash starts a tag; one before it is a registry port
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, found := strings.Cut(name, ":")
+	return found && tag != "latest"
+}
+
+// writeContainer writes the commands that pull a container pack's image and
+// run it as a systemd service, replacing any earlier version of the service.
+// Ports are published on the instance's localhost only.
+func writeContainer(b *strings.Builder, packID string, c *types.Container) error {
+	if err := ValidateContainer(c); err != nil {
+		return fmt.Errorf("container of pack '%s': %w", packID, err)
+	}
+	runtime := runtimeOf(c)
+	service := ContainerService(packID)
+	envFile := ContainerEnvDir + "/" + packID + ".env"
+
+	b.WriteString("\n# Run the container as a systemd service\n")
+	fmt.Fprintf(b, "echo %s\n", ssh.Quote("Setting up container "+c.Image+"..."))
+	fmt.Fprintf(b, "command -v %s >/dev/null 2>&1 || { sudo apt-get update -y && sudo apt-get install -y %s; }\n",
+		runtime, map[string]string{RuntimeDocker: "docker.io", RuntimePodman: "podman"}[runtime])
+	if runtime == RuntimeDocker {
+		b.WriteString("sudo systemctl enable --now docker\n")
+	}
+	fmt.Fprintf(b, "sudo %s pull %s\n", runtime, c.Image)
+
+	args := []string{"/usr/bin/env", runtime, "run", "--rm", "--name", containerName(packID)}
+	ports, _ := ContainerPorts(c)
+	for _, port := range ports {
+		args = append(args, "-p", fmt.Sprintf("127.0.0.1:%d:%d", port.Host, port.Container))
+	}
+	for _, volume := range c.Volumes {
+		v, _ := parseVolume(volume)
+		if !v.named {
+			// Create host directories as the instance user, so the container can use them
+			dir := strings.Replace(v.source, homePlaceholder, "$HOME", 1)
+			if strings.HasPrefix(v.source, homePlaceholder) {
+				fmt.Fprintf(b, "mkdir -p \"%s\"\n", dir)
+			} else {
+				fmt.Fprintf(b, "sudo mkdir -p %s\n", word(dir))
+			}
+		}
+		args = append(args, "-v", v.String())
+	}
+
+	fmt.Fprintf(b, "sudo mkdir -p %s\n", ContainerEnvDir)
+	if len(c.Environment) > 0 {
+		keys := make([]string, 0, len(c.Environment))
+		for key := range c.Environment {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(b, "sudo install -m 600 /dev/null %s\n", envFile)
+		fmt.Fprintf(b, "sudo tee %s >/dev/null <<'LFR_CONTAINER_ENV'\n", envFile)
+		for _, key := range keys {
+			fmt.Fprintf(b, "%s=%s\n", key, c.Environment[key])
+		}
+		b.WriteString("LFR_CONTAINER_ENV\n")
+		args = append(args, "--env-file", envFile)
+	} else {
+		fmt.Fprintf(b, "sudo rm -f %s\n", envFile)
+	}
+	args = append(args, c.Image)
+	args = append(args, c.Command...)
+
+	stop := fmt.Sprintf("/usr/bin/env %s stop %s", runtime, containerName(packID))
+	remove := fmt.Sprintf("-/usr/bin/env %s rm -f %s", runtime, containerName(packID))
+	after := "network-online.target"
+	requires := ""
+	if runtime == RuntimeDocker {
+		after += " docker.service"
+		requires = "Requires=docker.service\n"
+	}
+
+	fmt.Fprintf(b, "sed \"s|%s|$HOME|g\" <<'LFR_UNIT' | sudo tee /etc/systemd/system/%s >/dev/null\n", homePlaceholder, service)
+	fmt.Fprintf(b, "[Unit]\nDescription=lfr-tools pack %s (%s)\nWants=network-online.target\nAfter=%s\n%s\n", packID, c.Image, after, requires)
+	fmt.Fprintf(b, "[Service]\nExecStartPre=%s\nExecStart=%s\nExecStop=%s\nRestart=always\nRestartSec=5\n\n", remove, systemdCommand(args), stop)
+	b.WriteString("[Install]\nWantedBy=multi-user.target\nLFR_UNIT\n")
+
+	b.WriteString("sudo systemctl daemon-reload\n")
+	fmt.Fprintf(b, "sudo systemctl enable %s\n", service)
+	fmt.Fprintf(b, "sudo systemctl restart %s\n", service)
+
+	var published []string
+	for _, port := range ports {
+		published = append(published, strconv.Itoa(port.Host))
+	}
+	if len(published) > 0 {
+		fmt.Fprintf(b, "echo %s\n", ssh.Quote(fmt.Sprintf("Container %s is listening on localhost port %s; open it with lfr ssh tunnel <username> --pack %s",
+			containerName(packID), strings.Join(published, ", "), packID)))
+	}
+	return nil
+}
+
+// writeContainerRemoval writes the commands that stop and remove a container
+// pack's service and image. Host directories and named volumes are kept, since
+// they hold the user's data.
+func writeContainerRemoval(b *strings.Builder, packID string, c *types.Container) {
+	runtime := runtimeOf(c)
+	service := ContainerService(packID)
+
+	b.WriteString("\n# Remove the container service\n")
+	fmt.Fprintf(b, "echo %s\n", ssh.Quote("Removing container "+c.Image+"..."))
+	fmt.Fprintf(b, "sudo systemctl disable --now %s 2>/dev/null || true\n", service)
+	fmt.Fprintf(b, "sudo rm -f /etc/systemd/system/%s %s/%s.env\n", service, ContainerEnvDir, packID)
+	b.WriteString("sudo systemctl daemon-reload\n")
+	writeImageRemoval(b, runtime, c.Image)
+}
+
+// writeImageRemoval writes the command that removes an image, unless the
+// runtime is gone or the image is still in use.
+func writeImageRemoval(b *strings.Builder, runtime, image string) {
+	if !containerImage.MatchString(image) {
+		return
+	}
+	fmt.Fprintf(b, "if command -v %s >/dev/null 2>&1; then sudo %s rmi %s || true; fi\n", runtime, runtime, image)
+}
+
+// systemdCommand joins a command line for a unit file, quoting arguments that
+// need it and escaping systemd's specifiers and variables.
+func systemdCommand(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+		if arg == "" || strings.ContainsAny(arg, " \t\"'\\;") {
+			arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
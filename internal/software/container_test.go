@@ -0,0 +1,232 @@
+package software
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+func TestParseContainerPort(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ContainerPort
+		wantErr bool
+	}{
+		{in: "8888", want: ContainerPort{Host: 8888, Container: 8888}},
+		{in: "9000:8787", want: ContainerPort{Host: 9000, Container: 8787}},
+		{in: "0", wantErr: true},
+		{in: "8888:", wantErr: true},
+		{in: "127.0.0.1:8888:8888", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseContainerPort(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseContainerPort failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseVolume(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		named   bool
+		wantErr bool
+	}{
+		{in: "~/work:/home/jovyan/work", want: "@HOME@/work:/home/jovyan/work"},
+		{in: "$HOME/data:/data:ro", want: "@HOME@/data:/data:ro"},
+		{in: "/srv/shared:/shared:ro,Z", want: "/srv/shared:/shared:ro,Z"},
+		{in: "rstudio-home:/home/rstudio", want: "rstudio-home:/home/rstudio", named: true},
+		{in: "data:relative", wantErr: true},
+		{in: "./data:/data", wantErr: true},
+		{in: "/data:/data:rw,exec", wantErr: true},
+		{in: "/my data:/data", wantErr: true},
+		{in: "/data", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseVolume(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVolume failed: %v", err)
+			}
+			if got.String() != tt.want || got.named != tt.named {
+				t.Errorf("expected %s (named %v), got %s (named %v)", tt.want, tt.named, got, got.named)
+			}
+		})
+	}
+}
+
+func TestValidateContainer(t *testing.T) {
+	tests := []struct {
+		name      string
+		container types.Container
+		wantErr   string
+	}{
+		{name: "valid", container: types.Container{Image: "rocker/rstudio:4.3.2", Ports: []string{"8787"}, Environment: map[string]string{"DISABLE_AUTH": "true"}}},
+		{name: "no image", container: types.Container{}, wantErr: "no image"},
+		{name: "image", container: types.Container{Image: "rocker/rstudio; rm -rf /"}, wantErr: "invalid container image"},
+		{name: "runtime", container: types.Container{Image: "nginx:1.25", Runtime: "lxc"}, wantErr: "unsupported container runtime"},
+		{name: "duplicate port", container: types.Container{Image: "nginx:1.25", Ports: []string{"8080:80", "8080:443"}}, wantErr: "port 8080 is published twice"},
+		{name: "volume", container: types.Container{Image: "nginx:1.25", Volumes: []string{"data"}}, wantErr: "invalid volume"},
+		{name: "environment", container: types.Container{Image: "nginx:1.25", Environment: map[string]string{"A": "1\n2"}}, wantErr: "contains a newline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateContainer(&tt.container)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestImagePinned(t *testing.T) {
+	tests := map[string]bool{
+		"rocker/rstudio":                          false,
+		"rocker/rstudio:latest":                   false,
+		"rocker/rstudio:4.3.2":                    true,
+		"registry.example.com:5000/tools":         false,
+		"registry.example.com:5000/tools:1.0":     true,
+		"quay.io/jupyter/scipy-notebook@sha256:0": true,
+	}
+	for image, want := range tests {
+		if got := ImagePinned(image); got != want {
+			t.Errorf("ImagePinned(%q) = %v, want %v", image, got, want)
+		}
+	}
+}
+
+func TestInstallScriptContainer(t *testing.T) {
+	pack := &types.SoftwarePack{
+		ID:      "rstudio",
+		Name:    "RStudio Server",
+		Type:    types.PackTypeContainer,
+		Version: "4.3.2",
+		Container: &types.Container{
+			Image:       "rocker/rstudio:4.3.2",
+			Ports:       []string{"8787", "9000:9000"},
+			Volumes:     []string{"~/projects:/home/rstudio/projects", "rstudio-lib:/usr/local/lib/R/site-library"},
+			Environment: map[string]string{"DISABLE_AUTH": "true", "ROOT": "false"},
+			Command:     []string{"/init", "--note=50%"},
+		},
+	}
+
+	script, err := InstallScript(pack, "alice-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("InstallScript failed: %v", err)
+	}
+
+	order := []string{
+		"command -v docker >/dev/null 2>&1 || { sudo apt-get update -y && sudo apt-get install -y docker.io; }\n",
+		"sudo systemctl enable --now docker\n",
+		"sudo docker pull rocker/rstudio:4.3.2\n",
+		`mkdir -p "$HOME/projects"` + "\n",
+		"sudo install -m 600 /dev/null /etc/lfr-tools/containers/rstudio.env\n",
+		"DISABLE_AUTH=true\nROOT=false\nLFR_CONTAINER_ENV\n",
+		`sed "s|@HOME@|$HOME|g" <<'LFR_UNIT' | sudo tee /etc/systemd/system/lfr-rstudio.service >/dev/null` + "\n",
+		"Requires=docker.service\n",
+		"ExecStartPre=-/usr/bin/env docker rm -f lfr-rstudio\n",
+		"ExecStart=/usr/bin/env docker run --rm --name lfr-rstudio -p 127.0.0.1:8787:8787 -p 127.0.0.1:9000:9000 " +
+			"-v @HOME@/projects:/home/rstudio/projects -v rstudio-lib:/usr/local/lib/R/site-library " +
+			"--env-file /etc/lfr-tools/containers/rstudio.env rocker/rstudio:4.3.2 /init --note=50%%\n",
+		"Restart=always\n",
+		"LFR_UNIT\n",
+		"sudo systemctl daemon-reload\n",
+		"sudo systemctl enable lfr-rstudio.service\n",
+		"sudo systemctl restart lfr-rstudio.service\n",
+		"localhost port 8787, 9000; open it with lfr ssh tunnel <username> --pack rstudio",
+	}
+	last := -1
+	for _, want := range order {
+		i := strings.Index(script, want)
+		if i <= last {
+			t.Fatalf("expected %q after the previous step, got:\n%s", want, script)
+		}
+		last = i
+	}
+
+	pack.Container = &types.Container{Image: "docker.io/library/nginx:1.25", Runtime: RuntimePodman, Ports: []string{"8080:80"}}
+	script, err = InstallScript(pack, "alice-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("InstallScript failed: %v", err)
+	}
+	for _, want := range []string{"sudo apt-get install -y podman;", "sudo podman pull docker.io/library/nginx:1.25\n", "-p 127.0.0.1:8080:80 ", "sudo rm -f /etc/lfr-tools/containers/rstudio.env\n"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected script to contain %q, got:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "docker.service") {
+		t.Errorf("expected a podman unit not to depend on docker, got:\n%s", script)
+	}
+
+	pack.Container = nil
+	if _, err := InstallScript(pack, "alice-ubuntu_22_04"); err == nil {
+		t.Error("expected a container pack without a container to fail")
+	}
+}
+
+func TestUpgradeAndRemoveContainer(t *testing.T) {
+	old := &types.Container{Image: "rocker/rstudio:4.3.1", Ports: []string{"8787"}}
+	record := &types.InstallResult{PackID: "rstudio", Version: "4.3.1", Container: old}
+	pack := &types.SoftwarePack{ID: "rstudio", Name: "RStudio Server", Type: types.PackTypeContainer, Version: "4.3.2",
+		Container: &types.Container{Image: "rocker/rstudio:4.3.2", Ports: []string{"8787"}}}
+
+	delta := Diff(record, pack)
+	if !delta.Container || delta.Empty() {
+		t.Fatalf("expected the new image to change the container, got %+v", delta)
+	}
+	script, err := UpgradeScript(record, pack, delta, "alice-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("UpgradeScript failed: %v", err)
+	}
+	restart := strings.Index(script, "sudo systemctl restart lfr-rstudio.service\n")
+	rmi := strings.Index(script, "sudo docker rmi rocker/rstudio:4.3.1 || true")
+	if restart < 0 || rmi < restart {
+		t.Errorf("expected the old image to be removed after the restart, got:\n%s", script)
+	}
+
+	if delta := Diff(&types.InstallResult{PackID: "rstudio", Container: pack.Container}, pack); delta.Container {
+		t.Error("expected an unchanged container not to be reinstalled")
+	}
+
+	script, err = RemoveScript("rstudio", nil, nil, old)
+	if err != nil {
+		t.Fatalf("RemoveScript failed: %v", err)
+	}
+	for _, want := range []string{
+		"sudo systemctl disable --now lfr-rstudio.service 2>/dev/null || true\n",
+		"sudo rm -f /etc/systemd/system/lfr-rstudio.service /etc/lfr-tools/containers/rstudio.env\n",
+		"if command -v docker >/dev/null 2>&1; then sudo docker rmi rocker/rstudio:4.3.1 || true; fi\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected script to contain %q, got:\n%s", want, script)
+		}
+	}
+}
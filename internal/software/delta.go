@@ -0,0 +1,316 @@
+package software
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// Delta is what changes on an instance when an installed pack is upgraded to a
+// new definition.
+type Delta struct {
+	// Install are packages that are new or whose version or options changed.
+	Install []types.Package
+	// Remove are packages the new definition no longer has.
+	Remove []types.Package
+	// Environment reports whether the pack's environment variables changed.
+	Environment bool
+	// Scripts are scripts that are new or whose content changed.
+	Scripts []types.Script
+	// Container reports whether the pack's container changed.
+	Container bool
+}
+
+// Empty reports whether the delta changes nothing.
+func (d Delta) Empty() bool {
+	return len(d.Install) == 0 && len(d.Remove) == 0 && !d.Environment && len(d.Scripts) == 0 && !d.Container
+}
+
+// ScriptChecksum identifies a version of a script as name@checksum.
+func ScriptChecksum(script types.Script) string {
+	sum := sha256.Sum256([]byte(script.Content))
+	return script.Name + "@" + hex.EncodeToString(sum[:6])
+}
+
+// InstalledPackages returns the packages a record shows installed. Records
+// written before package specs were kept only have names; their sources are
+// taken from pack, the pack's current definition, when it has a package of
+// that name, and default to APT. A failed install records no packages, so pack's
+// are assumed. pack may be nil.
+func InstalledPackages(record *types.InstallResult, pack *types.SoftwarePack) []types.Package {
+	if len(record.PackageSpecs) > 0 {
+		return record.PackageSpecs
+	}
+
+	var defined []types.Package
+	if pack != nil {
+		defined = pack.Packages
+	}
+	if len(record.Packages) == 0 {
+		return defined
+	}
+
+	var packages []types.Package
+	for _, name := range record.Packages {
+		pkg := types.Package{Name: name, Source: SourceAPT}
+		for _, d := range defined {
+			if d.Name == name {
+				pkg = types.Package{Name: name, Source: d.Source}
+			}
+		}
+		packages = append(packages, pkg)
+	}
+	return packages
+}
+
+// Diff works out what upgrading the pack a record describes to a new
+// definition changes.
+func Diff(record *types.InstallResult, pack *types.SoftwarePack) Delta {
+	var delta Delta
+
+	installed := make(map[string]types.Package)
+	for _, pkg := range InstalledPackages(record, pack) {
+		installed[packageKey(pkg)] = pkg
+	}
+	wanted := make(map[string]bool)
+	for _, pkg := range pack.Packages {
+		key := packageKey(pkg)
+		wanted[key] = true
+		old, ok := installed[key]
+		if !ok || old.Version != pkg.Version || !reflect.DeepEqual(old.Options, pkg.Options) {
+			delta.Install = append(delta.Install, pkg)
+		}
+	}
+	for _, pkg := range InstalledPackages(record, pack) {
+		if !wanted[packageKey(pkg)] {
+			delta.Remove = append(delta.Remove, pkg)
+		}
+	}
+
+	delta.Environment = !sameEnvironment(record.Environment, pack.Environment)
+	delta.Container = !reflect.DeepEqual(record.Container, pack.Container)
+
+	ran := make(map[string]bool)
+	for _, script := range record.Scripts {
+		ran[script] = true
+	}
+	for _, script := range pack.Scripts {
+		if !ran[ScriptChecksum(script)] {
+			delta.Scripts = append(delta.Scripts, script)
+		}
+	}
+
+	return delta
+}
+
+// Unshared drops the packages that packs other than id, as recorded in
+// records, still use, so removing a pack doesn't remove them.
+func Unshared(packages []types.Package, records []*types.InstallResult, id string) []types.Package {
+	used := make(map[string]bool)
+	for _, record := range records {
+		if record.PackID == id {
+			continue
+		}
+		for _, pkg := range InstalledPackages(record, nil) {
+			used[packageKey(pkg)] = true
+		}
+	}
+
+	var unshared []types.Package
+	for _, pkg := range packages {
+		if !used[packageKey(pkg)] {
+			unshared = append(unshared, pkg)
+		}
+	}
+	return unshared
+}
+
+// UpgradeScript generates the script that upgrades an installed pack to a new
+// definition, applying only delta.
+func UpgradeScript(record *types.InstallResult, pack *types.SoftwarePack, delta Delta, instanceName string) (string, error) {
+	if !packID.MatchString(pack.ID) {
+		return "", fmt.Errorf("invalid pack ID %q", pack.ID)
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	b.WriteString("set -e\n\n")
+	fmt.Fprintf(&b, "echo %s\n", ssh.Quote(fmt.Sprintf("Upgrading %s from %s to %s on %s", pack.Name, record.Version, pack.Version, instanceName)))
+
+	if err := writeRemovals(&b, pack.ID, delta.Remove, record.NewPackages); err != nil {
+		return "", err
+	}
+
+	if len(delta.Install) > 0 {
+		b.WriteString("\nsudo apt-get update -y\n")
+		// Held packages would stay at their old version
+		for _, pkg := range delta.Install {
+			if sourceOf(pkg) == SourceAPT {
+				fmt.Fprintf(&b, "sudo apt-mark unhold %s >/dev/null 2>&1 || true\n", word(pkg.Name))
+			}
+		}
+		if err := writePackages(&b, pack.ID, delta.Install); err != nil {
+			return "", err
+		}
+	}
+
+	if delta.Environment {
+		b.WriteString("\n# Set environment variables\n")
+		b.WriteString(EnvironmentScript(pack.ID, pack.Environment))
+	}
+
+	writeScripts(&b, delta.Scripts)
+
+	if delta.Container {
+		old := record.Container
+		switch {
+		case pack.Container != nil:
+			// Restarting the service with the new unit replaces the old container
+			if err := writeContainer(&b, pack.ID, pack.Container); err != nil {
+				return "", err
+			}
+			if old != nil && old.Image != pack.Container.Image {
+				writeImageRemoval(&b, runtimeOf(old), old.Image)
+			}
+		case old != nil:
+			writeContainerRemoval(&b, pack.ID, old)
+		}
+	}
+
+	fmt.Fprintf(&b, "\necho %s\n", ssh.Quote("Pack "+pack.ID+" upgraded to "+pack.Version))
+	return b.String(), nil
+}
+
+// RemoveScript generates the script that removes an installed pack's
+// packages, container, if it has one, environment variables and registry
+// record. installed are the APT packages the pack installed, which are the
+// only ones purged.
+func RemoveScript(id string, packages []types.Package, installed []string, container *types.Container) (string, error) {
+	if !packID.MatchString(id) {
+		return "", fmt.Errorf("invalid pack ID %q", id)
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	b.WriteString("set -e\n\n")
+	fmt.Fprintf(&b, "echo %s\n", ssh.Quote("Removing "+id))
+
+	if container != nil {
+		writeContainerRemoval(&b, id, container)
+	}
+
+	if err := writeRemovals(&b, id, packages, installed); err != nil {
+		return "", err
+	}
+
+	b.WriteString("\n# Remove environment variables\n")
+	b.WriteString(EnvironmentScript(id, nil))
+
+	fmt.Fprintf(&b, "\nrm -f \"%s/%s.json\"\n", RegistryDir, id)
+	fmt.Fprintf(&b, "echo %s\n", ssh.Quote("Pack "+id+" removed"))
+	return b.String(), nil
+}
+
+// writeRemovals writes the commands that remove packages. Only the APT
+// packages in installed, those the pack installed, are purged, and not if
+// that would remove other packages that depend on them; packages that were on
+// the instance before the pack are kept.
+func writeRemovals(b *strings.Builder, packID string, packages []types.Package, installed []string) error {
+	isNew := make(map[string]bool)
+	for _, name := range installed {
+		isNew[name] = true
+	}
+
+	var purge []string
+	located := false
+	for _, pkg := range packages {
+		source := sourceOf(pkg)
+
+		var commands []string
+		switch source {
+		case SourceAPT, SourceDeb:
+			name, ok := aptName(pkg)
+			switch {
+			case !ok:
+				commands = []string{"echo " + ssh.Quote("Remove "+pkg.Name+" by hand: its package name isn't known")}
+			case isNew[name]:
+				commands = []string{fmt.Sprintf("sudo apt-mark unhold %s >/dev/null 2>&1 || true", word(name))}
+				purge = append(purge, name)
+			default:
+				commands = []string{
+					fmt.Sprintf("sudo apt-mark unhold %s >/dev/null 2>&1 || true", word(name)),
+					"echo " + ssh.Quote("Keeping "+name+": it was installed before the pack"),
+				}
+			}
+		case SourcePip:
+			commands = []string{fmt.Sprintf(`"%s/bin/pip" uninstall -y %s`, VenvPath, word(pkg.Name))}
+		case SourceNPM:
+			commands = []string{"sudo npm uninstall -g " + word(pkg.Name)}
+		case SourceSnap:
+			commands = []string{"sudo snap remove " + word(pkg.Name)}
+		case SourceConda:
+			if !located {
+				commands = append(commands, `LFR_CONDA="$(command -v conda || echo "`+CondaPath+`/bin/conda")"`)
+				located = true
+			}
+			commands = append(commands, `"$LFR_CONDA" remove -y `+word(pkg.Name))
+		case SourceCustom:
+			commands = []string{"echo " + ssh.Quote(pkg.Name+" was installed by the pack's scripts; remove it by hand")}
+		default:
+			return fmt.Errorf("package %s of pack '%s': unsupported package source %q", pkg.Name, packID, source)
+		}
+
+		b.WriteString("\n")
+		fmt.Fprintf(b, "echo %s\n", ssh.Quote("Removing "+pkg.Name+"..."))
+		for _, command := range commands {
+			b.WriteString(command + "\n")
+		}
+	}
+
+	if len(purge) > 0 {
+		// A simulated purge lists every package that would go, including
+		// packages installed since that depend on the pack's
+		names := strings.Join(words(purge), " ")
+		patterns := make([]string, 0, len(purge))
+		for _, name := range purge {
+			patterns = append(patterns, "-e "+word(name))
+		}
+		fmt.Fprintf(b, "\nif sudo apt-get purge -s %s | awk '/^Purg /{print $2}' | grep -qvxF %s; then\n", names, strings.Join(patterns, " "))
+		fmt.Fprintf(b, "  echo %s\n", ssh.Quote("Keeping "+strings.Join(purge, ", ")+": other packages depend on them"))
+		b.WriteString("else\n")
+		fmt.Fprintf(b, "  sudo apt-get purge -y %s\n", names)
+		b.WriteString("fi\n")
+	}
+	return nil
+}
+
+// debPackageName returns the package name in a .deb URL named the Debian way,
+// name_version_arch.deb.
+func debPackageName(url string) (string, bool) {
+	file := path.Base(url)
+	name, _, ok := strings.Cut(strings.TrimSuffix(file, ".deb"), "_")
+	return name, ok && name != ""
+}
+
+// packageKey identifies a package by source and name.
+func packageKey(pkg types.Package) string {
+	return sourceOf(pkg) + ":" + pkg.Name
+}
+
+func sameEnvironment(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package software
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+func TestDiff(t *testing.T) {
+	setup := types.Script{Name: "setup", Content: "echo v1"}
+	record := &types.InstallResult{
+		PackID:  "web-dev",
+		Version: "1.0",
+		Success: true,
+		PackageSpecs: []types.Package{
+			{Name: "nodejs", Source: "apt"},
+			{Name: "typescript", Source: "npm", Version: "5.3.3"},
+			{Name: "unzip", Source: "apt"},
+		},
+		Environment: map[string]string{"NODE_ENV": "development"},
+		Scripts:     []string{ScriptChecksum(setup)},
+	}
+
+	tests := []struct {
+		name        string
+		pack        *types.SoftwarePack
+		install     string
+		remove      string
+		environment bool
+		scripts     string
+	}{
+		{
+			name: "unchanged",
+			pack: &types.SoftwarePack{
+				ID:          "web-dev",
+				Packages:    record.PackageSpecs,
+				Environment: map[string]string{"NODE_ENV": "development"},
+				Scripts:     []types.Script{setup},
+			},
+		},
+		{
+			name: "packages",
+			pack: &types.SoftwarePack{
+				ID: "web-dev",
+				Packages: []types.Package{
+					{Name: "nodejs", Source: "apt"},
+					{Name: "typescript", Source: "npm", Version: "5.4.5"},
+					{Name: "eslint", Source: "npm"},
+				},
+				Environment: map[string]string{"NODE_ENV": "development"},
+				Scripts:     []types.Script{setup},
+			},
+			install: "typescript,eslint",
+			remove:  "unzip",
+		},
+		{
+			name: "environment and scripts",
+			pack: &types.SoftwarePack{
+				ID:          "web-dev",
+				Packages:    record.PackageSpecs,
+				Environment: map[string]string{"NODE_ENV": "production"},
+				Scripts:     []types.Script{{Name: "setup", Content: "echo v2"}, {Name: "extra", Content: "true"}},
+			},
+			environment: true,
+			scripts:     "setup,extra",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := Diff(record, tt.pack)
+			if got := packageNames(delta.Install); got != tt.install {
+				t.Errorf("expected to install %q, got %q", tt.install, got)
+			}
+			if got := packageNames(delta.Remove); got != tt.remove {
+				t.Errorf("expected to remove %q, got %q", tt.remove, got)
+			}
+			if delta.Environment != tt.environment {
+				t.Errorf("expected environment change %v, got %v", tt.environment, delta.Environment)
+			}
+			var scripts []string
+			for _, script := range delta.Scripts {
+				scripts = append(scripts, script.Name)
+			}
+			if got := strings.Join(scripts, ","); got != tt.scripts {
+				t.Errorf("expected to run scripts %q, got %q", tt.scripts, got)
+			}
+			if empty := tt.install == "" && tt.remove == "" && !tt.environment && tt.scripts == ""; delta.Empty() != empty {
+				t.Errorf("expected Empty() %v", empty)
+			}
+		})
+	}
+}
+
+func TestInstalledPackagesWithoutSpecs(t *testing.T) {
+	pack := &types.SoftwarePack{ID: "web-dev", Packages: []types.Package{{Name: "typescript", Source: "npm"}, {Name: "git", Source: "apt"}}}
+
+	got := InstalledPackages(&types.InstallResult{PackID: "web-dev", Packages: []string{"typescript", "curl"}}, pack)
+	if len(got) != 2 || got[0].Source != "npm" || got[1].Source != "apt" {
+		t.Errorf("expected sources from the definition, defaulting to apt, got %+v", got)
+	}
+
+	got = InstalledPackages(&types.InstallResult{PackID: "web-dev"}, pack)
+	if packageNames(got) != "typescript,git" {
+		t.Errorf("expected a record without packages to assume the definition's, got %+v", got)
+	}
+}
+
+func TestUnshared(t *testing.T) {
+	records := []*types.InstallResult{
+		{PackID: "web-dev", PackageSpecs: []types.Package{{Name: "git", Source: "apt"}, {Name: "nodejs", Source: "apt"}}},
+		{PackID: "python-dev", Packages: []string{"git", "python3"}},
+	}
+
+	got := Unshared(records[0].PackageSpecs, records, "web-dev")
+	if packageNames(got) != "nodejs" {
+		t.Errorf("expected git to be kept for python-dev, got %+v", got)
+	}
+}
+
+func TestUpgradeScript(t *testing.T) {
+	record := &types.InstallResult{PackID: "web-dev", Version: "1.0", NewPackages: []string{"unzip"}}
+	pack := &types.SoftwarePack{ID: "web-dev", Name: "Web Development", Version: "1.1", Environment: map[string]string{"NODE_ENV": "production"}}
+	delta := Delta{
+		Install:     []types.Package{{Name: "nodejs", Source: "apt", Version: "20.11.1"}},
+		Remove:      []types.Package{{Name: "typescript", Source: "npm"}, {Name: "unzip", Source: "apt"}, {Name: "curl", Source: "apt"}},
+		Environment: true,
+	}
+
+	script, err := UpgradeScript(record, pack, delta, "alice-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("UpgradeScript failed: %v", err)
+	}
+
+	order := []string{
+		"Upgrading Web Development from 1.0 to 1.1 on alice-ubuntu_22_04",
+		"sudo npm uninstall -g typescript\n",
+		"sudo apt-mark unhold unzip",
+		"Keeping curl: it was installed before the pack",
+		"sudo apt-get purge -y unzip\n",
+		"sudo apt-mark unhold nodejs",
+		"echo 'lfr-tools: new package nodejs'\n",
+		"sudo apt-get install -y nodejs=20.11.1\n",
+		`export NODE_ENV="production"`,
+		"Pack web-dev upgraded to 1.1",
+	}
+	last := -1
+	for _, want := range order {
+		i := strings.Index(script, want)
+		if i <= last {
+			t.Fatalf("expected %q after the previous step, got:\n%s", want, script)
+		}
+		last = i
+	}
+}
+
+func TestRemoveScript(t *testing.T) {
+	script, err := RemoveScript("data-science", []types.Package{
+		{Name: "r-base", Source: "apt"},
+		{Name: "numpy", Source: "pip"},
+		{Name: "code", Source: "snap"},
+		{Name: "r-essentials", Source: "conda"},
+		{Name: "https://example.com/rstudio-server_2023.12.1_amd64.deb", Source: "deb"},
+		{Name: "https://example.com/tool.deb", Source: "deb"},
+		{Name: "rstudio", Source: "custom"},
+		{Name: "git", Source: "apt"},
+	}, []string{"r-base", "rstudio-server"}, nil)
+	if err != nil {
+		t.Fatalf("RemoveScript failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`"$HOME/.lfr-tools/venv/bin/pip" uninstall -y numpy` + "\n",
+		"sudo snap remove code\n",
+		`"$LFR_CONDA" remove -y r-essentials` + "\n",
+		"Remove https://example.com/tool.deb by hand",
+		"Keeping git: it was installed before the pack",
+		"if sudo apt-get purge -s r-base rstudio-server | awk '/^Purg /{print $2}' | grep -qvxF -e r-base -e rstudio-server; then\n",
+		"  echo 'Keeping r-base, rstudio-server: other packages depend on them'\n",
+		"  sudo apt-get purge -y r-base rstudio-server\n",
+		"sed -i '/^# BEGIN lfr-tools pack=data-science$/,/^# END lfr-tools pack=data-science$/d' ~/.bashrc\n",
+		`rm -f "$HOME/.lfr-tools/software/data-science.json"` + "\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected script to contain %q, got:\n%s", want, script)
+		}
+	}
+	for _, unwanted := range []string{"autoremove", "apt-mark auto", "purge -y git", "purge -y r-base rstudio-server git"} {
+		if strings.Contains(script, unwanted) {
+			t.Errorf("expected only the pack's new APT packages to be purged, got %q in:\n%s", unwanted, script)
+		}
+	}
+}
+
+func TestTrackNewPackages(t *testing.T) {
+	pack := &types.SoftwarePack{ID: "web-dev", Packages: []types.Package{
+		{Name: "nodejs", Source: "apt"},
+		{Name: "git", Source: "apt"},
+		{Name: "typescript", Source: "npm"},
+		{Name: "https://example.com/code_1.86.0_amd64.deb", Source: "deb"},
+	}}
+	output := "Installing nodejs...\nlfr-tools: new package nodejs\nlfr-tools: new package code\nlfr-tools: new package unrelated\n"
+
+	got := TrackNewPackages([]string{"npm", "git"}, pack, output)
+	if strings.Join(got, ",") != "git,nodejs,code" {
+		t.Errorf("expected the recorded and new packages the pack still has, got %v", got)
+	}
+}
+
+func packageNames(packages []types.Package) string {
+	var names []string
+	for _, pkg := range packages {
+		names = append(names, pkg.Name)
+	}
+	return strings.Join(names, ",")
+}
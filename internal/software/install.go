@@ -0,0 +1,371 @@
+package software
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// Package sources.
+const (
+	SourceAPT    = "apt"
+	SourcePip    = "pip"
+	SourceNPM    = "npm"
+	SourceSnap   = "snap"
+	SourceConda  = "conda"
+	SourceDeb    = "deb"
+	SourceCustom = "custom"
+)
+
+// VenvPath is the virtual environment pip packages are installed in, shared
+// by every pack on an instance.
+const VenvPath = "$HOME/.lfr-tools/venv"
+
+// CondaPath is where Miniconda is installed when an instance has no conda.
+const CondaPath = "$HOME/miniconda3"
+
+// Setup run once per script before the first package of a source that needs
+// it.
+var sourceSetup = map[string]string{
+	SourcePip: `# Python packages are installed in a shared virtual environment
+if [ ! -x "` + VenvPath + `/bin/pip" ]; then
+  sudo apt-get install -y python3-venv
+  python3 -m venv "` + VenvPath + `"
+fi
+grep -qxF 'export PATH="` + VenvPath + `/bin:$PATH"' ~/.bashrc || echo 'export PATH="` + VenvPath + `/bin:$PATH"' >> ~/.bashrc
+`,
+	SourceNPM: `command -v npm >/dev/null 2>&1 || sudo apt-get install -y nodejs npm
+`,
+	SourceSnap: `command -v snap >/dev/null 2>&1 || sudo apt-get install -y snapd
+`,
+	SourceConda: `LFR_CONDA="$(command -v conda || echo "` + CondaPath + `/bin/conda")"
+if [ ! -x "$LFR_CONDA" ]; then
+  curl -fsSL "https://repo.anaconda.com/miniconda/Miniconda3-latest-Linux-$(uname -m).sh" -o /tmp/miniconda.sh
+  bash /tmp/miniconda.sh -b -p "` + CondaPath + `"
+  rm -f /tmp/miniconda.sh
+  LFR_CONDA="` + CondaPath + `/bin/conda"
+fi
+`,
+}
+
+// InstallScript generates the bash script that installs a pack on an
+// instance: its packages, each followed by its post-install commands, then
+// its environment variables and scripts, and for container packs the
+// container's service.
+func InstallScript(pack *types.SoftwarePack, instanceName string) (string, error) {
+	if !packID.MatchString(pack.ID) {
+		return "", fmt.Errorf("invalid pack ID %q", pack.ID)
+	}
+	if pack.Type == types.PackTypeContainer && pack.Container == nil {
+		return "", fmt.Errorf("container pack '%s' has no container", pack.ID)
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	b.WriteString("set -e\n\n")
+	fmt.Fprintf(&b, "echo %s\n", ssh.Quote("Installing "+pack.Name+" on "+instanceName))
+	b.WriteString("echo 'Starting at: '$(date)\n\n")
+
+	// Update package manager
+	b.WriteString("sudo apt-get update -y\n")
+
+	if err := writePackages(&b, pack.ID, pack.Packages); err != nil {
+		return "", err
+	}
+
+	// Set environment variables, dropping any an earlier version set
+	b.WriteString("\n# Set environment variables\n")
+	b.WriteString(EnvironmentScript(pack.ID, pack.Environment))
+
+	// Run custom scripts
+	writeScripts(&b, pack.Scripts)
+
+	if pack.Container != nil {
+		if err := writeContainer(&b, pack.ID, pack.Container); err != nil {
+			return "", err
+		}
+	}
+
+	b.WriteString("\necho 'Installation completed at: '$(date)\n")
+	fmt.Fprintf(&b, "echo %s\n", ssh.Quote("Pack "+pack.ID+" installed successfully"))
+
+	return b.String(), nil
+}
+
+// writePackages writes the commands that install packages, with each
+// source's setup before its first package.
+func writePackages(b *strings.Builder, packID string, packages []types.Package) error {
+	setup := make(map[string]bool)
+	for _, pkg := range packages {
+		source := sourceOf(pkg)
+
+		commands, err := packageCommands(source, pkg)
+		if err != nil {
+			return fmt.Errorf("package %s of pack '%s': %w", pkg.Name, packID, err)
+		}
+
+		b.WriteString("\n")
+		if s, ok := sourceSetup[source]; ok && !setup[source] {
+			b.WriteString(s)
+			setup[source] = true
+		}
+		fmt.Fprintf(b, "echo %s\n", ssh.Quote("Installing "+pkg.Name+"..."))
+		for _, command := range commands {
+			b.WriteString(command + "\n")
+		}
+		for _, command := range pkg.PostInstall {
+			b.WriteString(command + "\n")
+		}
+	}
+	return nil
+}
+
+// writeScripts writes a pack's scripts.
+func writeScripts(b *strings.Builder, scripts []types.Script) {
+	for _, script := range scripts {
+		fmt.Fprintf(b, "\n# %s\n", script.Description)
+		fmt.Fprintf(b, "echo %s\n", ssh.Quote("Running "+script.Name+"..."))
+		b.WriteString(script.Content + "\n")
+	}
+}
+
+// sourceOf returns a package's source, which defaults to APT.
+func sourceOf(pkg types.Package) string {
+	if pkg.Source == "" {
+		return SourceAPT
+	}
+	return pkg.Source
+}
+
+// packageCommands returns the commands that install a package from source.
+func packageCommands(source string, pkg types.Package) ([]string, error) {
+	if pkg.Name == "" {
+		return nil, fmt.Errorf("package has no name")
+	}
+	options := words(pkg.Options)
+
+	switch source {
+	case SourceAPT:
+		name := pkg.Name
+		if pkg.Version != "" {
+			name += "=" + pkg.Version
+		}
+		commands := []string{newPackageCheck(pkg.Name), join("sudo apt-get install -y", options, word(name))}
+		// Hold pinned packages so that upgrades don't move them
+		if pkg.Version != "" {
+			commands = append(commands, "sudo apt-mark hold "+word(pkg.Name))
+		}
+		return commands, nil
+
+	case SourcePip:
+		name := pkg.Name
+		if pkg.Version != "" {
+			if strings.ContainsAny(pkg.Version[:1], "=<>!~") {
+				name += pkg.Version
+			} else {
+				name += "==" + pkg.Version
+			}
+		}
+		return []string{join(`"`+VenvPath+`/bin/pip" install`, options, word(name))}, nil
+
+	case SourceNPM:
+		name := pkg.Name
+		if pkg.Version != "" {
+			name += "@" + pkg.Version
+		}
+		return []string{join("sudo npm install -g", options, word(name))}, nil
+
+	case SourceSnap:
+		command := "sudo snap install " + word(pkg.Name)
+		if pkg.Version != "" {
+			command += " --channel=" + word(pkg.Version)
+		}
+		return []string{join(command, options, "")}, nil
+
+	case SourceConda:
+		name := pkg.Name
+		if pkg.Version != "" {
+			name += "=" + pkg.Version
+		}
+		return []string{join(`"$LFR_CONDA" install -y`, options, word(name))}, nil
+
+	case SourceDeb:
+		if !strings.HasPrefix(pkg.Name, "https://") && !strings.HasPrefix(pkg.Name, "http://") {
+			return nil, fmt.Errorf("deb packages must be named by their URL")
+		}
+		// apt-get resolves the package's dependencies, unlike dpkg -i
+		commands := []string{
+			`LFR_DEB="$(mktemp --suffix=.deb)"`,
+			`curl -fsSL ` + word(pkg.Name) + ` -o "$LFR_DEB"`,
+			`chmod 644 "$LFR_DEB"`,
+			join("sudo apt-get install -y", options, `"$LFR_DEB"`),
+			`rm -f "$LFR_DEB"`,
+		}
+		if name, ok := debPackageName(pkg.Name); ok {
+			commands = append([]string{newPackageCheck(name)}, commands...)
+		}
+		return commands, nil
+
+	case SourceCustom:
+		return []string{"echo " + ssh.Quote(pkg.Name+" is installed by the pack's scripts")}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported package source %q", source)
+	}
+}
+
+// NewPackageMarker starts the line install scripts print for each APT package
+// that wasn't on the instance before, so that removing the pack only purges
+// packages it installed.
+const NewPackageMarker = "lfr-tools: new package "
+
+// newPackageCheck returns a command that prints NewPackageMarker and the name of
+// an APT package if it isn't installed.
+func newPackageCheck(name string) string {
+	return fmt.Sprintf(`dpkg-query -W -f='${Status}' %s 2>/dev/null | grep -q 'ok installed' || echo %s`,
+		word(name), ssh.Quote(NewPackageMarker+name))
+}
+
+// ParseNewPackages returns the packages an install script's output marks as
+// new.
+func ParseNewPackages(output string) []string {
+	var packages []string
+	for _, line := range strings.Split(output, "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), NewPackageMarker); ok && name != "" {
+			packages = append(packages, name)
+		}
+	}
+	return packages
+}
+
+// TrackNewPackages returns the APT packages a pack installed once it has been
+// installed or upgraded to pack: those previously recorded that the pack still
+// has, and those the script's output marks as new.
+func TrackNewPackages(previous []string, pack *types.SoftwarePack, output string) []string {
+	has := make(map[string]bool)
+	for _, pkg := range pack.Packages {
+		if name, ok := aptName(pkg); ok {
+			has[name] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var packages []string
+	for _, name := range append(append([]string(nil), previous...), ParseNewPackages(output)...) {
+		if has[name] && !seen[name] {
+			seen[name] = true
+			packages = append(packages, name)
+		}
+	}
+	return packages
+}
+
+// aptName returns the name APT knows a package by, for APT and .deb packages.
+func aptName(pkg types.Package) (string, bool) {
+	switch sourceOf(pkg) {
+	case SourceAPT:
+		return pkg.Name, true
+	case SourceDeb:
+		return debPackageName(pkg.Name)
+	}
+	return "", false
+}
+
+// safeWord matches words that need no quoting in a shell.
+var safeWord = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+
+// word quotes s for the shell if it needs quoting.
+func word(s string) string {
+	if safeWord.MatchString(s) {
+		return s
+	}
+	return ssh.Quote(s)
+}
+
+func words(ss []string) []string {
+	quoted := make([]string, 0, len(ss))
+	for _, s := range ss {
+		quoted = append(quoted, word(s))
+	}
+	return quoted
+}
+
+// join joins a command, its options and an argument, skipping empty parts.
+func join(command string, options []string, arg string) string {
+	parts := append([]string{command}, options...)
+	if arg != "" {
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// envReference matches the variable references environment values can use,
+// such as $PATH or ${HOME}.
+var envReference = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*|\{[A-Za-z_][A-Za-z0-9_]*\})`)
+
+// quoteEnvValue double-quotes an environment value for bash, escaping
+// everything the shell would expand except variable references, so a value
+// can't run commands or end the quotes.
+func quoteEnvValue(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '$':
+			if ref := envReference.FindString(value[i:]); ref != "" {
+				b.WriteString(ref)
+				i += len(ref) - 1
+				continue
+			}
+			b.WriteString(`\$`)
+		case '"', '\\', '`':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			// Keep the block one line per variable
+			b.WriteString(`"$'\n'"`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Markers around the block of a pack's environment variables in ~/.bashrc.
+const (
+	envBeginMarker = "# BEGIN lfr-tools pack="
+	envEndMarker   = "# END lfr-tools pack="
+)
+
+// EnvironmentScript returns a script that replaces a pack's block of
+// environment variables in ~/.bashrc, so installing a pack again doesn't add
+// them twice. With no variables, the block is removed.
+func EnvironmentScript(id string, environment map[string]string) string {
+	var b strings.Builder
+	pattern := strings.ReplaceAll(id, ".", `\.`)
+	b.WriteString("touch ~/.bashrc\n")
+	fmt.Fprintf(&b, "sed -i '/^%s%s$/,/^%s%s$/d' ~/.bashrc\n", envBeginMarker, pattern, envEndMarker, pattern)
+	if len(environment) == 0 {
+		return b.String()
+	}
+
+	keys := make([]string, 0, len(environment))
+	for key := range environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	b.WriteString("cat >> ~/.bashrc <<'LFR_ENV'\n")
+	b.WriteString(envBeginMarker + id + "\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "export %s=%s\n", key, quoteEnvValue(environment[key]))
+	}
+	b.WriteString(envEndMarker + id + "\n")
+	b.WriteString("LFR_ENV\n")
+	return b.String()
+}
@@ -0,0 +1,147 @@
+package software
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+func TestInstallScriptSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkg     types.Package
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "apt",
+			pkg:  types.Package{Name: "nodejs", Source: "apt"},
+			want: []string{"sudo apt-get install -y nodejs\n"},
+		},
+		{
+			name: "apt without a source",
+			pkg:  types.Package{Name: "git"},
+			want: []string{"sudo apt-get install -y git\n"},
+		},
+		{
+			name: "apt pinned",
+			pkg:  types.Package{Name: "nodejs", Source: "apt", Version: "18.19.1+dfsg-6ubuntu5", Options: []string{"--no-install-recommends"}},
+			want: []string{
+				"sudo apt-get install -y --no-install-recommends nodejs=18.19.1+dfsg-6ubuntu5\n",
+				"sudo apt-mark hold nodejs\n",
+			},
+		},
+		{
+			name: "pip",
+			pkg:  types.Package{Name: "numpy", Source: "pip", Version: "1.26.4"},
+			want: []string{
+				`python3 -m venv "$HOME/.lfr-tools/venv"`,
+				`"$HOME/.lfr-tools/venv/bin/pip" install numpy==1.26.4` + "\n",
+			},
+		},
+		{
+			name: "pip version specifier",
+			pkg:  types.Package{Name: "pandas", Source: "pip", Version: ">=2.0,<3"},
+			want: []string{`"$HOME/.lfr-tools/venv/bin/pip" install 'pandas>=2.0,<3'` + "\n"},
+		},
+		{
+			name: "npm",
+			pkg:  types.Package{Name: "typescript", Source: "npm", Version: "5.4.5"},
+			want: []string{"sudo npm install -g typescript@5.4.5\n"},
+		},
+		{
+			name: "snap",
+			pkg:  types.Package{Name: "code", Source: "snap", Version: "latest/stable", Options: []string{"--classic"}},
+			want: []string{"sudo snap install code --channel=latest/stable --classic\n"},
+		},
+		{
+			name: "conda",
+			pkg:  types.Package{Name: "r-essentials", Source: "conda", Version: "4.3", Options: []string{"-c", "conda-forge"}},
+			want: []string{
+				"Miniconda3-latest-Linux-$(uname -m).sh",
+				`"$LFR_CONDA" install -y -c conda-forge r-essentials=4.3` + "\n",
+			},
+		},
+		{
+			name: "deb",
+			pkg:  types.Package{Name: "https://example.com/rstudio-server-2023.12.1-402-amd64.deb", Source: "deb"},
+			want: []string{
+				`curl -fsSL https://example.com/rstudio-server-2023.12.1-402-amd64.deb -o "$LFR_DEB"` + "\n",
+				`sudo apt-get install -y "$LFR_DEB"` + "\n",
+			},
+		},
+		{
+			name:    "deb without a URL",
+			pkg:     types.Package{Name: "rstudio-server", Source: "deb"},
+			wantErr: "named by their URL",
+		},
+		{
+			name: "custom",
+			pkg:  types.Package{Name: "rstudio-server", Source: "custom"},
+			want: []string{`echo 'rstudio-server is installed by the pack'\''s scripts'` + "\n"},
+		},
+		{
+			name:    "unknown source",
+			pkg:     types.Package{Name: "thing", Source: "brew"},
+			wantErr: `unsupported package source "brew"`,
+		},
+		{
+			name: "post install",
+			pkg:  types.Package{Name: "jupyter", Source: "pip", PostInstall: []string{"jupyter notebook --generate-config"}},
+			want: []string{`install jupyter` + "\njupyter notebook --generate-config\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pack := &types.SoftwarePack{ID: "test", Name: "Test", Packages: []types.Package{tt.pkg}}
+			script, err := InstallScript(pack, "alice-ubuntu_22_04")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallScript failed: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(script, want) {
+					t.Errorf("expected script to contain %q, got:\n%s", want, script)
+				}
+			}
+		})
+	}
+}
+
+func TestInstallScriptSetupOnce(t *testing.T) {
+	pack := &types.SoftwarePack{
+		ID: "test",
+		Packages: []types.Package{
+			{Name: "numpy", Source: "pip"},
+			{Name: "git", Source: "apt"},
+			{Name: "pandas", Source: "pip"},
+		},
+		Environment: map[string]string{"B": "2", "A": "1"},
+		Scripts:     []types.Script{{Name: "setup", Description: "Setup", Content: "echo done"}},
+	}
+
+	script, err := InstallScript(pack, "alice-ubuntu_22_04")
+	if err != nil {
+		t.Fatalf("InstallScript failed: %v", err)
+	}
+
+	if n := strings.Count(script, "python3 -m venv"); n != 1 {
+		t.Errorf("expected the venv to be set up once, got %d times", n)
+	}
+	order := []string{"install numpy", "install -y git", "install pandas", `export A="1"`, `export B="2"`, "echo done", "Pack test installed successfully"}
+	last := -1
+	for _, want := range order {
+		i := strings.Index(script, want)
+		if i <= last {
+			t.Fatalf("expected %q after the previous step, got:\n%s", want, script)
+		}
+		last = i
+	}
+}
@@ -0,0 +1,535 @@
+package software
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// Severity is how serious a lint finding is.
+type Severity string
+
+const (
+	// SeverityError marks packs that won't install correctly or are unsafe.
+	SeverityError Severity = "error"
+	// SeverityWarning marks packs that probably don't do what was meant.
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem lint found in a pack.
+type Finding struct {
+	Severity Severity `json:"severity" yaml:"severity"`
+	// Path is the field the finding is about, such as packages[2].source, or
+	// for scripts the line, as in scripts[0].content:3.
+	Path string `json:"path" yaml:"path"`
+	// Rule names the check, such as schema or dangerous. Shell checks that
+	// match a ShellCheck warning use its code, such as SC2006.
+	Rule    string `json:"rule" yaml:"rule"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (f Finding) String() string {
+	path := f.Path
+	if path == "" {
+		path = "(pack)"
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", path, f.Severity, f.Message, f.Rule)
+}
+
+// KnownBlueprints are the blueprints packs can list as supported.
+var KnownBlueprints = []string{
+	"ubuntu_22_04",
+	"ubuntu_20_04",
+	"amazon_linux_2",
+	"centos_7",
+	"debian_11",
+	"jupyterlab_ubuntu_22_04",
+	"rstudio_ubuntu_22_04",
+	"vscode_ubuntu_22_04",
+}
+
+// LintOptions configure Lint.
+type LintOptions struct {
+	// Blueprints are the blueprints that are known; KnownBlueprints if empty.
+	Blueprints []string
+	// Bash, if set, is the path of a bash used to check script syntax.
+	Bash string
+}
+
+// Lint checks a pack file: that it matches Schema, that its type agrees with
+// its package sources and container, that it only lists known blueprints, and
+// that its scripts are safe and run unattended.
+func Lint(ctx context.Context, data []byte, isJSON bool, opts LintOptions) []Finding {
+	var findings []Finding
+
+	doc, err := decodeDocument(data, isJSON)
+	if err != nil {
+		return []Finding{{Severity: SeverityError, Rule: "parse", Message: err.Error()}}
+	}
+	if !isJSON && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Rule:     "format",
+			Message:  "file is JSON but named as YAML; rename it to .json or rewrite it as YAML",
+		})
+	}
+
+	schemaFindings := validateSchema(doc)
+	findings = append(findings, schemaFindings...)
+
+	// A pack that doesn't match the schema may not decode
+	var pack types.SoftwarePack
+	normalized, _ := json.Marshal(doc)
+	if err := json.Unmarshal(normalized, &pack); err != nil {
+		if len(schemaFindings) == 0 {
+			findings = append(findings, Finding{Severity: SeverityError, Rule: "parse", Message: err.Error()})
+		}
+		return findings
+	}
+
+	// Fields that don't match the schema aren't reported again
+	for _, f := range LintPack(ctx, &pack, opts) {
+		if !within(f.Path, schemaFindings) {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// within reports whether path is the path of a finding, or one of them is
+// inside the other.
+func within(path string, findings []Finding) bool {
+	for _, f := range findings {
+		if path == f.Path || (path != "" && (inside(path, f.Path) || inside(f.Path, path))) {
+			return true
+		}
+	}
+	return false
+}
+
+// inside reports whether path is a field, element or line of parent.
+func inside(path, parent string) bool {
+	return parent != "" && len(path) > len(parent) && strings.HasPrefix(path, parent) &&
+		strings.ContainsRune(".[:", rune(path[len(parent)]))
+}
+
+// decodeDocument decodes a pack file into the values encoding/json would
+// produce, so that YAML and JSON files are checked alike.
+func decodeDocument(data []byte, isJSON bool) (interface{}, error) {
+	var doc interface{}
+	if isJSON {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse pack: %w", err)
+		}
+		return doc, nil
+	}
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse pack: %w", err)
+	}
+	normalized, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pack: %w", err)
+	}
+	doc = nil
+	if err := json.Unmarshal(normalized, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse pack: %w", err)
+	}
+	return doc, nil
+}
+
+// LintPack checks a decoded pack; Lint also checks the file against the
+// schema.
+func LintPack(ctx context.Context, pack *types.SoftwarePack, opts LintOptions) []Finding {
+	l := &linter{}
+
+	l.checkMetadata(pack)
+	l.checkType(pack)
+	l.checkBlueprints(pack, opts.Blueprints)
+	l.checkPackages(pack)
+	l.checkEnvironment("environment", pack.Environment)
+	if pack.Container != nil {
+		l.checkContainer(pack.Container)
+	}
+
+	names := make(map[string]bool)
+	for i, script := range pack.Scripts {
+		path := fmt.Sprintf("scripts[%d]", i)
+		if names[script.Name] {
+			l.warn(path+".name", "duplicate", "script %q is defined twice; upgrades track scripts by name", script.Name)
+		}
+		names[script.Name] = true
+
+		if script.Type != "" && script.Type != "bash" && script.Type != "sh" {
+			l.warn(path+".type", "script-type", "scripts run with bash; type %q is ignored", script.Type)
+		}
+		if script.RunAs != "" {
+			l.warn(path+".run_as", "script-type", "run_as is ignored; scripts run as the instance user and use sudo where needed")
+		}
+		if len(script.Environment) > 0 {
+			l.warn(path+".environment", "script-type", "script environment is ignored; set variables in the pack's environment or the script")
+		}
+
+		l.checkShell(path+".content", script.Content)
+		if opts.Bash != "" {
+			l.checkSyntax(ctx, opts.Bash, path+".content", script.Content)
+		}
+	}
+
+	return l.findings
+}
+
+type linter struct {
+	findings []Finding
+}
+
+func (l *linter) add(severity Severity, path, rule, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{
+		Severity: severity,
+		Path:     path,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) error(path, rule, format string, args ...interface{}) {
+	l.add(SeverityError, path, rule, format, args...)
+}
+
+func (l *linter) warn(path, rule, format string, args ...interface{}) {
+	l.add(SeverityWarning, path, rule, format, args...)
+}
+
+func (l *linter) checkMetadata(pack *types.SoftwarePack) {
+	if pack.Version == "" {
+		l.warn("version", "version", "packs without a version can't be upgraded, pinned or published")
+	}
+
+	seen := make(map[string]bool)
+	for i, dep := range pack.Dependencies {
+		id, _ := ParseRef(dep)
+		path := fmt.Sprintf("dependencies[%d]", i)
+		if id == pack.ID {
+			l.error(path, "dependency", "pack depends on itself")
+		}
+		if seen[id] {
+			l.warn(path, "duplicate", "dependency %s is listed twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+// checkType checks that the pack's type agrees with what it installs.
+func (l *linter) checkType(pack *types.SoftwarePack) {
+	switch pack.Type {
+	case "":
+		l.warn("type", "type", "type is not set; use apt, container, script or mixed")
+	case types.PackTypeAPT:
+		for i, pkg := range pack.Packages {
+			if source := sourceOf(pkg); source != SourceAPT && source != SourceDeb {
+				l.error(fmt.Sprintf("packages[%d].source", i), "type",
+					"apt packs only install apt and deb packages, but %s is from %s; use type mixed", pkg.Name, source)
+			}
+		}
+	case types.PackTypeContainer:
+		if pack.Container == nil {
+			l.error("container", "type", "container packs need a container")
+		}
+	case types.PackTypeScript:
+		for i, pkg := range pack.Packages {
+			if source := sourceOf(pkg); source != SourceCustom {
+				l.error(fmt.Sprintf("packages[%d].source", i), "type",
+					"script packs only list custom packages, but %s is from %s; use type mixed", pkg.Name, source)
+			}
+		}
+		if len(pack.Scripts) == 0 {
+			l.error("scripts", "type", "script packs need at least one script")
+		}
+	}
+
+	if pack.Container != nil && pack.Type != types.PackTypeContainer {
+		l.error("type", "type", "only container packs run containers; use type container")
+	}
+
+	if len(pack.Packages) == 0 && len(pack.Scripts) == 0 && len(pack.Environment) == 0 && len(pack.Dependencies) == 0 && pack.Container == nil {
+		l.warn("", "empty", "pack installs nothing")
+	}
+}
+
+func (l *linter) checkContainer(c *types.Container) {
+	if err := ValidateContainer(c); err != nil {
+		l.error("container", "container", "%v", err)
+		return
+	}
+	if !ImagePinned(c.Image) {
+		l.warn("container.image", "container", "pin the image to a tag or digest, so every instance runs the same software")
+	}
+	if len(c.Ports) == 0 {
+		l.warn("container.ports", "container", "the container publishes no ports to reach it through an SSH tunnel")
+	}
+}
+
+func (l *linter) checkBlueprints(pack *types.SoftwarePack, known []string) {
+	if len(known) == 0 {
+		known = KnownBlueprints
+	}
+	for i, blueprint := range pack.Supported {
+		found := false
+		for _, k := range known {
+			if k == blueprint {
+				found = true
+			}
+		}
+		if !found {
+			l.warn(fmt.Sprintf("supported_platforms[%d]", i), "blueprint",
+				"unknown blueprint %q (known: %s)", blueprint, strings.Join(known, ", "))
+		}
+	}
+}
+
+func (l *linter) checkPackages(pack *types.SoftwarePack) {
+	seen := make(map[string]bool)
+	for i, pkg := range pack.Packages {
+		path := fmt.Sprintf("packages[%d]", i)
+		source := sourceOf(pkg)
+
+		if _, err := packageCommands(source, pkg); err != nil {
+			l.error(path, "package", "%v", err)
+		}
+		if source == SourceCustom && pkg.Version != "" {
+			l.warn(path+".version", "package", "custom packages are installed by scripts; the version is ignored")
+		}
+		if seen[packageKey(pkg)] {
+			l.warn(path, "duplicate", "%s package %s is listed twice", source, pkg.Name)
+		}
+		seen[packageKey(pkg)] = true
+
+		for j, command := range pkg.PostInstall {
+			l.checkShell(fmt.Sprintf("%s.post_install[%d]", path, j), command)
+		}
+	}
+}
+
+// envName matches environment variable names that can be exported.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (l *linter) checkEnvironment(path string, environment map[string]string) {
+	keys := make([]string, 0, len(environment))
+	for key := range environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !envName.MatchString(key) {
+			l.error(fieldPath(path, key), "environment", "%q is not a valid environment variable name", key)
+		}
+		// Values are quoted so that only variable references are expanded
+		if value := environment[key]; strings.Contains(value, "`") || strings.Contains(value, "$(") {
+			l.warn(fieldPath(path, key), "environment", "command substitution isn't run; the value is set as written")
+		}
+	}
+}
+
+// shellRule is a pattern that flags a line of a script.
+type shellRule struct {
+	rule     string
+	severity Severity
+	pattern  *regexp.Regexp
+	message  string
+}
+
+// Commands that destroy the instance or run unreviewed code are dangerous;
+// the others break installs, which run unattended with the pack's scripts fed
+// to bash on stdin after set -e.
+var shellRules = []shellRule{
+	{
+		rule:     "dangerous",
+		severity: SeverityError,
+		pattern:  regexp.MustCompile(`\brm\s+(-[A-Za-z]+\s+|--[a-z-]+\s+)*-[A-Za-z]*[rR][A-Za-z]*\s+(-[A-Za-z]+\s+|--[a-z-]+\s+)*("?(/|/\*|~|~/|\$HOME/?|\$\{HOME\}/?)"?)(\s|$|;|&|\|)`),
+		message:  "removes the root or home directory",
+	},
+	{
+		rule:     "dangerous",
+		severity: SeverityError,
+		pattern:  regexp.MustCompile(`\bmkfs(\.\w+)?\s|\bdd\b.*\bof=/dev/(sd|xvd|nvme|hd)|>\s*/dev/(sd|xvd|nvme|hd)`),
+		message:  "overwrites a disk",
+	},
+	{
+		rule:     "dangerous",
+		severity: SeverityError,
+		pattern:  regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`),
+		message:  "is a fork bomb",
+	},
+	{
+		rule:     "dangerous",
+		severity: SeverityWarning,
+		pattern:  regexp.MustCompile(`\b(curl|wget)\b[^|;&]*\|\s*(sudo\s+(-\S+\s+)*)?(env\s+)?(ba|da|z)?sh\b`),
+		message:  "pipes a download into a shell; download it, check its checksum, then run it",
+	},
+	{
+		rule:     "dangerous",
+		severity: SeverityWarning,
+		pattern:  regexp.MustCompile(`\bchmod\s+(-R\s+)?(0?777|a\+rwx)\b`),
+		message:  "makes files writable by everyone",
+	},
+	{
+		rule:     "SC2115",
+		severity: SeverityWarning,
+		pattern:  regexp.MustCompile(`\brm\s+-[A-Za-z]*[rR][A-Za-z]*\s+"?\$\{?\w+\}?"?/`),
+		message:  `removes from a variable's path, which is / if the variable is empty; use "${var:?}/"`,
+	},
+	{
+		rule:     "SC2006",
+		severity: SeverityWarning,
+		pattern:  regexp.MustCompile("`[^`]*`"),
+		message:  "use $(...) instead of backquotes",
+	},
+	{
+		rule:     "SC2024",
+		severity: SeverityWarning,
+		pattern:  regexp.MustCompile(`\bsudo\s+[^|;&>]*[^0-9&]>{1,2}\s*/(etc|usr|opt|var|root)/`),
+		message:  "the redirect is done by the instance user, not sudo; use sudo tee",
+	},
+	{
+		rule:     "interactive",
+		severity: SeverityError,
+		pattern:  regexp.MustCompile(`\bapt(-get)?\s+(-\S+\s+)*(install|upgrade|dist-upgrade|remove|purge)\b`),
+		message:  "apt prompts for confirmation; pass -y",
+	},
+	{
+		rule:     "interactive",
+		severity: SeverityWarning,
+		pattern:  regexp.MustCompile(`(^|[;&|]\s*|\bsudo\s+)apt\s+`),
+		message:  "apt's command line isn't stable for scripts; use apt-get",
+	},
+	{
+		rule:     "stdin",
+		severity: SeverityError,
+		pattern:  regexp.MustCompile(`(^|[;&|(]\s*)read\b[^<]*$`),
+		message:  "read takes its input from the rest of the install script, which bash reads on stdin",
+	},
+	{
+		rule:     "exit",
+		severity: SeverityWarning,
+		pattern:  regexp.MustCompile(`(^|[;&|]\s*)exit(\s+0)?\s*($|[;&|)])`),
+		message:  "exit ends the whole install script, so later packages and scripts are skipped but the pack is recorded as installed",
+	},
+}
+
+// yesFlag matches the flags that stop apt-get prompting.
+var yesFlag = regexp.MustCompile(`(^|\s)(-[A-Za-z]*y[A-Za-z]*|--yes|--assume-yes)(\s|$)`)
+
+// heredoc matches the start of a here-document and captures its delimiter.
+var heredoc = regexp.MustCompile(`(^|[^<])<<(-?)\s*['"]?([A-Za-z_][A-Za-z0-9_]*)['"]?`)
+
+// checkShell checks a script's lines against shellRules and that its
+// here-documents are terminated, since an unterminated one would swallow the
+// rest of the install script.
+func (l *linter) checkShell(path string, content string) {
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := stripComment(lines[i])
+		at := fmt.Sprintf("%s:%d", path, i+1)
+
+		for _, rule := range shellRules {
+			if !rule.pattern.MatchString(line) {
+				continue
+			}
+			if rule.rule == "interactive" && rule.severity == SeverityError && yesFlag.MatchString(line) {
+				continue
+			}
+			l.add(rule.severity, at, rule.rule, "%s", rule.message)
+		}
+
+		if m := heredoc.FindStringSubmatch(line); m != nil {
+			end := i + 1
+			for ; end < len(lines); end++ {
+				terminator := lines[end]
+				if m[2] == "-" {
+					terminator = strings.TrimLeft(terminator, "\t")
+				}
+				if terminator == m[3] {
+					break
+				}
+			}
+			if end == len(lines) {
+				l.error(at, "heredoc", "here-document %s is never terminated", m[3])
+			}
+			i = end
+		}
+	}
+}
+
+// stripComment drops a trailing comment from a line of shell, ignoring #
+// inside quotes and words such as $#.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// checkSyntax parses a script with bash -n.
+func (l *linter) checkSyntax(ctx context.Context, bash, path, content string) {
+	cmd := exec.CommandContext(ctx, bash, "-n")
+	cmd.Stdin = strings.NewReader(content)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		return
+	}
+
+	// bash reports errors as "bash: line N: message", followed by a line
+	// quoting the offending code
+	reported := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		at := path
+		if _, rest, ok := strings.Cut(line, "line "); ok {
+			if n, message, ok := strings.Cut(rest, ": "); ok {
+				at, line = path+":"+n, message
+			}
+		}
+		if !reported[at] {
+			l.error(at, "syntax", "%s", line)
+			reported[at] = true
+		}
+	}
+}
+
+// fieldPath appends a field to a path.
+func fieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// HasErrors reports whether any finding is an error.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
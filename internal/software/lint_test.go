@@ -0,0 +1,255 @@
+package software
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+func TestLintSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		isJSON bool
+		want   []string
+	}{
+		{
+			name: "valid",
+			data: "id: stats\nname: Statistics\ntype: apt\nversion: \"1.0\"\npackages:\n  - name: r-base\n    source: apt\n",
+		},
+		{
+			name:   "JSON nulls",
+			data:   `{"id": "stats", "name": "Statistics", "type": "apt", "version": "1.0", "dependencies": null, "packages": [{"name": "r-base", "source": "apt"}]}`,
+			isJSON: true,
+		},
+		{
+			name: "JSON named as YAML",
+			data: `{"id": "stats", "name": "Statistics", "type": "apt", "version": "1.0", "packages": [{"name": "r-base"}]}`,
+			want: []string{"(pack): warning: file is JSON but named as YAML"},
+		},
+		{
+			name: "unquoted YAML version",
+			data: "id: stats\nname: Statistics\ntype: apt\nversion: 1.0\npackages:\n  - name: r-base\n",
+			want: []string{"version: error: must be string, not integer [schema]"},
+		},
+		{
+			name: "schema violations",
+			data: "id: -stats\nname: Statistics\ntype: docker\nversion: \"1.0\"\nlicence: MIT\npackages:\n  - name: r-base\n    source: cran\n  - version: \"2\"\nscripts:\n  - name: setup\n",
+			want: []string{
+				`id: error: "-stats" must match`,
+				"licence: error: is not a known field",
+				"packages[0].source: error: must be one of apt, pip, npm, snap, conda, deb, custom, not cran",
+				"packages[1].name: error: is required",
+				"scripts[0].content: error: is required",
+				"type: error: must be one of apt, container, script, mixed, not docker",
+			},
+		},
+		{
+			name: "container",
+			data: "id: rstudio\nname: RStudio\ntype: container\nversion: \"1.0\"\ncontainer:\n  image: rocker/rstudio:4.3.2\n  runtime: lxc\n  ports: [\"8787\", \"localhost:8787\"]\n  volumes: [\"~/projects:/home/rstudio/projects\"]\n  restart: always\n",
+			want: []string{
+				`container.ports[1]: error: "localhost:8787" must match`,
+				"container.restart: error: is not a known field",
+				"container.runtime: error: must be one of docker, podman, not lxc",
+			},
+		},
+		{
+			name: "not YAML",
+			data: "id: [",
+			want: []string{"(pack): error: failed to parse pack"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := Lint(context.Background(), []byte(tt.data), tt.isJSON, LintOptions{})
+			assertFindings(t, findings, tt.want)
+		})
+	}
+}
+
+func TestLintPack(t *testing.T) {
+	base := func() *types.SoftwarePack {
+		return &types.SoftwarePack{ID: "tools", Name: "Tools", Type: types.PackTypeMixed, Version: "1.0",
+			Packages: []types.Package{{Name: "git", Source: "apt"}}}
+	}
+	script := func(content string) *types.SoftwarePack {
+		pack := base()
+		pack.Scripts = []types.Script{{Name: "setup", Content: content, Type: "bash"}}
+		return pack
+	}
+
+	tests := []struct {
+		name string
+		pack *types.SoftwarePack
+		want []string
+	}{
+		{name: "clean", pack: script("sudo apt-get install -y jq\ncurl -fsSL https://example.com/tool.tar.gz | tar xz\necho \"done # not a comment\"")},
+		{
+			name: "type against sources",
+			pack: func() *types.SoftwarePack {
+				pack := base()
+				pack.Type = types.PackTypeAPT
+				pack.Packages = append(pack.Packages, types.Package{Name: "numpy", Source: "pip"}, types.Package{Name: "https://example.com/tool_1.0_amd64.deb", Source: "deb"})
+				return pack
+			}(),
+			want: []string{"packages[1].source: error: apt packs only install apt and deb packages, but numpy is from pip; use type mixed [type]"},
+		},
+		{
+			name: "script pack",
+			pack: func() *types.SoftwarePack {
+				pack := base()
+				pack.Type = types.PackTypeScript
+				return pack
+			}(),
+			want: []string{"packages[0].source: error: script packs only list custom packages", "scripts: error: script packs need at least one script"},
+		},
+		{
+			name: "unknown blueprint",
+			pack: func() *types.SoftwarePack {
+				pack := base()
+				pack.Supported = []string{"ubuntu_22_04", "windows_2022"}
+				return pack
+			}(),
+			want: []string{`supported_platforms[1]: warning: unknown blueprint "windows_2022"`},
+		},
+		{
+			name: "packages and environment",
+			pack: func() *types.SoftwarePack {
+				pack := base()
+				pack.Version = ""
+				pack.Dependencies = []string{"tools", "base", "base@1.0"}
+				pack.Packages = append(pack.Packages, types.Package{Name: "git", Source: "apt"}, types.Package{Name: "tool.deb", Source: "deb"})
+				pack.Environment = map[string]string{"MY-VAR": "1", "GREETING": "$(whoami)"}
+				return pack
+			}(),
+			want: []string{
+				"version: warning: packs without a version",
+				"dependencies[0]: error: pack depends on itself",
+				"dependencies[2]: warning: dependency base is listed twice",
+				"packages[1]: warning: apt package git is listed twice",
+				"packages[2]: error: deb packages must be named by their URL",
+				"environment.GREETING: warning: command substitution isn't run",
+				`environment.MY-VAR: error: "MY-VAR" is not a valid environment variable name`,
+			},
+		},
+		{
+			name: "dangerous",
+			pack: script("sudo rm -rf /\nrm -rf ~/.cache\nrm -r -f \"$HOME\"\ncurl -fsSL https://get.example.com | sudo bash\nwget -qO- https://example.com/i.sh | sh\nsudo dd if=/dev/zero of=/dev/xvda\nchmod -R 777 /opt/data\nrm -rf $BUILD/*\n# rm -rf / in a comment"),
+			want: []string{
+				"scripts[0].content:1: error: removes the root or home directory [dangerous]",
+				"scripts[0].content:3: error: removes the root or home directory [dangerous]",
+				"scripts[0].content:4: warning: pipes a download into a shell",
+				"scripts[0].content:5: warning: pipes a download into a shell",
+				"scripts[0].content:6: error: overwrites a disk [dangerous]",
+				"scripts[0].content:7: warning: makes files writable by everyone [dangerous]",
+				"scripts[0].content:8: warning: removes from a variable's path",
+			},
+		},
+		{
+			name: "unattended",
+			pack: script("sudo apt-get install jq\nsudo apt install -y tree\nVERSION=`uname -r`\nsudo echo 'vm.swappiness=10' > /etc/sysctl.d/99-swap.conf\nread -p 'Continue? ' answer\nread -r line < /etc/hostname\nexit 0\n[ -f /opt/x ] || exit 1"),
+			want: []string{
+				"scripts[0].content:1: error: apt prompts for confirmation; pass -y [interactive]",
+				"scripts[0].content:2: warning: apt's command line isn't stable for scripts; use apt-get [interactive]",
+				"scripts[0].content:3: warning: use $(...) instead of backquotes [SC2006]",
+				"scripts[0].content:4: warning: the redirect is done by the instance user, not sudo; use sudo tee [SC2024]",
+				"scripts[0].content:5: error: read takes its input from the rest of the install script",
+				"scripts[0].content:7: warning: exit ends the whole install script",
+			},
+		},
+		{
+			name: "here-documents",
+			pack: script("cat > /tmp/a <<EOF\nrm -rf /\nEOF\ncat <<-'INDENTED'\n\tok\n\tINDENTED\ngrep x <<< \"$y\"\ncat > /tmp/b <<END\nnever ends"),
+			want: []string{"scripts[0].content:8: error: here-document END is never terminated [heredoc]"},
+		},
+		{
+			name: "script fields",
+			pack: func() *types.SoftwarePack {
+				pack := script("echo hi")
+				pack.Scripts = append(pack.Scripts, types.Script{Name: "setup", Content: "print('hi')", Type: "python", RunAs: "root"})
+				pack.Packages[0].PostInstall = []string{"git config --system init.defaultBranch main", "sudo apt-get upgrade"}
+				return pack
+			}(),
+			want: []string{
+				"packages[0].post_install[1]:1: error: apt prompts for confirmation",
+				`scripts[1].name: warning: script "setup" is defined twice`,
+				`scripts[1].type: warning: scripts run with bash; type "python" is ignored`,
+				"scripts[1].run_as: warning: run_as is ignored",
+			},
+		},
+		{
+			name: "container",
+			pack: &types.SoftwarePack{ID: "rstudio", Name: "RStudio", Type: types.PackTypeContainer, Version: "1.0",
+				Container: &types.Container{Image: "rocker/rstudio", Ports: []string{"8787"}}},
+			want: []string{"container.image: warning: pin the image to a tag or digest"},
+		},
+		{
+			name: "container without ports",
+			pack: &types.SoftwarePack{ID: "worker", Name: "Worker", Type: types.PackTypeContainer, Version: "1.0",
+				Container: &types.Container{Image: "example/worker:1.0"}},
+			want: []string{"container.ports: warning: the container publishes no ports"},
+		},
+		{
+			name: "invalid container",
+			pack: &types.SoftwarePack{ID: "rstudio", Name: "RStudio", Type: types.PackTypeContainer, Version: "1.0",
+				Container: &types.Container{Image: "rocker/rstudio:4.3.2", Ports: []string{"8787", "8787"}}},
+			want: []string{"container: error: port 8787 is published twice [container]"},
+		},
+		{
+			name: "container type",
+			pack: func() *types.SoftwarePack {
+				pack := base()
+				pack.Container = &types.Container{Image: "rocker/rstudio:4.3.2", Ports: []string{"8787"}}
+				return pack
+			}(),
+			want: []string{"type: error: only container packs run containers; use type container [type]"},
+		},
+		{
+			name: "container pack without container",
+			pack: &types.SoftwarePack{ID: "rstudio", Name: "RStudio", Type: types.PackTypeContainer, Version: "1.0",
+				Packages: []types.Package{{Name: "git", Source: "apt"}}},
+			want: []string{"container: error: container packs need a container [type]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertFindings(t, LintPack(context.Background(), tt.pack, LintOptions{}), tt.want)
+		})
+	}
+}
+
+func TestLintSyntax(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	pack := &types.SoftwarePack{ID: "tools", Name: "Tools", Type: types.PackTypeScript, Version: "1.0",
+		Scripts: []types.Script{{Name: "setup", Content: "if [ -d /opt ]; then\n  echo ok\nfi\nfi"}}}
+	findings := LintPack(context.Background(), pack, LintOptions{Bash: bash})
+	assertFindings(t, findings, []string{"scripts[0].content:4: error: syntax error near unexpected token"})
+}
+
+// assertFindings checks that each finding starts with the wanted string at
+// the same position.
+func assertFindings(t *testing.T, findings []Finding, want []string) {
+	t.Helper()
+
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.String())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d findings, got %d:\n%s", len(want), len(got), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("expected finding %d to start with %q, got %q", i, want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package software
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// RegistryDir is the directory on an instance holding a JSON record of each
+// pack installed on it, named after the pack's ID.
+const RegistryDir = "$HOME/.lfr-tools/software"
+
+// ReadRegistryScript prints every record in an instance's registry.
+const ReadRegistryScript = `for f in "` + RegistryDir + `"/*.json; do
+  [ -f "$f" ] && cat "$f" && echo
+done
+true
+`
+
+// packID matches pack IDs that are safe to use as file names.
+var packID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ParseRegistry reads the records printed by ReadRegistryScript, sorted by
+// pack ID.
+func ParseRegistry(data []byte) ([]*types.InstallResult, error) {
+	var records []*types.InstallResult
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var record types.InstallResult
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse software registry: %w", err)
+		}
+		records = append(records, &record)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].PackID < records[j].PackID })
+	return records, nil
+}
+
+// RecordScript returns a script that writes a pack's record to the registry,
+// replacing any earlier one.
+func RecordScript(result *types.InstallResult) (string, error) {
+	if !packID.MatchString(result.PackID) {
+		return "", fmt.Errorf("invalid pack ID %q", result.PackID)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal install record: %w", err)
+	}
+
+	path := RegistryDir + "/" + result.PackID + ".json"
+	return fmt.Sprintf("mkdir -p \"%s\"\ncat > \"%s.tmp\" <<'LFR_RECORD'\n%s\nLFR_RECORD\nmv \"%s.tmp\" \"%s\"\n",
+		RegistryDir, path, data, path, path), nil
+}
+
+// Satisfied reports whether a pack's record shows this version of it
+// installed successfully.
+func Satisfied(records []*types.InstallResult, pack *types.SoftwarePack) bool {
+	record := Find(records, pack.ID)
+	return record != nil && record.Success && record.Version == pack.Version
+}
+
+// Find returns a pack's record, or nil.
+func Find(records []*types.InstallResult, id string) *types.InstallResult {
+	for _, record := range records {
+		if record.PackID == id {
+			return record
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package software
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+func TestRecordScriptRoundTrip(t *testing.T) {
+	result := &types.InstallResult{
+		PackID:      "python-dev",
+		Version:     "1.0",
+		Success:     true,
+		Message:     "Installation completed",
+		InstalledAt: "2024-01-15T10:00:00Z",
+		Packages:    []string{"python3", "git"},
+	}
+
+	script, err := RecordScript(result)
+	if err != nil {
+		t.Fatalf("RecordScript failed: %v", err)
+	}
+	if !strings.Contains(script, `mv "$HOME/.lfr-tools/software/python-dev.json.tmp" "$HOME/.lfr-tools/software/python-dev.json"`) {
+		t.Errorf("expected the record to replace python-dev.json, got:\n%s", script)
+	}
+
+	// The heredoc's body is what ReadRegistryScript prints back
+	body := strings.Split(script, "\n")[2]
+	records, err := ParseRegistry([]byte(body + "\n" + `{"pack_id":"data-science","version":"1.0","success":false}` + "\n"))
+	if err != nil {
+		t.Fatalf("ParseRegistry failed: %v", err)
+	}
+	if len(records) != 2 || records[0].PackID != "data-science" || records[1].PackID != "python-dev" {
+		t.Fatalf("expected both records sorted by pack ID, got %+v", records)
+	}
+	if got := records[1]; !got.Success || got.Version != "1.0" || strings.Join(got.Packages, ",") != "python3,git" {
+		t.Errorf("expected the record to round trip, got %+v", got)
+	}
+
+	if _, err := RecordScript(&types.InstallResult{PackID: "../etc"}); err == nil {
+		t.Error("expected a pack ID that isn't a file name to be rejected")
+	}
+	if _, err := ParseRegistry([]byte("not json")); err == nil {
+		t.Error("expected an unparseable registry to fail")
+	}
+}
+
+func TestSatisfied(t *testing.T) {
+	records := []*types.InstallResult{
+		{PackID: "python-dev", Version: "1.0", Success: true},
+		{PackID: "gpu-ml", Version: "1.0", Success: false},
+	}
+
+	tests := []struct {
+		name string
+		pack *types.SoftwarePack
+		want bool
+	}{
+		{name: "installed", pack: &types.SoftwarePack{ID: "python-dev", Version: "1.0"}, want: true},
+		{name: "other version", pack: &types.SoftwarePack{ID: "python-dev", Version: "1.1"}, want: false},
+		{name: "failed", pack: &types.SoftwarePack{ID: "gpu-ml", Version: "1.0"}, want: false},
+		{name: "not installed", pack: &types.SoftwarePack{ID: "web-dev", Version: "1.0"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Satisfied(records, tt.pack); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEnvironmentScript(t *testing.T) {
+	script := EnvironmentScript("python-dev", map[string]string{
+		"PATH":             "/home/ubuntu/.local/bin:$PATH",
+		"PYTHON_USER_BASE": "/home/ubuntu/.local",
+	})
+
+	want := `sed -i '/^# BEGIN lfr-tools pack=python-dev$/,/^# END lfr-tools pack=python-dev$/d' ~/.bashrc
+cat >> ~/.bashrc <<'LFR_ENV'
+# BEGIN lfr-tools pack=python-dev
+export PATH="/home/ubuntu/.local/bin:$PATH"
+export PYTHON_USER_BASE="/home/ubuntu/.local"
+# END lfr-tools pack=python-dev
+LFR_ENV
+`
+	if !strings.HasSuffix(script, want) {
+		t.Errorf("expected the pack's block to be replaced, got:\n%s", script)
+	}
+
+	// Values can't run commands or end the quotes
+	script = EnvironmentScript("tools", map[string]string{"GREETING": "say \"hi\" $(id) `id` ${HOME} $5 \\\nnext"})
+	if want := `export GREETING="say \"hi\" \$(id) \` + "`id\\`" + ` ${HOME} \$5 \\"$'\n'"next"` + "\n"; !strings.Contains(script, want) {
+		t.Errorf("expected the value to be escaped as %q, got:\n%s", want, script)
+	}
+
+	if got := EnvironmentScript("python3.11", nil); strings.Contains(got, ">>") || !strings.Contains(got, `pack=python3\.11$`) {
+		t.Errorf("expected only the block's removal, got:\n%s", got)
+	}
+}
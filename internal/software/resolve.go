@@ -0,0 +1,242 @@
+// Package software resolves software packs and their dependencies into the
+// order they are installed in, and generates the scripts that install them.
+package software
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// ErrCycle is returned when packs depend on each other.
+var ErrCycle = errors.New("dependency cycle")
+
+// ErrVersionConflict is returned when packs need different versions of a
+// pack.
+var ErrVersionConflict = errors.New("version conflict")
+
+// Lookup finds a pack by reference, an ID optionally pinned to a version as
+// in python-dev@1.1.
+type Lookup func(ref string) (*types.SoftwarePack, error)
+
+// Resolve returns the packs needed to install the packs in refs, each after
+// the packs it depends on. Packs shared by several dependents appear once.
+func Resolve(refs []string, lookup Lookup) ([]*types.SoftwarePack, error) {
+	r := &resolver{
+		lookup:   lookup,
+		state:    make(map[string]int),
+		resolved: make(map[string]*types.SoftwarePack),
+	}
+	for _, ref := range refs {
+		if err := r.visit(ref, nil); err != nil {
+			return nil, err
+		}
+	}
+	return r.order, nil
+}
+
+// Visit states of a depth-first search.
+const (
+	unvisited = iota
+	visiting
+	visited
+)
+
+type resolver struct {
+	lookup   Lookup
+	state    map[string]int
+	resolved map[string]*types.SoftwarePack
+	order    []*types.SoftwarePack
+}
+
+// visit appends a pack to the order after its dependencies. path is the chain
+// of dependents that led to it.
+func (r *resolver) visit(ref string, path []string) error {
+	id, version := ParseRef(ref)
+
+	switch r.state[id] {
+	case visited:
+		// An unpinned reference accepts whichever version was resolved
+		if resolved := r.resolved[id]; version != "" && resolved.Version != version {
+			return fmt.Errorf("%w: %s is needed at %s by %s but %s was already chosen",
+				ErrVersionConflict, id, version, dependent(path), resolved.Version)
+		}
+		return nil
+	case visiting:
+		start := 0
+		for i, p := range path {
+			if p == id {
+				start = i
+			}
+		}
+		cycle := append(append([]string(nil), path[start:]...), id)
+		return fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycle, " -> "))
+	}
+
+	pack, err := r.lookup(ref)
+	if err != nil {
+		if len(path) > 0 {
+			return fmt.Errorf("pack '%s' required by '%s': %w", id, path[len(path)-1], err)
+		}
+		return err
+	}
+
+	r.state[id] = visiting
+	for _, dep := range pack.Dependencies {
+		if err := r.visit(dep, append(path, id)); err != nil {
+			return err
+		}
+	}
+	r.state[id] = visited
+
+	r.resolved[id] = pack
+	r.order = append(r.order, pack)
+	return nil
+}
+
+// dependent names the pack at the end of a dependency path.
+func dependent(path []string) string {
+	if len(path) == 0 {
+		return "the command line"
+	}
+	return "'" + path[len(path)-1] + "'"
+}
+
+// Conflict is a package or environment variable that two packs set
+// differently, or a port two container packs both publish.
+type Conflict struct {
+	// Kind is "package", "environment" or "port".
+	Kind string
+	Name string
+	// Packs and Values are the two packs and what each sets.
+	Packs  [2]string
+	Values [2]string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s %s: '%s' wants %s, '%s' wants %s",
+		c.Kind, c.Name, c.Packs[0], c.Values[0], c.Packs[1], c.Values[1])
+}
+
+// Conflicts returns the packages pinned to different versions, the
+// environment variables set to different values and the ports published by
+// more than one container of packs that would be installed together.
+// Variables whose value refers to themselves, such as PATH=/opt/bin:$PATH,
+// extend each other and never conflict.
+func Conflicts(packs []*types.SoftwarePack) []Conflict {
+	type setting struct {
+		pack  string
+		value string
+	}
+
+	var conflicts []Conflict
+	versions := make(map[string]setting)
+	environment := make(map[string]setting)
+	ports := make(map[string]setting)
+
+	for _, pack := range packs {
+		for _, pkg := range pack.Packages {
+			if pkg.Version == "" {
+				continue
+			}
+			key := packageKey(pkg)
+			if seen, ok := versions[key]; ok && seen.value != pkg.Version && seen.pack != pack.ID {
+				conflicts = append(conflicts, Conflict{
+					Kind:   "package",
+					Name:   key,
+					Packs:  [2]string{seen.pack, pack.ID},
+					Values: [2]string{seen.value, pkg.Version},
+				})
+				continue
+			}
+			versions[key] = setting{pack: pack.ID, value: pkg.Version}
+		}
+
+		keys := make([]string, 0, len(pack.Environment))
+		for key := range pack.Environment {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := pack.Environment[key]
+			if extends(key, value) {
+				continue
+			}
+			if seen, ok := environment[key]; ok && seen.value != value {
+				conflicts = append(conflicts, Conflict{
+					Kind:   "environment",
+					Name:   key,
+					Packs:  [2]string{seen.pack, pack.ID},
+					Values: [2]string{seen.value, value},
+				})
+				continue
+			}
+			environment[key] = setting{pack: pack.ID, value: value}
+		}
+
+		if pack.Container == nil {
+			continue
+		}
+		published, _ := ContainerPorts(pack.Container)
+		for _, port := range published {
+			key := strconv.Itoa(port.Host)
+			if seen, ok := ports[key]; ok && seen.pack != pack.ID {
+				conflicts = append(conflicts, Conflict{
+					Kind:   "port",
+					Name:   key,
+					Packs:  [2]string{seen.pack, pack.ID},
+					Values: [2]string{seen.value, pack.Container.Image},
+				})
+				continue
+			}
+			ports[key] = setting{pack: pack.ID, value: pack.Container.Image}
+		}
+	}
+	return conflicts
+}
+
+// extends reports whether value refers to the variable key it is assigned to.
+func extends(key, value string) bool {
+	return strings.Contains(value, "$"+key) || strings.Contains(value, "${"+key+"}")
+}
+
+// InstalledProbe returns a script that prints the ID of each pack whose APT
+// packages are all installed. Packs without APT packages can't be detected
+// and are never reported; if none of packs can be, the script is empty. It
+// finds packs installed before the instance had a registry, or by hand.
+func InstalledProbe(packs []*types.SoftwarePack) string {
+	var b strings.Builder
+	for _, pack := range packs {
+		var names []string
+		for _, pkg := range pack.Packages {
+			if pkg.Source == SourceAPT || pkg.Source == "" {
+				names = append(names, word(pkg.Name))
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "dpkg -s %s >/dev/null 2>&1 && echo %s\n", strings.Join(names, " "), word(pack.ID))
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	b.WriteString("true\n")
+	return b.String()
+}
+
+// ParseInstalled reads the pack IDs printed by an InstalledProbe script.
+func ParseInstalled(output string) map[string]bool {
+	installed := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if id := strings.TrimSpace(line); id != "" {
+			installed[id] = true
+		}
+	}
+	return installed
+}
@@ -0,0 +1,174 @@
+package software
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+func lookupIn(packs ...*types.SoftwarePack) Lookup {
+	byID := make(map[string]*types.SoftwarePack)
+	for _, pack := range packs {
+		byID[pack.ID] = pack
+	}
+	return func(id string) (*types.SoftwarePack, error) {
+		if pack, ok := byID[id]; ok {
+			return pack, nil
+		}
+		return nil, fmt.Errorf("software pack '%s' not found", id)
+	}
+}
+
+func pack(id string, deps ...string) *types.SoftwarePack {
+	return &types.SoftwarePack{ID: id, Dependencies: deps}
+}
+
+func TestResolve(t *testing.T) {
+	lookup := lookupIn(
+		pack("python-dev"),
+		pack("data-science", "python-dev"),
+		pack("gpu-ml", "python-dev"),
+		pack("course", "data-science", "gpu-ml"),
+		pack("a", "b"),
+		pack("b", "c"),
+		pack("c", "a"),
+		pack("self", "self"),
+		pack("broken", "missing"),
+	)
+
+	tests := []struct {
+		name    string
+		ids     []string
+		want    string
+		wantErr string
+	}{
+		{name: "no dependencies", ids: []string{"python-dev"}, want: "python-dev"},
+		{name: "dependency first", ids: []string{"data-science"}, want: "python-dev,data-science"},
+		{name: "shared dependency once", ids: []string{"course"}, want: "python-dev,data-science,gpu-ml,course"},
+		{name: "several roots", ids: []string{"gpu-ml", "data-science"}, want: "python-dev,gpu-ml,data-science"},
+		{name: "cycle", ids: []string{"a"}, wantErr: "dependency cycle: a -> b -> c -> a"},
+		{name: "self dependency", ids: []string{"self"}, wantErr: "dependency cycle: self -> self"},
+		{name: "missing dependency", ids: []string{"broken"}, wantErr: "required by 'broken'"},
+		{name: "missing pack", ids: []string{"nope"}, wantErr: "software pack 'nope' not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packs, err := Resolve(tt.ids, lookup)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+
+			var ids []string
+			for _, p := range packs {
+				ids = append(ids, p.ID)
+			}
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("expected order %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := Resolve([]string{"a"}, lookup); !errors.Is(err, ErrCycle) {
+		t.Errorf("expected ErrCycle, got %v", err)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		packs []*types.SoftwarePack
+		want  []string
+	}{
+		{
+			name: "same version",
+			packs: []*types.SoftwarePack{
+				{ID: "a", Packages: []types.Package{{Name: "nodejs", Source: "apt", Version: "18"}}},
+				{ID: "b", Packages: []types.Package{{Name: "nodejs", Source: "apt", Version: "18"}}},
+			},
+		},
+		{
+			name: "unpinned",
+			packs: []*types.SoftwarePack{
+				{ID: "a", Packages: []types.Package{{Name: "nodejs", Source: "apt", Version: "18"}}},
+				{ID: "b", Packages: []types.Package{{Name: "nodejs", Source: "apt"}}},
+			},
+		},
+		{
+			name: "different versions",
+			packs: []*types.SoftwarePack{
+				{ID: "a", Packages: []types.Package{{Name: "numpy", Source: "pip", Version: "1.26"}}},
+				{ID: "b", Packages: []types.Package{{Name: "numpy", Source: "pip", Version: "2.0"}}},
+			},
+			want: []string{"package pip:numpy: 'a' wants 1.26, 'b' wants 2.0"},
+		},
+		{
+			name: "different sources",
+			packs: []*types.SoftwarePack{
+				{ID: "a", Packages: []types.Package{{Name: "node", Source: "apt", Version: "18"}}},
+				{ID: "b", Packages: []types.Package{{Name: "node", Source: "snap", Version: "20"}}},
+			},
+		},
+		{
+			name: "environment",
+			packs: []*types.SoftwarePack{
+				{ID: "a", Environment: map[string]string{"CUDA_VISIBLE_DEVICES": "0", "PATH": "/opt/a:$PATH"}},
+				{ID: "b", Environment: map[string]string{"CUDA_VISIBLE_DEVICES": "1", "PATH": "/opt/b:${PATH}"}},
+			},
+			want: []string{"environment CUDA_VISIBLE_DEVICES: 'a' wants 0, 'b' wants 1"},
+		},
+		{
+			name: "ports",
+			packs: []*types.SoftwarePack{
+				{ID: "jupyter", Container: &types.Container{Image: "quay.io/jupyter/base-notebook:2024-10-07", Ports: []string{"8888"}}},
+				{ID: "rstudio", Container: &types.Container{Image: "rocker/rstudio:4.3.2", Ports: []string{"8787"}}},
+				{ID: "lab", Container: &types.Container{Image: "example/lab:1.0", Ports: []string{"8888:8080"}}},
+			},
+			want: []string{"port 8888: 'jupyter' wants quay.io/jupyter/base-notebook:2024-10-07, 'lab' wants example/lab:1.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, conflict := range Conflicts(tt.packs) {
+				got = append(got, conflict.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("expected conflicts %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInstalledProbe(t *testing.T) {
+	script := InstalledProbe([]*types.SoftwarePack{
+		{ID: "python-dev", Packages: []types.Package{{Name: "python3", Source: "apt"}, {Name: "numpy", Source: "pip"}, {Name: "git", Source: "apt"}}},
+		{ID: "scripts-only", Packages: []types.Package{{Name: "rstudio-server", Source: "custom"}}},
+	})
+
+	if !strings.Contains(script, "dpkg -s python3 git >/dev/null 2>&1 && echo python-dev\n") {
+		t.Errorf("expected a dpkg check of the APT packages, got %q", script)
+	}
+	if strings.Contains(script, "scripts-only") {
+		t.Errorf("expected packs without APT packages to be left out, got %q", script)
+	}
+
+	if got := InstalledProbe([]*types.SoftwarePack{{ID: "scripts-only"}}); got != "" {
+		t.Errorf("expected no probe when no pack can be detected, got %q", got)
+	}
+
+	installed := ParseInstalled("python-dev\n\n")
+	if !installed["python-dev"] || len(installed) != 1 {
+		t.Errorf("expected python-dev to be installed, got %v", installed)
+	}
+}
@@ -0,0 +1,188 @@
+package software
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is the JSON schema of a pack definition.
+//
+//go:embed pack.schema.json
+var Schema []byte
+
+// schema is the subset of JSON schema that Schema uses.
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 schemaTypes        `json:"type"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	MinLength            *int               `json:"minLength"`
+	Definitions          map[string]*schema `json:"definitions"`
+}
+
+// schemaTypes is a type keyword, which is a type or a list of types.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// validateSchema checks a decoded JSON document against Schema, returning an
+// error finding for each violation.
+func validateSchema(doc interface{}) []Finding {
+	var root schema
+	if err := json.Unmarshal(Schema, &root); err != nil {
+		// Schema is embedded, so this is a build problem
+		panic(fmt.Sprintf("invalid pack schema: %v", err))
+	}
+
+	v := &validator{root: &root}
+	v.validate(&root, doc, "")
+	return v.findings
+}
+
+type validator struct {
+	root     *schema
+	findings []Finding
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	v.findings = append(v.findings, Finding{
+		Severity: SeverityError,
+		Path:     path,
+		Rule:     "schema",
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(s *schema, value interface{}, path string) {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/definitions/")
+		s = v.root.Definitions[name]
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		v.fail(path, "must be %s, not %s", strings.Join(s.Type, " or "), jsonType(value))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		var allowed []string
+		for _, e := range s.Enum {
+			if e == value {
+				found = true
+			}
+			if e != "" {
+				allowed = append(allowed, fmt.Sprint(e))
+			}
+		}
+		if !found {
+			v.fail(path, "must be one of %s, not %v", strings.Join(allowed, ", "), value)
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		if s.MinLength != nil && len(value) < *s.MinLength {
+			v.fail(path, "must not be empty")
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(value) {
+			v.fail(path, "%q must match %s", value, s.Pattern)
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := value[key]; !ok {
+				v.fail(fieldPath(path, key), "is required")
+			}
+		}
+
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var additional schema
+		allowAdditional := true
+		if len(s.AdditionalProperties) > 0 {
+			if err := json.Unmarshal(s.AdditionalProperties, &allowAdditional); err != nil {
+				allowAdditional = true
+				if err := json.Unmarshal(s.AdditionalProperties, &additional); err != nil {
+					panic(fmt.Sprintf("invalid pack schema: %v", err))
+				}
+			}
+		}
+
+		for _, key := range keys {
+			if property, ok := s.Properties[key]; ok {
+				v.validate(property, value[key], fieldPath(path, key))
+				continue
+			}
+			if !allowAdditional {
+				v.fail(fieldPath(path, key), "is not a known field")
+				continue
+			}
+			v.validate(&additional, value[key], fieldPath(path, key))
+		}
+	}
+}
+
+// matches reports whether a decoded JSON value has one of the types.
+func (t schemaTypes) matches(value interface{}) bool {
+	actual := jsonType(value)
+	for _, want := range t {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON schema type of a decoded JSON value.
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,308 @@
+package ssh
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Forward is a local port forwarded to an address as seen from the instance.
+type Forward struct {
+	// LocalAddr is the host:port to listen on locally.
+	LocalAddr string `json:"local"`
+	// RemoteAddr is the host:port the instance connects to.
+	RemoteAddr string `json:"remote"`
+}
+
+// String formats a forward the way ParseForward accepts it.
+func (f Forward) String() string {
+	return f.LocalAddr + ":" + f.RemoteAddr
+}
+
+// ParseForward parses a forward in one of the forms
+//
+//	port                       same port on both ends
+//	local_port:remote_port
+//	local_port:host:remote_port
+//	bind_address:local_port:host:remote_port
+//
+// Local ports bind to localhost unless a bind address is given, and remote
+// ports are on the instance's localhost unless a host is given. IPv6
+// addresses are written in brackets, as in [::1]:8888:localhost:8888.
+func ParseForward(spec string) (Forward, error) {
+	parts, err := splitForward(spec)
+	if err != nil {
+		return Forward{}, fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+
+	var bind, localPort, host, remotePort string
+	switch len(parts) {
+	case 1:
+		bind, localPort, host, remotePort = "localhost", parts[0], "localhost", parts[0]
+	case 2:
+		bind, localPort, host, remotePort = "localhost", parts[0], "localhost", parts[1]
+	case 3:
+		bind, localPort, host, remotePort = "localhost", parts[0], parts[1], parts[2]
+	case 4:
+		bind, localPort, host, remotePort = parts[0], parts[1], parts[2], parts[3]
+	default:
+		return Forward{}, fmt.Errorf("invalid forward %q: expected local_port:remote_port", spec)
+	}
+
+	for _, port := range []string{localPort, remotePort} {
+		if _, err := ParsePort(port); err != nil {
+			return Forward{}, fmt.Errorf("invalid forward %q: %w", spec, err)
+		}
+	}
+	if bind == "" || host == "" {
+		return Forward{}, fmt.Errorf("invalid forward %q: empty host", spec)
+	}
+
+	return Forward{
+		LocalAddr:  net.JoinHostPort(bind, localPort),
+		RemoteAddr: net.JoinHostPort(host, remotePort),
+	}, nil
+}
+
+// splitForward splits a forward on colons, keeping bracketed IPv6 addresses
+// whole.
+func splitForward(spec string) ([]string, error) {
+	var parts []string
+	for {
+		if strings.HasPrefix(spec, "[") {
+			end := strings.Index(spec, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']' in address")
+			}
+			parts = append(parts, spec[1:end])
+			spec = spec[end+1:]
+			if spec == "" {
+				return parts, nil
+			}
+			if spec[0] != ':' {
+				return nil, fmt.Errorf("expected ':' after ']'")
+			}
+			spec = spec[1:]
+			continue
+		}
+
+		i := strings.Index(spec, ":")
+		if i < 0 {
+			return append(parts, spec), nil
+		}
+		parts = append(parts, spec[:i])
+		spec = spec[i+1:]
+	}
+}
+
+// ParsePort parses a TCP port number.
+func ParsePort(port string) (int, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("invalid port %q", port)
+	}
+	return n, nil
+}
+
+// Forward accepts connections on listener and forwards each one to
+// remoteAddr through the instance until ctx is done or the listener fails.
+// The listener is closed on return.
+func (c *Client) Forward(ctx context.Context, listener net.Listener, remoteAddr string) error {
+	return c.serve(ctx, listener, func(local net.Conn) {
+		remote, err := c.conn.Dial("tcp", remoteAddr)
+		if err != nil {
+			return
+		}
+		pipe(local, remote)
+	})
+}
+
+// ServeSOCKS runs a SOCKS5 proxy on listener whose connections are made from
+// the instance, until ctx is done or the listener fails. Only the CONNECT
+// command without authentication is supported. The listener is closed on
+// return.
+func (c *Client) ServeSOCKS(ctx context.Context, listener net.Listener) error {
+	return c.serve(ctx, listener, func(local net.Conn) {
+		target, err := socksHandshake(local)
+		if err != nil {
+			return
+		}
+
+		remote, err := c.conn.Dial("tcp", target)
+		if err != nil {
+			socksReply(local, socksHostUnreachable)
+			return
+		}
+		if err := socksReply(local, socksSucceeded); err != nil {
+			remote.Close()
+			return
+		}
+		pipe(local, remote)
+	})
+}
+
+// serve accepts connections on listener and handles each in a goroutine,
+// closing them all when ctx is done.
+func (c *Client) serve(ctx context.Context, listener net.Listener, handle func(net.Conn)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	open := make(map[net.Conn]struct{})
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		mu.Lock()
+		for conn := range open {
+			conn.Close()
+		}
+		mu.Unlock()
+	}()
+
+	var err error
+	for {
+		var conn net.Conn
+		conn, err = listener.Accept()
+		if err != nil {
+			break
+		}
+
+		mu.Lock()
+		open[conn] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				conn.Close()
+				mu.Lock()
+				delete(open, conn)
+				mu.Unlock()
+			}()
+			handle(conn)
+		}()
+	}
+
+	cancel()
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("failed to accept connection on %s: %w", listener.Addr(), err)
+}
+
+// pipe copies between two connections until either side is done, then closes
+// the remote one.
+func pipe(local, remote net.Conn) {
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// SOCKS5 protocol values (RFC 1928).
+const (
+	socksVersion         = 5
+	socksNoAuth          = 0
+	socksNoAcceptable    = 0xff
+	socksConnect         = 1
+	socksIPv4            = 1
+	socksDomain          = 3
+	socksIPv6            = 4
+	socksSucceeded       = 0
+	socksHostUnreachable = 4
+	socksNotSupported    = 7
+)
+
+// socksHandshake negotiates a SOCKS5 CONNECT request and returns its target.
+func socksHandshake(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == socksNoAcceptable {
+		return "", errors.New("SOCKS client requires authentication")
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[0] != socksVersion || request[1] != socksConnect {
+		socksReply(conn, socksNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksIPv4, socksIPv6:
+		size := net.IPv4len
+		if request[3] == socksIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		socksReply(conn, socksNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksReply sends a SOCKS5 reply with an unspecified bound address.
+func socksReply(conn net.Conn, status byte) error {
+	_, err := conn.Write([]byte{socksVersion, status, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,189 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/lfr-tools/internal/testutils"
+)
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec    string
+		local   string
+		remote  string
+		wantErr bool
+	}{
+		{spec: "8888", local: "localhost:8888", remote: "localhost:8888"},
+		{spec: "9000:8787", local: "localhost:9000", remote: "localhost:8787"},
+		{spec: "5433:db.internal:5432", local: "localhost:5433", remote: "db.internal:5432"},
+		{spec: "0.0.0.0:8080:localhost:80", local: "0.0.0.0:8080", remote: "localhost:80"},
+		{spec: "[::1]:8888:localhost:8888", local: "[::1]:8888", remote: "localhost:8888"},
+		{spec: "8888:[fd00::5]:5432", local: "localhost:8888", remote: "[fd00::5]:5432"},
+		{spec: "[::]:8080:[::1]:80", local: "[::]:8080", remote: "[::1]:80"},
+		{spec: "jupyter", wantErr: true},
+		{spec: "[::1:8888:localhost:8888", wantErr: true},
+		{spec: "[::1]8888:localhost:8888", wantErr: true},
+		{spec: "8888:70000", wantErr: true},
+		{spec: "8888::80", wantErr: true},
+		{spec: "a:b:c:d:e", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			forward, err := ParseForward(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", forward)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseForward failed: %v", err)
+			}
+			if forward.LocalAddr != tt.local || forward.RemoteAddr != tt.remote {
+				t.Errorf("expected %s -> %s, got %s -> %s", tt.local, tt.remote, forward.LocalAddr, forward.RemoteAddr)
+			}
+			if again, err := ParseForward(forward.String()); err != nil || again != forward {
+				t.Errorf("expected %s to parse back to the same forward, got %+v, %v", forward, again, err)
+			}
+		})
+	}
+}
+
+// echoServer starts a TCP server that echoes each line back with a prefix.
+func echoServer(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					io.WriteString(conn, "echo: "+scanner.Text()+"\n")
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// roundTrip sends a line on conn and returns the reply.
+func roundTrip(t *testing.T, conn net.Conn, line string) string {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	return reply
+}
+
+func TestForward(t *testing.T) {
+	server := testutils.NewSSHServer(t)
+	client := dialServer(t, server)
+	port := echoServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Forward(ctx, listener, "localhost:"+strconv.Itoa(port))
+	}()
+
+	for _, line := range []string{"first", "second"} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to connect to the forward: %v", err)
+		}
+		if reply := roundTrip(t, conn, line); reply != "echo: "+line+"\n" {
+			t.Errorf("unexpected reply %q", reply)
+		}
+		conn.Close()
+	}
+
+	if forwards := server.Forwards(); len(forwards) != 2 || forwards[0] != "localhost:"+strconv.Itoa(port) {
+		t.Errorf("unexpected forwards %v", forwards)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Forward did not return after cancellation")
+	}
+}
+
+func TestServeSOCKS(t *testing.T) {
+	server := testutils.NewSSHServer(t)
+	client := dialServer(t, server)
+	port := echoServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.ServeSOCKS(ctx, listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect to the proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Greeting offering no authentication
+	conn.Write([]byte{5, 1, 0})
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil || method[1] != 0 {
+		t.Fatalf("unexpected method selection %v (%v)", method, err)
+	}
+
+	// CONNECT to a domain name
+	host := "intranet.example"
+	request := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	conn.Write(request)
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != 0 {
+		t.Fatalf("unexpected CONNECT reply %v (%v)", reply, err)
+	}
+
+	if got := roundTrip(t, conn, "hello"); got != "echo: hello\n" {
+		t.Errorf("unexpected reply %q", got)
+	}
+	if forwards := server.Forwards(); len(forwards) != 1 || forwards[0] != net.JoinHostPort(host, strconv.Itoa(port)) {
+		t.Errorf("expected a forward to %s, got %v", host, forwards)
+	}
+}
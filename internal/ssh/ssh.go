@@ -0,0 +1,296 @@
+// Package ssh runs commands and scripts on Lightsail instances over SSH, using
+// golang.org/x/crypto/ssh instead of shelling out to the ssh binary.
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// DefaultConnectTimeout is used when Config.Timeout is zero.
+const DefaultConnectTimeout = 15 * time.Second
+
+// Config describes how to reach and authenticate to an instance.
+type Config struct {
+	Host string
+	// Port defaults to 22.
+	Port int
+	User string
+	// PrivateKey is a PEM encoded private key.
+	PrivateKey []byte
+	// Certificate is an optional OpenSSH certificate for PrivateKey, such as
+	// the CertKey returned by GetInstanceAccessDetails.
+	Certificate []byte
+	// HostKeyCallback verifies the server's host key. It is required.
+	HostKeyCallback gossh.HostKeyCallback
+	// Timeout bounds connecting and the SSH handshake.
+	Timeout time.Duration
+}
+
+// Address returns the host:port the config connects to.
+func (c Config) Address() string {
+	port := c.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// Client is a connection to an instance.
+type Client struct {
+	conn *gossh.Client
+	addr string
+}
+
+// Dial connects and authenticates to an instance.
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	signer, err := Signer(cfg.PrivateKey, cfg.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.HostKeyCallback == nil {
+		return nil, fmt.Errorf("no host key callback for %s: host keys must be verified", cfg.Address())
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultConnectTimeout
+	}
+
+	addr := cfg.Address()
+	dialer := net.Dialer{Timeout: timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	// Bound the handshake too, then clear the deadline for the session
+	if err := netConn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to set deadline for %s: %w", addr, err)
+	}
+
+	sshConn, chans, reqs, err := gossh.NewClientConn(netConn, addr, &gossh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(signer)},
+		HostKeyCallback: cfg.HostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to establish SSH connection to %s: %w", addr, err)
+	}
+
+	if err := netConn.SetDeadline(time.Time{}); err != nil {
+		sshConn.Close()
+		return nil, fmt.Errorf("failed to clear deadline for %s: %w", addr, err)
+	}
+
+	return &Client{conn: gossh.NewClient(sshConn, chans, reqs), addr: addr}, nil
+}
+
+// Signer parses a PEM private key and, if given, an OpenSSH certificate for it.
+func Signer(privateKey, certificate []byte) (gossh.Signer, error) {
+	signer, err := gossh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	if len(bytes.TrimSpace(certificate)) == 0 {
+		return signer, nil
+	}
+
+	pub, _, _, _, err := gossh.ParseAuthorizedKey(certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	cert, ok := pub.(*gossh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse certificate: got a %s public key", pub.Type())
+	}
+
+	certSigner, err := gossh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use certificate: %w", err)
+	}
+	return certSigner, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Address returns the host:port the client is connected to.
+func (c *Client) Address() string {
+	return c.addr
+}
+
+// Wait blocks until the connection is closed or lost.
+func (c *Client) Wait() error {
+	return c.conn.Wait()
+}
+
+// Conn returns the underlying SSH client.
+func (c *Client) Conn() *gossh.Client {
+	return c.conn
+}
+
+// SFTP opens an SFTP session over the connection. Close it before the client.
+func (c *Client) SFTP() (*sftp.Client, error) {
+	client, err := sftp.NewClient(c.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SFTP session on %s: %w", c.addr, err)
+	}
+	return client, nil
+}
+
+// RunOptions configures a remote command.
+type RunOptions struct {
+	// Stdin, Stdout and Stderr are streamed to and from the command. Nil
+	// writers discard output.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Sudo runs the command as root with non-interactive sudo.
+	Sudo bool
+	// Timeout kills the command if it runs longer. Zero means no timeout
+	// beyond the context's.
+	Timeout time.Duration
+}
+
+// ExitError is returned when a remote command exits with a non-zero status.
+type ExitError struct {
+	Code int
+	// Signal is set if the command was killed by a signal.
+	Signal string
+}
+
+// Error implements error.
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("remote command killed by signal %s", e.Signal)
+	}
+	return fmt.Sprintf("remote command exited with status %d", e.Code)
+}
+
+// ExitCode returns the exit status of a command run with Run, RunScript or
+// Output: 0 for a nil error, the status for an ExitError, and -1 if the
+// command was killed or never ran.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) && exitErr.Signal == "" {
+		return exitErr.Code
+	}
+	return -1
+}
+
+// Run runs a shell command and waits for it to finish. A non-zero exit status
+// is returned as an *ExitError.
+func (c *Client) Run(ctx context.Context, command string, opts RunOptions) error {
+	if opts.Sudo {
+		command = "sudo -n sh -c " + Quote(command)
+	}
+	return c.run(ctx, command, opts)
+}
+
+// RunScript runs a bash script by streaming it to bash on stdin, so scripts of
+// any size run without being copied to the instance first.
+func (c *Client) RunScript(ctx context.Context, script string, opts RunOptions) error {
+	if opts.Stdin != nil {
+		return fmt.Errorf("RunScript reads the script from stdin and can't take other input")
+	}
+	opts.Stdin = strings.NewReader(script)
+
+	command := "bash -s"
+	if opts.Sudo {
+		command = "sudo -n bash -s"
+	}
+	return c.run(ctx, command, opts)
+}
+
+// Output runs a command and returns its standard output.
+func (c *Client) Output(ctx context.Context, command string, opts RunOptions) ([]byte, error) {
+	var stdout bytes.Buffer
+	opts.Stdout = &stdout
+	err := c.Run(ctx, command, opts)
+	return stdout.Bytes(), err
+}
+
+func (c *Client) run(ctx context.Context, command string, opts RunOptions) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open SSH session on %s: %w", c.addr, err)
+	}
+	defer session.Close()
+
+	session.Stdin = opts.Stdin
+	session.Stdout = opts.Stdout
+	session.Stderr = opts.Stderr
+
+	if err := session.Start(command); err != nil {
+		return fmt.Errorf("failed to start remote command on %s: %w", c.addr, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return exitError(err)
+	case <-ctx.Done():
+		// Not every server honours signals, so close the session as well
+		_ = session.Signal(gossh.SIGKILL)
+		session.Close()
+		return fmt.Errorf("remote command on %s stopped: %w", c.addr, ctx.Err())
+	}
+}
+
+// exitError converts a session error into an *ExitError where possible.
+func exitError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *gossh.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Code: exitErr.ExitStatus(), Signal: exitErr.Signal()}
+	}
+
+	var missing *gossh.ExitMissingError
+	if errors.As(err, &missing) {
+		return fmt.Errorf("remote command ended without an exit status: %w", err)
+	}
+
+	return fmt.Errorf("remote command failed: %w", err)
+}
+
+// Quote quotes a string for use as a single POSIX shell word.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
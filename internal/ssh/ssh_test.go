@@ -0,0 +1,180 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/scttfrdmn/lfr-tools/internal/testutils"
+)
+
+func dialServer(t *testing.T, server *testutils.SSHServer) *Client {
+	t.Helper()
+
+	client, err := Dial(context.Background(), Config{
+		Host:            server.Host(),
+		Port:            server.Port(),
+		User:            "ubuntu",
+		PrivateKey:      server.ClientKey,
+		HostKeyCallback: gossh.FixedHostKey(server.HostKey),
+	})
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRunStreamsOutputAndExitCode(t *testing.T) {
+	server := testutils.NewSSHServer(t)
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		fmt.Fprintln(stdout, "out:"+command)
+		fmt.Fprintln(stderr, "err:"+command)
+		if command == "false" {
+			return 3
+		}
+		return 0
+	})
+	client := dialServer(t, server)
+
+	tests := []struct {
+		command string
+		code    int
+	}{
+		{"true", 0},
+		{"false", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := client.Run(context.Background(), tt.command, RunOptions{Stdout: &stdout, Stderr: &stderr})
+
+			if got := ExitCode(err); got != tt.code {
+				t.Errorf("expected exit code %d, got %d (%v)", tt.code, got, err)
+			}
+			if stdout.String() != "out:"+tt.command+"\n" {
+				t.Errorf("unexpected stdout %q", stdout.String())
+			}
+			if stderr.String() != "err:"+tt.command+"\n" {
+				t.Errorf("unexpected stderr %q", stderr.String())
+			}
+		})
+	}
+
+	if users := server.Users(); len(users) != 1 || users[0] != "ubuntu" {
+		t.Errorf("expected one connection as ubuntu, got %v", users)
+	}
+}
+
+func TestRunSudoAndRunScript(t *testing.T) {
+	server := testutils.NewSSHServer(t)
+	var script string
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		if strings.HasSuffix(command, "bash -s") {
+			data, _ := io.ReadAll(stdin)
+			script = string(data)
+		}
+		return 0
+	})
+	client := dialServer(t, server)
+
+	if err := client.Run(context.Background(), "echo 'hi'", RunOptions{Sudo: true}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if err := client.RunScript(context.Background(), "apt-get update\n", RunOptions{Sudo: true}); err != nil {
+		t.Fatalf("RunScript failed: %v", err)
+	}
+
+	commands := server.Commands()
+	expected := []string{`sudo -n sh -c 'echo '\''hi'\'''`, "sudo -n bash -s"}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected commands %q", commands)
+	}
+	if script != "apt-get update\n" {
+		t.Errorf("expected the script on stdin, got %q", script)
+	}
+
+	if err := client.RunScript(context.Background(), "true", RunOptions{Stdin: strings.NewReader("x")}); err == nil {
+		t.Error("expected RunScript to reject stdin")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	server := testutils.NewSSHServer(t)
+	server.Handle(func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		if command != "sleep 600" {
+			return 0
+		}
+		<-ctx.Done()
+		return 137
+	})
+	client := dialServer(t, server)
+
+	start := time.Now()
+	err := client.Run(context.Background(), "sleep 600", RunOptions{Timeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if ExitCode(err) != -1 {
+		t.Errorf("expected exit code -1 for a killed command, got %d", ExitCode(err))
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+
+	// The connection is still usable afterwards
+	if _, err := client.Output(context.Background(), "true", RunOptions{}); err != nil {
+		t.Errorf("expected the client to survive a timed out command, got %v", err)
+	}
+}
+
+func TestDialRejectsUnknownKey(t *testing.T) {
+	server := testutils.NewSSHServer(t)
+	other := testutils.NewSSHServer(t)
+
+	_, err := Dial(context.Background(), Config{
+		Host:            server.Host(),
+		Port:            server.Port(),
+		User:            "ubuntu",
+		PrivateKey:      other.ClientKey,
+		HostKeyCallback: gossh.FixedHostKey(server.HostKey),
+	})
+	if err == nil {
+		t.Fatal("expected authentication to fail")
+	}
+}
+
+func TestDialVerifiesHostKey(t *testing.T) {
+	server := testutils.NewSSHServer(t)
+	other := testutils.NewSSHServer(t)
+
+	cfg := Config{Host: server.Host(), Port: server.Port(), User: "ubuntu", PrivateKey: server.ClientKey}
+	if _, err := Dial(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "host keys must be verified") {
+		t.Errorf("expected a missing host key callback to be refused, got %v", err)
+	}
+
+	cfg.HostKeyCallback = gossh.FixedHostKey(other.HostKey)
+	if _, err := Dial(context.Background(), cfg); err == nil {
+		t.Error("expected a different host key to be refused")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"":          "''",
+		"ls -la":    "'ls -la'",
+		"it's here": `'it'\''s here'`,
+	}
+	for input, expected := range tests {
+		if got := Quote(input); got != expected {
+			t.Errorf("Quote(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
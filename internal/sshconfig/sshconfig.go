@@ -0,0 +1,278 @@
+// Package sshconfig maintains an OpenSSH client config file with a Host block
+// per instance, kept in one section per project so that projects can be
+// regenerated independently.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// header starts every generated file.
+const header = "# Generated by lfr-tools. Edits are overwritten by 'lfr ssh config'.\n"
+
+// Section markers. Settings that must survive regeneration, such as port
+// forwards, are recorded on the begin marker.
+const (
+	beginMarker = "# BEGIN lfr-tools project="
+	endMarker   = "# END lfr-tools project="
+)
+
+// Host is a Host block for one instance.
+type Host struct {
+	// Alias is the name used with ssh, such as alice-bio101.
+	Alias    string
+	Instance string
+	// HostName is the instance's public IP, empty while it is stopped.
+	HostName     string
+	User         string
+	IdentityFile string
+	// KnownHostsFile is the project's known_hosts file the host's keys are
+	// pinned in.
+	KnownHostsFile string
+	// LocalForwards are "[bind:]port host:port" LocalForward arguments.
+	LocalForwards []string
+}
+
+// Section is a project's block of hosts.
+type Section struct {
+	Project string
+	// Forwards are the forward specs the hosts' LocalForwards came from.
+	Forwards []string
+	Hosts    []Host
+}
+
+// Render formats a section.
+func (s *Section) Render() string {
+	var b strings.Builder
+
+	b.WriteString(beginMarker + s.Project)
+	if len(s.Forwards) > 0 {
+		b.WriteString(" forwards=" + strings.Join(s.Forwards, ","))
+	}
+	b.WriteString("\n")
+
+	hosts := append([]Host(nil), s.Hosts...)
+	sort.SliceStable(hosts, func(i, j int) bool { return hosts[i].Alias < hosts[j].Alias })
+
+	for _, host := range hosts {
+		fmt.Fprintf(&b, "Host %s\n", host.Alias)
+		if host.HostName == "" {
+			fmt.Fprintf(&b, "    # %s is not running; start it and rerun 'lfr ssh config'\n", host.Instance)
+		} else {
+			fmt.Fprintf(&b, "    # %s\n", host.Instance)
+			fmt.Fprintf(&b, "    HostName %s\n", host.HostName)
+		}
+		fmt.Fprintf(&b, "    User %s\n", host.User)
+		if host.IdentityFile != "" {
+			fmt.Fprintf(&b, "    IdentityFile %s\n", quote(host.IdentityFile))
+			b.WriteString("    IdentitiesOnly yes\n")
+		}
+		// Public IPs change when instances restart, so host keys are
+		// recorded under the instance's name instead
+		fmt.Fprintf(&b, "    HostKeyAlias %s\n", host.Instance)
+		if host.KnownHostsFile != "" {
+			fmt.Fprintf(&b, "    UserKnownHostsFile %s\n", quote(host.KnownHostsFile))
+		}
+		b.WriteString("    StrictHostKeyChecking accept-new\n")
+		for _, forward := range host.LocalForwards {
+			fmt.Fprintf(&b, "    LocalForward %s\n", forward)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(endMarker + s.Project + "\n")
+	return b.String()
+}
+
+// File is a generated config file.
+type File struct {
+	Path     string
+	sections []*Section
+	// raw holds each section's text as read, so sections that aren't
+	// replaced are written back unchanged.
+	raw map[string]string
+}
+
+// Load reads a generated config file. A missing file loads as empty.
+func Load(path string) (*File, error) {
+	f := &File{Path: path, raw: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH config %s: %w", path, err)
+	}
+
+	var current *Section
+	var raw strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, beginMarker):
+			current = parseBeginMarker(line)
+			raw.Reset()
+			raw.WriteString(line + "\n")
+		case current != nil && line == endMarker+current.Project:
+			raw.WriteString(line + "\n")
+			f.sections = append(f.sections, current)
+			f.raw[current.Project] = raw.String()
+			current = nil
+		case current != nil:
+			raw.WriteString(line + "\n")
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("SSH config %s: section for project %s is not terminated", path, current.Project)
+	}
+
+	return f, nil
+}
+
+func parseBeginMarker(line string) *Section {
+	fields := strings.Fields(strings.TrimPrefix(line, beginMarker))
+	section := &Section{}
+	if len(fields) > 0 {
+		section.Project = fields[0]
+	}
+	for _, field := range fields[1:] {
+		if value, ok := strings.CutPrefix(field, "forwards="); ok && value != "" {
+			section.Forwards = strings.Split(value, ",")
+		}
+	}
+	return section
+}
+
+// Section returns a project's section as last loaded, or nil. Its Hosts are
+// not parsed.
+func (f *File) Section(project string) *Section {
+	for _, section := range f.sections {
+		if section.Project == project {
+			return section
+		}
+	}
+	return nil
+}
+
+// Projects returns the projects with a section in the file.
+func (f *File) Projects() []string {
+	var projects []string
+	for _, section := range f.sections {
+		projects = append(projects, section.Project)
+	}
+	return projects
+}
+
+// Set replaces or adds a project's section.
+func (f *File) Set(section *Section) {
+	f.raw[section.Project] = section.Render()
+	for i, existing := range f.sections {
+		if existing.Project == section.Project {
+			f.sections[i] = section
+			return
+		}
+	}
+	f.sections = append(f.sections, section)
+}
+
+// Remove drops a project's section.
+func (f *File) Remove(project string) {
+	for i, existing := range f.sections {
+		if existing.Project == project {
+			f.sections = append(f.sections[:i], f.sections[i+1:]...)
+			delete(f.raw, project)
+			return
+		}
+	}
+}
+
+// String formats the file, with sections sorted by project.
+func (f *File) String() string {
+	sections := append([]*Section(nil), f.sections...)
+	sort.Slice(sections, func(i, j int) bool { return sections[i].Project < sections[j].Project })
+
+	var b strings.Builder
+	b.WriteString(header)
+	for _, section := range sections {
+		b.WriteString("\n")
+		b.WriteString(f.raw[section.Project])
+	}
+	return b.String()
+}
+
+// Save writes the file atomically, creating its directory if needed.
+func (f *File) Save() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(f.Path), err)
+	}
+
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(f.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write SSH config: %w", err)
+	}
+	if err := os.Rename(tmp, f.Path); err != nil {
+		return fmt.Errorf("failed to write SSH config: %w", err)
+	}
+	return nil
+}
+
+// EnsureInclude adds an Include of includePath to the top of the OpenSSH
+// config at configPath, creating it if needed. It reports whether the file
+// was changed. Include must come before any Host block to apply to all hosts.
+func EnsureInclude(configPath, includePath string) (bool, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Include") {
+			continue
+		}
+		for _, included := range fields[1:] {
+			if sameFile(strings.Trim(included, `"`), includePath) {
+				return false, nil
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", filepath.Dir(configPath), err)
+	}
+
+	include := fmt.Sprintf("# Added by lfr-tools\nInclude %s\n\n", quote(includePath))
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(configPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(configPath, append([]byte(include), data...), mode); err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", configPath, err)
+	}
+	return true, nil
+}
+
+// sameFile reports whether an Include argument names path, expanding ~.
+func sameFile(included, path string) bool {
+	if strings.HasPrefix(included, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			included = filepath.Join(home, included[2:])
+		}
+	}
+	return filepath.Clean(included) == filepath.Clean(path)
+}
+
+// quote quotes a config value containing spaces.
+func quote(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
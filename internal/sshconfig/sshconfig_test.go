@@ -0,0 +1,144 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSetKeepsOtherProjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.d", "lfr-tools")
+
+	file, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load of a missing file failed: %v", err)
+	}
+	file.Set(&Section{
+		Project:  "bio101",
+		Forwards: []string{"8888", "9000:8787"},
+		Hosts: []Host{
+			{Alias: "bob-bio101", Instance: "bob-ubuntu_22_04", User: "ubuntu"},
+			{
+				Alias:          "alice-bio101",
+				Instance:       "alice-ubuntu_22_04",
+				HostName:       "203.0.113.10",
+				User:           "ubuntu",
+				IdentityFile:   "/home/me/.ssh/lfr-tools/LightsailDefaultKey.pem",
+				KnownHostsFile: "/home/me/.lfr-tools/known_hosts/bio101",
+				LocalForwards:  []string{"localhost:8888 localhost:8888"},
+			},
+		},
+	})
+	file.Set(&Section{Project: "cs101", Hosts: []Host{{Alias: "carol-cs101", Instance: "carol-ubuntu_22_04", HostName: "203.0.113.20", User: "ubuntu"}}})
+	if err := file.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	for _, expected := range []string{
+		"# BEGIN lfr-tools project=bio101 forwards=8888,9000:8787\nHost alice-bio101\n",
+		"    HostName 203.0.113.10\n",
+		"    IdentityFile /home/me/.ssh/lfr-tools/LightsailDefaultKey.pem\n",
+		"    HostKeyAlias alice-ubuntu_22_04\n    UserKnownHostsFile /home/me/.lfr-tools/known_hosts/bio101\n",
+		"    LocalForward localhost:8888 localhost:8888\n",
+		"Host bob-bio101\n    # bob-ubuntu_22_04 is not running",
+		"# END lfr-tools project=cs101\n",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("expected config to contain %q, got:\n%s", expected, content)
+		}
+	}
+	if strings.Index(content, "alice-bio101") > strings.Index(content, "bob-bio101") {
+		t.Error("expected hosts sorted by alias")
+	}
+
+	// Regenerating one project leaves the other untouched
+	file, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if projects := file.Projects(); strings.Join(projects, ",") != "bio101,cs101" {
+		t.Errorf("unexpected projects %v", projects)
+	}
+	if forwards := file.Section("bio101").Forwards; strings.Join(forwards, ",") != "8888,9000:8787" {
+		t.Errorf("expected the forwards to be read back, got %v", forwards)
+	}
+
+	file.Set(&Section{Project: "cs101", Hosts: []Host{{Alias: "carol-cs101", Instance: "carol-ubuntu_22_04", HostName: "203.0.113.99", User: "ubuntu"}}})
+	if err := file.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if !strings.Contains(string(data), "HostName 203.0.113.99") || strings.Contains(string(data), "203.0.113.20") {
+		t.Errorf("expected cs101 to be replaced, got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "HostName 203.0.113.10") {
+		t.Errorf("expected bio101 to be kept, got:\n%s", data)
+	}
+
+	file.Remove("bio101")
+	if strings.Contains(file.String(), "bio101") {
+		t.Error("expected bio101 to be removed")
+	}
+}
+
+func TestLoadRejectsUnterminatedSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lfr-tools")
+	os.WriteFile(path, []byte(header+"\n"+beginMarker+"bio101\nHost alice-bio101\n"), 0600)
+
+	if _, err := Load(path); err == nil {
+		t.Error("expected an unterminated section to fail")
+	}
+}
+
+func TestEnsureInclude(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".ssh", "config")
+	includePath := filepath.Join(home, ".ssh", "config.d", "lfr-tools")
+
+	tests := []struct {
+		name     string
+		existing string
+		added    bool
+	}{
+		{name: "no config", added: true},
+		{name: "existing hosts", existing: "Host github.com\n    User git\n", added: true},
+		{name: "already included", existing: "Include " + includePath + "\n", added: false},
+		{name: "included with tilde", existing: "include ~/.ssh/config.d/lfr-tools\n", added: false},
+		{name: "other include", existing: "Include ~/.ssh/config.d/work\n", added: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.RemoveAll(filepath.Join(home, ".ssh"))
+			if tt.existing != "" {
+				os.MkdirAll(filepath.Dir(configPath), 0700)
+				os.WriteFile(configPath, []byte(tt.existing), 0644)
+			}
+
+			added, err := EnsureInclude(configPath, includePath)
+			if err != nil {
+				t.Fatalf("EnsureInclude failed: %v", err)
+			}
+			if added != tt.added {
+				t.Errorf("expected added=%v, got %v", tt.added, added)
+			}
+
+			data, _ := os.ReadFile(configPath)
+			if !strings.HasPrefix(string(data), "# Added by lfr-tools\nInclude ") && tt.added {
+				t.Errorf("expected the Include first, got:\n%s", data)
+			}
+			if !strings.HasSuffix(string(data), tt.existing) {
+				t.Errorf("expected the existing config to be kept, got:\n%s", data)
+			}
+
+			// Running again changes nothing
+			if added, _ := EnsureInclude(configPath, includePath); added {
+				t.Error("expected a second EnsureInclude to be a no-op")
+			}
+		})
+	}
+}
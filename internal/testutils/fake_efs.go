@@ -0,0 +1,227 @@
+package testutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	efsTypes "github.com/aws/aws-sdk-go-v2/service/efs/types"
+)
+
+// FakeEFS is an in-memory EFS service. File systems are available immediately.
+type FakeEFS struct {
+	cloud *FakeCloud
+
+	fileSystems  map[string]efsTypes.FileSystemDescription
+	mountTargets map[string][]efsTypes.MountTargetDescription
+}
+
+func newFakeEFS(cloud *FakeCloud) *FakeEFS {
+	return &FakeEFS{
+		cloud:        cloud,
+		fileSystems:  make(map[string]efsTypes.FileSystemDescription),
+		mountTargets: make(map[string][]efsTypes.MountTargetDescription),
+	}
+}
+
+func (f *FakeEFS) fileSystem(id string) (efsTypes.FileSystemDescription, error) {
+	fs, ok := f.fileSystems[id]
+	if !ok {
+		return fs, &efsTypes.FileSystemNotFound{Message: aws.String(fmt.Sprintf("File system '%s' does not exist.", id))}
+	}
+	return fs, nil
+}
+
+// CreateFileSystem creates a file system.
+func (f *FakeEFS) CreateFileSystem(ctx context.Context, params *efs.CreateFileSystemInput, optFns ...func(*efs.Options)) (*efs.CreateFileSystemOutput, error) {
+	if err := f.cloud.begin(ctx, "CreateFileSystem", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	now := f.cloud.Now()
+	fs := efsTypes.FileSystemDescription{
+		FileSystemId:    aws.String(fmt.Sprintf("fs-%08x", f.cloud.id())),
+		LifeCycleState:  efsTypes.LifeCycleStateAvailable,
+		PerformanceMode: params.PerformanceMode,
+		ThroughputMode:  params.ThroughputMode,
+		CreationTime:    &now,
+		Tags:            append([]efsTypes.Tag(nil), params.Tags...),
+	}
+	for _, tag := range params.Tags {
+		if aws.ToString(tag.Key) == "Name" {
+			fs.Name = tag.Value
+		}
+	}
+	f.fileSystems[aws.ToString(fs.FileSystemId)] = fs
+
+	return &efs.CreateFileSystemOutput{
+		FileSystemId:    fs.FileSystemId,
+		LifeCycleState:  fs.LifeCycleState,
+		PerformanceMode: fs.PerformanceMode,
+		ThroughputMode:  fs.ThroughputMode,
+		CreationTime:    fs.CreationTime,
+		Name:            fs.Name,
+		Tags:            fs.Tags,
+	}, nil
+}
+
+// CreateMountTarget creates a mount target in a subnet.
+func (f *FakeEFS) CreateMountTarget(ctx context.Context, params *efs.CreateMountTargetInput, optFns ...func(*efs.Options)) (*efs.CreateMountTargetOutput, error) {
+	if err := f.cloud.begin(ctx, "CreateMountTarget", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	id := aws.ToString(params.FileSystemId)
+	if _, err := f.fileSystem(id); err != nil {
+		return nil, err
+	}
+
+	n := f.cloud.id()
+	mt := efsTypes.MountTargetDescription{
+		MountTargetId:  aws.String(fmt.Sprintf("fsmt-%08x", n)),
+		FileSystemId:   params.FileSystemId,
+		SubnetId:       params.SubnetId,
+		IpAddress:      aws.String(fmt.Sprintf("172.31.0.%d", n)),
+		LifeCycleState: efsTypes.LifeCycleStateAvailable,
+	}
+	f.mountTargets[id] = append(f.mountTargets[id], mt)
+
+	return &efs.CreateMountTargetOutput{
+		MountTargetId:  mt.MountTargetId,
+		FileSystemId:   mt.FileSystemId,
+		SubnetId:       mt.SubnetId,
+		IpAddress:      mt.IpAddress,
+		LifeCycleState: mt.LifeCycleState,
+	}, nil
+}
+
+// DescribeFileSystems lists file systems.
+func (f *FakeEFS) DescribeFileSystems(ctx context.Context, params *efs.DescribeFileSystemsInput, optFns ...func(*efs.Options)) (*efs.DescribeFileSystemsOutput, error) {
+	if err := f.cloud.begin(ctx, "DescribeFileSystems", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	var fileSystems []efsTypes.FileSystemDescription
+	for _, id := range sortedKeys(f.fileSystems) {
+		fileSystems = append(fileSystems, f.fileSystems[id])
+	}
+	return &efs.DescribeFileSystemsOutput{FileSystems: fileSystems}, nil
+}
+
+// DescribeTags returns a file system's tags.
+func (f *FakeEFS) DescribeTags(ctx context.Context, params *efs.DescribeTagsInput, optFns ...func(*efs.Options)) (*efs.DescribeTagsOutput, error) {
+	if err := f.cloud.begin(ctx, "DescribeTags", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	fs, err := f.fileSystem(aws.ToString(params.FileSystemId))
+	if err != nil {
+		return nil, err
+	}
+	return &efs.DescribeTagsOutput{Tags: append([]efsTypes.Tag(nil), fs.Tags...)}, nil
+}
+
+// DescribeMountTargets lists a file system's mount targets.
+func (f *FakeEFS) DescribeMountTargets(ctx context.Context, params *efs.DescribeMountTargetsInput, optFns ...func(*efs.Options)) (*efs.DescribeMountTargetsOutput, error) {
+	if err := f.cloud.begin(ctx, "DescribeMountTargets", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	id := aws.ToString(params.FileSystemId)
+	if _, err := f.fileSystem(id); err != nil {
+		return nil, err
+	}
+	return &efs.DescribeMountTargetsOutput{
+		MountTargets: append([]efsTypes.MountTargetDescription(nil), f.mountTargets[id]...),
+	}, nil
+}
+
+// FakeEC2 is an in-memory EC2 service with a default VPC and two subnets.
+type FakeEC2 struct {
+	cloud *FakeCloud
+
+	securityGroups map[string]ec2Types.SecurityGroup
+	ingress        map[string][]ec2Types.IpPermission
+}
+
+func newFakeEC2(cloud *FakeCloud) *FakeEC2 {
+	return &FakeEC2{
+		cloud:          cloud,
+		securityGroups: make(map[string]ec2Types.SecurityGroup),
+		ingress:        make(map[string][]ec2Types.IpPermission),
+	}
+}
+
+// FakeDefaultVPC is the ID of the fake cloud's default VPC.
+const FakeDefaultVPC = "vpc-0fake0default"
+
+// DescribeVpcs returns the default VPC.
+func (f *FakeEC2) DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	if err := f.cloud.begin(ctx, "DescribeVpcs", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	return &ec2.DescribeVpcsOutput{
+		Vpcs: []ec2Types.Vpc{{VpcId: aws.String(FakeDefaultVPC), CidrBlock: aws.String("172.31.0.0/16"), IsDefault: aws.Bool(true)}},
+	}, nil
+}
+
+// DescribeSubnets returns the default VPC's subnets.
+func (f *FakeEC2) DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	if err := f.cloud.begin(ctx, "DescribeSubnets", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	var subnets []ec2Types.Subnet
+	for i, zone := range []string{"a", "b"} {
+		subnets = append(subnets, ec2Types.Subnet{
+			SubnetId:         aws.String(fmt.Sprintf("subnet-0fake%d", i)),
+			VpcId:            aws.String(FakeDefaultVPC),
+			AvailabilityZone: aws.String(f.cloud.Region + zone),
+			CidrBlock:        aws.String(fmt.Sprintf("172.31.%d.0/20", i*16)),
+		})
+	}
+	return &ec2.DescribeSubnetsOutput{Subnets: subnets}, nil
+}
+
+// CreateSecurityGroup creates a security group.
+func (f *FakeEC2) CreateSecurityGroup(ctx context.Context, params *ec2.CreateSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error) {
+	if err := f.cloud.begin(ctx, "CreateSecurityGroup", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	id := fmt.Sprintf("sg-%08x", f.cloud.id())
+	f.securityGroups[id] = ec2Types.SecurityGroup{
+		GroupId:   aws.String(id),
+		GroupName: params.GroupName,
+		VpcId:     params.VpcId,
+	}
+	return &ec2.CreateSecurityGroupOutput{GroupId: aws.String(id)}, nil
+}
+
+// AuthorizeSecurityGroupIngress adds ingress rules to a security group.
+func (f *FakeEC2) AuthorizeSecurityGroupIngress(ctx context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	if err := f.cloud.begin(ctx, "AuthorizeSecurityGroupIngress", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	id := aws.ToString(params.GroupId)
+	if _, ok := f.securityGroups[id]; !ok {
+		return nil, fmt.Errorf("InvalidGroup.NotFound: The security group '%s' does not exist", id)
+	}
+
+	f.ingress[id] = append(f.ingress[id], params.IpPermissions...)
+	return &ec2.AuthorizeSecurityGroupIngressOutput{Return: aws.Bool(true)}, nil
+}
@@ -0,0 +1,562 @@
+package testutils
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// fakeIAMUser is an IAM user and everything attached to it.
+type fakeIAMUser struct {
+	user         iamTypes.User
+	tags         []iamTypes.Tag
+	loginProfile *iamTypes.LoginProfile
+	groups       []string
+	policies     map[string]string
+}
+
+// fakeIAMGroup is an IAM group and its attached managed policies.
+type fakeIAMGroup struct {
+	group    iamTypes.Group
+	policies []string
+}
+
+// FakeIAM is an in-memory IAM service. Like IAM, it refuses to delete users
+// that still have groups, inline policies or a login profile.
+type FakeIAM struct {
+	cloud *FakeCloud
+
+	users    map[string]*fakeIAMUser
+	groups   map[string]*fakeIAMGroup
+	policies map[string]iamTypes.Policy
+}
+
+func newFakeIAM(cloud *FakeCloud) *FakeIAM {
+	return &FakeIAM{
+		cloud:    cloud,
+		users:    make(map[string]*fakeIAMUser),
+		groups:   make(map[string]*fakeIAMGroup),
+		policies: make(map[string]iamTypes.Policy),
+	}
+}
+
+// UserNames returns the names of all IAM users in sorted order.
+func (f *FakeIAM) UserNames() []string {
+	f.cloud.mu.Lock()
+	defer f.cloud.mu.Unlock()
+	return sortedKeys(f.users)
+}
+
+// UserGroups returns the groups a user belongs to.
+func (f *FakeIAM) UserGroups(username string) []string {
+	f.cloud.mu.Lock()
+	defer f.cloud.mu.Unlock()
+
+	if u, ok := f.users[username]; ok {
+		return append([]string(nil), u.groups...)
+	}
+	return nil
+}
+
+// UserPolicy returns the document of a user's inline policy.
+func (f *FakeIAM) UserPolicy(username, policyName string) (string, bool) {
+	f.cloud.mu.Lock()
+	defer f.cloud.mu.Unlock()
+
+	u, ok := f.users[username]
+	if !ok {
+		return "", false
+	}
+	doc, ok := u.policies[policyName]
+	return doc, ok
+}
+
+// HasLoginProfile reports whether a user has a console password.
+func (f *FakeIAM) HasLoginProfile(username string) bool {
+	f.cloud.mu.Lock()
+	defer f.cloud.mu.Unlock()
+
+	u, ok := f.users[username]
+	return ok && u.loginProfile != nil
+}
+
+func (f *FakeIAM) arn(resourceType, name string) *string {
+	return aws.String(fmt.Sprintf("arn:aws:iam::%s:%s/%s", FakeAccountID, resourceType, name))
+}
+
+func noSuchEntity(format string, args ...interface{}) error {
+	return &iamTypes.NoSuchEntityException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+func entityExists(format string, args ...interface{}) error {
+	return &iamTypes.EntityAlreadyExistsException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+func (f *FakeIAM) user(name string) (*fakeIAMUser, error) {
+	u, ok := f.users[name]
+	if !ok {
+		return nil, noSuchEntity("The user with name %s cannot be found.", name)
+	}
+	return u, nil
+}
+
+func (f *FakeIAM) group(name string) (*fakeIAMGroup, error) {
+	g, ok := f.groups[name]
+	if !ok {
+		return nil, noSuchEntity("The group with name %s cannot be found.", name)
+	}
+	return g, nil
+}
+
+// ListPolicies returns customer managed policies.
+func (f *FakeIAM) ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	if err := f.cloud.begin(ctx, "ListPolicies", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	var policies []iamTypes.Policy
+	for _, name := range sortedKeys(f.policies) {
+		policies = append(policies, f.policies[name])
+	}
+	return &iam.ListPoliciesOutput{Policies: policies}, nil
+}
+
+// CreatePolicy creates a customer managed policy.
+func (f *FakeIAM) CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+	if err := f.cloud.begin(ctx, "CreatePolicy", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.PolicyName)
+	if _, exists := f.policies[name]; exists {
+		return nil, entityExists("A policy called %s already exists.", name)
+	}
+
+	now := f.cloud.Now()
+	policy := iamTypes.Policy{
+		PolicyName: aws.String(name),
+		PolicyId:   aws.String(fmt.Sprintf("ANPA%08d", f.cloud.id())),
+		Arn:        f.arn("policy", name),
+		CreateDate: &now,
+	}
+	f.policies[name] = policy
+
+	return &iam.CreatePolicyOutput{Policy: &policy}, nil
+}
+
+// GetGroup returns a group and its members.
+func (f *FakeIAM) GetGroup(ctx context.Context, params *iam.GetGroupInput, optFns ...func(*iam.Options)) (*iam.GetGroupOutput, error) {
+	if err := f.cloud.begin(ctx, "GetGroup", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.GroupName)
+	g, err := f.group(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []iamTypes.User
+	for _, username := range sortedKeys(f.users) {
+		u := f.users[username]
+		for _, groupName := range u.groups {
+			if groupName == name {
+				users = append(users, u.user)
+				break
+			}
+		}
+	}
+
+	group := g.group
+	return &iam.GetGroupOutput{Group: &group, Users: users}, nil
+}
+
+// CreateGroup creates a group.
+func (f *FakeIAM) CreateGroup(ctx context.Context, params *iam.CreateGroupInput, optFns ...func(*iam.Options)) (*iam.CreateGroupOutput, error) {
+	if err := f.cloud.begin(ctx, "CreateGroup", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.GroupName)
+	if _, exists := f.groups[name]; exists {
+		return nil, entityExists("Group with name %s already exists.", name)
+	}
+
+	now := f.cloud.Now()
+	path := aws.ToString(params.Path)
+	if path == "" {
+		path = "/"
+	}
+	g := &fakeIAMGroup{
+		group: iamTypes.Group{
+			GroupName:  aws.String(name),
+			GroupId:    aws.String(fmt.Sprintf("AGPA%08d", f.cloud.id())),
+			Arn:        f.arn("group", name),
+			Path:       aws.String(path),
+			CreateDate: &now,
+		},
+	}
+	f.groups[name] = g
+
+	group := g.group
+	return &iam.CreateGroupOutput{Group: &group}, nil
+}
+
+// AttachGroupPolicy attaches a managed policy to a group.
+func (f *FakeIAM) AttachGroupPolicy(ctx context.Context, params *iam.AttachGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachGroupPolicyOutput, error) {
+	if err := f.cloud.begin(ctx, "AttachGroupPolicy", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	g, err := f.group(aws.ToString(params.GroupName))
+	if err != nil {
+		return nil, err
+	}
+
+	arn := aws.ToString(params.PolicyArn)
+	for _, attached := range g.policies {
+		if attached == arn {
+			return &iam.AttachGroupPolicyOutput{}, nil
+		}
+	}
+	g.policies = append(g.policies, arn)
+
+	return &iam.AttachGroupPolicyOutput{}, nil
+}
+
+// ListAttachedGroupPolicies lists the managed policies attached to a group.
+func (f *FakeIAM) ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	if err := f.cloud.begin(ctx, "ListAttachedGroupPolicies", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	g, err := f.group(aws.ToString(params.GroupName))
+	if err != nil {
+		return nil, err
+	}
+
+	var attached []iamTypes.AttachedPolicy
+	for _, arn := range g.policies {
+		attached = append(attached, iamTypes.AttachedPolicy{PolicyArn: aws.String(arn)})
+	}
+	return &iam.ListAttachedGroupPoliciesOutput{AttachedPolicies: attached}, nil
+}
+
+// CreateUser creates a user.
+func (f *FakeIAM) CreateUser(ctx context.Context, params *iam.CreateUserInput, optFns ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+	if err := f.cloud.begin(ctx, "CreateUser", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.UserName)
+	if _, exists := f.users[name]; exists {
+		return nil, entityExists("User with name %s already exists.", name)
+	}
+
+	now := f.cloud.Now()
+	u := &fakeIAMUser{
+		user: iamTypes.User{
+			UserName:   aws.String(name),
+			UserId:     aws.String(fmt.Sprintf("AIDA%08d", f.cloud.id())),
+			Arn:        f.arn("user", name),
+			Path:       aws.String("/"),
+			CreateDate: &now,
+		},
+		tags:     append([]iamTypes.Tag(nil), params.Tags...),
+		policies: make(map[string]string),
+	}
+	f.users[name] = u
+
+	user := u.user
+	return &iam.CreateUserOutput{User: &user}, nil
+}
+
+// GetUser returns a user.
+func (f *FakeIAM) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	if err := f.cloud.begin(ctx, "GetUser", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+
+	user := u.user
+	user.Tags = append([]iamTypes.Tag(nil), u.tags...)
+	return &iam.GetUserOutput{User: &user}, nil
+}
+
+// ListUsers returns all users in name order in a single page.
+func (f *FakeIAM) ListUsers(ctx context.Context, params *iam.ListUsersInput, optFns ...func(*iam.Options)) (*iam.ListUsersOutput, error) {
+	if err := f.cloud.begin(ctx, "ListUsers", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	var users []iamTypes.User
+	for _, name := range sortedKeys(f.users) {
+		users = append(users, f.users[name].user)
+	}
+	return &iam.ListUsersOutput{Users: users}, nil
+}
+
+// ListUserTags returns a user's tags.
+func (f *FakeIAM) ListUserTags(ctx context.Context, params *iam.ListUserTagsInput, optFns ...func(*iam.Options)) (*iam.ListUserTagsOutput, error) {
+	if err := f.cloud.begin(ctx, "ListUserTags", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserTagsOutput{Tags: append([]iamTypes.Tag(nil), u.tags...)}, nil
+}
+
+// CreateLoginProfile gives a user a console password.
+func (f *FakeIAM) CreateLoginProfile(ctx context.Context, params *iam.CreateLoginProfileInput, optFns ...func(*iam.Options)) (*iam.CreateLoginProfileOutput, error) {
+	if err := f.cloud.begin(ctx, "CreateLoginProfile", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.UserName)
+	u, err := f.user(name)
+	if err != nil {
+		return nil, err
+	}
+	if u.loginProfile != nil {
+		return nil, entityExists("Login Profile for user %s already exists.", name)
+	}
+
+	now := f.cloud.Now()
+	u.loginProfile = &iamTypes.LoginProfile{
+		UserName:              aws.String(name),
+		CreateDate:            &now,
+		PasswordResetRequired: params.PasswordResetRequired,
+	}
+
+	profile := *u.loginProfile
+	return &iam.CreateLoginProfileOutput{LoginProfile: &profile}, nil
+}
+
+// DeleteLoginProfile removes a user's console password.
+func (f *FakeIAM) DeleteLoginProfile(ctx context.Context, params *iam.DeleteLoginProfileInput, optFns ...func(*iam.Options)) (*iam.DeleteLoginProfileOutput, error) {
+	if err := f.cloud.begin(ctx, "DeleteLoginProfile", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.UserName)
+	u, err := f.user(name)
+	if err != nil {
+		return nil, err
+	}
+	if u.loginProfile == nil {
+		return nil, noSuchEntity("Login Profile for User %s cannot be found.", name)
+	}
+
+	u.loginProfile = nil
+	return &iam.DeleteLoginProfileOutput{}, nil
+}
+
+// UpdateLoginProfile changes a user's console password.
+func (f *FakeIAM) UpdateLoginProfile(ctx context.Context, params *iam.UpdateLoginProfileInput, optFns ...func(*iam.Options)) (*iam.UpdateLoginProfileOutput, error) {
+	if err := f.cloud.begin(ctx, "UpdateLoginProfile", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.UserName)
+	u, err := f.user(name)
+	if err != nil {
+		return nil, err
+	}
+	if u.loginProfile == nil {
+		return nil, noSuchEntity("Login Profile for User %s cannot be found.", name)
+	}
+
+	if params.PasswordResetRequired != nil {
+		u.loginProfile.PasswordResetRequired = *params.PasswordResetRequired
+	}
+	return &iam.UpdateLoginProfileOutput{}, nil
+}
+
+// AddUserToGroup adds a user to a group.
+func (f *FakeIAM) AddUserToGroup(ctx context.Context, params *iam.AddUserToGroupInput, optFns ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error) {
+	if err := f.cloud.begin(ctx, "AddUserToGroup", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	groupName := aws.ToString(params.GroupName)
+	if _, err := f.group(groupName); err != nil {
+		return nil, err
+	}
+
+	for _, existing := range u.groups {
+		if existing == groupName {
+			return &iam.AddUserToGroupOutput{}, nil
+		}
+	}
+	u.groups = append(u.groups, groupName)
+
+	return &iam.AddUserToGroupOutput{}, nil
+}
+
+// RemoveUserFromGroup removes a user from a group.
+func (f *FakeIAM) RemoveUserFromGroup(ctx context.Context, params *iam.RemoveUserFromGroupInput, optFns ...func(*iam.Options)) (*iam.RemoveUserFromGroupOutput, error) {
+	if err := f.cloud.begin(ctx, "RemoveUserFromGroup", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	groupName := aws.ToString(params.GroupName)
+
+	for i, existing := range u.groups {
+		if existing == groupName {
+			u.groups = append(u.groups[:i], u.groups[i+1:]...)
+			return &iam.RemoveUserFromGroupOutput{}, nil
+		}
+	}
+	return nil, noSuchEntity("User %s is not in group %s.", aws.ToString(params.UserName), groupName)
+}
+
+// ListGroupsForUser lists the groups a user belongs to.
+func (f *FakeIAM) ListGroupsForUser(ctx context.Context, params *iam.ListGroupsForUserInput, optFns ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+	if err := f.cloud.begin(ctx, "ListGroupsForUser", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []iamTypes.Group
+	for _, name := range u.groups {
+		if g, ok := f.groups[name]; ok {
+			groups = append(groups, g.group)
+		}
+	}
+	return &iam.ListGroupsForUserOutput{Groups: groups}, nil
+}
+
+// PutUserPolicy creates or replaces a user's inline policy.
+func (f *FakeIAM) PutUserPolicy(ctx context.Context, params *iam.PutUserPolicyInput, optFns ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+	if err := f.cloud.begin(ctx, "PutUserPolicy", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+
+	u.policies[aws.ToString(params.PolicyName)] = aws.ToString(params.PolicyDocument)
+	return &iam.PutUserPolicyOutput{}, nil
+}
+
+// GetUserPolicy returns a user's inline policy. As in IAM, the document is URL-encoded.
+func (f *FakeIAM) GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error) {
+	if err := f.cloud.begin(ctx, "GetUserPolicy", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	policyName := aws.ToString(params.PolicyName)
+	document, ok := u.policies[policyName]
+	if !ok {
+		return nil, noSuchEntity("The user policy with name %s cannot be found.", policyName)
+	}
+
+	return &iam.GetUserPolicyOutput{
+		UserName:       params.UserName,
+		PolicyName:     params.PolicyName,
+		PolicyDocument: aws.String(url.QueryEscape(document)),
+	}, nil
+}
+
+// ListUserPolicies lists a user's inline policy names.
+func (f *FakeIAM) ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	if err := f.cloud.begin(ctx, "ListUserPolicies", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserPoliciesOutput{PolicyNames: sortedKeys(u.policies)}, nil
+}
+
+// DeleteUserPolicy deletes a user's inline policy.
+func (f *FakeIAM) DeleteUserPolicy(ctx context.Context, params *iam.DeleteUserPolicyInput, optFns ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error) {
+	if err := f.cloud.begin(ctx, "DeleteUserPolicy", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	u, err := f.user(aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	policyName := aws.ToString(params.PolicyName)
+	if _, ok := u.policies[policyName]; !ok {
+		return nil, noSuchEntity("The user policy with name %s cannot be found.", policyName)
+	}
+
+	delete(u.policies, policyName)
+	return &iam.DeleteUserPolicyOutput{}, nil
+}
+
+// DeleteUser deletes a user with no remaining groups, policies or login profile.
+func (f *FakeIAM) DeleteUser(ctx context.Context, params *iam.DeleteUserInput, optFns ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+	if err := f.cloud.begin(ctx, "DeleteUser", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.UserName)
+	u, err := f.user(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.groups) > 0 || len(u.policies) > 0 || u.loginProfile != nil {
+		return nil, &iamTypes.DeleteConflictException{
+			Message: aws.String(fmt.Sprintf("Cannot delete entity, must remove dependent resources first: %s", name)),
+		}
+	}
+
+	delete(f.users, name)
+	return &iam.DeleteUserOutput{}, nil
+}
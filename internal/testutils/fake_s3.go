@@ -0,0 +1,228 @@
+package testutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fakeObject is a stored S3 object.
+type fakeObject struct {
+	data         []byte
+	contentType  string
+	acl          s3Types.ObjectCannedACL
+	lastModified time.Time
+}
+
+// fakeBucket is an S3 bucket and its objects.
+type fakeBucket struct {
+	policy  string
+	objects map[string]*fakeObject
+}
+
+// FakeS3 is an in-memory S3 service.
+type FakeS3 struct {
+	cloud *FakeCloud
+
+	buckets map[string]*fakeBucket
+}
+
+func newFakeS3(cloud *FakeCloud) *FakeS3 {
+	return &FakeS3{
+		cloud:   cloud,
+		buckets: make(map[string]*fakeBucket),
+	}
+}
+
+// PutObjectData stores an object directly, creating the bucket if needed.
+func (f *FakeS3) PutObjectData(bucket, key string, data []byte) {
+	f.cloud.mu.Lock()
+	defer f.cloud.mu.Unlock()
+
+	b, ok := f.buckets[bucket]
+	if !ok {
+		b = &fakeBucket{objects: make(map[string]*fakeObject)}
+		f.buckets[bucket] = b
+	}
+	b.objects[key] = &fakeObject{data: append([]byte(nil), data...), lastModified: f.cloud.Now()}
+}
+
+// ObjectData returns the contents of an object.
+func (f *FakeS3) ObjectData(bucket, key string) ([]byte, bool) {
+	f.cloud.mu.Lock()
+	defer f.cloud.mu.Unlock()
+
+	b, ok := f.buckets[bucket]
+	if !ok {
+		return nil, false
+	}
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), obj.data...), true
+}
+
+// Keys returns all object keys in a bucket in sorted order.
+func (f *FakeS3) Keys(bucket string) []string {
+	f.cloud.mu.Lock()
+	defer f.cloud.mu.Unlock()
+
+	b, ok := f.buckets[bucket]
+	if !ok {
+		return nil
+	}
+	return sortedKeys(b.objects)
+}
+
+func (f *FakeS3) bucket(name string) (*fakeBucket, error) {
+	b, ok := f.buckets[name]
+	if !ok {
+		return nil, &s3Types.NoSuchBucket{Message: aws.String(fmt.Sprintf("The specified bucket does not exist: %s", name))}
+	}
+	return b, nil
+}
+
+// PutObject stores an object.
+func (f *FakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := f.cloud.begin(ctx, "PutObject", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	b, err := f.bucket(aws.ToString(params.Bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if params.Body != nil {
+		data, err = io.ReadAll(params.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object body: %w", err)
+		}
+	}
+
+	b.objects[aws.ToString(params.Key)] = &fakeObject{
+		data:         data,
+		contentType:  aws.ToString(params.ContentType),
+		acl:          params.ACL,
+		lastModified: f.cloud.Now(),
+	}
+	return &s3.PutObjectOutput{ETag: aws.String(fmt.Sprintf("\"%x\"", len(data)))}, nil
+}
+
+// GetObject returns an object.
+func (f *FakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := f.cloud.begin(ctx, "GetObject", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	b, err := f.bucket(aws.ToString(params.Bucket))
+	if err != nil {
+		return nil, err
+	}
+	key := aws.ToString(params.Key)
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, &s3Types.NoSuchKey{Message: aws.String(fmt.Sprintf("The specified key does not exist: %s", key))}
+	}
+
+	lastModified := obj.lastModified
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(append([]byte(nil), obj.data...))),
+		ContentLength: aws.Int64(int64(len(obj.data))),
+		ContentType:   aws.String(obj.contentType),
+		LastModified:  &lastModified,
+	}, nil
+}
+
+// ListObjectsV2 lists objects under a prefix.
+func (f *FakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if err := f.cloud.begin(ctx, "ListObjectsV2", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	b, err := f.bucket(aws.ToString(params.Bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := aws.ToString(params.Prefix)
+	var contents []s3Types.Object
+	for _, key := range sortedKeys(b.objects) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		obj := b.objects[key]
+		lastModified := obj.lastModified
+		contents = append(contents, s3Types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(obj.data))),
+			LastModified: &lastModified,
+		})
+	}
+
+	return &s3.ListObjectsV2Output{
+		Contents:    contents,
+		KeyCount:    aws.Int32(int32(len(contents))),
+		IsTruncated: aws.Bool(false),
+	}, nil
+}
+
+// DeleteObject deletes an object; deleting a missing key succeeds as in S3.
+func (f *FakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if err := f.cloud.begin(ctx, "DeleteObject", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	b, err := f.bucket(aws.ToString(params.Bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	delete(b.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// CreateBucket creates a bucket.
+func (f *FakeS3) CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	if err := f.cloud.begin(ctx, "CreateBucket", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	name := aws.ToString(params.Bucket)
+	if _, exists := f.buckets[name]; exists {
+		return nil, &s3Types.BucketAlreadyOwnedByYou{Message: aws.String(fmt.Sprintf("Bucket %s already exists", name))}
+	}
+
+	f.buckets[name] = &fakeBucket{objects: make(map[string]*fakeObject)}
+	return &s3.CreateBucketOutput{Location: aws.String("/" + name)}, nil
+}
+
+// PutBucketPolicy sets a bucket's policy.
+func (f *FakeS3) PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error) {
+	if err := f.cloud.begin(ctx, "PutBucketPolicy", params); err != nil {
+		return nil, err
+	}
+	defer f.cloud.end()
+
+	b, err := f.bucket(aws.ToString(params.Bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	b.policy = aws.ToString(params.Policy)
+	return &s3.PutBucketPolicyOutput{}, nil
+}
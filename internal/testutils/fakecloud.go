@@ -0,0 +1,165 @@
+package testutils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeAccountID is the AWS account ID used in ARNs generated by FakeCloud.
+const FakeAccountID = "123456789012"
+
+// FakeCloud is a stateful in-memory stand-in for the AWS services used by lfr-tools.
+// Each service field satisfies the matching API interface in internal/aws.
+type FakeCloud struct {
+	Lightsail *FakeLightsail
+	IAM       *FakeIAM
+	S3        *FakeS3
+	EFS       *FakeEFS
+	EC2       *FakeEC2
+
+	// Region is used for resource locations and ARNs.
+	Region string
+
+	// SettleReads is the number of reads for which a resource stays in a
+	// transitional state (pending, stopping) before reaching its target state.
+	// Zero means transitions complete before the next read.
+	SettleReads int
+
+	// Now returns the current time for timestamps.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]func(params interface{}) error
+	calls    []string
+	nextID   int
+}
+
+// NewFakeCloud creates an empty fake cloud in us-east-1.
+func NewFakeCloud() *FakeCloud {
+	c := &FakeCloud{
+		Region:   "us-east-1",
+		Now:      time.Now,
+		failures: make(map[string]func(params interface{}) error),
+	}
+
+	c.Lightsail = newFakeLightsail(c)
+	c.IAM = newFakeIAM(c)
+	c.S3 = newFakeS3(c)
+	c.EFS = newFakeEFS(c)
+	c.EC2 = newFakeEC2(c)
+
+	return c
+}
+
+// FailOn makes every call to the named operation (e.g. "CreateInstances") return err.
+func (c *FakeCloud) FailOn(operation string, err error) {
+	c.FailWhen(operation, func(interface{}) error {
+		return err
+	})
+}
+
+// FailWhen calls fn with the input of every call to the named operation; a
+// non-nil result is returned as the call's error before any state changes.
+func (c *FakeCloud) FailWhen(operation string, fn func(params interface{}) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[operation] = fn
+}
+
+// ClearFailures removes all injected failures.
+func (c *FakeCloud) ClearFailures() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = make(map[string]func(params interface{}) error)
+}
+
+// Calls returns the names of all operations invoked so far, in order.
+func (c *FakeCloud) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+// CallCount returns how many times the named operation was invoked.
+func (c *FakeCloud) CallCount(operation string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := 0
+	for _, call := range c.calls {
+		if call == operation {
+			count++
+		}
+	}
+	return count
+}
+
+// begin locks the cloud, records the call and returns any injected failure,
+// or ctx's error once it is done, as the SDK does. On success callers must
+// defer c.end(); on failure the lock is already released.
+func (c *FakeCloud) begin(ctx context.Context, operation string, params interface{}) error {
+	c.mu.Lock()
+	c.calls = append(c.calls, operation)
+	if err := ctx.Err(); err != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	if fn, ok := c.failures[operation]; ok {
+		if err := fn(params); err != nil {
+			c.mu.Unlock()
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+	return nil
+}
+
+// end releases the lock taken by begin.
+func (c *FakeCloud) end() {
+	c.mu.Unlock()
+}
+
+// id returns a unique suffix for generated identifiers.
+func (c *FakeCloud) id() int {
+	c.nextID++
+	return c.nextID
+}
+
+// transition tracks a resource moving from a transitional state to a target state.
+type transition struct {
+	state     string
+	target    string
+	readsLeft int
+}
+
+// start begins a transition through state to target.
+func (t *transition) start(state, target string, settleReads int) {
+	t.state = state
+	t.target = target
+	t.readsLeft = settleReads
+}
+
+// observe returns the state seen by a read, advancing the transition.
+func (t *transition) observe() string {
+	if t.target != "" {
+		if t.readsLeft <= 0 {
+			t.state = t.target
+			t.target = ""
+		} else {
+			t.readsLeft--
+		}
+	}
+	return t.state
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
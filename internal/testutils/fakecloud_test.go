@@ -0,0 +1,175 @@
+package testutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	lightsailTypes "github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+func getState(t *testing.T, cloud *FakeCloud, name string) string {
+	t.Helper()
+
+	out, err := cloud.Lightsail.GetInstance(context.Background(), &lightsail.GetInstanceInput{InstanceName: aws.String(name)})
+	if err != nil {
+		t.Fatalf("GetInstance failed: %v", err)
+	}
+	return aws.ToString(out.Instance.State.Name)
+}
+
+func TestFakeLightsailInstanceLifecycle(t *testing.T) {
+	cloud := NewFakeCloud()
+	cloud.SettleReads = 1
+	ctx := context.Background()
+
+	_, err := cloud.Lightsail.CreateInstances(ctx, &lightsail.CreateInstancesInput{
+		InstanceNames: []string{"alice-ubuntu_22_04"},
+		BlueprintId:   aws.String("ubuntu_22_04"),
+		BundleId:      aws.String("app_standard_xl_1_0"),
+	})
+	if err != nil {
+		t.Fatalf("CreateInstances failed: %v", err)
+	}
+
+	steps := []struct {
+		action func() error
+		states []string
+	}{
+		{nil, []string{"pending", "running", "running"}},
+		{func() error {
+			_, err := cloud.Lightsail.StopInstance(ctx, &lightsail.StopInstanceInput{InstanceName: aws.String("alice-ubuntu_22_04")})
+			return err
+		}, []string{"stopping", "stopped"}},
+		{func() error {
+			_, err := cloud.Lightsail.StartInstance(ctx, &lightsail.StartInstanceInput{InstanceName: aws.String("alice-ubuntu_22_04")})
+			return err
+		}, []string{"pending", "running"}},
+	}
+
+	for _, step := range steps {
+		if step.action != nil {
+			if err := step.action(); err != nil {
+				t.Fatalf("action failed: %v", err)
+			}
+		}
+		for _, expected := range step.states {
+			if got := getState(t, cloud, "alice-ubuntu_22_04"); got != expected {
+				t.Fatalf("expected state %s, got %s", expected, got)
+			}
+		}
+	}
+
+	// Starting a running instance is rejected, as in Lightsail.
+	_, err = cloud.Lightsail.StartInstance(ctx, &lightsail.StartInstanceInput{InstanceName: aws.String("alice-ubuntu_22_04")})
+	var invalid *lightsailTypes.InvalidInputException
+	if !errors.As(err, &invalid) {
+		t.Errorf("expected InvalidInputException, got %v", err)
+	}
+}
+
+func TestFakeLightsailSnapshotRequiresAvailable(t *testing.T) {
+	cloud := NewFakeCloud()
+	cloud.SettleReads = 1
+	ctx := context.Background()
+
+	cloud.Lightsail.AddInstance("alice-ubuntu_22_04", "ubuntu_22_04", "app_standard_xl_1_0", "physics", "stopped")
+	_, err := cloud.Lightsail.CreateInstanceSnapshot(ctx, &lightsail.CreateInstanceSnapshotInput{
+		InstanceName:         aws.String("alice-ubuntu_22_04"),
+		InstanceSnapshotName: aws.String("snap"),
+	})
+	if err != nil {
+		t.Fatalf("CreateInstanceSnapshot failed: %v", err)
+	}
+
+	create := func() error {
+		_, err := cloud.Lightsail.CreateInstancesFromSnapshot(ctx, &lightsail.CreateInstancesFromSnapshotInput{
+			InstanceNames:        []string{"alice-copy"},
+			InstanceSnapshotName: aws.String("snap"),
+			BundleId:             aws.String("app_standard_2xl_1_0"),
+		})
+		return err
+	}
+
+	if err := create(); err == nil {
+		t.Fatal("expected creating from a pending snapshot to fail")
+	}
+	if err := create(); err != nil {
+		t.Fatalf("expected creating from an available snapshot to succeed: %v", err)
+	}
+
+	out, err := cloud.Lightsail.GetInstance(ctx, &lightsail.GetInstanceInput{InstanceName: aws.String("alice-copy")})
+	if err != nil {
+		t.Fatalf("GetInstance failed: %v", err)
+	}
+	if aws.ToString(out.Instance.BlueprintId) != "ubuntu_22_04" || aws.ToString(out.Instance.BundleId) != "app_standard_2xl_1_0" {
+		t.Errorf("unexpected instance from snapshot: %+v", out.Instance)
+	}
+}
+
+func TestFakeIAMDeleteUserConflict(t *testing.T) {
+	cloud := NewFakeCloud()
+	ctx := context.Background()
+
+	_, _ = cloud.IAM.CreateUser(ctx, &iam.CreateUserInput{UserName: aws.String("alice")})
+	_, _ = cloud.IAM.PutUserPolicy(ctx, &iam.PutUserPolicyInput{
+		UserName:       aws.String("alice"),
+		PolicyName:     aws.String("p"),
+		PolicyDocument: aws.String("{}"),
+	})
+
+	if _, err := cloud.IAM.DeleteUser(ctx, &iam.DeleteUserInput{UserName: aws.String("alice")}); err == nil {
+		t.Fatal("expected DeleteUser to fail while an inline policy remains")
+	}
+
+	_, _ = cloud.IAM.DeleteUserPolicy(ctx, &iam.DeleteUserPolicyInput{UserName: aws.String("alice"), PolicyName: aws.String("p")})
+	if _, err := cloud.IAM.DeleteUser(ctx, &iam.DeleteUserInput{UserName: aws.String("alice")}); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if len(cloud.IAM.UserNames()) != 0 {
+		t.Errorf("expected no users, got %v", cloud.IAM.UserNames())
+	}
+}
+
+func TestFakeCloudFailureInjection(t *testing.T) {
+	cloud := NewFakeCloud()
+	ctx := context.Background()
+	injected := errors.New("throttled")
+
+	cloud.FailOn("CreateUser", injected)
+	_, err := cloud.IAM.CreateUser(ctx, &iam.CreateUserInput{UserName: aws.String("alice")})
+	if !errors.Is(err, injected) {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+	if len(cloud.IAM.UserNames()) != 0 {
+		t.Error("a failed call must not change state")
+	}
+
+	cloud.ClearFailures()
+	if _, err := cloud.IAM.CreateUser(ctx, &iam.CreateUserInput{UserName: aws.String("alice")}); err != nil {
+		t.Fatalf("CreateUser failed after clearing failures: %v", err)
+	}
+	if got := cloud.CallCount("CreateUser"); got != 2 {
+		t.Errorf("expected 2 CreateUser calls, got %d", got)
+	}
+}
+
+func TestMockLightsailClientOverrides(t *testing.T) {
+	cloud := NewFakeCloud()
+	mock := NewMockLightsailClient(cloud)
+	mock.GetInstanceFunc = func(ctx context.Context, params *lightsail.GetInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstanceOutput, error) {
+		return nil, errors.New("overridden")
+	}
+
+	if _, err := mock.GetInstance(context.Background(), &lightsail.GetInstanceInput{InstanceName: aws.String("x")}); err == nil || err.Error() != "overridden" {
+		t.Errorf("expected override to be used, got %v", err)
+	}
+
+	// Methods without an override fall through to the fake.
+	if _, err := mock.GetInstances(context.Background(), &lightsail.GetInstancesInput{}); err != nil {
+		t.Errorf("expected fallthrough to fake, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package testutils
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+)
+
+// NewMockIAMClient creates an IAM mock backed by the cloud's FakeIAM.
+func NewMockIAMClient(cloud *FakeCloud) *MockIAMClient {
+	return &MockIAMClient{FakeIAM: cloud.IAM}
+}
+
+// NewMockLightsailClient creates a Lightsail mock backed by the cloud's FakeLightsail.
+func NewMockLightsailClient(cloud *FakeCloud) *MockLightsailClient {
+	return &MockLightsailClient{FakeLightsail: cloud.Lightsail}
+}
+
+// ListPolicies calls ListPoliciesFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	if m.ListPoliciesFunc != nil {
+		return m.ListPoliciesFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.ListPolicies(ctx, params, optFns...)
+}
+
+// CreatePolicy calls CreatePolicyFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+	if m.CreatePolicyFunc != nil {
+		return m.CreatePolicyFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.CreatePolicy(ctx, params, optFns...)
+}
+
+// GetGroup calls GetGroupFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) GetGroup(ctx context.Context, params *iam.GetGroupInput, optFns ...func(*iam.Options)) (*iam.GetGroupOutput, error) {
+	if m.GetGroupFunc != nil {
+		return m.GetGroupFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.GetGroup(ctx, params, optFns...)
+}
+
+// CreateGroup calls CreateGroupFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) CreateGroup(ctx context.Context, params *iam.CreateGroupInput, optFns ...func(*iam.Options)) (*iam.CreateGroupOutput, error) {
+	if m.CreateGroupFunc != nil {
+		return m.CreateGroupFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.CreateGroup(ctx, params, optFns...)
+}
+
+// AttachGroupPolicy calls AttachGroupPolicyFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) AttachGroupPolicy(ctx context.Context, params *iam.AttachGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachGroupPolicyOutput, error) {
+	if m.AttachGroupPolicyFunc != nil {
+		return m.AttachGroupPolicyFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.AttachGroupPolicy(ctx, params, optFns...)
+}
+
+// CreateUser calls CreateUserFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) CreateUser(ctx context.Context, params *iam.CreateUserInput, optFns ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+	if m.CreateUserFunc != nil {
+		return m.CreateUserFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.CreateUser(ctx, params, optFns...)
+}
+
+// CreateLoginProfile calls CreateLoginProfileFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) CreateLoginProfile(ctx context.Context, params *iam.CreateLoginProfileInput, optFns ...func(*iam.Options)) (*iam.CreateLoginProfileOutput, error) {
+	if m.CreateLoginProfileFunc != nil {
+		return m.CreateLoginProfileFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.CreateLoginProfile(ctx, params, optFns...)
+}
+
+// AddUserToGroup calls AddUserToGroupFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) AddUserToGroup(ctx context.Context, params *iam.AddUserToGroupInput, optFns ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error) {
+	if m.AddUserToGroupFunc != nil {
+		return m.AddUserToGroupFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.AddUserToGroup(ctx, params, optFns...)
+}
+
+// PutUserPolicy calls PutUserPolicyFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) PutUserPolicy(ctx context.Context, params *iam.PutUserPolicyInput, optFns ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+	if m.PutUserPolicyFunc != nil {
+		return m.PutUserPolicyFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.PutUserPolicy(ctx, params, optFns...)
+}
+
+// ListGroupsForUser calls ListGroupsForUserFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) ListGroupsForUser(ctx context.Context, params *iam.ListGroupsForUserInput, optFns ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+	if m.ListGroupsForUserFunc != nil {
+		return m.ListGroupsForUserFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.ListGroupsForUser(ctx, params, optFns...)
+}
+
+// RemoveUserFromGroup calls RemoveUserFromGroupFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) RemoveUserFromGroup(ctx context.Context, params *iam.RemoveUserFromGroupInput, optFns ...func(*iam.Options)) (*iam.RemoveUserFromGroupOutput, error) {
+	if m.RemoveUserFromGroupFunc != nil {
+		return m.RemoveUserFromGroupFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.RemoveUserFromGroup(ctx, params, optFns...)
+}
+
+// DeleteLoginProfile calls DeleteLoginProfileFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) DeleteLoginProfile(ctx context.Context, params *iam.DeleteLoginProfileInput, optFns ...func(*iam.Options)) (*iam.DeleteLoginProfileOutput, error) {
+	if m.DeleteLoginProfileFunc != nil {
+		return m.DeleteLoginProfileFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.DeleteLoginProfile(ctx, params, optFns...)
+}
+
+// ListUserPolicies calls ListUserPoliciesFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	if m.ListUserPoliciesFunc != nil {
+		return m.ListUserPoliciesFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.ListUserPolicies(ctx, params, optFns...)
+}
+
+// DeleteUserPolicy calls DeleteUserPolicyFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) DeleteUserPolicy(ctx context.Context, params *iam.DeleteUserPolicyInput, optFns ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error) {
+	if m.DeleteUserPolicyFunc != nil {
+		return m.DeleteUserPolicyFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.DeleteUserPolicy(ctx, params, optFns...)
+}
+
+// DeleteUser calls DeleteUserFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) DeleteUser(ctx context.Context, params *iam.DeleteUserInput, optFns ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+	if m.DeleteUserFunc != nil {
+		return m.DeleteUserFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.DeleteUser(ctx, params, optFns...)
+}
+
+// GetUser calls GetUserFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	if m.GetUserFunc != nil {
+		return m.GetUserFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.GetUser(ctx, params, optFns...)
+}
+
+// ListUserTags calls ListUserTagsFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) ListUserTags(ctx context.Context, params *iam.ListUserTagsInput, optFns ...func(*iam.Options)) (*iam.ListUserTagsOutput, error) {
+	if m.ListUserTagsFunc != nil {
+		return m.ListUserTagsFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.ListUserTags(ctx, params, optFns...)
+}
+
+// ListAttachedGroupPolicies calls ListAttachedGroupPoliciesFunc if set, otherwise the embedded FakeIAM.
+func (m *MockIAMClient) ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	if m.ListAttachedGroupPoliciesFunc != nil {
+		return m.ListAttachedGroupPoliciesFunc(ctx, params, optFns...)
+	}
+	return m.FakeIAM.ListAttachedGroupPolicies(ctx, params, optFns...)
+}
+
+// GetBlueprints calls GetBlueprintsFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) GetBlueprints(ctx context.Context, params *lightsail.GetBlueprintsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetBlueprintsOutput, error) {
+	if m.GetBlueprintsFunc != nil {
+		return m.GetBlueprintsFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.GetBlueprints(ctx, params, optFns...)
+}
+
+// GetBundles calls GetBundlesFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) GetBundles(ctx context.Context, params *lightsail.GetBundlesInput, optFns ...func(*lightsail.Options)) (*lightsail.GetBundlesOutput, error) {
+	if m.GetBundlesFunc != nil {
+		return m.GetBundlesFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.GetBundles(ctx, params, optFns...)
+}
+
+// GetRegions calls GetRegionsFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) GetRegions(ctx context.Context, params *lightsail.GetRegionsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetRegionsOutput, error) {
+	if m.GetRegionsFunc != nil {
+		return m.GetRegionsFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.GetRegions(ctx, params, optFns...)
+}
+
+// CreateInstances calls CreateInstancesFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) CreateInstances(ctx context.Context, params *lightsail.CreateInstancesInput, optFns ...func(*lightsail.Options)) (*lightsail.CreateInstancesOutput, error) {
+	if m.CreateInstancesFunc != nil {
+		return m.CreateInstancesFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.CreateInstances(ctx, params, optFns...)
+}
+
+// GetInstance calls GetInstanceFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) GetInstance(ctx context.Context, params *lightsail.GetInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstanceOutput, error) {
+	if m.GetInstanceFunc != nil {
+		return m.GetInstanceFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.GetInstance(ctx, params, optFns...)
+}
+
+// GetInstances calls GetInstancesFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) GetInstances(ctx context.Context, params *lightsail.GetInstancesInput, optFns ...func(*lightsail.Options)) (*lightsail.GetInstancesOutput, error) {
+	if m.GetInstancesFunc != nil {
+		return m.GetInstancesFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.GetInstances(ctx, params, optFns...)
+}
+
+// DeleteInstance calls DeleteInstanceFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) DeleteInstance(ctx context.Context, params *lightsail.DeleteInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.DeleteInstanceOutput, error) {
+	if m.DeleteInstanceFunc != nil {
+		return m.DeleteInstanceFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.DeleteInstance(ctx, params, optFns...)
+}
+
+// StartInstance calls StartInstanceFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) StartInstance(ctx context.Context, params *lightsail.StartInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.StartInstanceOutput, error) {
+	if m.StartInstanceFunc != nil {
+		return m.StartInstanceFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.StartInstance(ctx, params, optFns...)
+}
+
+// StopInstance calls StopInstanceFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) StopInstance(ctx context.Context, params *lightsail.StopInstanceInput, optFns ...func(*lightsail.Options)) (*lightsail.StopInstanceOutput, error) {
+	if m.StopInstanceFunc != nil {
+		return m.StopInstanceFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.StopInstance(ctx, params, optFns...)
+}
+
+// GetKeyPair calls GetKeyPairFunc if set, otherwise the embedded FakeLightsail.
+func (m *MockLightsailClient) GetKeyPair(ctx context.Context, params *lightsail.GetKeyPairInput, optFns ...func(*lightsail.Options)) (*lightsail.GetKeyPairOutput, error) {
+	if m.GetKeyPairFunc != nil {
+		return m.GetKeyPairFunc(ctx, params, optFns...)
+	}
+	return m.FakeLightsail.GetKeyPair(ctx, params, optFns...)
+}
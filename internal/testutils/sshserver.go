@@ -0,0 +1,316 @@
+package testutils
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// SSHHandler runs a command received by an SSHServer and returns its exit
+// status. ctx is cancelled when the client signals or closes the session.
+type SSHHandler func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// SSHServer is an in-process SSH server that hands exec requests to a
+// handler, serves SFTP from an in-memory file system shared by all
+// connections, in which relative paths start at /home/ubuntu, and forwards
+// ports to the loopback interface. It only accepts the key in ClientKey and
+// keys added with AuthorizeKey.
+type SSHServer struct {
+	// Addr is the host:port the server listens on.
+	Addr string
+	// ClientKey is the PEM private key clients must authenticate with.
+	ClientKey []byte
+	// HostKey is the server's host key.
+	HostKey gossh.PublicKey
+
+	listener net.Listener
+	config   *gossh.ServerConfig
+
+	files sftp.Handlers
+
+	mu         sync.Mutex
+	authorized [][]byte
+	handler    SSHHandler
+	commands   []string
+	users      []string
+	forwards   []string
+}
+
+// NewSSHServer starts an SSH server on a loopback port that is closed when the
+// test ends. By default every command succeeds without output.
+func NewSSHServer(t *testing.T) *SSHServer {
+	t.Helper()
+
+	hostSigner := newSigner(t)
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %v", err)
+	}
+	clientSigner, err := gossh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		t.Fatalf("failed to create client signer: %v", err)
+	}
+	block, err := gossh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatalf("failed to marshal client key: %v", err)
+	}
+
+	s := &SSHServer{
+		ClientKey: pem.EncodeToMemory(block),
+		HostKey:   hostSigner.PublicKey(),
+		files:     sftp.InMemHandler(),
+		handler: func(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+			return 0
+		},
+	}
+
+	// Like an instance, the SFTP file system starts with the home directory
+	for _, dir := range []string{"/home", "/home/ubuntu"} {
+		if err := s.files.FileCmd.Filecmd(sftp.NewRequest("Mkdir", dir)); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	s.authorized = [][]byte{clientSigner.PublicKey().Marshal()}
+	s.config = &gossh.ServerConfig{
+		PublicKeyCallback: func(conn gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for _, authorized := range s.authorized {
+				if string(key.Marshal()) == string(authorized) {
+					s.users = append(s.users, conn.User())
+					return nil, nil
+				}
+			}
+			return nil, io.ErrUnexpectedEOF
+		},
+	}
+	s.config.AddHostKey(hostSigner)
+
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s.Addr = s.listener.Addr().String()
+	t.Cleanup(func() { s.listener.Close() })
+
+	go s.serve()
+	return s
+}
+
+func newSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("failed to create host signer: %v", err)
+	}
+	return signer
+}
+
+// Host returns the host part of Addr.
+func (s *SSHServer) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+// Port returns the port part of Addr.
+func (s *SSHServer) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// AuthorizeKey makes the server accept key as well as ClientKey.
+func (s *SSHServer) AuthorizeKey(key gossh.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorized = append(s.authorized, key.Marshal())
+}
+
+// Handle replaces the command handler.
+func (s *SSHServer) Handle(handler SSHHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = handler
+}
+
+// Commands returns the commands received so far.
+func (s *SSHServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Forwards returns the host:port targets of port forwards opened so far.
+func (s *SSHServer) Forwards() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.forwards...)
+}
+
+// Users returns the user names of authenticated connections.
+func (s *SSHServer) Users() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.users...)
+}
+
+func (s *SSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *SSHServer) serveConn(conn net.Conn) {
+	sshConn, chans, reqs, err := gossh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	go gossh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go s.serveSession(channel, requests)
+		case "direct-tcpip":
+			go s.serveDirectTCPIP(newChannel)
+		default:
+			newChannel.Reject(gossh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// serveDirectTCPIP connects a port forward to its target. Every target host
+// resolves to the loopback interface, like "localhost" on an instance.
+func (s *SSHServer) serveDirectTCPIP(newChannel gossh.NewChannel) {
+	var payload struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := gossh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(gossh.ConnectionFailed, "invalid payload")
+		return
+	}
+
+	s.mu.Lock()
+	s.forwards = append(s.forwards, net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	s.mu.Unlock()
+
+	target, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	defer target.Close()
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go gossh.DiscardRequests(requests)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(target, channel)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(channel, target)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (s *SSHServer) serveSession(channel gossh.Channel, requests <-chan *gossh.Request) {
+	defer channel.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan int, 1)
+	started := false
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				cancel()
+				if started {
+					<-done
+				}
+				return
+			}
+
+			switch req.Type {
+			case "exec":
+				var payload struct{ Command string }
+				if started || gossh.Unmarshal(req.Payload, &payload) != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				started = true
+
+				s.mu.Lock()
+				s.commands = append(s.commands, payload.Command)
+				handler := s.handler
+				s.mu.Unlock()
+
+				go func() {
+					done <- handler(ctx, payload.Command, channel, channel, channel.Stderr())
+				}()
+			case "subsystem":
+				var payload struct{ Name string }
+				if started || gossh.Unmarshal(req.Payload, &payload) != nil || payload.Name != "sftp" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				started = true
+
+				go func() {
+					server := sftp.NewRequestServer(channel, s.files, sftp.WithStartDirectory("/home/ubuntu"))
+					server.Serve()
+					server.Close()
+					done <- 0
+				}()
+			case "signal":
+				cancel()
+			default:
+				if req.WantReply {
+					req.Reply(req.Type == "env", nil)
+				}
+			}
+		case status := <-done:
+			payload := make([]byte, 4)
+			binary.BigEndian.PutUint32(payload, uint32(status))
+			channel.SendRequest("exit-status", false, payload)
+			return
+		}
+	}
+}
@@ -14,7 +14,10 @@ import (
 )
 
 // MockIAMClient provides a mock implementation of the IAM client for testing.
+// Calls without a Func override fall through to the embedded FakeIAM.
 type MockIAMClient struct {
+	*FakeIAM
+
 	ListPoliciesFunc          func(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error)
 	CreatePolicyFunc          func(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error)
 	GetGroupFunc              func(ctx context.Context, params *iam.GetGroupInput, optFns ...func(*iam.Options)) (*iam.GetGroupOutput, error)
@@ -36,7 +39,10 @@ type MockIAMClient struct {
 }
 
 // MockLightsailClient provides a mock implementation of the Lightsail client for testing.
+// Calls without a Func override fall through to the embedded FakeLightsail.
 type MockLightsailClient struct {
+	*FakeLightsail
+
 	GetBlueprintsFunc     func(ctx context.Context, params *lightsail.GetBlueprintsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetBlueprintsOutput, error)
 	GetBundlesFunc        func(ctx context.Context, params *lightsail.GetBundlesInput, optFns ...func(*lightsail.Options)) (*lightsail.GetBundlesOutput, error)
 	GetRegionsFunc        func(ctx context.Context, params *lightsail.GetRegionsInput, optFns ...func(*lightsail.Options)) (*lightsail.GetRegionsOutput, error)
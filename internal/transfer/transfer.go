@@ -0,0 +1,289 @@
+// Package transfer copies files between the local machine and instances over
+// SFTP, recording the size and SHA-256 checksum of every file it copies.
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// File is a copied file.
+type File struct {
+	// Path is slash separated and relative to the copied file or directory.
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Collection statuses.
+const (
+	StatusCollected = "collected"
+	StatusMissing   = "missing"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// Manifest records a collection from a project's instances.
+type Manifest struct {
+	Project     string      `json:"project"`
+	RemotePath  string      `json:"remote_path"`
+	CollectedAt time.Time   `json:"collected_at"`
+	Users       []UserFiles `json:"users"`
+}
+
+// UserFiles is what was collected from one user's instance.
+type UserFiles struct {
+	User     string `json:"user"`
+	Instance string `json:"instance"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Files    []File `json:"files,omitempty"`
+}
+
+// WriteManifest writes a manifest as indented JSON.
+func WriteManifest(filename string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// RemotePath turns a "~/" path into one relative to the home directory, which
+// is where SFTP resolves relative paths.
+func RemotePath(remote string) string {
+	if remote == "~" {
+		return "."
+	}
+	return strings.TrimPrefix(remote, "~/")
+}
+
+// Push copies a local file or directory to an instance. A directory's contents
+// are copied into the remote directory, which is created if needed. A file is
+// copied to the remote path, or into it if the path ends in "/" or is an
+// existing directory. Every file is read back and its checksum verified.
+func Push(ctx context.Context, client *sftp.Client, local, remote string) ([]File, error) {
+	remote = RemotePath(remote)
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", local, err)
+	}
+
+	if !info.IsDir() {
+		target := remote
+		if strings.HasSuffix(remote, "/") || isRemoteDir(client, remote) {
+			target = path.Join(remote, filepath.Base(local))
+		}
+		if err := client.MkdirAll(path.Dir(target)); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", path.Dir(target), err)
+		}
+
+		file, err := pushFile(client, local, target)
+		if err != nil {
+			return nil, err
+		}
+		file.Path = path.Base(target)
+		return []File{*file}, nil
+	}
+
+	var files []File
+	err = filepath.WalkDir(local, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(local, localPath)
+		if err != nil {
+			return err
+		}
+		target := path.Join(remote, filepath.ToSlash(rel))
+
+		switch {
+		case entry.IsDir():
+			if err := client.MkdirAll(target); err != nil {
+				return fmt.Errorf("failed to create %s: %w", target, err)
+			}
+		case entry.Type().IsRegular():
+			file, err := pushFile(client, localPath, target)
+			if err != nil {
+				return err
+			}
+			file.Path = filepath.ToSlash(rel)
+			files = append(files, *file)
+		}
+		// Symlinks and special files are skipped
+		return nil
+	})
+	return files, err
+}
+
+// pushFile uploads one file and verifies the remote copy's checksum.
+func pushFile(client *sftp.Client, localPath, target string) (*File, error) {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", localPath, err)
+	}
+
+	dst, err := client.Create(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", target, err)
+	}
+
+	hash := sha256.New()
+	size, err := dst.ReadFrom(io.TeeReader(src, hash))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", target, err)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	remoteChecksum, err := RemoteChecksum(client, target)
+	if err != nil {
+		return nil, err
+	}
+	if remoteChecksum != checksum {
+		return nil, fmt.Errorf("checksum mismatch for %s: uploaded %s, instance has %s", target, checksum, remoteChecksum)
+	}
+
+	// Keep the local modification time so repeated pushes are recognisable
+	_ = client.Chtimes(target, info.ModTime(), info.ModTime())
+
+	return &File{Size: size, SHA256: checksum, ModTime: info.ModTime()}, nil
+}
+
+// RemoteChecksum returns the SHA-256 checksum of a remote file.
+func RemoteChecksum(client *sftp.Client, remotePath string) (string, error) {
+	file, err := client.Open(remotePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", remotePath, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := file.WriteTo(hash); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", remotePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Collect copies a remote file or directory into a local directory: a file to
+// localDir/<name>, and a directory's contents to localDir/<name>/. A missing
+// remote path returns an error matching fs.ErrNotExist.
+func Collect(ctx context.Context, client *sftp.Client, remote, localDir string) ([]File, error) {
+	remote = path.Clean(RemotePath(remote))
+
+	info, err := client.Stat(remote)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", remote, fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("failed to stat %s: %w", remote, err)
+	}
+
+	name := path.Base(remote)
+	if name == "." || name == "/" {
+		name = "home"
+	}
+
+	if !info.IsDir() {
+		file, err := collectFile(client, remote, filepath.Join(localDir, name))
+		if err != nil {
+			return nil, err
+		}
+		file.Path = name
+		return []File{*file}, nil
+	}
+
+	var files []File
+	walker := client.Walk(remote)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return files, fmt.Errorf("failed to read %s: %w", walker.Path(), err)
+		}
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+		if !walker.Stat().Mode().IsRegular() {
+			continue
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), remote), "/")
+		file, err := collectFile(client, walker.Path(), filepath.Join(localDir, name, filepath.FromSlash(rel)))
+		if err != nil {
+			return files, err
+		}
+		file.Path = path.Join(name, rel)
+		files = append(files, *file)
+	}
+	return files, nil
+}
+
+// collectFile downloads one file, recording its checksum.
+func collectFile(client *sftp.Client, remotePath, localPath string) (*File, error) {
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", remotePath, err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", remotePath, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(localPath), err)
+	}
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+
+	hash := sha256.New()
+	size, err := src.WriteTo(io.MultiWriter(dst, hash))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", remotePath, err)
+	}
+
+	_ = os.Chtimes(localPath, info.ModTime(), info.ModTime())
+
+	return &File{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil)), ModTime: info.ModTime()}, nil
+}
+
+func isRemoteDir(client *sftp.Client, remote string) bool {
+	info, err := client.Stat(remote)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,157 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/scttfrdmn/lfr-tools/internal/ssh"
+	"github.com/scttfrdmn/lfr-tools/internal/testutils"
+)
+
+func sftpClient(t *testing.T) *sftp.Client {
+	t.Helper()
+
+	server := testutils.NewSSHServer(t)
+	conn, err := ssh.Dial(context.Background(), ssh.Config{
+		Host:            server.Host(),
+		Port:            server.Port(),
+		User:            "ubuntu",
+		PrivateKey:      server.ClientKey,
+		HostKeyCallback: gossh.FixedHostKey(server.HostKey),
+	})
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client, err := conn.SFTP()
+	if err != nil {
+		t.Fatalf("failed to start SFTP: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func filePaths(files []File) string {
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestPushAndCollectDirectory(t *testing.T) {
+	client := sftpClient(t)
+	ctx := context.Background()
+
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{
+		"README.md":      "starter code\n",
+		"src/main.py":    "print('hello')\n",
+		"src/data/a.csv": "x,y\n1,2\n",
+	})
+
+	pushed, err := Push(ctx, client, local, "~/hw1")
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if got := filePaths(pushed); got != "README.md,src/data/a.csv,src/main.py" {
+		t.Errorf("unexpected pushed files %s", got)
+	}
+
+	// The home directory is /home/ubuntu, so relative and absolute paths agree
+	checksum, err := RemoteChecksum(client, "/home/ubuntu/hw1/src/main.py")
+	if err != nil {
+		t.Fatalf("RemoteChecksum failed: %v", err)
+	}
+	if checksum != pushed[2].SHA256 {
+		t.Errorf("expected remote checksum %s, got %s", pushed[2].SHA256, checksum)
+	}
+
+	into := t.TempDir()
+	collected, err := Collect(ctx, client, "hw1/", into)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if got := filePaths(collected); got != "hw1/README.md,hw1/src/data/a.csv,hw1/src/main.py" {
+		t.Errorf("unexpected collected files %s", got)
+	}
+	for i, file := range collected {
+		if file.SHA256 != pushed[i].SHA256 || file.Size != pushed[i].Size {
+			t.Errorf("collected %s differs from what was pushed: %+v vs %+v", file.Path, file, pushed[i])
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(into, "hw1", "src", "main.py"))
+	if err != nil || string(data) != "print('hello')\n" {
+		t.Errorf("unexpected collected content %q (%v)", data, err)
+	}
+}
+
+func TestPushAndCollectFile(t *testing.T) {
+	client := sftpClient(t)
+	ctx := context.Background()
+
+	local := t.TempDir()
+	writeFiles(t, local, map[string]string{"notes.txt": "read me\n"})
+
+	if err := client.MkdirAll("handouts"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remote   string
+		expected string
+	}{
+		{"handouts", "/home/ubuntu/handouts/notes.txt"},
+		{"new/", "/home/ubuntu/new/notes.txt"},
+		{"renamed.txt", "/home/ubuntu/renamed.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			if _, err := Push(ctx, client, filepath.Join(local, "notes.txt"), tt.remote); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+			if _, err := client.Stat(tt.expected); err != nil {
+				t.Errorf("expected %s to exist: %v", tt.expected, err)
+			}
+		})
+	}
+
+	into := t.TempDir()
+	collected, err := Collect(ctx, client, "renamed.txt", into)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if got := filePaths(collected); got != "renamed.txt" {
+		t.Errorf("unexpected collected files %s", got)
+	}
+
+	_, err = Collect(ctx, client, "missing", into)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a not exist error for a missing path, got %v", err)
+	}
+}
@@ -15,6 +15,7 @@ type SoftwarePack struct {
 	Environment map[string]string `json:"environment" yaml:"environment"`
 	Tags        []string          `json:"tags" yaml:"tags"`
 	Supported   []string          `json:"supported_platforms" yaml:"supported_platforms"`
+	Container   *Container        `json:"container,omitempty" yaml:"container,omitempty"` // container packs only
 }
 
 // PackType defines the type of software pack.
@@ -27,11 +28,22 @@ const (
 	PackTypeMixed     PackType = "mixed"
 )
 
+// Container is the container a container pack runs on an instance as a
+// systemd service.
+type Container struct {
+	Image       string            `json:"image" yaml:"image"`                         // pinned to a tag or digest
+	Runtime     string            `json:"runtime,omitempty" yaml:"runtime,omitempty"` // docker (default) or podman
+	Ports       []string          `json:"ports,omitempty" yaml:"ports,omitempty"`     // port or host_port:container_port
+	Volumes     []string          `json:"volumes,omitempty" yaml:"volumes,omitempty"` // host_path_or_volume:container_path[:options]
+	Environment map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Command     []string          `json:"command,omitempty" yaml:"command,omitempty"`
+}
+
 // Package represents an individual software package.
 type Package struct {
 	Name     string   `json:"name" yaml:"name"`
 	Version  string   `json:"version,omitempty" yaml:"version,omitempty"`
-	Source   string   `json:"source" yaml:"source"` // apt, snap, pip, npm, etc.
+	Source   string   `json:"source" yaml:"source"` // apt, pip, npm, snap, conda, deb or custom
 	Options  []string `json:"options,omitempty" yaml:"options,omitempty"`
 	PostInstall []string `json:"post_install,omitempty" yaml:"post_install,omitempty"`
 }
@@ -49,10 +61,21 @@ type Script struct {
 // InstallResult represents the result of a software pack installation.
 type InstallResult struct {
 	PackID      string    `json:"pack_id"`
+	Version     string    `json:"version,omitempty"`
 	Success     bool      `json:"success"`
 	Message     string    `json:"message"`
 	Duration    string    `json:"duration"`
 	InstalledAt string    `json:"installed_at"`
 	Packages    []string  `json:"packages_installed"`
 	Errors      []string  `json:"errors,omitempty"`
+	// PackageSpecs, Environment and Scripts record what a successful install
+	// set up, so that upgrades and removals can work out what changed.
+	// Scripts are recorded as name@checksum.
+	PackageSpecs []Package        `json:"package_specs,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+	Scripts     []string          `json:"scripts,omitempty"`
+	Container   *Container        `json:"container,omitempty"`
+	// NewPackages are the APT packages the pack installed that weren't on the
+	// instance before; removing the pack purges only these.
+	NewPackages []string `json:"new_packages,omitempty"`
 }
\ No newline at end of file
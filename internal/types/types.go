@@ -42,6 +42,18 @@ type Instance struct {
 	CreatedAt    time.Time         `json:"created_at" yaml:"created_at"`
 	PublicIP     string            `json:"public_ip,omitempty" yaml:"public_ip,omitempty"`
 	PrivateIP    string            `json:"private_ip,omitempty" yaml:"private_ip,omitempty"`
+	// SSHKeyName is the key pair installed on the instance when it was created.
+	SSHKeyName string `json:"ssh_key_name,omitempty" yaml:"ssh_key_name,omitempty"`
+	// AvailabilityZone is the zone the instance runs in.
+	AvailabilityZone string `json:"availability_zone,omitempty" yaml:"availability_zone,omitempty"`
+	// Idle is the instance's stop-on-idle add-on, or nil if it isn't enabled.
+	Idle *IdleDetection `json:"idle,omitempty" yaml:"idle,omitempty"`
+}
+
+// IdleDetection is the stop-on-idle configuration of an instance.
+type IdleDetection struct {
+	ThresholdMinutes int `json:"threshold_minutes" yaml:"threshold_minutes"`
+	DurationMinutes  int `json:"duration_minutes" yaml:"duration_minutes"`
 }
 
 // Disk represents a Lightsail block storage disk.
@@ -57,4 +69,52 @@ type Disk struct {
 	Region           string            `json:"region" yaml:"region"`
 	Tags             map[string]string `json:"tags" yaml:"tags"`
 	CreatedAt        time.Time         `json:"created_at" yaml:"created_at"`
-}
\ No newline at end of file
+}
+
+// Snapshot represents a Lightsail instance snapshot.
+type Snapshot struct {
+	Name          string `json:"name" yaml:"name"`
+	ARN           string `json:"arn" yaml:"arn"`
+	State         string `json:"state" yaml:"state"`
+	FromInstance  string `json:"from_instance" yaml:"from_instance"`
+	FromBlueprint string `json:"from_blueprint" yaml:"from_blueprint"`
+	FromBundle    string `json:"from_bundle" yaml:"from_bundle"`
+	SizeGB        int32  `json:"size_gb" yaml:"size_gb"`
+	Region        string `json:"region" yaml:"region"`
+	// AvailabilityZone is the zone of the instance the snapshot was taken from.
+	AvailabilityZone string            `json:"availability_zone,omitempty" yaml:"availability_zone,omitempty"`
+	Tags             map[string]string `json:"tags" yaml:"tags"`
+	CreatedAt        time.Time         `json:"created_at" yaml:"created_at"`
+}
+
+// KeyPair represents a Lightsail SSH key pair.
+type KeyPair struct {
+	Name        string            `json:"name" yaml:"name"`
+	ARN         string            `json:"arn" yaml:"arn"`
+	Fingerprint string            `json:"fingerprint" yaml:"fingerprint"`
+	Tags        map[string]string `json:"tags" yaml:"tags"`
+	CreatedAt   time.Time         `json:"created_at" yaml:"created_at"`
+}
+
+// MetricPoint is a single datapoint of a Lightsail instance metric.
+type MetricPoint struct {
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+	Average   float64   `json:"average" yaml:"average"`
+	Maximum   float64   `json:"maximum" yaml:"maximum"`
+	Sum       float64   `json:"sum" yaml:"sum"`
+}
+
+// InstanceUsage summarizes recent metric data for a Lightsail instance.
+type InstanceUsage struct {
+	Name              string        `json:"name" yaml:"name"`
+	State             string        `json:"state" yaml:"state"`
+	CPUAverage        float64       `json:"cpu_average" yaml:"cpu_average"`
+	CPUMaximum        float64       `json:"cpu_maximum" yaml:"cpu_maximum"`
+	NetworkInBytes    float64       `json:"network_in_bytes" yaml:"network_in_bytes"`
+	NetworkOutBytes   float64       `json:"network_out_bytes" yaml:"network_out_bytes"`
+	StatusCheckFailed bool          `json:"status_check_failed" yaml:"status_check_failed"`
+	IdleFor           time.Duration `json:"idle_for" yaml:"idle_for"`
+	IdleForAtLeast    bool          `json:"idle_for_at_least" yaml:"idle_for_at_least"`
+	Idle              bool          `json:"idle" yaml:"idle"`
+	HasData           bool          `json:"has_data" yaml:"has_data"`
+}
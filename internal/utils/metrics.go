@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// InstanceMetrics holds the raw metric datapoints collected for an instance.
+type InstanceMetrics struct {
+	CPU               []types.MetricPoint
+	NetworkIn         []types.MetricPoint
+	NetworkOut        []types.MetricPoint
+	StatusCheckFailed []types.MetricPoint
+}
+
+// IdleDuration returns how long average CPU utilization has stayed below the
+// threshold, measured from the start of the first quiet datapoint after the last
+// busy one. If no datapoint reaches the threshold the instance has been quiet for
+// the whole window, so the duration is a lower bound and atLeast is true.
+func IdleDuration(cpu []types.MetricPoint, cpuThreshold float64, now time.Time) (idle time.Duration, atLeast bool) {
+	if len(cpu) == 0 {
+		return 0, false
+	}
+
+	lastBusy := -1
+	for i, point := range cpu {
+		if point.Average >= cpuThreshold {
+			lastBusy = i
+		}
+	}
+
+	switch {
+	case lastBusy == len(cpu)-1:
+		return 0, false
+	case lastBusy < 0:
+		return now.Sub(cpu[0].Timestamp), true
+	default:
+		return now.Sub(cpu[lastBusy+1].Timestamp), false
+	}
+}
+
+// SummarizeInstanceUsage builds a usage summary for an instance from its metrics.
+// A running instance is idle once its CPU has stayed below cpuThreshold for at
+// least idleThreshold.
+func SummarizeInstanceUsage(instance *types.Instance, metrics *InstanceMetrics, cpuThreshold float64, idleThreshold time.Duration, now time.Time) *types.InstanceUsage {
+	usage := &types.InstanceUsage{
+		Name:  instance.Name,
+		State: instance.State,
+	}
+	if metrics == nil || len(metrics.CPU) == 0 {
+		return usage
+	}
+
+	usage.HasData = true
+
+	var cpuTotal float64
+	for _, point := range metrics.CPU {
+		cpuTotal += point.Average
+		if point.Maximum > usage.CPUMaximum {
+			usage.CPUMaximum = point.Maximum
+		}
+	}
+	usage.CPUAverage = cpuTotal / float64(len(metrics.CPU))
+
+	for _, point := range metrics.NetworkIn {
+		usage.NetworkInBytes += point.Sum
+	}
+	for _, point := range metrics.NetworkOut {
+		usage.NetworkOutBytes += point.Sum
+	}
+
+	// Only the most recent status check reflects the instance's current health
+	if n := len(metrics.StatusCheckFailed); n > 0 {
+		usage.StatusCheckFailed = metrics.StatusCheckFailed[n-1].Maximum > 0
+	}
+
+	usage.IdleFor, usage.IdleForAtLeast = IdleDuration(metrics.CPU, cpuThreshold, now)
+	usage.Idle = instance.State == "running" && usage.IdleFor >= idleThreshold
+
+	return usage
+}
+
+// FormatBytes formats a byte count using binary units.
+func FormatBytes(bytes float64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%.0f B", bytes)
+	}
+
+	div, exp := float64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", bytes/div, "KMGTP"[exp])
+}
+
+// FormatDuration formats a duration as hours and minutes, e.g. "2h05m" or "45m".
+func FormatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+
+	d = d.Round(time.Minute)
+	hours := int(d / time.Hour)
+	minutes := int((d % time.Hour) / time.Minute)
+	if hours == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh%02dm", hours, minutes)
+}
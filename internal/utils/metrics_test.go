@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/lfr-tools/internal/types"
+)
+
+// cpuSeries builds five-minute CPU datapoints ending at now.
+func cpuSeries(now time.Time, averages ...float64) []types.MetricPoint {
+	points := make([]types.MetricPoint, len(averages))
+	for i, avg := range averages {
+		points[i] = types.MetricPoint{
+			Timestamp: now.Add(-time.Duration(len(averages)-i) * 5 * time.Minute),
+			Average:   avg,
+			Maximum:   avg * 2,
+		}
+	}
+	return points
+}
+
+func TestIdleDuration(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		cpu         []types.MetricPoint
+		expected    time.Duration
+		expectLower bool
+	}{
+		{"no data", nil, 0, false},
+		{"busy now", cpuSeries(now, 1, 1, 50), 0, false},
+		{"quiet after busy", cpuSeries(now, 50, 1, 1, 1), 15 * time.Minute, false},
+		{"quiet whole window", cpuSeries(now, 1, 2, 1), 15 * time.Minute, true},
+		{"threshold is busy", cpuSeries(now, 5, 1), 5 * time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idle, atLeast := IdleDuration(tt.cpu, 5, now)
+			if idle != tt.expected {
+				t.Errorf("expected idle %v, got %v", tt.expected, idle)
+			}
+			if atLeast != tt.expectLower {
+				t.Errorf("expected atLeast=%v, got %v", tt.expectLower, atLeast)
+			}
+		})
+	}
+}
+
+func TestSummarizeInstanceUsage(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	metrics := &InstanceMetrics{
+		CPU:               cpuSeries(now, 40, 2, 2, 2, 2),
+		NetworkIn:         []types.MetricPoint{{Timestamp: now, Sum: 1024}, {Timestamp: now, Sum: 2048}},
+		NetworkOut:        []types.MetricPoint{{Timestamp: now, Sum: 512}},
+		StatusCheckFailed: []types.MetricPoint{{Timestamp: now.Add(-time.Minute), Maximum: 1}, {Timestamp: now, Maximum: 0}},
+	}
+
+	running := &types.Instance{Name: "alice-ubuntu_22_04", State: "running"}
+	usage := SummarizeInstanceUsage(running, metrics, 5, 15*time.Minute, now)
+
+	if !usage.HasData || !usage.Idle {
+		t.Errorf("expected idle instance with data, got %+v", usage)
+	}
+	if usage.IdleFor != 20*time.Minute {
+		t.Errorf("expected idle for 20m, got %v", usage.IdleFor)
+	}
+	if usage.CPUAverage != 9.6 || usage.CPUMaximum != 80 {
+		t.Errorf("unexpected CPU summary: avg=%v max=%v", usage.CPUAverage, usage.CPUMaximum)
+	}
+	if usage.NetworkInBytes != 3072 || usage.NetworkOutBytes != 512 {
+		t.Errorf("unexpected network totals: in=%v out=%v", usage.NetworkInBytes, usage.NetworkOutBytes)
+	}
+	if usage.StatusCheckFailed {
+		t.Error("expected latest status check to pass")
+	}
+
+	// Stopped instances are never reported as idle
+	stopped := &types.Instance{Name: "bob-ubuntu_22_04", State: "stopped"}
+	if usage := SummarizeInstanceUsage(stopped, metrics, 5, 15*time.Minute, now); usage.Idle {
+		t.Error("expected stopped instance not to be idle")
+	}
+
+	if usage := SummarizeInstanceUsage(running, nil, 5, 15*time.Minute, now); usage.HasData || usage.Idle {
+		t.Errorf("expected no data, got %+v", usage)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    float64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 * 1024 * 1024 * 1024, "3.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.bytes); got != tt.expected {
+			t.Errorf("FormatBytes(%v) = %s, expected %s", tt.bytes, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{30 * time.Second, "<1m"},
+		{45 * time.Minute, "45m"},
+		{2*time.Hour + 5*time.Minute, "2h05m"},
+		{26 * time.Hour, "26h00m"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatDuration(tt.duration); got != tt.expected {
+			t.Errorf("FormatDuration(%v) = %s, expected %s", tt.duration, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultParallel is the default number of concurrent workers for bulk operations.
+const DefaultParallel = 5
+
+// throttlingErrorCodes are the AWS error codes returned when a request rate limit is exceeded.
+var throttlingErrorCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"TooManyRequestsException":               true,
+	"RequestLimitExceeded":                   true,
+	"RequestThrottled":                       true,
+	"RequestThrottledException":              true,
+	"ProvisionedThroughputExceededException": true,
+}
+
+// IsThrottlingError reports whether err is an AWS throttling error.
+func IsThrottlingError(err error) bool {
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		return throttlingErrorCodes[apiErr.ErrorCode()]
+	}
+	return false
+}
+
+// BulkOptions configures RunBulk.
+type BulkOptions struct {
+	// Parallel is the maximum number of items processed at once.
+	Parallel int
+	// Action describes the operation in progress output, e.g. "Starting".
+	Action string
+	// MaxRetries is the number of times an item is retried after a throttling error.
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; it doubles on each retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between retries.
+	MaxDelay time.Duration
+	// Out receives progress output. Defaults to os.Stdout.
+	Out io.Writer
+	// Interactive redraws a single status line instead of printing one line
+	// per update. Defaults to whether Out is a terminal outside CI.
+	Interactive *bool
+	// Journal, if set, records the progress of each item.
+	Journal BulkJournal
+}
+
+// BulkJournal records the progress of each item in a bulk run. Its methods are
+// called concurrently from the workers.
+type BulkJournal interface {
+	ItemStarted(item string)
+	ItemFinished(result BulkResult)
+}
+
+// BulkResult is the outcome of processing a single item.
+type BulkResult struct {
+	Item     string
+	Detail   string
+	Err      error
+	Attempts int
+	Elapsed  time.Duration
+}
+
+// BulkFunc processes one item, returning an optional detail for the progress output.
+type BulkFunc func(ctx context.Context, item string) (string, error)
+
+// RunBulk processes items with a bounded pool of workers, retrying throttled
+// items with exponential backoff. Results are returned in the order of items.
+// Items not started before ctx is cancelled fail with the context's error.
+func RunBulk(ctx context.Context, items []string, opts BulkOptions, fn BulkFunc) []BulkResult {
+	opts = opts.withDefaults()
+	results := make([]BulkResult, len(items))
+	progress := newBulkProgress(opts, len(items))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Parallel && w < len(items); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				progress.started()
+				if opts.Journal != nil {
+					opts.Journal.ItemStarted(items[i])
+				}
+
+				results[i] = runWithRetry(ctx, items[i], opts, fn)
+
+				if opts.Journal != nil {
+					opts.Journal.ItemFinished(results[i])
+				}
+				progress.finished(results[i])
+			}
+		}()
+	}
+
+	for i := range items {
+		if ctx.Err() != nil {
+			results[i] = BulkResult{Item: items[i], Err: ctx.Err()}
+			if opts.Journal != nil {
+				opts.Journal.ItemFinished(results[i])
+			}
+			progress.finished(results[i])
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	progress.done()
+	return results
+}
+
+// runWithRetry runs fn for one item, retrying throttling errors with backoff.
+func runWithRetry(ctx context.Context, item string, opts BulkOptions, fn BulkFunc) BulkResult {
+	result := BulkResult{Item: item}
+	start := time.Now()
+
+	for {
+		result.Attempts++
+		result.Detail, result.Err = fn(ctx, item)
+		if result.Err == nil || !IsThrottlingError(result.Err) || result.Attempts > opts.MaxRetries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			result.Elapsed = time.Since(start)
+			return result
+		case <-time.After(BackoffDelay(result.Attempts, opts.BaseDelay, opts.MaxDelay)):
+		}
+	}
+
+	result.Elapsed = time.Since(start)
+	return result
+}
+
+// BackoffDelay returns the delay before retry number attempt (starting at 1):
+// base doubled for each earlier retry, capped at max, with up to half of it
+// randomized so that throttled workers don't retry in lockstep.
+func BackoffDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (o BulkOptions) withDefaults() BulkOptions {
+	if o.Parallel < 1 {
+		o.Parallel = 1
+	}
+	if o.Action == "" {
+		o.Action = "Processing"
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 5
+	}
+	if o.BaseDelay == 0 {
+		o.BaseDelay = 500 * time.Millisecond
+	}
+	if o.MaxDelay == 0 {
+		o.MaxDelay = 20 * time.Second
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	if o.Interactive == nil {
+		interactive := IsInteractive(o.Out)
+		o.Interactive = &interactive
+	}
+	return o
+}
+
+// IsInteractive reports whether out is a terminal and we are not running in CI.
+func IsInteractive(out io.Writer) bool {
+	if os.Getenv("CI") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// bulkProgress reports progress for RunBulk. Each finished item is printed on
+// its own line; on a terminal a status line with running totals is redrawn
+// below them.
+type bulkProgress struct {
+	mu          sync.Mutex
+	out         io.Writer
+	action      string
+	interactive bool
+	total       int
+	running     int
+	completed   int
+	failed      int
+	start       time.Time
+}
+
+func newBulkProgress(opts BulkOptions, total int) *bulkProgress {
+	return &bulkProgress{
+		out:         opts.Out,
+		action:      opts.Action,
+		interactive: *opts.Interactive,
+		total:       total,
+		start:       time.Now(),
+	}
+}
+
+func (p *bulkProgress) started() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.running++
+	p.drawStatus()
+}
+
+func (p *bulkProgress) finished(result BulkResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if result.Attempts > 0 {
+		p.running--
+	}
+	p.completed++
+
+	var line strings.Builder
+	if p.interactive {
+		line.WriteString("\r\033[K")
+	}
+	width := len(fmt.Sprint(p.total))
+	fmt.Fprintf(&line, "[%*d/%d] ", width, p.completed, p.total)
+	if result.Err != nil {
+		p.failed++
+		fmt.Fprintf(&line, "❌ %s: %v", result.Item, result.Err)
+	} else {
+		fmt.Fprintf(&line, "✅ %s", result.Item)
+		if result.Detail != "" {
+			fmt.Fprintf(&line, ": %s", result.Detail)
+		}
+	}
+	if result.Attempts > 1 {
+		fmt.Fprintf(&line, " (%d attempts)", result.Attempts)
+	}
+	fmt.Fprintf(&line, " (%v)\n", result.Elapsed.Round(100*time.Millisecond))
+
+	_, _ = io.WriteString(p.out, line.String())
+	p.drawStatus()
+}
+
+// drawStatus redraws the status line on a terminal. Callers must hold p.mu.
+func (p *bulkProgress) drawStatus() {
+	if !p.interactive || p.completed == p.total {
+		return
+	}
+	fmt.Fprintf(p.out, "\r\033[K⏳ %s: %d/%d done, %d running, %d failed (elapsed: %v)",
+		p.action, p.completed, p.total, p.running, p.failed, time.Since(p.start).Round(time.Second))
+}
+
+func (p *bulkProgress) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.interactive {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+// BulkFailures returns the results that failed.
+func BulkFailures(results []BulkResult) []BulkResult {
+	var failed []BulkResult
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// BulkError returns an error describing how many items failed, or nil if none did.
+func BulkError(results []BulkResult, noun, verb string) error {
+	failed := BulkFailures(results)
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed to %s %d of %d %s", verb, len(failed), len(results), noun)
+}
+
+// PrintBulkSummary prints success and failure counts followed by each failure.
+func PrintBulkSummary(results []BulkResult) {
+	failed := BulkFailures(results)
+
+	fmt.Printf("✅ Success: %d\n", len(results)-len(failed))
+	if len(failed) == 0 {
+		return
+	}
+
+	fmt.Printf("❌ Failed: %d\n", len(failed))
+	for _, result := range failed {
+		fmt.Printf("   - %s: %v\n", result.Item, result.Err)
+	}
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// throttlingError mimics an AWS API error with a throttling error code.
+type throttlingError struct{}
+
+func (throttlingError) Error() string     { return "ThrottlingException: Rate exceeded" }
+func (throttlingError) ErrorCode() string { return "ThrottlingException" }
+
+func quietOptions(parallel int) BulkOptions {
+	interactive := false
+	return BulkOptions{
+		Parallel:    parallel,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    4 * time.Millisecond,
+		Out:         &bytes.Buffer{},
+		Interactive: &interactive,
+	}
+}
+
+func TestRunBulkBoundsConcurrencyAndKeepsOrder(t *testing.T) {
+	var items []string
+	for i := 0; i < 20; i++ {
+		items = append(items, fmt.Sprintf("item-%02d", i))
+	}
+
+	var running, maxRunning int32
+	results := RunBulk(context.Background(), items, quietOptions(3), func(ctx context.Context, item string) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		if item == "item-07" {
+			return "", errors.New("boom")
+		}
+		return "done", nil
+	})
+
+	if maxRunning > 3 {
+		t.Errorf("expected at most 3 concurrent items, got %d", maxRunning)
+	}
+	for i, result := range results {
+		if result.Item != items[i] {
+			t.Fatalf("result %d is for %s, expected %s", i, result.Item, items[i])
+		}
+	}
+	if failed := BulkFailures(results); len(failed) != 1 || failed[0].Item != "item-07" {
+		t.Errorf("expected only item-07 to fail, got %v", failed)
+	}
+	if err := BulkError(results, "items", "process"); err == nil || err.Error() != "failed to process 1 of 20 items" {
+		t.Errorf("unexpected bulk error: %v", err)
+	}
+}
+
+func TestRunBulkRetriesThrottling(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		expectErr   bool
+		expectTries int
+	}{
+		{"succeeds after throttling", 2, throttlingError{}, false, 3},
+		{"gives up after max retries", 100, throttlingError{}, true, 6},
+		{"other errors are not retried", 100, errors.New("access denied"), true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			results := RunBulk(context.Background(), []string{"alice"}, quietOptions(1), func(ctx context.Context, item string) (string, error) {
+				calls++
+				if calls <= tt.failures {
+					return "", fmt.Errorf("operation error Lightsail: StartInstance, %w", tt.err)
+				}
+				return "", nil
+			})
+
+			if (results[0].Err != nil) != tt.expectErr {
+				t.Errorf("expected error=%v, got %v", tt.expectErr, results[0].Err)
+			}
+			if results[0].Attempts != tt.expectTries {
+				t.Errorf("expected %d attempts, got %d", tt.expectTries, results[0].Attempts)
+			}
+		})
+	}
+}
+
+func TestRunBulkCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := RunBulk(ctx, []string{"a", "b"}, quietOptions(2), func(ctx context.Context, item string) (string, error) {
+		t.Errorf("item %s should not run after cancellation", item)
+		return "", nil
+	})
+
+	for _, result := range results {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("expected %s to be cancelled, got %v", result.Item, result.Err)
+		}
+	}
+}
+
+func TestRunBulkProgressOutput(t *testing.T) {
+	opts := quietOptions(1)
+	out := opts.Out.(*bytes.Buffer)
+
+	RunBulk(context.Background(), []string{"alice", "bob"}, opts, func(ctx context.Context, item string) (string, error) {
+		if item == "bob" {
+			return "", errors.New("not found")
+		}
+		return "running", nil
+	})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per item, got %q", out.String())
+	}
+	if !strings.HasPrefix(lines[0], "[1/2] ✅ alice: running") {
+		t.Errorf("unexpected success line: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "[2/2] ❌ bob: not found") {
+		t.Errorf("unexpected failure line: %s", lines[1])
+	}
+	if strings.Contains(out.String(), "\r") {
+		t.Error("non-interactive output should not redraw lines")
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+
+	for _, tt := range tests {
+		delay := BackoffDelay(tt.attempt, base, max)
+		if delay < tt.ceiling/2 || delay > tt.ceiling {
+			t.Errorf("attempt %d: expected delay in [%v, %v], got %v", tt.attempt, tt.ceiling/2, tt.ceiling, delay)
+		}
+	}
+}
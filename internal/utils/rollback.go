@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+)
+
+// rollbackStep is a compensating action recorded after a successful step.
+type rollbackStep struct {
+	description string
+	undo        func() error
+}
+
+// Rollback records compensating actions for a multi-step operation so that a
+// failure part way through can undo the steps that already succeeded.
+type Rollback struct {
+	steps []rollbackStep
+}
+
+// Add records a compensating action for a step that has just succeeded.
+func (r *Rollback) Add(description string, undo func() error) {
+	r.steps = append(r.steps, rollbackStep{description: description, undo: undo})
+}
+
+// Len returns the number of recorded compensating actions.
+func (r *Rollback) Len() int {
+	return len(r.steps)
+}
+
+// Run executes the compensating actions in reverse order, continuing past
+// failures, and clears them. It returns the errors of any actions that failed.
+func (r *Rollback) Run() []error {
+	var errs []error
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		step := r.steps[i]
+		fmt.Printf("↩️  Rolling back: %s\n", step.description)
+		if err := step.undo(); err != nil {
+			fmt.Printf("❌ Rollback step failed (%s): %v\n", step.description, err)
+			errs = append(errs, fmt.Errorf("%s: %w", step.description, err))
+		}
+	}
+	r.steps = nil
+	return errs
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRollbackRunsInReverseOrder(t *testing.T) {
+	var order []string
+	rb := &Rollback{}
+
+	rb.Add("first", func() error {
+		order = append(order, "first")
+		return nil
+	})
+	rb.Add("second", func() error {
+		order = append(order, "second")
+		return errors.New("boom")
+	})
+	rb.Add("third", func() error {
+		order = append(order, "third")
+		return nil
+	})
+
+	errs := rb.Run()
+
+	if got := strings.Join(order, ","); got != "third,second,first" {
+		t.Errorf("expected reverse order, got %s", got)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "second") {
+		t.Errorf("expected one error from the second step, got %v", errs)
+	}
+	if rb.Len() != 0 {
+		t.Errorf("expected steps to be cleared, got %d", rb.Len())
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/spf13/viper"
 
 	"github.com/scttfrdmn/lfr-tools/internal/aws"
@@ -39,12 +40,6 @@ func UpdateInstanceStatusInS3(ctx context.Context, instance *types.Instance) err
 		return nil // No project context, skip
 	}
 
-	// Extract username from instance name
-	username := ExtractUsernameFromInstance(instance.Name)
-	if username == "" {
-		return nil // Can't determine username, skip
-	}
-
 	// Create AWS client
 	awsClient, err := aws.NewClient(ctx, aws.Options{
 		Region:  viper.GetString("aws.region"),
@@ -56,13 +51,28 @@ func UpdateInstanceStatusInS3(ctx context.Context, instance *types.Instance) err
 		return nil
 	}
 
+	// The status is the owning IAM user's
+	usernames, err := aws.NewIAMService(awsClient).ListUsernames(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to find the owner of %s for S3 sync: %v\n", instance.Name, err)
+		return nil
+	}
+	username := InstanceOwner(instance.Name, usernames)
+	if username == "" {
+		return nil // No IAM user owns the instance, skip
+	}
+
 	s3Service := aws.NewS3Service(awsClient)
 
 	// Create status object
 	status := &aws.StudentStatus{
-		State:       instance.State,
-		PublicIP:    instance.PublicIP,
-		LastUpdated: time.Now(),
+		State:        instance.State,
+		PublicIP:     instance.PublicIP,
+		LastUpdated:  time.Now(),
+		InstanceName: instance.Name,
+	}
+	if instance.State == "running" {
+		status.HostKeys = instanceHostKeys(ctx, aws.NewLightsailService(awsClient), instance.Name)
 	}
 
 	// Update status in S3
@@ -84,6 +94,28 @@ func UpdateMultipleInstancesInS3(ctx context.Context, instances []*types.Instanc
 	}
 }
 
+// instanceHostKeys returns the SSH host keys Lightsail reports for a running
+// instance as authorized_keys lines, or nil if they aren't available.
+func instanceHostKeys(ctx context.Context, lightsailService *aws.LightsailService, instanceName string) []string {
+	details, err := lightsailService.GetInstanceAccessDetails(ctx, instanceName)
+	if err != nil || details.AccessDetails == nil {
+		return nil
+	}
+
+	var keys []string
+	for _, hostKey := range details.AccessDetails.HostKeys {
+		publicKey := strings.TrimSpace(awssdk.ToString(hostKey.PublicKey))
+		if publicKey == "" {
+			continue
+		}
+		if !strings.Contains(publicKey, " ") {
+			publicKey = awssdk.ToString(hostKey.Algorithm) + " " + publicKey
+		}
+		keys = append(keys, publicKey)
+	}
+	return keys
+}
+
 // getS3SyncConfig gets S3 sync configuration from environment or config.
 func getS3SyncConfig() S3SyncConfig {
 	// Check for S3 sync configuration
@@ -109,6 +141,9 @@ func getS3SyncConfig() S3SyncConfig {
 }
 
 // ExtractUsernameFromInstance extracts username from instance name.
+//
+// Deprecated: usernames may contain hyphens, so the first segment of the name
+// can be another user's. Use InstanceOwner with the IAM usernames instead.
 func ExtractUsernameFromInstance(instanceName string) string {
 	// Instance names follow pattern: username-blueprint
 	parts := strings.Split(instanceName, "-")
@@ -118,6 +153,19 @@ func ExtractUsernameFromInstance(instanceName string) string {
 	return ""
 }
 
+// InstanceOwner returns the user in usernames whose instance instanceName is,
+// or "". Usernames may contain hyphens, so the longest username that prefixes
+// the name wins: bob-smith-ubuntu_22_04 is bob-smith's even if bob is a user.
+func InstanceOwner(instanceName string, usernames []string) string {
+	owner := ""
+	for _, username := range usernames {
+		if strings.HasPrefix(instanceName, username+"-") && len(username) > len(owner) {
+			owner = username
+		}
+	}
+	return owner
+}
+
 // GetS3SyncConfig exposes S3 sync configuration for external use.
 func GetS3SyncConfig() S3SyncConfig {
 	return getS3SyncConfig()
@@ -30,6 +30,23 @@ func TestExtractUsernameFromInstance(t *testing.T) {
 	}
 }
 
+func TestInstanceOwner(t *testing.T) {
+	usernames := []string{"bob", "bob-smith", "alice"}
+	tests := map[string]string{
+		"bob-ubuntu_22_04":               "bob",
+		"bob-smith-ubuntu_22_04":         "bob-smith",
+		"bob-smith-ubuntu_22_04-resized": "bob-smith",
+		"alice-ubuntu_22_04":             "alice",
+		"alice":                          "",
+		"carol-ubuntu_22_04":             "",
+	}
+	for instanceName, want := range tests {
+		if got := InstanceOwner(instanceName, usernames); got != want {
+			t.Errorf("InstanceOwner(%q) = %q, want %q", instanceName, got, want)
+		}
+	}
+}
+
 func TestUpdateInstanceStatusInS3(t *testing.T) {
 	// Test with S3 sync disabled (should not error)
 	instance := &types.Instance{
@@ -16,6 +16,8 @@ type WaitConfig struct {
 	ResourceName   string
 	TargetState    string
 	CurrentStateFn func() (string, error)
+	// Quiet disables progress output, e.g. when many waits run concurrently.
+	Quiet bool
 }
 
 // DefaultWaitConfig returns sensible defaults for waiting operations.
@@ -30,6 +32,10 @@ func DefaultWaitConfig(operation, resourceName string) *WaitConfig {
 
 // WaitForState waits for a resource to reach a target state with progress updates and visual indicator.
 func WaitForState(ctx context.Context, config *WaitConfig) error {
+	if config.Quiet {
+		return waitQuietly(ctx, config)
+	}
+
 	fmt.Printf("⏳ Waiting for %s %s to reach state '%s'...\n",
 		config.Operation, config.ResourceName, config.TargetState)
 
@@ -125,6 +131,48 @@ func WaitForInstanceState(ctx context.Context, instanceName, targetState string,
 	return WaitForState(ctx, config)
 }
 
+// WaitForInstanceStateQuiet waits for a Lightsail instance to reach target state without progress output.
+func WaitForInstanceStateQuiet(ctx context.Context, instanceName, targetState string, checkStateFn func() (string, error)) error {
+	config := DefaultWaitConfig("instance", instanceName)
+	config.TargetState = targetState
+	config.CurrentStateFn = checkStateFn
+	config.MaxDuration = 10 * time.Minute
+	config.Quiet = true
+
+	return WaitForState(ctx, config)
+}
+
+// waitQuietly polls for the target state like WaitForState but prints nothing.
+func waitQuietly(ctx context.Context, config *WaitConfig) error {
+	timeout := time.After(config.MaxDuration)
+	ticker := time.NewTicker(config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		currentState, err := config.CurrentStateFn()
+		if err != nil {
+			return fmt.Errorf("error checking state: %w", err)
+		}
+		if currentState == config.TargetState {
+			return nil
+		}
+		if strings.Contains(strings.ToLower(currentState), "error") ||
+			strings.Contains(strings.ToLower(currentState), "failed") {
+			return fmt.Errorf("%s %s entered error state: %s",
+				config.Operation, config.ResourceName, currentState)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for %s %s after %v",
+				config.Operation, config.ResourceName, config.MaxDuration)
+		case <-ticker.C:
+		}
+	}
+}
+
 // WaitForEFSState waits for an EFS file system to reach target state.
 func WaitForEFSState(ctx context.Context, filesystemID, targetState string, checkStateFn func() (string, error)) error {
 	config := DefaultWaitConfig("EFS", filesystemID)